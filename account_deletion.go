@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+const (
+	// accountDeletionGracePeriod is how long a user has to change their
+	// mind before their account and everything in it is deleted.
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+	purgeInterval              = time.Hour
+	// maxPurgeBatch is how many accounts are deleted per query, so one run
+	// doesn't hold a huge list of IDs.
+	maxPurgeBatch = 100
+)
+
+// handlerUsersDelete schedules the user's account for deletion once the
+// grace period ends, and signs them out everywhere. The password is asked
+// for again so a stolen access token can't delete the account.
+func (cfg *apiConfig) handlerUsersDelete(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password" validate:"required"`
+	}
+	type response struct {
+		User
+	}
+
+	userID, ok := cfg.authenticateAccountOwner(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	err = auth.CheckPasswordHash(params.Password, dbUser.HashedPassword)
+	if err != nil {
+		cfg.audit(r, auditEvent{
+			Action:     auditDeletionRequest,
+			Failed:     true,
+			ActorID:    userID,
+			TargetType: auditTargetUser,
+			TargetID:   userID,
+			Details:    map[string]any{"reason": "wrong password"},
+		})
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidCredentials, "Incorrect password", err)
+		return
+	}
+
+	// asking again doesn't push the deletion back
+	if !dbUser.DeletionScheduledAt.Valid {
+		err = cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+			var err error
+			dbUser, err = tx.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+				ID:                  userID,
+				DeletionScheduledAt: time.Now().Add(accountDeletionGracePeriod),
+			})
+			if err != nil {
+				return err
+			}
+			return tx.RevokeAllRefreshTokensForUser(r.Context(), userID)
+		})
+		if err != nil {
+			respondWithDBError(w, r, "Couldn't schedule account deletion", err)
+			return
+		}
+		cfg.audit(r, auditEvent{
+			Action:     auditDeletionRequest,
+			ActorID:    userID,
+			TargetType: auditTargetUser,
+			TargetID:   userID,
+			Details:    map[string]any{"deletion_scheduled_at": dbUser.DeletionScheduledAt.Time},
+		})
+	}
+
+	respondWithJSON(w, http.StatusAccepted, response{
+		User: userFromDB(dbUser),
+	})
+}
+
+// handlerUsersCancelDeletion keeps an account that was scheduled for
+// deletion, as long as the grace period hasn't ended.
+func (cfg *apiConfig) handlerUsersCancelDeletion(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		User
+	}
+
+	userID, ok := cfg.authenticateAccountOwner(w, r)
+	if !ok {
+		return
+	}
+
+	dbUser, err := cfg.store.CancelUserDeletion(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditDeletionCancel,
+		ActorID:    userID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+	})
+	respondWithJSON(w, http.StatusOK, response{
+		User: userFromDB(dbUser),
+	})
+}
+
+// runPurgeJob deletes accounts whose grace period has ended, exports that
+// have expired and stale refresh tokens, every interval until ctx is
+// cancelled.
+func (cfg *apiConfig) runPurgeJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := cfg.purgeDeletedAccounts(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging deleted accounts: %s", err)
+		}
+		err = cfg.purgeExpiredExports(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging expired exports: %s", err)
+		}
+		_, err = cfg.purgeRefreshTokens(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging refresh tokens: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeletedAccounts deletes every account scheduled for deletion at or
+// before now. The foreign keys cascade the delete to everything the user
+// made; the files of their media and exports are removed by a job.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context, now time.Time) error {
+	for {
+		ids, err := cfg.store.GetUsersDueForDeletion(ctx, database.GetUsersDueForDeletionParams{
+			DueBefore:  now,
+			MaxResults: maxPurgeBatch,
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			err := cfg.purgeAccount(ctx, id, now)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", id, err)
+			}
+		}
+		if len(ids) < maxPurgeBatch {
+			return nil
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeAccount(ctx context.Context, id uuid.UUID, now time.Time) error {
+	enqueued := false
+	err := cfg.store.WithTx(ctx, func(tx store.Store) error {
+		// the user may have cancelled since they were listed
+		user, err := tx.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !user.DeletionScheduledAt.Valid || user.DeletionScheduledAt.Time.After(now) {
+			return nil
+		}
+
+		var blobKeys []string
+		dbMedia, err := tx.GetMediaByUserID(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, m := range dbMedia {
+			blobKeys = append(blobKeys, mediaBlobKey(m.ID, false), mediaBlobKey(m.ID, true))
+		}
+		exports, err := tx.GetDataExportsByUserID(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, e := range exports {
+			blobKeys = append(blobKeys, exportBlobKey(e.ID))
+		}
+		if len(blobKeys) > 0 {
+			_, err = deleteBlobsJob.Enqueue(ctx, tx, deleteBlobsPayload{Keys: blobKeys})
+			if err != nil {
+				return err
+			}
+			enqueued = true
+		}
+		return tx.DeleteUser(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	if enqueued {
+		cfg.jobs.Wake()
+	}
+	return nil
+}
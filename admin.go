@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+const adminUsage = "usage: chirpy admin grant|revoke <email> | purge-tokens"
+
+// runAdminCommand runs `chirpy admin grant|revoke <email>`, which is how
+// the first admin gets made, and `chirpy admin purge-tokens`, which runs
+// the refresh token cleanup now.
+func runAdminCommand(ctx context.Context, s store.Store, args []string) error {
+	if len(args) == 1 && args[0] == "purge-tokens" {
+		deleted, err := purgeStaleRefreshTokens(ctx, s, time.Now())
+		if err != nil {
+			return err
+		}
+		log.Printf("Deleted %d expired or revoked refresh tokens", deleted)
+		return nil
+	}
+	if len(args) != 2 || (args[0] != "grant" && args[0] != "revoke") {
+		return errors.New(adminUsage)
+	}
+
+	user, err := s.SetUserAdmin(ctx, database.SetUserAdminParams{
+		Email:   args[1],
+		IsAdmin: args[0] == "grant",
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user with email %s", args[1])
+	}
+	if err != nil {
+		return err
+	}
+	action := auditAdminRevoke
+	if user.IsAdmin {
+		action = auditAdminGrant
+	}
+	err = auditCommand(ctx, s, action, user.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s is_admin = %t", user.Email, user.IsAdmin)
+	return nil
+}
+
+// auditCommand records an action taken from the command line. There is no
+// actor, client or request to record, only that it came from the CLI.
+func auditCommand(ctx context.Context, s store.Store, action string, userID uuid.UUID) error {
+	details, err := json.Marshal(map[string]any{"source": "cli"})
+	if err != nil {
+		return err
+	}
+	_, err = s.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		Action:     action,
+		Outcome:    "success",
+		TargetType: sql.NullString{String: auditTargetUser, Valid: true},
+		TargetID:   uuid.NullUUID{UUID: userID, Valid: true},
+		Details:    details,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't record %s audit event: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// Actions recorded in the audit log.
+const (
+	auditLogin             = "user.login"
+	auditRefresh           = "token.refresh"
+	auditRevoke            = "token.revoke"
+	auditUpdateCredentials = "user.update_credentials"
+	auditUpgrade           = "user.upgrade"
+	auditReset             = "admin.reset"
+	auditChirpDelete       = "chirp.delete"
+	auditChirpHide         = "chirp.hide"
+	auditChirpUnhide       = "chirp.unhide"
+	auditJobRetry          = "admin.job_retry"
+	auditPurgeTokens       = "admin.purge_tokens"
+	auditForceLogout       = "admin.force_logout"
+	auditChirpyRedGrant    = "admin.chirpy_red_grant"
+	auditChirpyRedRevoke   = "admin.chirpy_red_revoke"
+	auditSuspend           = "admin.suspend"
+	auditUnsuspend         = "admin.unsuspend"
+	auditImpersonate       = "admin.impersonate"
+	auditImpersonatedCall  = "admin.impersonated_request"
+	auditAdminGrant        = "admin.admin_grant"
+	auditAdminRevoke       = "admin.admin_revoke"
+	auditDeletionRequest   = "user.deletion_request"
+	auditDeletionCancel    = "user.deletion_cancel"
+)
+
+const (
+	auditTargetUser  = "user"
+	auditTargetChirp = "chirp"
+	auditTargetJob   = "job"
+)
+
+// auditEvent is a security-sensitive action. ActorID and TargetID are
+// uuid.Nil when there isn't one, such as a failed login for an unknown
+// email.
+type auditEvent struct {
+	Action     string
+	Failed     bool
+	ActorID    uuid.UUID
+	TargetType string
+	TargetID   uuid.UUID
+	Details    map[string]any
+}
+
+// audit records e as done by the client that sent r. Failing to record it
+// doesn't fail the request, so it is only logged. If r was sent with an
+// impersonation token, the admin using it is added to the details.
+func (cfg *apiConfig) audit(r *http.Request, e auditEvent) {
+	// the client hanging up doesn't stop the event being recorded
+	ctx := context.WithoutCancel(r.Context())
+
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if impersonatorID, ok := auth.JWTActor(token, cfg.jwtSecret); ok {
+			e.Details = maps.Clone(e.Details)
+			if e.Details == nil {
+				e.Details = map[string]any{}
+			}
+			e.Details["impersonator_id"] = impersonatorID
+		}
+	}
+
+	details := []byte("{}")
+	if len(e.Details) > 0 {
+		var err error
+		details, err = json.Marshal(e.Details)
+		if err != nil {
+			log.Printf("[%s] Error marshalling %s audit details: %s", requestIDFromContext(ctx), e.Action, err)
+			details = []byte("{}")
+		}
+	}
+	arg := database.CreateAuditEventParams{
+		Action:    e.Action,
+		Outcome:   "success",
+		IP:        cfg.clientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: requestIDFromContext(ctx),
+		Details:   details,
+	}
+	if e.Failed {
+		arg.Outcome = "failure"
+	}
+	if e.ActorID != uuid.Nil {
+		arg.ActorID = uuid.NullUUID{UUID: e.ActorID, Valid: true}
+	}
+	if e.TargetID != uuid.Nil {
+		arg.TargetType = sql.NullString{String: e.TargetType, Valid: true}
+		arg.TargetID = uuid.NullUUID{UUID: e.TargetID, Valid: true}
+	}
+
+	_, err := cfg.store.CreateAuditEvent(ctx, arg)
+	if err != nil {
+		log.Printf("[%s] Error recording %s audit event: %s", requestIDFromContext(ctx), e.Action, err)
+	}
+}
+
+// middlewareImpersonationAudit records every request made with an
+// impersonation token, by the admin as the user, before it is served. The
+// WebSocket handshake's access_token parameter counts too.
+func (cfg *apiConfig) middlewareImpersonationAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+			token = r.URL.Query().Get("access_token")
+		}
+		if adminID, ok := auth.JWTActor(token, cfg.jwtSecret); ok {
+			userID, _ := auth.ValidateJWT(token, cfg.jwtSecret)
+			cfg.audit(r, auditEvent{
+				Action:     auditImpersonatedCall,
+				ActorID:    adminID,
+				TargetType: auditTargetUser,
+				TargetID:   userID,
+				Details:    map[string]any{"method": r.Method, "path": r.URL.Path},
+			})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
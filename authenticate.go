@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// authenticate returns the ID of the user whose access token authorizes r.
+// If there isn't a valid one it responds with 401, and if an admin has
+// suspended the user it responds with 403, and returns false.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	user, ok := cfg.authenticateUser(w, r)
+	return user.ID, ok
+}
+
+// authenticateUser is authenticate that returns the whole user. A token for
+// a user who has since been deleted is still valid, so the user is only
+// the ID then.
+func (cfg *apiConfig) authenticateUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeMissingToken, "Couldn't find JWT", err)
+		return database.User{}, false
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidToken, "Couldn't validate JWT", err)
+		return database.User{}, false
+	}
+
+	user, err := activeUser(r.Context(), cfg.store, userID)
+	if errors.Is(err, errAccountSuspended) {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Account suspended", err)
+		return database.User{}, false
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{ID: userID}, true
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't get user", err)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// activeUser returns the user with id, or errAccountSuspended if an admin
+// has suspended them. Access tokens outlive a suspension, so everything
+// that accepts one checks this, as does anything done for the user later,
+// such as publishing their scheduled chirps.
+func activeUser(ctx context.Context, s store.Store, id uuid.UUID) (database.User, error) {
+	user, err := s.GetUserByID(ctx, id)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user.SuspendedAt.Valid {
+		return database.User{}, errAccountSuspended
+	}
+	return user, nil
+}
+
+// authenticateAccountOwner is authenticate for endpoints that change the
+// account's credentials, delete it or export its data. An admin using an
+// impersonation token gets 403, so support access can't take an account
+// over.
+func (cfg *apiConfig) authenticateAccountOwner(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	// authenticate has already found and validated the token
+	token, _ := auth.GetBearerToken(r.Header)
+	if _, impersonated := auth.JWTActor(token, cfg.jwtSecret); impersonated {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Impersonation tokens can't do this", nil)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// authenticateAdmin is authenticate for admin-only endpoints. It responds
+// with 403 if the user isn't an admin.
+func (cfg *apiConfig) authenticateAdmin(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	user, ok := cfg.authenticateUser(w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if !user.IsAdmin {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Only admins can do this", nil)
+		return uuid.Nil, false
+	}
+	return user.ID, true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.10")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies() unexpected error: %v", err)
+	}
+	cfg := &apiConfig{trustedProxies: trusted}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		wantClientIP string
+	}{
+		{
+			name:         "direct connection",
+			remoteAddr:   "203.0.113.7:5000",
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "untrusted peer can't spoof X-Forwarded-For",
+			remoteAddr:   "203.0.113.7:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			wantClientIP: "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			wantClientIP: "198.51.100.1",
+		},
+		{
+			name:         "chain of trusted proxies",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"198.51.100.1, 192.168.1.10", "10.9.9.9"},
+			wantClientIP: "198.51.100.1",
+		},
+		{
+			name:         "forged hops left of the client are ignored",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"1.1.1.1, 198.51.100.1"},
+			wantClientIP: "198.51.100.1",
+		},
+		{
+			name:         "trusted proxy without header",
+			remoteAddr:   "10.1.2.3:5000",
+			wantClientIP: "10.1.2.3",
+		},
+		{
+			name:         "garbage header",
+			remoteAddr:   "10.1.2.3:5000",
+			forwardedFor: []string{"not-an-ip"},
+			wantClientIP: "10.1.2.3",
+		},
+		{
+			name:         "IPv4-mapped IPv6 peer",
+			remoteAddr:   "[::ffff:203.0.113.7]:5000",
+			wantClientIP: "203.0.113.7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("Failed to build request: %v", err)
+			}
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			got := cfg.clientIP(r)
+			if got != tt.wantClientIP {
+				t.Errorf("clientIP() = %q, want %q", got, tt.wantClientIP)
+			}
+		})
+	}
+}
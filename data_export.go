@@ -0,0 +1,390 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/media"
+)
+
+const (
+	// exportLifetime is how long a finished export can be downloaded.
+	exportLifetime = 7 * 24 * time.Hour
+	// exportStaleAfter is when an export a worker claimed but never
+	// finished is handed to another worker.
+	exportStaleAfter = 15 * time.Minute
+	exportInterval   = time.Minute
+
+	exportDownloadPath = "/api/users/me/export/download"
+)
+
+// mediaExtensions name the media files in an export.
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// DataExport is the state of an archive of everything a user has stored.
+// DownloadURL is only set once it is ready.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	SizeBytes   *int64     `json:"size_bytes"`
+	DownloadURL *string    `json:"download_url"`
+}
+
+func dataExportFromDB(e database.DataExport) DataExport {
+	export := DataExport{
+		ID:        e.ID,
+		Status:    e.Status,
+		CreatedAt: e.CreatedAt,
+	}
+	if e.CompletedAt.Valid {
+		export.CompletedAt = &e.CompletedAt.Time
+	}
+	if e.ExpiresAt.Valid {
+		export.ExpiresAt = &e.ExpiresAt.Time
+	}
+	if e.SizeBytes.Valid {
+		export.SizeBytes = &e.SizeBytes.Int64
+	}
+	if e.Status == "ready" {
+		url := exportDownloadPath
+		export.DownloadURL = &url
+	}
+	return export
+}
+
+func exportBlobKey(id uuid.UUID) string {
+	return "export-" + id.String() + ".zip"
+}
+
+// exportAvailable reports whether e can be downloaded.
+func exportAvailable(e database.DataExport, now time.Time) bool {
+	return e.Status == "ready" && e.ExpiresAt.Valid && e.ExpiresAt.Time.After(now)
+}
+
+// handlerUsersExport reports on the user's latest export. If there is none
+// in progress or ready to download, a new one is queued and the response
+// is 202 until it is ready.
+func (cfg *apiConfig) handlerUsersExport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateAccountOwner(w, r)
+	if !ok {
+		return
+	}
+
+	latest, err := cfg.store.GetLatestDataExport(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithDBError(w, r, "Couldn't get export", err)
+		return
+	}
+	switch {
+	case err == nil && exportAvailable(latest, time.Now()):
+		respondWithJSON(w, http.StatusOK, dataExportFromDB(latest))
+		return
+	case err == nil && (latest.Status == "pending" || latest.Status == "running"):
+		respondWithJSON(w, http.StatusAccepted, dataExportFromDB(latest))
+		return
+	}
+
+	latest, err = cfg.store.CreateDataExport(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't start export", err)
+		return
+	}
+	// wake the worker, unless it is already due to look
+	select {
+	case cfg.exportQueued <- struct{}{}:
+	default:
+	}
+	respondWithJSON(w, http.StatusAccepted, dataExportFromDB(latest))
+}
+
+// handlerUsersExportDownload serves the user's latest export, if it is
+// ready and hasn't expired.
+func (cfg *apiConfig) handlerUsersExportDownload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticateAccountOwner(w, r)
+	if !ok {
+		return
+	}
+
+	latest, err := cfg.store.GetLatestDataExport(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithDBError(w, r, "Couldn't get export", err)
+		return
+	}
+	if err != nil || !exportAvailable(latest, time.Now()) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "No export is ready to download", err)
+		return
+	}
+
+	f, err := cfg.blobs.Open(r.Context(), exportBlobKey(latest.ID))
+	if errors.Is(err, media.ErrNotFound) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "No export is ready to download", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't open export", err)
+		return
+	}
+	defer f.Close()
+
+	filename := "chirpy-export-" + latest.CreatedAt.Format("2006-01-02") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", latest.CompletedAt.Time, f)
+}
+
+// runExportWorker builds queued exports until ctx is cancelled. It looks
+// for work every interval, and straight away when an export is queued on
+// this replica.
+func (cfg *apiConfig) runExportWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := cfg.processDataExports(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error processing exports: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.exportQueued:
+		}
+	}
+}
+
+// processDataExports builds exports until none are left queued. An export
+// that fails is marked failed; the user can ask for another.
+func (cfg *apiConfig) processDataExports(ctx context.Context) error {
+	for {
+		export, err := cfg.store.ClaimDataExport(ctx, time.Now().Add(-exportStaleAfter))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cfg.buildDataExport(ctx, export)
+		if err != nil {
+			log.Printf("Error building export %s: %s", export.ID, err)
+			cfg.deleteExportBlob(ctx, export.ID)
+			err = cfg.store.FailDataExport(ctx, export.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// buildDataExport writes a zip of the user's profile, chirps, likes,
+// follows, sessions and media to the blob store. Sessions only include
+// when they started and ended, never their tokens.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, export database.DataExport) error {
+	type like struct {
+		ChirpID   uuid.UUID `json:"chirp_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type session struct {
+		CreatedAt time.Time  `json:"created_at"`
+		ExpiresAt time.Time  `json:"expires_at"`
+		RevokedAt *time.Time `json:"revoked_at"`
+	}
+	type follow struct {
+		UserID    uuid.UUID `json:"user_id"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+	type follows struct {
+		Following []follow `json:"following"`
+		Followers []follow `json:"followers"`
+	}
+	type mediaFile struct {
+		Media
+		CreatedAt time.Time `json:"created_at"`
+		File      string    `json:"file"`
+	}
+
+	dbUser, err := cfg.store.GetUserByID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	dbChirps, err := cfg.store.GetChirpsByAuthorID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	chirps, err := cfg.chirpsFromDB(ctx, dbChirps, expansion{})
+	if err != nil {
+		return err
+	}
+
+	dbLikes, err := cfg.store.GetChirpLikesByUserID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	likes := make([]like, 0, len(dbLikes))
+	for _, l := range dbLikes {
+		likes = append(likes, like{ChirpID: l.ChirpID, CreatedAt: l.CreatedAt})
+	}
+
+	dbFollows, err := cfg.store.GetFollowsByUserID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	f := follows{Following: []follow{}, Followers: []follow{}}
+	for _, dbFollow := range dbFollows {
+		if dbFollow.FollowerID == export.UserID {
+			f.Following = append(f.Following, follow{UserID: dbFollow.FolloweeID, CreatedAt: dbFollow.CreatedAt})
+		} else {
+			f.Followers = append(f.Followers, follow{UserID: dbFollow.FollowerID, CreatedAt: dbFollow.CreatedAt})
+		}
+	}
+
+	tokens, err := cfg.store.GetRefreshTokensByUserID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	sessions := make([]session, 0, len(tokens))
+	for _, t := range tokens {
+		s := session{CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt}
+		if t.RevokedAt.Valid {
+			s.RevokedAt = &t.RevokedAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+
+	dbMedia, err := cfg.store.GetMediaByUserID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+	mediaFiles := make([]mediaFile, 0, len(dbMedia))
+	for _, m := range dbMedia {
+		mediaFiles = append(mediaFiles, mediaFile{
+			Media:     mediaFromDB(m),
+			CreatedAt: m.CreatedAt,
+			File:      "media/" + m.ID.String() + mediaExtensions[m.ContentType],
+		})
+	}
+
+	// media can make the archive large, so it is spooled to disk
+	tmp, err := os.CreateTemp("", "chirpy-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	documents := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", userFromDB(dbUser)},
+		{"chirps.json", chirps},
+		{"likes.json", likes},
+		{"follows.json", f},
+		{"sessions.json", sessions},
+		{"media.json", mediaFiles},
+	}
+	for _, doc := range documents {
+		err = writeZipJSON(zw, doc.name, doc.v)
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range mediaFiles {
+		err = cfg.copyBlobToZip(ctx, zw, m.File, mediaBlobKey(m.ID, false))
+		if err != nil {
+			return fmt.Errorf("media %s: %w", m.ID, err)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = cfg.blobs.Put(ctx, exportBlobKey(export.ID), tmp)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.store.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ExpiresAt: time.Now().Add(exportLifetime),
+		SizeBytes: size,
+		ID:        export.ID,
+	})
+	return err
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v any) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (cfg *apiConfig) copyBlobToZip(ctx context.Context, zw *zip.Writer, name, key string) error {
+	f, err := cfg.blobs.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// images are already compressed
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// purgeExpiredExports deletes exports that expired at or before now, along
+// with their files.
+func (cfg *apiConfig) purgeExpiredExports(ctx context.Context, now time.Time) error {
+	ids, err := cfg.store.DeleteExpiredDataExports(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		cfg.deleteExportBlob(ctx, id)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) deleteExportBlob(ctx context.Context, id uuid.UUID) {
+	err := cfg.blobs.Delete(ctx, exportBlobKey(id))
+	if err != nil {
+		log.Printf("[%s] Error deleting export blob: %s", requestIDFromContext(ctx), err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+const maxRequestBodyBytes = 1 << 20
+
+// decodeAndValidate strictly decodes a JSON request body into T and checks
+// its `validate` tags. On failure it writes the problem response itself and
+// returns false, so handlers only need to return.
+func decodeAndValidate[T any](w http.ResponseWriter, r *http.Request) (T, bool) {
+	var params T
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondWithError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/json", err)
+		return params, false
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&params)
+	if err == nil && decoder.More() {
+		err = errors.New("body must contain a single JSON object")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+				fmt.Sprintf("Request body must be %d bytes or less", maxBytesErr.Limit), err)
+			return params, false
+		}
+		if errors.Is(err, io.EOF) {
+			err = errors.New("body is empty")
+		}
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidJSON, "Couldn't decode request body: "+err.Error(), err)
+		return params, false
+	}
+
+	if errs := validate.Struct(&params); errs != nil {
+		respondWithValidationErrors(w, r, errs)
+		return params, false
+	}
+	return params, true
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/lib/pq"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+// errorCode is the stable, machine-readable identifier clients switch on.
+// Titles and details may be reworded; codes may not.
+type errorCode string
+
+const (
+	codeBadRequest         errorCode = "bad_request"
+	codeInvalidJSON        errorCode = "invalid_json"
+	codeValidationFailed   errorCode = "validation_failed"
+	codeUnsupportedMedia   errorCode = "unsupported_media_type"
+	codeBodyTooLarge       errorCode = "body_too_large"
+	codeInvalidID          errorCode = "invalid_id"
+	codeChirpTooLong       errorCode = "chirp_too_long"
+	codeMissingToken       errorCode = "missing_token"
+	codeInvalidToken       errorCode = "invalid_token"
+	codeInvalidCredentials errorCode = "invalid_credentials"
+	codeInvalidAPIKey      errorCode = "invalid_api_key"
+	codeForbidden          errorCode = "forbidden"
+	codeNotFound           errorCode = "not_found"
+	codeConflict           errorCode = "conflict"
+	codeRateLimited        errorCode = "rate_limited"
+	codeInternal           errorCode = "internal_error"
+)
+
+var errorTitles = map[errorCode]string{
+	codeBadRequest:         "Bad request",
+	codeInvalidJSON:        "Malformed JSON body",
+	codeValidationFailed:   "Request body failed validation",
+	codeUnsupportedMedia:   "Unsupported media type",
+	codeBodyTooLarge:       "Request body too large",
+	codeInvalidID:          "Invalid ID",
+	codeChirpTooLong:       "Chirp is too long",
+	codeMissingToken:       "Missing credentials",
+	codeInvalidToken:       "Invalid token",
+	codeInvalidCredentials: "Invalid credentials",
+	codeInvalidAPIKey:      "Invalid API key",
+	codeForbidden:          "Forbidden",
+	codeNotFound:           "Resource not found",
+	codeConflict:           "Resource already exists",
+	codeRateLimited:        "Too many requests",
+	codeInternal:           "Internal server error",
+}
+
+const problemTypePrefix = "urn:chirpy:problem:"
+
+// problem is an RFC 7807 application/problem+json body. Code, RequestID
+// and Errors are extension members.
+type problem struct {
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Status    int             `json:"status"`
+	Detail    string          `json:"detail,omitempty"`
+	Instance  string          `json:"instance,omitempty"`
+	Code      errorCode       `json:"code"`
+	RequestID string          `json:"request_id,omitempty"`
+	Errors    validate.Errors `json:"errors,omitempty"`
+}
+
+// respondWithError writes a problem+json response. err is the underlying
+// cause; it is logged but never sent to the client.
+func respondWithError(w http.ResponseWriter, r *http.Request, code int, errCode errorCode, detail string, err error) {
+	respondWithProblem(w, r, newProblem(r, code, errCode, detail), err)
+}
+
+// respondWithValidationErrors reports every invalid field of a request body.
+func respondWithValidationErrors(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	p := newProblem(r, http.StatusUnprocessableEntity, codeValidationFailed, "One or more fields are invalid")
+	p.Errors = errs
+	respondWithProblem(w, r, p, errs)
+}
+
+func newProblem(r *http.Request, code int, errCode errorCode, detail string) problem {
+	title, ok := errorTitles[errCode]
+	if !ok {
+		title = http.StatusText(code)
+	}
+
+	return problem{
+		Type:      problemTypePrefix + string(errCode),
+		Title:     title,
+		Status:    code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      errCode,
+		RequestID: requestIDFromContext(r.Context()),
+	}
+}
+
+func respondWithProblem(w http.ResponseWriter, r *http.Request, p problem, err error) {
+	if err != nil {
+		log.Printf("[%s] %s %s: %s: %s", p.RequestID, r.Method, r.URL.Path, p.Detail, err)
+	}
+
+	if p.Status > 499 {
+		log.Printf("[%s] Responding with 5XX error: %s", p.RequestID, err)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Error marshalling JSON: %s", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	w.Write(data)
+}
+
+// respondWithDBError maps storage errors to the matching problem: missing
+// rows are 404s, unique violations are 409s and anything else is a 500.
+func respondWithDBError(w http.ResponseWriter, r *http.Request, detail string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, detail, err)
+		return
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			respondWithError(w, r, http.StatusConflict, codeConflict, detail, err)
+			return
+		case "foreign_key_violation":
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, detail, err)
+			return
+		}
+	}
+
+	respondWithError(w, r, http.StatusInternalServerError, codeInternal, detail, err)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// expansion says which related objects to embed in chirps, as requested
+// with the expand query parameter.
+type expansion struct {
+	Author bool
+}
+
+// parseExpand reads the comma-separated expand query parameter. If it
+// names something that can't be expanded it responds with 400 and returns
+// false.
+func parseExpand(w http.ResponseWriter, r *http.Request) (expansion, bool) {
+	var exp expansion
+	s := r.URL.Query().Get("expand")
+	if s == "" {
+		return exp, true
+	}
+	for _, field := range strings.Split(s, ",") {
+		switch strings.TrimSpace(field) {
+		case "author":
+			exp.Author = true
+		default:
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Can't expand %q, only author", field), nil)
+			return expansion{}, false
+		}
+	}
+	return exp, true
+}
+
+// Author is the summary of a user embedded in chirps with expand=author.
+type Author struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarURL   *string   `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func authorFromDB(dbUser database.User) *Author {
+	author := &Author{
+		ID:          dbUser.ID,
+		DisplayName: dbUser.DisplayName,
+		AvatarURL:   avatarURL(dbUser),
+		IsChirpyRed: dbUser.IsChirpyRed,
+	}
+	if dbUser.Handle.Valid {
+		author.Handle = &dbUser.Handle.String
+	}
+	return author
+}
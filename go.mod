@@ -9,6 +9,19 @@ require (
 	github.com/lib/pq v1.10.9
 )
 
-require golang.org/x/crypto v0.39.0
+require golang.org/x/crypto v0.40.0
 
-require github.com/golang-jwt/jwt/v5 v5.2.2
+require (
+	github.com/coder/websocket v1.8.14
+	github.com/golang-jwt/jwt/v5 v5.2.2
+	github.com/pressly/goose/v3 v3.26.0
+	golang.org/x/image v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/mfridman/interpolate v0.0.2 // indirect
+	github.com/sethvargo/go-retry v0.3.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+)
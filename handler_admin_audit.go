@@ -0,0 +1,227 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+type AuditEvent struct {
+	ID         uuid.UUID       `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Action     string          `json:"action"`
+	Outcome    string          `json:"outcome"`
+	ActorID    *uuid.UUID      `json:"actor_id"`
+	TargetType *string         `json:"target_type"`
+	TargetID   *uuid.UUID      `json:"target_id"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	Details    json.RawMessage `json:"details"`
+}
+
+func auditEventFromDB(e database.AuditEvent) AuditEvent {
+	event := AuditEvent{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		RequestID: e.RequestID,
+		Details:   e.Details,
+	}
+	if e.ActorID.Valid {
+		event.ActorID = &e.ActorID.UUID
+	}
+	if e.TargetType.Valid {
+		event.TargetType = &e.TargetType.String
+	}
+	if e.TargetID.Valid {
+		event.TargetID = &e.TargetID.UUID
+	}
+	return event
+}
+
+// auditCSVHeader is the first row of a CSV export, naming the columns in
+// the order auditCSVRecord writes them.
+var auditCSVHeader = []string{"id", "created_at", "action", "outcome", "actor_id", "target_type", "target_id", "ip", "user_agent", "request_id", "details"}
+
+func auditCSVRecord(e database.AuditEvent) []string {
+	var actorID, targetID string
+	if e.ActorID.Valid {
+		actorID = e.ActorID.UUID.String()
+	}
+	if e.TargetID.Valid {
+		targetID = e.TargetID.UUID.String()
+	}
+	return []string{
+		e.ID.String(),
+		e.CreatedAt.Format(time.RFC3339Nano),
+		e.Action,
+		e.Outcome,
+		actorID,
+		e.TargetType.String,
+		targetID,
+		e.IP,
+		csvText(e.UserAgent),
+		e.RequestID,
+		string(e.Details),
+	}
+}
+
+// csvText escapes s, which the client chose, so a spreadsheet opening the
+// CSV shows it rather than running it as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// parseAuditFilters reads the filters of an audit log query. If one is
+// invalid it responds with 400 and returns false.
+func parseAuditFilters(w http.ResponseWriter, r *http.Request) (database.GetAuditEventsParams, bool) {
+	query := r.URL.Query()
+	var arg database.GetAuditEventsParams
+
+	if s := query.Get("action"); s != "" {
+		arg.Action = sql.NullString{String: s, Valid: true}
+	}
+	switch s := query.Get("outcome"); s {
+	case "":
+	case "success", "failure":
+		arg.Outcome = sql.NullString{String: s, Valid: true}
+	default:
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "outcome must be success or failure", nil)
+		return arg, false
+	}
+
+	ids := []struct {
+		name string
+		dst  *uuid.NullUUID
+	}{{"actor_id", &arg.ActorID}, {"target_id", &arg.TargetID}}
+	for _, id := range ids {
+		s := query.Get(id.name)
+		if s == "" {
+			continue
+		}
+		parsed, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Couldn't parse "+id.name, err)
+			return arg, false
+		}
+		*id.dst = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+
+	times := []struct {
+		name string
+		dst  *sql.NullTime
+	}{{"since", &arg.Since}, {"until", &arg.Until}}
+	for _, t := range times {
+		s := query.Get(t.name)
+		if s == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, t.name+" must be an RFC 3339 timestamp", err)
+			return arg, false
+		}
+		*t.dst = sql.NullTime{Time: parsed.UTC(), Valid: true}
+	}
+	return arg, true
+}
+
+// handlerAdminAuditEventsGet lists audit events newest first, filtered by
+// the query string. With format=csv every matching event is written as
+// CSV instead of one page of JSON.
+func (cfg *apiConfig) handlerAdminAuditEventsGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Events     []AuditEvent `json:"events"`
+		NextCursor *uuid.UUID   `json:"next_cursor"`
+	}
+
+	_, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+	arg, ok := parseAuditFilters(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "csv":
+		cfg.writeAuditCSV(w, r, arg)
+		return
+	default:
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "format must be json or csv", nil)
+		return
+	}
+
+	arg.Before = p.Before
+	arg.MaxResults = p.Limit
+	dbEvents, err := cfg.store.GetAuditEvents(r.Context(), arg)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get audit events", err)
+		return
+	}
+
+	resp := response{Events: []AuditEvent{}}
+	for _, e := range dbEvents {
+		resp.Events = append(resp.Events, auditEventFromDB(e))
+	}
+	if len(dbEvents) > 0 {
+		resp.NextCursor = p.nextCursor(len(dbEvents), dbEvents[len(dbEvents)-1].ID)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// writeAuditCSV writes every event matching arg, a page at a time so the
+// whole log is never held in memory.
+func (cfg *apiConfig) writeAuditCSV(w http.ResponseWriter, r *http.Request, arg database.GetAuditEventsParams) {
+	arg.MaxResults = maxPageSize
+	dbEvents, err := cfg.store.GetAuditEvents(r.Context(), arg)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get audit events", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit-events.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(auditCSVHeader)
+	for {
+		for _, e := range dbEvents {
+			cw.Write(auditCSVRecord(e))
+		}
+		if len(dbEvents) < maxPageSize {
+			break
+		}
+
+		arg.Before = uuid.NullUUID{UUID: dbEvents[len(dbEvents)-1].ID, Valid: true}
+		dbEvents, err = cfg.store.GetAuditEvents(r.Context(), arg)
+		if err != nil {
+			// some of the CSV may already be sent, so all we can do is stop
+			log.Printf("[%s] Error getting audit events for CSV: %s", requestIDFromContext(r.Context()), err)
+			break
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("[%s] Error writing audit CSV: %s", requestIDFromContext(r.Context()), err)
+	}
+}
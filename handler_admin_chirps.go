@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// handlerAdminChirpsHide excludes a chirp from trending and profile stats
+// until an admin unhides it. It can still be fetched and is still listed
+// everywhere else, such as the timeline; deleting it takes it down.
+func (cfg *apiConfig) handlerAdminChirpsHide(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminChirpsUnhide(w http.ResponseWriter, r *http.Request) {
+	cfg.setChirpHidden(w, r, false)
+}
+
+func (cfg *apiConfig) setChirpHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	adminID, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	_, err = cfg.store.SetChirpHidden(r.Context(), database.SetChirpHiddenParams{
+		ID:     chirpID,
+		Hidden: hidden,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Chirp not found", err)
+		return
+	}
+	action := auditChirpUnhide
+	if hidden {
+		action = auditChirpHide
+	}
+	cfg.audit(r, auditEvent{
+		Action:     action,
+		ActorID:    adminID,
+		TargetType: auditTargetChirp,
+		TargetID:   chirpID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+type Job struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	MaxAttempts int32           `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedUntil *time.Time      `json:"locked_until"`
+	LastError   *string         `json:"last_error"`
+}
+
+func jobFromDB(j database.Job) Job {
+	job := Job{
+		ID:          j.ID,
+		CreatedAt:   j.CreatedAt,
+		UpdatedAt:   j.UpdatedAt,
+		Kind:        j.Kind,
+		Payload:     j.Payload,
+		Status:      j.Status,
+		Attempts:    j.Attempts,
+		MaxAttempts: j.MaxAttempts,
+		RunAt:       j.RunAt,
+	}
+	if j.LockedUntil.Valid {
+		job.LockedUntil = &j.LockedUntil.Time
+	}
+	if j.LastError.Valid {
+		job.LastError = &j.LastError.String
+	}
+	return job
+}
+
+// handlerAdminJobsGet lists jobs newest first, optionally only those with
+// the status given in the query string.
+func (cfg *apiConfig) handlerAdminJobsGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Jobs       []Job      `json:"jobs"`
+		NextCursor *uuid.UUID `json:"next_cursor"`
+	}
+
+	_, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	var status sql.NullString
+	switch s := r.URL.Query().Get("status"); s {
+	case "":
+	case "pending", "running", "dead":
+		status = sql.NullString{String: s, Valid: true}
+	default:
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "status must be pending, running or dead", nil)
+		return
+	}
+
+	dbJobs, err := cfg.store.GetJobs(r.Context(), database.GetJobsParams{
+		Status:     status,
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get jobs", err)
+		return
+	}
+
+	resp := response{Jobs: []Job{}}
+	for _, j := range dbJobs {
+		resp.Jobs = append(resp.Jobs, jobFromDB(j))
+	}
+	if len(dbJobs) > 0 {
+		resp.NextCursor = p.nextCursor(len(dbJobs), dbJobs[len(dbJobs)-1].ID)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerAdminJobGet(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid job ID", err)
+		return
+	}
+	_, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := cfg.store.GetJobByID(r.Context(), jobID)
+	if err != nil {
+		respondWithDBError(w, r, "Job not found", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, jobFromDB(job))
+}
+
+// handlerAdminJobRetry gives a dead job a fresh set of attempts. Jobs that
+// are still pending or running can't be retried.
+func (cfg *apiConfig) handlerAdminJobRetry(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("jobID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid job ID", err)
+		return
+	}
+	adminID, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := cfg.store.RequeueJob(r.Context(), jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = cfg.store.GetJobByID(r.Context(), jobID)
+		if err == nil {
+			respondWithError(w, r, http.StatusConflict, codeConflict, "Only dead jobs can be retried", nil)
+			return
+		}
+	}
+	if err != nil {
+		respondWithDBError(w, r, "Job not found", err)
+		return
+	}
+	cfg.jobs.Wake()
+	cfg.audit(r, auditEvent{
+		Action:     auditJobRetry,
+		ActorID:    adminID,
+		TargetType: auditTargetJob,
+		TargetID:   jobID,
+	})
+	respondWithJSON(w, http.StatusOK, jobFromDB(job))
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// impersonationTokenExpiry is how long a support session as another user
+// lasts. It can't be refreshed.
+const impersonationTokenExpiry = 15 * time.Minute
+
+// AdminUser is a User with the account details only admins see.
+type AdminUser struct {
+	User
+	IsAdmin     bool       `json:"is_admin"`
+	SuspendedAt *time.Time `json:"suspended_at"`
+}
+
+func adminUserFromDB(dbUser database.User) AdminUser {
+	user := AdminUser{
+		User:    userFromDB(dbUser),
+		IsAdmin: dbUser.IsAdmin,
+	}
+	if dbUser.SuspendedAt.Valid {
+		user.SuspendedAt = &dbUser.SuspendedAt.Time
+	}
+	return user
+}
+
+// Session is a refresh token, without the secret.
+type Session struct {
+	ID        string     `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func sessionFromDB(t database.RefreshToken) Session {
+	session := Session{
+		ID:        t.ID,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+	}
+	if t.RevokedAt.Valid {
+		session.RevokedAt = &t.RevokedAt.Time
+	}
+	return session
+}
+
+// likeEscaper escapes the wildcards of an ILIKE pattern so they match
+// themselves.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// handlerAdminUsersGet lists users newest first. With q, only users whose
+// email or handle contains it, ignoring case, are listed.
+func (cfg *apiConfig) handlerAdminUsersGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Users      []AdminUser `json:"users"`
+		NextCursor *uuid.UUID  `json:"next_cursor"`
+	}
+
+	_, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	dbUsers, err := cfg.store.SearchUsers(r.Context(), database.SearchUsersParams{
+		Pattern:    likeEscaper.Replace(strings.TrimSpace(r.URL.Query().Get("q"))),
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't search users", err)
+		return
+	}
+
+	resp := response{Users: []AdminUser{}}
+	for _, u := range dbUsers {
+		resp.Users = append(resp.Users, adminUserFromDB(u))
+	}
+	if len(dbUsers) > 0 {
+		resp.NextCursor = p.nextCursor(len(dbUsers), dbUsers[len(dbUsers)-1].ID)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// adminTargetUser reads the user an admin endpoint acts on from the path
+// and checks the client is an admin. If not, it responds and returns false.
+func (cfg *apiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (adminID, userID uuid.UUID, ok bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	adminID, ok = cfg.authenticateAdmin(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return adminID, userID, true
+}
+
+func (cfg *apiConfig) handlerAdminUserGet(w http.ResponseWriter, r *http.Request) {
+	_, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, adminUserFromDB(user))
+}
+
+// handlerAdminUserSessionsGet lists a user's refresh tokens, oldest first,
+// including revoked and expired ones that haven't been purged yet.
+func (cfg *apiConfig) handlerAdminUserSessionsGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Sessions []Session `json:"sessions"`
+	}
+
+	_, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	tokens, err := cfg.store.GetRefreshTokensByUserID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get sessions", err)
+		return
+	}
+
+	resp := response{Sessions: []Session{}}
+	for _, t := range tokens {
+		resp.Sessions = append(resp.Sessions, sessionFromDB(t))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerAdminUserLogout revokes all of a user's refresh tokens. Access
+// tokens they already have keep working until they expire.
+func (cfg *apiConfig) handlerAdminUserLogout(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	err = cfg.store.RevokeAllRefreshTokensForUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't revoke sessions", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditForceLogout,
+		ActorID:    adminID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerAdminUserChirpyRedGrant gives a user Chirpy Red without a Polka
+// payment, such as to make up for a failed webhook.
+func (cfg *apiConfig) handlerAdminUserChirpyRedGrant(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserChirpyRed(w, r, true)
+}
+
+func (cfg *apiConfig) handlerAdminUserChirpyRedRevoke(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserChirpyRed(w, r, false)
+}
+
+func (cfg *apiConfig) setUserChirpyRed(w http.ResponseWriter, r *http.Request, isChirpyRed bool) {
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.SetUserChirpyRed(r.Context(), database.SetUserChirpyRedParams{
+		ID:          userID,
+		IsChirpyRed: isChirpyRed,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	action := auditChirpyRedRevoke
+	if isChirpyRed {
+		action = auditChirpyRedGrant
+	}
+	cfg.audit(r, auditEvent{
+		Action:     action,
+		ActorID:    adminID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+	})
+	respondWithJSON(w, http.StatusOK, adminUserFromDB(user))
+}
+
+// handlerAdminUserSuspend stops a user logging in or refreshing their
+// access token, and logs them out.
+func (cfg *apiConfig) handlerAdminUserSuspend(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var user database.User
+	err := cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		var err error
+		user, err = tx.SuspendUser(r.Context(), userID)
+		if err != nil {
+			return err
+		}
+		return tx.RevokeAllRefreshTokensForUser(r.Context(), userID)
+	})
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditSuspend,
+		ActorID:    adminID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+	})
+	respondWithJSON(w, http.StatusOK, adminUserFromDB(user))
+}
+
+func (cfg *apiConfig) handlerAdminUserUnsuspend(w http.ResponseWriter, r *http.Request) {
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.UnsuspendUser(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditUnsuspend,
+		ActorID:    adminID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+	})
+	respondWithJSON(w, http.StatusOK, adminUserFromDB(user))
+}
+
+// handlerAdminUserImpersonate gives the admin a short-lived access token
+// for the user, to see what they see. Every request made with it is
+// audited by middlewareImpersonationAudit, and it can't change the user's
+// credentials, delete the account or export its data. Admins can't be
+// impersonated, so this can't be used to act as a more privileged account.
+func (cfg *apiConfig) handlerAdminUserImpersonate(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		AdminUser
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	adminID, userID, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := cfg.store.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+	if user.IsAdmin {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Admins can't be impersonated", nil)
+		return
+	}
+
+	expiresAt := time.Now().Add(impersonationTokenExpiry)
+	token, err := auth.MakeImpersonationJWT(userID, adminID, cfg.jwtSecret, impersonationTokenExpiry)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to make JWT token", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditImpersonate,
+		ActorID:    adminID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+		Details:    map[string]any{"expires_at": expiresAt},
+	})
+	respondWithJSON(w, http.StatusOK, response{
+		AdminUser: adminUserFromDB(user),
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
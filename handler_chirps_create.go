@@ -1,74 +1,405 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
-	"github.com/lordbaldwin1/chirpy/internal/auth"
 	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+const maxChirpLength = 140
+
+// Who can see a chirp. Unlisted chirps can be seen by anyone but are left
+// out of the full list, hashtags, trending and the public streams.
+const (
+	visibilityPublic    = "public"
+	visibilityFollowers = "followers"
+	visibilityUnlisted  = "unlisted"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	ReplyToID *uuid.UUID `json:"reply_to_id"`
+	ThreadID  uuid.UUID  `json:"thread_id"`
+
+	Visibility string `json:"visibility"`
+
+	// Entities are the mentions and hashtags in Body, for clients to link.
+	// Only mentions recorded when the chirp was created are included.
+	Entities []entities.Entity `json:"entities"`
+	Media    []Media           `json:"media"`
+
+	// Author is only set with expand=author.
+	Author *Author `json:"author,omitempty"`
+}
+
+func chirpFromDB(dbChirp database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:         dbChirp.ID,
+		CreatedAt:  dbChirp.CreatedAt,
+		UpdatedAt:  dbChirp.UpdatedAt,
+		Body:       dbChirp.Body,
+		UserID:     dbChirp.UserID,
+		ThreadID:   dbChirp.ThreadID,
+		Visibility: dbChirp.Visibility,
+		Entities:   chirpEntities(dbChirp.Body, nil),
+		Media:      []Media{},
+	}
+	if dbChirp.ReplyToID.Valid {
+		chirp.ReplyToID = &dbChirp.ReplyToID.UUID
+	}
+	return chirp
+}
+
+// chirpEntities is the entities in body, with only the mentions of the
+// lower-cased handles in mentioned. A chirp's mentions are recorded when it
+// is created, so they don't include handles nobody had or users blocked
+// either way, which are left as plain text.
+func chirpEntities(body string, mentioned []string) []entities.Entity {
+	found := []entities.Entity{}
+	for _, e := range entities.Parse(body) {
+		if e.Type == entities.Mention && !slices.Contains(mentioned, strings.ToLower(e.Text)) {
+			continue
+		}
+		found = append(found, e)
+	}
+	return found
+}
+
+// chirpsFromDB is chirpFromDB for several chirps, with their media,
+// mentions and anything in exp loaded. Each kind of related object takes one query
+// however many chirps there are.
+func (cfg *apiConfig) chirpsFromDB(ctx context.Context, dbChirps []database.Chirp, exp expansion) ([]Chirp, error) {
+	chirps := make([]Chirp, 0, len(dbChirps))
+	if len(dbChirps) == 0 {
+		return chirps, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		ids = append(ids, c.ID)
+	}
+	rows, err := cfg.store.GetChirpMedia(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	media := map[uuid.UUID][]Media{}
+	for _, row := range rows {
+		media[row.ChirpID] = append(media[row.ChirpID], mediaFromDB(row.Media))
+	}
+	mentionRows, err := cfg.store.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	mentioned := map[uuid.UUID][]string{}
+	for _, row := range mentionRows {
+		mentioned[row.ChirpID] = append(mentioned[row.ChirpID], row.Handle)
+	}
+
+	authors := map[uuid.UUID]*Author{}
+	if exp.Author {
+		userIDs := make([]uuid.UUID, 0, len(dbChirps))
+		for _, c := range dbChirps {
+			userIDs = append(userIDs, c.UserID)
+		}
+		users, err := cfg.store.GetUsersByIDs(ctx, userIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			authors[u.ID] = authorFromDB(u)
+		}
+	}
+
+	for _, c := range dbChirps {
+		chirp := chirpFromDB(c)
+		chirp.Entities = chirpEntities(c.Body, mentioned[c.ID])
+		if m, ok := media[c.ID]; ok {
+			chirp.Media = m
+		}
+		chirp.Author = authors[c.UserID]
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
 }
 
+// handlerChirpsCreate creates a chirp, or with publish_at or draft saves it
+// to be published later.
 func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body       string     `json:"body" validate:"required"`
+		ReplyToID  string     `json:"reply_to_id" validate:"uuid"`
+		MediaIDs   []string   `json:"media_ids" validate:"max=4"`
+		Visibility string     `json:"visibility" validate:"oneof=public followers unlisted"`
+		PublishAt  *time.Time `json:"publish_at"`
+		Draft      bool       `json:"draft"`
 	}
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+	userId, ok := cfg.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	log.Printf("bearerToken: %s: \n", bearerToken)
-	userId, err := auth.ValidateJWT(bearerToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	var params parameters
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode request body JSON", err)
+	params.Body, ok = cleanChirpBody(w, r, params.Body)
+	if !ok {
+		return
+	}
+	if params.Visibility == "" {
+		params.Visibility = visibilityPublic
+	}
+
+	var replyToID uuid.NullUUID
+	if params.ReplyToID != "" {
+		replyToID = uuid.NullUUID{UUID: uuid.MustParse(params.ReplyToID), Valid: true}
+	}
+
+	attached, ok := cfg.mediaToAttach(w, r, userId, params.MediaIDs)
+	if !ok {
 		return
 	}
 
-	if len(params.Body) > 140 {
-		respondWithError(w, 400, "Chirp is too long", fmt.Errorf("error: chirp must be less than 140 characters"))
+	c := newChirp{
+		Body:       params.Body,
+		UserID:     userId,
+		ReplyToID:  replyToID,
+		Visibility: params.Visibility,
+		Media:      attached,
+	}
+	if params.PublishAt != nil || params.Draft {
+		cfg.scheduleChirp(w, r, c, params.PublishAt, params.Draft)
 		return
 	}
-	params.Body = removeProfanity(params.Body)
 
-	chirp, err := cfg.queries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   params.Body,
-		UserID: userId,
+	var chirp database.Chirp
+	var notifications []database.Notification
+	err := cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		var err error
+		chirp, notifications, err = createChirp(r.Context(), tx, c)
+		return err
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create chirp in database", err)
+		respondWithDBError(w, r, "Failed to create chirp in database", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
+	resp := cfg.announceChirp(r.Context(), chirp, notifications)
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// newChirp is a validated chirp to create.
+type newChirp struct {
+	Body       string
+	UserID     uuid.UUID
+	ReplyToID  uuid.NullUUID
+	Visibility string
+	Media      []database.Media
+}
+
+// createChirp creates c in tx along with its media, hashtags and mentions,
+// and notifies the users it replies to or mentions. The notifications are
+// returned to publish once tx commits.
+func createChirp(ctx context.Context, tx store.Store, c newChirp) (database.Chirp, []database.Notification, error) {
+	chirp, err := tx.CreateChirp(ctx, database.CreateChirpParams{
+		Body:       c.Body,
+		UserID:     c.UserID,
+		ReplyToID:  c.ReplyToID,
+		Visibility: c.Visibility,
 	})
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+
+	for i, m := range c.Media {
+		err := tx.CreateChirpMedia(ctx, database.CreateChirpMediaParams{
+			ChirpID:  chirp.ID,
+			MediaID:  m.ID,
+			Position: int16(i),
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+	}
+
+	// only users who can see the new chirp are notified about it
+	var notifications []database.Notification
+	notifyIfVisible := func(arg database.CreateNotificationParams) error {
+		visible, err := canView(ctx, tx, uuid.NullUUID{UUID: arg.UserID, Valid: true}, chirp)
+		if err != nil || !visible {
+			return err
+		}
+		notifications, err = notify(ctx, tx, notifications, arg)
+		return err
+	}
+
+	// the author of the chirp being replied to gets a reply notification
+	// even if they're mentioned too
+	var replyTo uuid.UUID
+	if c.ReplyToID.Valid {
+		parent, err := tx.GetChirpsByID(ctx, c.ReplyToID.UUID)
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+		// users can only reply to chirps they can see, and can't tell the
+		// others from missing ones
+		visible, err := canView(ctx, tx, uuid.NullUUID{UUID: c.UserID, Valid: true}, parent)
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+		if !visible {
+			return database.Chirp{}, nil, sql.ErrNoRows
+		}
+		replyTo = parent.UserID
+		err = notifyIfVisible(database.CreateNotificationParams{
+			UserID:  parent.UserID,
+			ActorID: c.UserID,
+			Type:    notificationReply,
+			ChirpID: chirpID,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+	}
+
+	found := entities.Parse(chirp.Body)
+	for _, tag := range entities.Hashtags(found) {
+		err := tx.CreateChirpHashtag(ctx, database.CreateChirpHashtagParams{
+			ChirpID: chirp.ID,
+			Tag:     tag,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+	}
+
+	// mentions of handles nobody has, or of users blocked either way, are
+	// left as plain text
+	handles := entities.Mentions(found)
+	if len(handles) == 0 {
+		return chirp, notifications, nil
+	}
+	mentioned, err := tx.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	blocked, err := tx.GetBlockRelatedUserIDs(ctx, c.UserID)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	}
+	for _, user := range mentioned {
+		if slices.Contains(blocked, user.ID) {
+			continue
+		}
+		err := tx.CreateChirpMention(ctx, database.CreateChirpMentionParams{
+			ChirpID: chirp.ID,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+		if user.ID == replyTo {
+			continue
+		}
+		err = notifyIfVisible(database.CreateNotificationParams{
+			UserID:  user.ID,
+			ActorID: c.UserID,
+			Type:    notificationMention,
+			ChirpID: chirpID,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		}
+	}
+	return chirp, notifications, nil
+}
+
+// announceChirp tells streams about a chirp, and delivers its
+// notifications, once the transaction that created them has committed. It
+// returns the chirp as clients see it.
+func (cfg *apiConfig) announceChirp(ctx context.Context, chirp database.Chirp, notifications []database.Notification) Chirp {
+	// the chirp has been created whatever happens here, so failing to load
+	// its media and mentions is only logged
+	resp := chirpFromDB(chirp)
+	loaded, err := cfg.chirpsFromDB(ctx, []database.Chirp{chirp}, expansion{})
+	if err != nil {
+		log.Printf("Error loading chirp %s to announce: %s", chirp.ID, err)
+	} else {
+		resp = loaded[0]
+	}
+	cfg.publishChirpEvent(ctx, events.ChirpCreated, resp)
+	cfg.publishNotifications(ctx, notifications)
+	return resp
+}
+
+// cleanChirpBody checks body isn't too long and filters its profanity. If
+// it is too long it responds with 400 and returns false.
+func cleanChirpBody(w http.ResponseWriter, r *http.Request, body string) (string, bool) {
+	if length := utf8.RuneCountInString(body); length > maxChirpLength {
+		respondWithError(w, r, http.StatusBadRequest, codeChirpTooLong, fmt.Sprintf("Chirp must be %d characters or less", maxChirpLength), fmt.Errorf("error: chirp is %d characters", length))
+		return "", false
+	}
+	return removeProfanity(body), true
+}
+
+// mediaToAttach looks up the media a new chirp should have attached, in
+// order. Users can only attach media they uploaded. If any ID is invalid it
+// responds with 422 and returns false.
+func (cfg *apiConfig) mediaToAttach(w http.ResponseWriter, r *http.Request, userID uuid.UUID, mediaIDs []string) ([]database.Media, bool) {
+	if len(mediaIDs) == 0 {
+		return nil, true
+	}
+
+	invalid := func(message string) ([]database.Media, bool) {
+		respondWithValidationErrors(w, r, validate.Errors{{Field: "media_ids", Message: message}})
+		return nil, false
+	}
+	ids := make([]uuid.UUID, 0, len(mediaIDs))
+	for _, s := range mediaIDs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return invalid("must be UUIDs")
+		}
+		if slices.Contains(ids, id) {
+			return invalid("must not contain duplicates")
+		}
+		ids = append(ids, id)
+	}
+
+	found, err := cfg.store.GetMediaByIDs(r.Context(), ids)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get media", err)
+		return nil, false
+	}
+	attached := make([]database.Media, 0, len(ids))
+	for _, id := range ids {
+		i := slices.IndexFunc(found, func(m database.Media) bool { return m.ID == id })
+		if i < 0 || found[i].UserID != userID {
+			return invalid("must be media you uploaded")
+		}
+		attached = append(attached, found[i])
+	}
+	return attached, true
 }
 
 // would be better using a map!
@@ -4,47 +4,47 @@ import (
 	"net/http"
 
 	"github.com/google/uuid"
-	"github.com/lordbaldwin1/chirpy/internal/auth"
 	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/events"
 )
 
 func (cfg *apiConfig) handlerChirpsDelete(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	chirpUUID, err := uuid.Parse(chirpID)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No bearer token in auth header", err)
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid JWT token", err)
-		return
-	}
-
-	dbChirp, err := cfg.queries.GetChirpsByID(r.Context(), chirpUUID)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Chirp not found", err)
+	// chirps the user can't see are as missing as they are when reading
+	dbChirp, ok := cfg.viewableChirp(w, r, uuid.NullUUID{UUID: userID, Valid: true}, chirpUUID)
+	if !ok {
 		return
 	}
 	if dbChirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "User doesn't have access to this chirp", err)
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "User doesn't have access to this chirp", nil)
 		return
 	}
 
-	err = cfg.queries.DeleteChirp(r.Context(), database.DeleteChirpParams{
+	err = cfg.store.DeleteChirp(r.Context(), database.DeleteChirpParams{
 		UserID: userID,
 		ID:     chirpUUID,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to delete chirp", err)
+		respondWithDBError(w, r, "Failed to delete chirp", err)
 		return
 	}
+	cfg.audit(r, auditEvent{
+		Action:     auditChirpDelete,
+		ActorID:    userID,
+		TargetType: auditTargetChirp,
+		TargetID:   chirpUUID,
+	})
+	cfg.publishChirpEvent(r.Context(), events.ChirpDeleted, chirpFromDB(dbChirp))
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+)
+
+// handlerHashtagChirps returns the public chirps tagged with a hashtag,
+// newest first. The tag matches regardless of case and may include the #.
+func (cfg *apiConfig) handlerHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := entities.NormalizeHashtag(r.PathValue("tag"))
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+
+	dbChirps, err := cfg.store.GetChirpsByHashtag(r.Context(), database.GetChirpsByHashtagParams{
+		Tag:        tag,
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get chirps", err)
+		return
+	}
+	f, err := cfg.loadChirpFilter(r.Context(), viewer)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+	resp, err := cfg.newChirpPage(r.Context(), p, dbChirps, f, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerUserMentions returns the chirps that mention a user, newest first.
+func (cfg *apiConfig) handlerUserMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+
+	dbChirps, err := cfg.store.GetChirpsMentioningUser(r.Context(), database.GetChirpsMentioningUserParams{
+		UserID:     userID,
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get chirps", err)
+		return
+	}
+	f, err := cfg.loadChirpFilter(r.Context(), viewer)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+	resp, err := cfg.newChirpPage(r.Context(), p, dbChirps, f, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
@@ -9,39 +9,51 @@ import (
 	"github.com/lordbaldwin1/chirpy/internal/database"
 )
 
+// handlerChirpsGet lists every public chirp, or the chirps of an author
+// that the viewer can see. Mutes only apply to the full list.
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 	authorID := r.URL.Query().Get("author_id")
 	sortOrder := r.URL.Query().Get("sort")
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+	f, err := cfg.loadChirpFilter(r.Context(), viewer)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
 	var dbChirps []database.Chirp
-	var err error
 
 	if authorID == "" {
-		dbChirps, err = cfg.queries.GetChirps(r.Context())
+		dbChirps, err = cfg.store.GetChirps(r.Context())
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps from DB", err)
+			respondWithDBError(w, r, "Couldn't get chirps from DB", err)
 			return
 		}
+		dbChirps = f.wanted(dbChirps)
 	} else {
 		authorUUID, err := uuid.Parse(authorID)
 		if err != nil {
-			respondWithError(w, http.StatusBadRequest, "Couldn't parse authorID", err)
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Couldn't parse authorID", err)
+			return
 		}
-		dbChirps, err = cfg.queries.GetChirpsByAuthorID(r.Context(), authorUUID)
+		dbChirps, err = cfg.store.GetChirpsByAuthorID(r.Context(), authorUUID)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Couldn't get chirps from DB", err)
+			respondWithDBError(w, r, "Couldn't get chirps from DB", err)
 			return
 		}
+		dbChirps = f.visible(dbChirps)
 	}
 
-	var chirps []Chirp
-	for _, dbChirp := range dbChirps {
-		chirps = append(chirps, Chirp{
-			ID:        dbChirp.ID,
-			CreatedAt: dbChirp.CreatedAt,
-			UpdatedAt: dbChirp.UpdatedAt,
-			Body:      dbChirp.Body,
-			UserID:    dbChirp.UserID,
-		})
+	chirps, err := cfg.chirpsFromDB(r.Context(), dbChirps, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
 	}
 
 	if sortOrder == "asc" {
@@ -59,23 +71,49 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *apiConfig) handlerChirpsGetByID(w http.ResponseWriter, r *http.Request) {
-	chirpID := r.PathValue("chirpID")
-
-	dbChirp, err := cfg.queries.GetChirpsByID(r.Context(), uuid.MustParse(chirpID))
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		if err == sql.ErrNoRows {
-			respondWithError(w, http.StatusNotFound, "Chirp not found", nil)
-			return
-		}
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
 
-		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp", err)
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+	dbChirp, ok := cfg.viewableChirp(w, r, viewer, chirpID)
+	if !ok {
+		return
+	}
+	chirps, err := cfg.chirpsFromDB(r.Context(), []database.Chirp{dbChirp}, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
 		return
 	}
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:        dbChirp.ID,
-		CreatedAt: dbChirp.CreatedAt,
-		UpdatedAt: dbChirp.UpdatedAt,
-		Body:      dbChirp.Body,
-		UserID:    dbChirp.UserID,
-	})
+	respondWithJSON(w, http.StatusOK, chirps[0])
+}
+
+// viewableChirp gets a chirp for viewer. Chirps they can't see
+// get the same 404 as chirps that don't exist, so their existence isn't
+// revealed. If there's no chirp to show it responds and returns false.
+func (cfg *apiConfig) viewableChirp(w http.ResponseWriter, r *http.Request, viewer uuid.NullUUID, chirpID uuid.UUID) (database.Chirp, bool) {
+	dbChirp, err := cfg.store.GetChirpsByID(r.Context(), chirpID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't retrieve chirp", err)
+		return database.Chirp{}, false
+	}
+	visible, err := canView(r.Context(), cfg.store, viewer, dbChirp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't retrieve chirp", err)
+		return database.Chirp{}, false
+	}
+	if !visible {
+		respondWithDBError(w, r, "Couldn't retrieve chirp", sql.ErrNoRows)
+		return database.Chirp{}, false
+	}
+	return dbChirp, true
 }
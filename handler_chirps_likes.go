@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+func (cfg *apiConfig) handlerChirpsLike(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var notifications []database.Notification
+	err = cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		chirp, err := tx.GetChirpsByID(r.Context(), chirpID)
+		if err != nil {
+			return err
+		}
+		// chirps the user can't see are treated as missing
+		visible, err := canView(r.Context(), tx, uuid.NullUUID{UUID: userID, Valid: true}, chirp)
+		if err != nil {
+			return err
+		}
+		if !visible {
+			return sql.ErrNoRows
+		}
+
+		liked, err := tx.CreateChirpLike(r.Context(), database.CreateChirpLikeParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+		// liking twice is fine but only notifies once
+		if err != nil || liked == 0 {
+			return err
+		}
+
+		notifications, err = notify(r.Context(), tx, notifications, database.CreateNotificationParams{
+			UserID:  chirp.UserID,
+			ActorID: userID,
+			Type:    notificationLike,
+			ChirpID: uuid.NullUUID{UUID: chirpID, Valid: true},
+		})
+		return err
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't like chirp", err)
+		return
+	}
+
+	cfg.publishNotifications(r.Context(), notifications)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerChirpsUnlike(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.store.DeleteChirpLike(r.Context(), database.DeleteChirpLikeParams{
+		UserID:  userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't unlike chirp", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+)
+
+const (
+	streamHeartbeatInterval = 15 * time.Second
+	streamRetryMillis       = 3000
+)
+
+// handlerChirpsStream pushes chirp events to the client as Server-Sent
+// Events. Clients that reconnect with Last-Event-ID get the events they
+// missed, as long as this replica still remembers them. The stream is
+// anonymous, so it only has public chirps, and unlisted ones too when
+// limited to one author.
+func (cfg *apiConfig) handlerChirpsStream(w http.ResponseWriter, r *http.Request) {
+	var authorID uuid.UUID
+	if s := r.URL.Query().Get("author_id"); s != "" {
+		var err error
+		authorID, err = uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Couldn't parse author_id", err)
+			return
+		}
+	}
+
+	var lastEventID int64
+	if s := r.Header.Get("Last-Event-ID"); s != "" {
+		var err error
+		lastEventID, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Last-Event-ID must be an event ID", err)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub, missed := cfg.eventHub.Subscribe(lastEventID)
+	defer cfg.eventHub.Unsubscribe(sub)
+
+	send := func(e events.Event) error {
+		if e.Private() || authorID != uuid.Nil && e.AuthorID != authorID {
+			return nil
+		}
+		listed := e.Visibility == visibilityPublic || authorID != uuid.Nil && e.Visibility == visibilityUnlisted
+		if !listed {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+	if err != nil {
+		return
+	}
+	for _, e := range missed {
+		if send(e) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			// the hub dropped us for falling behind; the client will
+			// reconnect and resume from its last event ID
+			if !ok {
+				return
+			}
+			err = send(e)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err != nil || rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// publishChirpEvent tells every stream about a chirp change. Failing to
+// publish doesn't fail the request that made the change.
+func (cfg *apiConfig) publishChirpEvent(ctx context.Context, eventType events.Type, chirp Chirp) {
+	data, err := json.Marshal(chirp)
+	if err != nil {
+		log.Printf("Error marshalling chirp event: %s", err)
+		return
+	}
+
+	err = cfg.events.Publish(ctx, events.Event{
+		Type:       eventType,
+		AuthorID:   chirp.UserID,
+		ThreadID:   chirp.ThreadID,
+		Visibility: chirp.Visibility,
+		Data:       data,
+	})
+	if err != nil {
+		log.Printf("[%s] Error publishing %s event: %s", requestIDFromContext(ctx), eventType, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// handlerChirpsThread returns every chirp in the thread the chirp belongs
+// to, oldest first. Other chirps the viewer doesn't want in their feeds are
+// left out.
+func (cfg *apiConfig) handlerChirpsThread(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid chirp ID", err)
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+	dbChirp, ok := cfg.viewableChirp(w, r, viewer, chirpID)
+	if !ok {
+		return
+	}
+	f, err := cfg.loadChirpFilter(r.Context(), viewer)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+
+	dbChirps, err := cfg.store.GetChirpsByThreadID(r.Context(), dbChirp.ThreadID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't retrieve thread", err)
+		return
+	}
+
+	kept := make([]database.Chirp, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		if c.ID == chirpID || f.wants(c) {
+			kept = append(kept, c)
+		}
+	}
+
+	chirps, err := cfg.chirpsFromDB(r.Context(), kept, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, chirps)
+}
@@ -1,9 +1,104 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+// readinessCheck reports whether a single dependency of the server is usable.
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
 
 func healthzHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
+
+// livezHandler only tells the orchestrator the process is alive and serving;
+// it never touches dependencies so a database outage doesn't restart us.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	healthzHandler(w, r)
+}
+
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	type checkStatus struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+	type response struct {
+		Status string                 `json:"status"`
+		Checks map[string]checkStatus `json:"checks"`
+	}
+
+	resp := response{
+		Status: "ready",
+		Checks: map[string]checkStatus{},
+	}
+
+	// report not-ready as soon as shutdown starts so load balancers
+	// drain us before the listener actually closes
+	if cfg.shuttingDown.Load() {
+		resp.Status = "not_ready"
+		resp.Checks["shutdown"] = checkStatus{Status: "fail", Error: "server is shutting down"}
+	} else {
+		resp.Checks["shutdown"] = checkStatus{Status: "ok"}
+	}
+
+	for _, c := range cfg.readinessChecks {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+		err := c.check(ctx)
+		cancel()
+		if err != nil {
+			resp.Status = "not_ready"
+			resp.Checks[c.name] = checkStatus{Status: "fail", Error: err.Error()}
+			continue
+		}
+		resp.Checks[c.name] = checkStatus{Status: "ok"}
+	}
+
+	code := http.StatusOK
+	if resp.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, code, resp)
+}
+
+func databaseReadinessCheck(db *sql.DB) readinessCheck {
+	return readinessCheck{
+		name: "database",
+		check: func(ctx context.Context) error {
+			return db.PingContext(ctx)
+		},
+	}
+}
+
+// migrationsReadinessCheck fails while the database is behind the schema
+// this binary was built with. A database that is ahead is fine: migrations
+// must stay backwards compatible so old replicas keep serving during deploys.
+func migrationsReadinessCheck(db *sql.DB, expectedVersion int64) readinessCheck {
+	return readinessCheck{
+		name: "migrations",
+		check: func(ctx context.Context) error {
+			var version int64
+			err := db.QueryRowContext(ctx,
+				"SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied",
+			).Scan(&version)
+			if err != nil {
+				return fmt.Errorf("couldn't read schema version: %w", err)
+			}
+			if version < expectedVersion {
+				return fmt.Errorf("schema version %d is behind expected version %d", version, expectedVersion)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/media"
+)
+
+const (
+	// multipartOverhead allows for the multipart headers and boundaries
+	// around an upload of media.MaxUploadBytes.
+	multipartOverhead = 64 << 10
+
+	// media never changes once uploaded, so it can be cached for good
+	mediaCacheControl = "public, max-age=31536000, immutable"
+)
+
+type Media struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+}
+
+func mediaFromDB(m database.Media) Media {
+	url := "/media/" + m.ID.String()
+	return Media{
+		ID:           m.ID,
+		URL:          url,
+		ThumbnailURL: url + "/thumbnail",
+		ContentType:  m.ContentType,
+		Width:        m.Width,
+		Height:       m.Height,
+	}
+}
+
+func mediaBlobKey(id uuid.UUID, thumbnail bool) string {
+	if thumbnail {
+		return id.String() + "-thumbnail"
+	}
+	return id.String()
+}
+
+// handlerMediaUpload takes an image as the "file" field of a multipart form
+// and stores it, with its metadata stripped, to be attached to chirps.
+func (cfg *apiConfig) handlerMediaUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		respondWithError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be multipart/form-data", err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, media.MaxUploadBytes+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Couldn't read multipart form", err)
+		return
+	}
+
+	var data []byte
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Form has no file field", nil)
+			return
+		}
+		if err == nil && part.FormName() == "file" {
+			data, err = io.ReadAll(io.LimitReader(part, media.MaxUploadBytes+1))
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || len(data) > media.MaxUploadBytes {
+			respondWithError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+				fmt.Sprintf("File must be %d bytes or less", media.MaxUploadBytes), err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Couldn't read multipart form", err)
+			return
+		}
+		if data != nil {
+			break
+		}
+	}
+
+	img, err := media.Process(data)
+	switch {
+	case errors.Is(err, media.ErrUnsupportedType):
+		respondWithError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "File must be a JPEG, PNG or GIF image", err)
+		return
+	case errors.Is(err, media.ErrTooLarge):
+		respondWithError(w, r, http.StatusRequestEntityTooLarge, codeBodyTooLarge,
+			fmt.Sprintf("Image must be %d pixels or less", media.MaxPixels), err)
+		return
+	case errors.Is(err, media.ErrInvalidImage):
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "File isn't a valid image", err)
+		return
+	case err != nil:
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't process image", err)
+		return
+	}
+
+	id := uuid.New()
+	err = cfg.putMediaBlobs(r, id, img)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't store image", err)
+		return
+	}
+
+	dbMedia, err := cfg.store.CreateMedia(r.Context(), database.CreateMediaParams{
+		ID:                   id,
+		UserID:               userID,
+		ContentType:          img.ContentType,
+		ThumbnailContentType: img.ThumbnailContentType,
+		Width:                int32(img.Width),
+		Height:               int32(img.Height),
+		SizeBytes:            int64(len(img.Data)),
+	})
+	if err != nil {
+		cfg.deleteMediaBlobs(r.Context(), id)
+		respondWithDBError(w, r, "Couldn't save media", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, mediaFromDB(dbMedia))
+}
+
+func (cfg *apiConfig) putMediaBlobs(r *http.Request, id uuid.UUID, img *media.Image) error {
+	err := cfg.blobs.Put(r.Context(), mediaBlobKey(id, false), bytes.NewReader(img.Data))
+	if err != nil {
+		return err
+	}
+	err = cfg.blobs.Put(r.Context(), mediaBlobKey(id, true), bytes.NewReader(img.Thumbnail))
+	if err != nil {
+		cfg.deleteMediaBlobs(r.Context(), id)
+	}
+	return err
+}
+
+func (cfg *apiConfig) deleteMediaBlobs(ctx context.Context, id uuid.UUID) {
+	for _, thumbnail := range []bool{false, true} {
+		err := cfg.blobs.Delete(ctx, mediaBlobKey(id, thumbnail))
+		if err != nil {
+			log.Printf("[%s] Error deleting media blob: %s", requestIDFromContext(ctx), err)
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerMediaGet(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, false)
+}
+
+func (cfg *apiConfig) handlerMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, true)
+}
+
+// serveMedia serves a file from the blob store, supporting range and
+// conditional requests.
+func (cfg *apiConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	id, err := uuid.Parse(r.PathValue("mediaID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid media ID", err)
+		return
+	}
+
+	dbMedia, err := cfg.store.GetMediaByID(r.Context(), id)
+	if err != nil {
+		respondWithDBError(w, r, "Media not found", err)
+		return
+	}
+	key := mediaBlobKey(id, thumbnail)
+	contentType := dbMedia.ContentType
+	if thumbnail {
+		contentType = dbMedia.ThumbnailContentType
+	}
+
+	f, err := cfg.blobs.Open(r.Context(), key)
+	if errors.Is(err, media.ErrNotFound) {
+		respondWithError(w, r, http.StatusNotFound, codeNotFound, "Media not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't open media", err)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", mediaCacheControl)
+	w.Header().Set("ETag", `"`+key+`"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", dbMedia.CreatedAt, f)
+}
@@ -12,6 +12,7 @@ func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
   <body>
     <h1>Welcome, Chirpy Admin</h1>
     <p>Chirpy has been visited %d times!</p>
+    <p>%d expired or revoked refresh tokens have been purged.</p>
   </body>
-</html>`, cfg.fileserverHits.Load())
+</html>`, cfg.fileserverHits.Load(), cfg.refreshTokensPurged.Load())
 }
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+const (
+	notificationMention = "mention"
+	notificationReply   = "reply"
+	notificationLike    = "like"
+	notificationFollow  = "follow"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Type      string     `json:"type"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func notificationFromDB(n database.Notification) Notification {
+	notification := Notification{
+		ID:        n.ID,
+		CreatedAt: n.CreatedAt,
+		Type:      n.Type,
+		ActorID:   n.ActorID,
+	}
+	if n.ChirpID.Valid {
+		notification.ChirpID = &n.ChirpID.UUID
+	}
+	if n.ReadAt.Valid {
+		notification.ReadAt = &n.ReadAt.Time
+	}
+	return notification
+}
+
+// notify records a notification as part of the transaction tx and appends
+// it to created. Nothing is recorded for users acting on their own chirps,
+// for types the recipient has turned off, or from users the recipient
+// muted or is blocked from either way.
+func notify(ctx context.Context, tx store.Store, created []database.Notification, arg database.CreateNotificationParams) ([]database.Notification, error) {
+	if arg.UserID == arg.ActorID {
+		return created, nil
+	}
+
+	prefs, err := notificationPreferences(ctx, tx, arg.UserID)
+	if err != nil {
+		return created, err
+	}
+	if !prefs.wants(arg.Type) {
+		return created, nil
+	}
+	blocked, err := tx.BlockExists(ctx, database.BlockExistsParams{
+		UserID:  arg.UserID,
+		OtherID: arg.ActorID,
+	})
+	if err != nil || blocked {
+		return created, err
+	}
+	muted, err := tx.GetMutedUserIDs(ctx, arg.UserID)
+	if err != nil || slices.Contains(muted, arg.ActorID) {
+		return created, err
+	}
+
+	n, err := tx.CreateNotification(ctx, arg)
+	if err != nil {
+		return created, err
+	}
+	return append(created, n), nil
+}
+
+// publishNotifications pushes committed notifications to their recipients'
+// live connections.
+func (cfg *apiConfig) publishNotifications(ctx context.Context, notifications []database.Notification) {
+	for _, n := range notifications {
+		data, err := json.Marshal(notificationFromDB(n))
+		if err != nil {
+			log.Printf("Error marshalling notification: %s", err)
+			continue
+		}
+
+		err = cfg.events.Publish(ctx, events.Event{
+			Type:        events.NotificationCreated,
+			RecipientID: n.UserID,
+			Data:        data,
+		})
+		if err != nil {
+			log.Printf("[%s] Error publishing notification: %s", requestIDFromContext(ctx), err)
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerNotificationsGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Notifications []Notification `json:"notifications"`
+		UnreadCount   int64          `json:"unread_count"`
+		NextCursor    *uuid.UUID     `json:"next_cursor"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	dbNotifications, err := cfg.store.GetNotifications(r.Context(), database.GetNotificationsParams{
+		UserID:     userID,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get notifications", err)
+		return
+	}
+	unread, err := cfg.store.CountUnreadNotifications(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't count unread notifications", err)
+		return
+	}
+
+	resp := response{
+		Notifications: []Notification{},
+		UnreadCount:   unread,
+	}
+	for _, n := range dbNotifications {
+		resp.Notifications = append(resp.Notifications, notificationFromDB(n))
+	}
+	if len(dbNotifications) > 0 {
+		resp.NextCursor = p.nextCursor(len(dbNotifications), dbNotifications[len(dbNotifications)-1].ID)
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := uuid.Parse(r.PathValue("notificationID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid notification ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := cfg.store.MarkNotificationRead(r.Context(), database.MarkNotificationReadParams{
+		ID:     notificationID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't find notification", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, notificationFromDB(n))
+}
+
+func (cfg *apiConfig) handlerNotificationsReadAll(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Marked int64 `json:"marked"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	marked, err := cfg.store.MarkAllNotificationsRead(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't mark notifications read", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{Marked: marked})
+}
+
+// NotificationPreferences says which types of notification a user gets.
+type NotificationPreferences struct {
+	Mentions bool `json:"mentions"`
+	Replies  bool `json:"replies"`
+	Likes    bool `json:"likes"`
+	Follows  bool `json:"follows"`
+}
+
+// notificationPreferences returns the user's preferences, which default to
+// every type.
+func notificationPreferences(ctx context.Context, s store.Store, userID uuid.UUID) (NotificationPreferences, error) {
+	prefs, err := s.GetNotificationPreferences(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationPreferences{Mentions: true, Replies: true, Likes: true, Follows: true}, nil
+	}
+	if err != nil {
+		return NotificationPreferences{}, err
+	}
+	return NotificationPreferences{
+		Mentions: prefs.Mentions,
+		Replies:  prefs.Replies,
+		Likes:    prefs.Likes,
+		Follows:  prefs.Follows,
+	}, nil
+}
+
+func (p NotificationPreferences) wants(notificationType string) bool {
+	switch notificationType {
+	case notificationMention:
+		return p.Mentions
+	case notificationReply:
+		return p.Replies
+	case notificationLike:
+		return p.Likes
+	case notificationFollow:
+		return p.Follows
+	}
+	return false
+}
+
+func (cfg *apiConfig) handlerNotificationPreferencesGet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := notificationPreferences(r.Context(), cfg.store, userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get notification preferences", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+func (cfg *apiConfig) handlerNotificationPreferencesUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Mentions *bool `json:"mentions" validate:"required"`
+		Replies  *bool `json:"replies" validate:"required"`
+		Likes    *bool `json:"likes" validate:"required"`
+		Follows  *bool `json:"follows" validate:"required"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := cfg.store.UpsertNotificationPreferences(r.Context(), database.UpsertNotificationPreferencesParams{
+		UserID:   userID,
+		Mentions: *params.Mentions,
+		Replies:  *params.Replies,
+		Likes:    *params.Likes,
+		Follows:  *params.Follows,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't update notification preferences", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, NotificationPreferences{
+		Mentions: prefs.Mentions,
+		Replies:  prefs.Replies,
+		Likes:    prefs.Likes,
+		Follows:  prefs.Follows,
+	})
+}
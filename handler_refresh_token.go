@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"net/http"
 	"time"
 
@@ -8,6 +11,11 @@ import (
 	"github.com/lordbaldwin1/chirpy/internal/database"
 )
 
+var (
+	errRefreshTokenMismatch = errors.New("refresh token doesn't match the stored digest")
+	errAccountSuspended     = errors.New("account is suspended")
+)
+
 func (cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 	type response struct {
 		Token string `json:"token"`
@@ -15,32 +23,69 @@ func (cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request)
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get bearer token to refresh", err)
+		respondWithError(w, r, http.StatusUnauthorized, codeMissingToken, "Couldn't get bearer token to refresh", err)
 		return
 	}
 
-	user, err := cfg.queries.GetUserFromRefreshToken(r.Context(), refreshToken)
+	user, err := cfg.userFromRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't find user", err)
+		cfg.audit(r, auditEvent{
+			Action:  auditRefresh,
+			Failed:  true,
+			Details: map[string]any{"reason": refreshFailureReason(err)},
+		})
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidToken, "Refresh token is invalid, expired or revoked", err)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't make new refresh token", err)
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't make new access token", err)
 		return
 	}
 
-	err = cfg.queries.UpdateRefreshToken(r.Context(), database.UpdateRefreshTokenParams{
-		Token:  accessToken,
-		UserID: user.ID,
+	cfg.audit(r, auditEvent{
+		Action:     auditRefresh,
+		ActorID:    user.ID,
+		TargetType: auditTargetUser,
+		TargetID:   user.ID,
 	})
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to update refresh token in db", err)
-		return
-	}
-
 	respondWithJSON(w, http.StatusOK, response{
 		Token: accessToken,
 	})
 }
+
+// userFromRefreshToken returns the user a live refresh token belongs to.
+// The token is found by its lookup ID and only accepted if it matches the
+// stored digest and the user isn't suspended.
+func (cfg *apiConfig) userFromRefreshToken(ctx context.Context, refreshToken string) (database.User, error) {
+	id, err := auth.RefreshTokenID(refreshToken)
+	if err != nil {
+		return database.User{}, err
+	}
+	row, err := cfg.store.GetUserFromRefreshToken(ctx, id)
+	if err != nil {
+		return database.User{}, err
+	}
+	if !auth.CheckRefreshTokenHash(refreshToken, row.TokenHash) {
+		return database.User{}, errRefreshTokenMismatch
+	}
+	if row.User.SuspendedAt.Valid {
+		return database.User{}, errAccountSuspended
+	}
+	return row.User, nil
+}
+
+func refreshFailureReason(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrMalformedRefreshToken):
+		return "malformed token"
+	case errors.Is(err, sql.ErrNoRows):
+		return "unknown, expired or revoked token"
+	case errors.Is(err, errRefreshTokenMismatch):
+		return "wrong secret"
+	case errors.Is(err, errAccountSuspended):
+		return "suspended"
+	}
+	return err.Error()
+}
@@ -1,23 +1,54 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/lordbaldwin1/chirpy/internal/store"
 )
 
+// handlerReset empties every table and, if the query string names a
+// fixture, loads it from the seed directory. Both happen in one
+// transaction, so a fixture that fails to load leaves the data as it was.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("Reset is only allowed in dev environment."))
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Reset is only allowed in dev environment.", nil)
 		return
 	}
 
-	cfg.fileserverHits.Store(0)
-	err := cfg.queries.DeleteAllUsers(r.Context())
+	var fixture seedFixture
+	name := r.URL.Query().Get("fixture")
+	if name != "" {
+		var err error
+		fixture, err = loadSeedFixture(cfg.seedDir, name)
+		if errors.Is(err, errFixtureNotFound) {
+			respondWithError(w, r, http.StatusNotFound, codeNotFound, "Fixture not found", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, err.Error(), err)
+			return
+		}
+	}
+
+	err := cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		err := tx.TruncateAllTables(r.Context())
+		if err != nil {
+			return err
+		}
+		return applySeedFixture(r.Context(), tx, fixture)
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Failed to reset the database: " + err.Error()))
+		respondWithDBError(w, r, "Failed to reset the database", err)
 		return
 	}
+	cfg.fileserverHits.Store(0)
+
+	var details map[string]any
+	if name != "" {
+		details = map[string]any{"fixture": name}
+	}
+	cfg.audit(r, auditEvent{Action: auditReset, Details: details})
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0 and database reset to initial state."))
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"github.com/lordbaldwin1/chirpy/internal/auth"
@@ -9,15 +11,43 @@ import (
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Couldn't get bearer token while revoking", err)
+		respondWithError(w, r, http.StatusUnauthorized, codeMissingToken, "Couldn't get bearer token while revoking", err)
 		return
 	}
 
-	err = cfg.queries.RevokeRefreshToken(r.Context(), refreshToken)
+	// revoking a token that doesn't exist, or that we can't match, does
+	// nothing, as it can't be used anyway
+	id, err := auth.RefreshTokenID(refreshToken)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke refresh token from db", err)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	stored, err := cfg.store.GetRefreshToken(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get refresh token from db", err)
+		return
+	}
+	if !auth.CheckRefreshTokenHash(refreshToken, stored.TokenHash) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = cfg.store.RevokeRefreshToken(r.Context(), id)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't revoke refresh token from db", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditRevoke,
+		ActorID:    stored.UserID,
+		TargetType: auditTargetUser,
+		TargetID:   stored.UserID,
+		Details:    map[string]any{"token_id": id},
+	})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// handlerTimeline returns the chirps of the user and everyone they follow,
+// newest first, a page at a time, without the users and keywords they
+// muted.
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+
+	dbChirps, err := cfg.store.GetTimeline(r.Context(), database.GetTimelineParams{
+		UserID:     userID,
+		Before:     p.Before,
+		MaxResults: p.Limit,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get timeline", err)
+		return
+	}
+	f, err := cfg.loadChirpFilter(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+	resp, err := cfg.newChirpPage(r.Context(), p, dbChirps, f, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
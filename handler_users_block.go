@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// errBlocked is returned inside transactions when a block between the two
+// users forbids what was asked.
+var errBlocked = errors.New("error: users are blocked")
+
+// handlerUsersBlock blocks a user. Any follows between the two are removed,
+// and neither sees the other's chirps or can follow, reply to or mention
+// the other until the block is lifted. Blocking twice is fine.
+func (cfg *apiConfig) handlerUsersBlock(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if blockedID == userID {
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Users can't block themselves", errors.New("error: self block"))
+		return
+	}
+
+	err = cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		_, err := tx.CreateBlock(r.Context(), database.CreateBlockParams{
+			BlockerID: userID,
+			BlockedID: blockedID,
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.DeleteFollow(r.Context(), database.DeleteFollowParams{
+			FollowerID: userID,
+			FolloweeID: blockedID,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.DeleteFollow(r.Context(), database.DeleteFollowParams{
+			FollowerID: blockedID,
+			FolloweeID: userID,
+		})
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't block user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUsersUnblock(w http.ResponseWriter, r *http.Request) {
+	blockedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.store.DeleteBlock(r.Context(), database.DeleteBlockParams{
+		BlockerID: userID,
+		BlockedID: blockedID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't unblock user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUsersBlocks lists the users the user blocked, newest first.
+func (cfg *apiConfig) handlerUsersBlocks(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Users []*Author `json:"users"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	blocked, err := cfg.store.GetBlockedUsers(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get blocked users", err)
+		return
+	}
+	resp := response{Users: []*Author{}}
+	for _, u := range blocked {
+		resp.Users = append(resp.Users, authorFromDB(u))
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
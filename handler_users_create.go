@@ -1,13 +1,16 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/lordbaldwin1/chirpy/internal/auth"
 	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
 )
 
 type User struct {
@@ -15,48 +18,80 @@ type User struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Email       string    `json:"email"`
+	Handle      *string   `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarURL   *string   `json:"avatar_url"`
 	IsChirpyRed bool      `json:"is_chirpy_red"`
+	// DeletionScheduledAt is when the account will be deleted, if the user
+	// has asked for that.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
+func userFromDB(dbUser database.User) User {
+	user := User{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		UpdatedAt:   dbUser.UpdatedAt,
+		Email:       dbUser.Email,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		IsChirpyRed: dbUser.IsChirpyRed,
+	}
+	if dbUser.Handle.Valid {
+		user.Handle = &dbUser.Handle.String
+	}
+	user.AvatarURL = avatarURL(dbUser)
+	if dbUser.DeletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &dbUser.DeletionScheduledAt.Time
+	}
+	return user
+}
+
+var invalidHandleMessage = fmt.Sprintf("must be at most %d ASCII letters, digits or underscores", entities.MaxHandleLength)
+
 func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+		Handle   string `json:"handle"`
 	}
 	type response struct {
 		User
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	var params parameters
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode body", err)
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
 		return
 	}
 
+	var handle sql.NullString
+	if params.Handle != "" {
+		if !entities.ValidHandle(params.Handle) {
+			respondWithValidationErrors(w, r, validate.Errors{{Field: "handle", Message: invalidHandleMessage}})
+			return
+		}
+		handle = sql.NullString{String: params.Handle, Valid: true}
+	}
+
+	var err error
 	params.Password, err = auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't hash password", err)
 		return
 	}
 
-	dbUser, err := cfg.queries.CreateUser(r.Context(), database.CreateUserParams{
+	dbUser, err := cfg.store.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          params.Email,
 		HashedPassword: params.Password,
+		Handle:         handle,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database failed to create user", err)
+		respondWithDBError(w, r, "Couldn't create user, the email or handle may already be taken", err)
 		return
 	}
 
 	respondWithJSON(w, http.StatusCreated, response{
-		User: User{
-			ID:          dbUser.ID,
-			CreatedAt:   dbUser.CreatedAt,
-			UpdatedAt:   dbUser.UpdatedAt,
-			Email:       dbUser.Email,
-			IsChirpyRed: dbUser.IsChirpyRed,
-		},
+		User: userFromDB(dbUser),
 	})
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+func (cfg *apiConfig) handlerUsersFollow(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if followeeID == userID {
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Users can't follow themselves", errors.New("error: self follow"))
+		return
+	}
+
+	var notifications []database.Notification
+	err = cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		blocked, err := tx.BlockExists(r.Context(), database.BlockExistsParams{
+			UserID:  userID,
+			OtherID: followeeID,
+		})
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errBlocked
+		}
+
+		followed, err := tx.CreateFollow(r.Context(), database.CreateFollowParams{
+			FollowerID: userID,
+			FolloweeID: followeeID,
+		})
+		// following twice is fine but only notifies once
+		if err != nil || followed == 0 {
+			return err
+		}
+
+		notifications, err = notify(r.Context(), tx, notifications, database.CreateNotificationParams{
+			UserID:  followeeID,
+			ActorID: userID,
+			Type:    notificationFollow,
+		})
+		return err
+	})
+	if errors.Is(err, errBlocked) {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "You can't follow a user you blocked or who blocked you", err)
+		return
+	}
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't follow user", err)
+		return
+	}
+
+	cfg.publishNotifications(r.Context(), notifications)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUsersUnfollow(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.store.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't unfollow user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
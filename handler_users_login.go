@@ -1,18 +1,34 @@
 package main
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/lordbaldwin1/chirpy/internal/auth"
 	"github.com/lordbaldwin1/chirpy/internal/database"
 )
 
+// loginCredentialsError is the detail for an unknown email and for a wrong
+// password alike, so logging in can't be used to find out who has an account.
+const loginCredentialsError = "Incorrect email or password"
+
+// unknownEmailHash is checked against when the email is unknown, so the
+// response takes as long as a wrong password's does.
+var unknownEmailHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not anyone's password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required"`
+		Password string `json:"password" validate:"required"`
 	}
 	type response struct {
 		User
@@ -20,56 +36,89 @@ func (cfg *apiConfig) handlerUsersLogin(w http.ResponseWriter, r *http.Request)
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	var params parameters
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode request body into JSON", err)
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
 		return
 	}
 
-	user, err := cfg.queries.GetUserByEmail(r.Context(), params.Email)
+	user, err := cfg.store.GetUserByEmail(r.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.audit(r, auditEvent{
+			Action:  auditLogin,
+			Failed:  true,
+			Details: map[string]any{"email": params.Email, "reason": "unknown email"},
+		})
+		_ = auth.CheckPasswordHash(params.Password, unknownEmailHash())
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidCredentials, loginCredentialsError, err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't find user", err)
+		respondWithDBError(w, r, "Couldn't find user", err)
 		return
 	}
 
 	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect password", err)
+		cfg.audit(r, auditEvent{
+			Action:     auditLogin,
+			Failed:     true,
+			TargetType: auditTargetUser,
+			TargetID:   user.ID,
+			Details:    map[string]any{"email": params.Email, "reason": "wrong password"},
+		})
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidCredentials, loginCredentialsError, err)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		cfg.audit(r, auditEvent{
+			Action:     auditLogin,
+			Failed:     true,
+			TargetType: auditTargetUser,
+			TargetID:   user.ID,
+			Details:    map[string]any{"email": params.Email, "reason": "suspended"},
+		})
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Account suspended", nil)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to make JWT token", err)
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Failed to make JWT token", err)
 		return
 	}
 
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't make refresh token", err)
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't make refresh token", err)
 		return
 	}
 
-	err = cfg.queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refreshToken,
+	refreshTokenID, err := auth.RefreshTokenID(refreshToken)
+	if err != nil {
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't make refresh token", err)
+		return
+	}
+
+	err = cfg.store.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		ID:        refreshTokenID,
+		TokenHash: auth.HashRefreshToken(refreshToken),
 		UserID:    user.ID,
 		ExpiresAt: time.Now().AddDate(0, 0, 60),
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't store refresh token in db", err)
+		respondWithDBError(w, r, "Couldn't store refresh token in db", err)
 		return
 	}
+	cfg.audit(r, auditEvent{
+		Action:     auditLogin,
+		ActorID:    user.ID,
+		TargetType: auditTargetUser,
+		TargetID:   user.ID,
+		Details:    map[string]any{"token_id": refreshTokenID},
+	})
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         userFromDB(user),
 		Token:        accessToken,
 		RefreshToken: refreshToken,
 	})
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+// maxMutedKeywords is how many keywords a user can mute.
+const maxMutedKeywords = 100
+
+type MutedKeyword struct {
+	Keyword   string    `json:"keyword"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handlerUsersMute mutes a user, hiding their chirps from the muter's
+// feeds and their notifications. The muted user isn't told. Muting twice
+// is fine.
+func (cfg *apiConfig) handlerUsersMute(w http.ResponseWriter, r *http.Request) {
+	mutedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if mutedID == userID {
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "Users can't mute themselves", errors.New("error: self mute"))
+		return
+	}
+
+	_, err = cfg.store.CreateMute(r.Context(), database.CreateMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't mute user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUsersUnmute(w http.ResponseWriter, r *http.Request) {
+	mutedID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid user ID", err)
+		return
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.store.DeleteMute(r.Context(), database.DeleteMuteParams{
+		MuterID: userID,
+		MutedID: mutedID,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't unmute user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUsersMutes lists the users the user muted, newest first, and the
+// keywords they muted.
+func (cfg *apiConfig) handlerUsersMutes(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Users    []*Author      `json:"users"`
+		Keywords []MutedKeyword `json:"keywords"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	muted, err := cfg.store.GetMutedUsers(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get muted users", err)
+		return
+	}
+	keywords, err := cfg.store.GetMutedKeywords(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get muted keywords", err)
+		return
+	}
+
+	resp := response{Users: []*Author{}, Keywords: []MutedKeyword{}}
+	for _, u := range muted {
+		resp.Users = append(resp.Users, authorFromDB(u))
+	}
+	for _, k := range keywords {
+		resp.Keywords = append(resp.Keywords, MutedKeyword{Keyword: k.Keyword, CreatedAt: k.CreatedAt})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// handlerMutedKeywordsCreate mutes a keyword. Chirps containing it
+// anywhere, ignoring case, are hidden from the user's feeds.
+func (cfg *apiConfig) handlerMutedKeywordsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Keyword string `json:"keyword" validate:"required,max=100"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
+		return
+	}
+	keyword := strings.ToLower(strings.TrimSpace(params.Keyword))
+	if keyword == "" {
+		respondWithValidationErrors(w, r, validate.Errors{{Field: "keyword", Message: "must not be blank"}})
+		return
+	}
+
+	existing, err := cfg.store.GetMutedKeywords(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get muted keywords", err)
+		return
+	}
+	if len(existing) >= maxMutedKeywords {
+		respondWithError(w, r, http.StatusConflict, codeConflict, fmt.Sprintf("You can mute at most %d keywords", maxMutedKeywords), nil)
+		return
+	}
+
+	_, err = cfg.store.CreateMutedKeyword(r.Context(), database.CreateMutedKeywordParams{
+		UserID:  userID,
+		Keyword: keyword,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't mute keyword", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerMutedKeywordsDelete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.store.DeleteMutedKeyword(r.Context(), database.DeleteMutedKeywordParams{
+		UserID:  userID,
+		Keyword: strings.ToLower(strings.TrimSpace(r.PathValue("keyword"))),
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't unmute keyword", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+// Profile is what anyone can see of a user. Email is only included for the
+// user themselves.
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         *string   `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      *string   `json:"avatar_url"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	Email          string    `json:"email,omitempty"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
+}
+
+// avatarURL is the URL of the user's avatar, or nil if they haven't set one.
+// The thumbnail is at the same URL plus /thumbnail.
+func avatarURL(dbUser database.User) *string {
+	if !dbUser.AvatarMediaID.Valid {
+		return nil
+	}
+	url := mediaFromDB(database.Media{ID: dbUser.AvatarMediaID.UUID}).URL
+	return &url
+}
+
+// handlerUsersProfile returns a user's public profile. Users are looked up
+// by handle, with or without the @, or by ID for those without a handle.
+func (cfg *apiConfig) handlerUsersProfile(w http.ResponseWriter, r *http.Request) {
+	handle := strings.TrimPrefix(r.PathValue("handle"), "@")
+
+	var dbUser database.User
+	var err error
+	if id, parseErr := uuid.Parse(handle); parseErr == nil {
+		dbUser, err = cfg.store.GetUserByID(r.Context(), id)
+	} else {
+		dbUser, err = cfg.store.GetUserByHandle(r.Context(), handle)
+	}
+	if err != nil {
+		respondWithDBError(w, r, "User not found", err)
+		return
+	}
+
+	stats, err := cfg.store.GetUserStats(r.Context(), dbUser.ID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get user stats", err)
+		return
+	}
+
+	profile := Profile{
+		ID:             dbUser.ID,
+		CreatedAt:      dbUser.CreatedAt,
+		DisplayName:    dbUser.DisplayName,
+		Bio:            dbUser.Bio,
+		AvatarURL:      avatarURL(dbUser),
+		IsChirpyRed:    dbUser.IsChirpyRed,
+		ChirpCount:     stats.ChirpCount,
+		FollowerCount:  stats.FollowerCount,
+		FollowingCount: stats.FollowingCount,
+	}
+	if dbUser.Handle.Valid {
+		profile.Handle = &dbUser.Handle.String
+	}
+	// the token is optional here, and only used to show the owner their email
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := auth.ValidateJWT(token, cfg.jwtSecret); err == nil && userID == dbUser.ID {
+			profile.Email = dbUser.Email
+		}
+	}
+	respondWithJSON(w, http.StatusOK, profile)
+}
+
+// handlerUsersProfileUpdate changes the fields of the user's profile that
+// are in the request. An empty handle or avatar_media_id removes it.
+func (cfg *apiConfig) handlerUsersProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Handle        *string `json:"handle"`
+		DisplayName   *string `json:"display_name" validate:"max=50"`
+		Bio           *string `json:"bio" validate:"max=160"`
+		AvatarMediaID *string `json:"avatar_media_id"`
+	}
+	type response struct {
+		User
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
+		return
+	}
+
+	arg := database.UpdateUserProfileParams{ID: userID}
+	if params.Handle != nil {
+		if *params.Handle != "" && !entities.ValidHandle(*params.Handle) {
+			respondWithValidationErrors(w, r, validate.Errors{{Field: "handle", Message: invalidHandleMessage}})
+			return
+		}
+		arg.SetHandle = true
+		arg.Handle = sql.NullString{String: *params.Handle, Valid: *params.Handle != ""}
+	}
+	if params.DisplayName != nil {
+		arg.DisplayName = sql.NullString{String: strings.TrimSpace(*params.DisplayName), Valid: true}
+	}
+	if params.Bio != nil {
+		arg.Bio = sql.NullString{String: strings.TrimSpace(*params.Bio), Valid: true}
+	}
+	if params.AvatarMediaID != nil {
+		arg.SetAvatar = true
+		if *params.AvatarMediaID != "" {
+			id, err := uuid.Parse(*params.AvatarMediaID)
+			if err != nil {
+				respondWithValidationErrors(w, r, validate.Errors{{Field: "avatar_media_id", Message: "must be a valid UUID"}})
+				return
+			}
+			avatar, err := cfg.store.GetMediaByID(r.Context(), id)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				respondWithDBError(w, r, "Couldn't get media", err)
+				return
+			}
+			if err != nil || avatar.UserID != userID {
+				respondWithValidationErrors(w, r, validate.Errors{{Field: "avatar_media_id", Message: "must be media you uploaded"}})
+				return
+			}
+			arg.AvatarMediaID = uuid.NullUUID{UUID: id, Valid: true}
+		}
+	}
+
+	dbUser, err := cfg.store.UpdateUserProfile(r.Context(), arg)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't update profile, the handle may already be taken", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response{
+		User: userFromDB(dbUser),
+	})
+}
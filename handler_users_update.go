@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/lordbaldwin1/chirpy/internal/auth"
@@ -10,57 +9,59 @@ import (
 
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"required,email,max=254"`
+		Password string `json:"password" validate:"required,min=8,maxbytes=72"`
 	}
 	type response struct {
 		User
 	}
 
-	accessToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get access token", err)
+	userID, ok := cfg.authenticateAccountOwner(w, r)
+	if !ok {
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid access token", err)
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	var params parameters
-	err = decoder.Decode(&params)
+	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode body", err)
+		respondWithError(w, r, http.StatusInternalServerError, codeInternal, "Couldn't hash password", err)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	oldUser, err := cfg.store.GetUserByID(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+		respondWithDBError(w, r, "Couldn't find user", err)
 		return
 	}
 
-	updatedUser, err := cfg.queries.UpdateUserEmailAndPassword(r.Context(), database.UpdateUserEmailAndPasswordParams{
+	updatedUser, err := cfg.store.UpdateUserEmailAndPassword(r.Context(), database.UpdateUserEmailAndPasswordParams{
 		Email:          params.Email,
 		HashedPassword: hashedPassword,
 		ID:             userID,
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't update email and password", err)
+		respondWithDBError(w, r, "Couldn't update email and password", err)
 		return
 	}
+	details := map[string]any{"email_changed": oldUser.Email != updatedUser.Email}
+	if oldUser.Email != updatedUser.Email {
+		details["old_email"] = oldUser.Email
+		details["new_email"] = updatedUser.Email
+	}
+	cfg.audit(r, auditEvent{
+		Action:     auditUpdateCredentials,
+		ActorID:    userID,
+		TargetType: auditTargetUser,
+		TargetID:   userID,
+		Details:    details,
+	})
 
 	respondWithJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          updatedUser.ID,
-			CreatedAt:   updatedUser.CreatedAt,
-			UpdatedAt:   updatedUser.UpdatedAt,
-			Email:       updatedUser.Email,
-			IsChirpyRed: updatedUser.IsChirpyRed,
-		},
+		User: userFromDB(updatedUser),
 	})
 
 }
@@ -18,38 +18,50 @@ func (cfg *apiConfig) handlerUsersUpgrade(w http.ResponseWriter, r *http.Request
 
 	apiKey, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Failed to get API key", err)
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidAPIKey, "Failed to get API key", err)
 		return
 	}
 
 	if apiKey != cfg.polkaAPIKey {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect Polka API key", err)
+		cfg.audit(r, auditEvent{
+			Action:  auditUpgrade,
+			Failed:  true,
+			Details: map[string]any{"reason": "incorrect API key"},
+		})
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidAPIKey, "Incorrect Polka API key", nil)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
+	// Polka adds fields and doesn't always label its bodies, so unlike our
+	// own endpoints this one takes any JSON that has what it needs
 	var params parameters
-	err = decoder.Decode(&params)
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)).Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to decode request body into JSON", err)
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidJSON, "Couldn't decode webhook body", err)
 		return
 	}
 
+	// acknowledge events we don't care about so Polka stops retrying them
 	if params.Event != "user.upgraded" {
-		respondWithError(w, http.StatusNoContent, "Event not user.upgraded", err)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	userUUID, err := uuid.Parse(params.Data.UserID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to parse userID", err)
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Failed to parse userID", err)
 		return
 	}
 
-	_, err = cfg.queries.UpgradeUserToChirpyRed(r.Context(), userUUID)
+	_, err = cfg.store.UpgradeUserToChirpyRed(r.Context(), userUUID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't find user to upgrade", err)
+		respondWithDBError(w, r, "Couldn't find user to upgrade", err)
 		return
 	}
+	cfg.audit(r, auditEvent{
+		Action:     auditUpgrade,
+		TargetType: auditTargetUser,
+		TargetID:   userUUID,
+	})
 
 	w.WriteHeader(http.StatusNoContent)
 }
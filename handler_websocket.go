@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+)
+
+const (
+	wsPingInterval     = 30 * time.Second
+	wsWriteTimeout     = 10 * time.Second
+	wsMaxMessageBytes  = 4096
+	wsMaxSubscriptions = 100
+
+	// wsStatusTokenExpired closes connections whose token expired without
+	// the client sending a new one.
+	wsStatusTokenExpired websocket.StatusCode = 4001
+	// wsStatusSuspended closes connections of users an admin suspended.
+	wsStatusSuspended websocket.StatusCode = 4003
+)
+
+// Message types a client can send.
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+	wsAuth        = "auth"
+	wsPing        = "ping"
+)
+
+// Topic prefixes a client can subscribe to. "timeline" on its own is every
+// public chirp; the others also have the unlisted and followers-only chirps
+// the user can see.
+const (
+	wsTopicTimeline = "timeline"
+	wsTopicAuthor   = "author:"
+	wsTopicThread   = "thread:"
+)
+
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type      string          `json:"type"`
+	Topic     string          `json:"topic,omitempty"`
+	ID        int64           `json:"id,omitempty"`
+	Event     events.Type     `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Code      errorCode       `json:"code,omitempty"`
+	Detail    string          `json:"detail,omitempty"`
+}
+
+// wsConn is the state of one WebSocket connection. Only the goroutine
+// running serve touches it.
+type wsConn struct {
+	conn      *websocket.Conn
+	userID    uuid.UUID
+	expiresAt time.Time
+	topics    map[string]struct{}
+	// filter is reloaded whenever the client sends a new token, which is
+	// when follows, blocks and mutes made since connecting take effect.
+	filter chirpFilter
+}
+
+// handlerWebSocket upgrades to a WebSocket that pushes chirp events for the
+// topics the client subscribes to, and the authenticated user's
+// notifications. Browsers can't set headers on a WebSocket handshake, so
+// the JWT may also be passed as the access_token query parameter.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		token = r.URL.Query().Get("access_token")
+		if token == "" {
+			respondWithError(w, r, http.StatusUnauthorized, codeMissingToken, "Couldn't find JWT", err)
+			return
+		}
+	} else if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeMissingToken, "Couldn't find JWT", err)
+		return
+	}
+
+	userID, expiresAt, err := auth.ValidateJWTExpiry(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, r, http.StatusUnauthorized, codeInvalidToken, "Couldn't validate JWT", err)
+		return
+	}
+	_, err = activeUser(r.Context(), cfg.store, userID)
+	if errors.Is(err, errAccountSuspended) {
+		respondWithError(w, r, http.StatusForbidden, codeForbidden, "Account suspended", err)
+		return
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithDBError(w, r, "Couldn't get user", err)
+		return
+	}
+
+	filter, err := cfg.loadChirpFilter(r.Context(), uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept has already written the response
+		log.Printf("[%s] Error accepting WebSocket: %s", requestIDFromContext(r.Context()), err)
+		return
+	}
+	conn.SetReadLimit(wsMaxMessageBytes)
+
+	c := &wsConn{
+		conn:      conn,
+		userID:    userID,
+		expiresAt: expiresAt,
+		topics:    map[string]struct{}{},
+		filter:    filter,
+	}
+	c.serve(r.Context(), cfg)
+}
+
+// serve runs the connection until it should be closed, then closes it.
+func (c *wsConn) serve(ctx context.Context, cfg *apiConfig) {
+	sub, _ := cfg.eventHub.Subscribe(0)
+	defer cfg.eventHub.Unsubscribe(sub)
+
+	// Cancelling a read closes the connection without a reason, so reads
+	// outlive ctx and only stop once we've closed it ourselves.
+	readCtx, stopReading := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopReading()
+
+	// reads happen on their own goroutine so pongs are processed while we
+	// wait on everything else
+	incoming := make(chan wsClientMessage)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			var msg wsClientMessage
+			err := wsjson.Read(readCtx, c.conn, &msg)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- msg:
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+
+	status, reason := c.run(ctx, cfg, sub, incoming, readErr)
+	c.conn.Close(status, reason)
+}
+
+// run handles messages and events until the connection should be closed and
+// returns the close status and reason.
+func (c *wsConn) run(ctx context.Context, cfg *apiConfig, sub *events.Subscription, incoming <-chan wsClientMessage, readErr <-chan error) (websocket.StatusCode, string) {
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	expiry := time.NewTimer(time.Until(c.expiresAt))
+	defer expiry.Stop()
+	if c.expiresAt.IsZero() {
+		expiry.Stop()
+	}
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return websocket.StatusGoingAway, "server shutting down"
+		case err := <-readErr:
+			var ce websocket.CloseError
+			if errors.As(err, &ce) {
+				return ce.Code, ""
+			}
+			if errors.Is(err, websocket.ErrMessageTooBig) {
+				return websocket.StatusMessageTooBig, "message too big"
+			}
+			return websocket.StatusUnsupportedData, "messages must be JSON"
+		case msg := <-incoming:
+			oldExpiry := c.expiresAt
+			err = c.handle(ctx, cfg, msg)
+			if !c.expiresAt.Equal(oldExpiry) {
+				expiry.Stop()
+				if !c.expiresAt.IsZero() {
+					expiry.Reset(time.Until(c.expiresAt))
+				}
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				return websocket.StatusTryAgainLater, "too far behind, reconnect"
+			}
+			err = c.deliver(ctx, e)
+		case <-ping.C:
+			// the token outlives a suspension, so check as often as we ping
+			if _, err := activeUser(ctx, cfg.store, c.userID); errors.Is(err, errAccountSuspended) {
+				return wsStatusSuspended, "account suspended"
+			}
+			pingCtx, cancelPing := context.WithTimeout(ctx, wsWriteTimeout)
+			err = c.conn.Ping(pingCtx)
+			cancelPing()
+		case <-expiry.C:
+			return wsStatusTokenExpired, "token expired"
+		}
+		if err != nil {
+			return websocket.StatusInternalError, ""
+		}
+	}
+}
+
+func (c *wsConn) handle(ctx context.Context, cfg *apiConfig, msg wsClientMessage) error {
+	switch msg.Type {
+	case wsSubscribe:
+		topic, ok := parseTopic(msg.Topic)
+		if !ok {
+			return c.sendError(ctx, codeBadRequest, fmt.Sprintf("Unknown topic %q", msg.Topic))
+		}
+		if _, ok := c.topics[topic]; !ok && len(c.topics) >= wsMaxSubscriptions {
+			return c.sendError(ctx, codeBadRequest, fmt.Sprintf("Connections can have at most %d subscriptions", wsMaxSubscriptions))
+		}
+		c.topics[topic] = struct{}{}
+		return c.send(ctx, wsServerMessage{Type: "subscribed", Topic: topic})
+	case wsUnsubscribe:
+		topic, ok := parseTopic(msg.Topic)
+		if !ok {
+			return c.sendError(ctx, codeBadRequest, fmt.Sprintf("Unknown topic %q", msg.Topic))
+		}
+		delete(c.topics, topic)
+		return c.send(ctx, wsServerMessage{Type: "unsubscribed", Topic: topic})
+	case wsAuth:
+		userID, expiresAt, err := auth.ValidateJWTExpiry(msg.Token, cfg.jwtSecret)
+		if err != nil {
+			return c.sendError(ctx, codeInvalidToken, "Couldn't validate JWT")
+		}
+		if userID != c.userID {
+			return c.sendError(ctx, codeForbidden, "Token is for a different user")
+		}
+		_, err = activeUser(ctx, cfg.store, userID)
+		if errors.Is(err, errAccountSuspended) {
+			return c.sendError(ctx, codeForbidden, "Account suspended")
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		c.filter, err = cfg.loadChirpFilter(ctx, uuid.NullUUID{UUID: userID, Valid: true})
+		if err != nil {
+			return err
+		}
+		c.expiresAt = expiresAt
+		resp := wsServerMessage{Type: "authenticated"}
+		if !expiresAt.IsZero() {
+			resp.ExpiresAt = &expiresAt
+		}
+		return c.send(ctx, resp)
+	case wsPing:
+		return c.send(ctx, wsServerMessage{Type: "pong"})
+	default:
+		return c.sendError(ctx, codeBadRequest, fmt.Sprintf("Unknown message type %q", msg.Type))
+	}
+}
+
+// deliver sends e if the connection is subscribed to it, or if it is a
+// notification for this user. Chirps the user can't see are never sent,
+// and mutes apply to the timeline topic as they do to feeds.
+func (c *wsConn) deliver(ctx context.Context, e events.Event) error {
+	if e.Private() {
+		if e.RecipientID != c.userID {
+			return nil
+		}
+		return c.send(ctx, wsServerMessage{Type: "notification", ID: e.ID, Event: e.Type, Data: e.Data})
+	}
+	if !c.filter.canSee(database.Chirp{UserID: e.AuthorID, Visibility: e.Visibility}) {
+		return nil
+	}
+
+	_, byAuthor := c.topics[wsTopicAuthor+e.AuthorID.String()]
+	_, inThread := c.topics[wsTopicThread+e.ThreadID.String()]
+	_, timeline := c.topics[wsTopicTimeline]
+	if byAuthor || inThread || timeline && e.Visibility == visibilityPublic && c.wants(e) {
+		return c.send(ctx, wsServerMessage{Type: "event", ID: e.ID, Event: e.Type, Data: e.Data})
+	}
+	return nil
+}
+
+// wants reports whether the chirp e is about belongs in the user's feeds.
+func (c *wsConn) wants(e events.Event) bool {
+	var chirp struct {
+		Body string `json:"body"`
+	}
+	if len(c.filter.keywords) > 0 {
+		// an event that isn't a chirp has no body to match
+		json.Unmarshal(e.Data, &chirp)
+	}
+	return c.filter.wants(database.Chirp{UserID: e.AuthorID, Body: chirp.Body, Visibility: e.Visibility})
+}
+
+func (c *wsConn) send(ctx context.Context, msg wsServerMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+	defer cancel()
+
+	return wsjson.Write(ctx, c.conn, msg)
+}
+
+func (c *wsConn) sendError(ctx context.Context, code errorCode, detail string) error {
+	return c.send(ctx, wsServerMessage{Type: "error", Code: code, Detail: detail})
+}
+
+// parseTopic returns topic with its ID in canonical form, so it matches the
+// topics events are checked against.
+func parseTopic(topic string) (string, bool) {
+	if topic == wsTopicTimeline {
+		return topic, true
+	}
+	for _, prefix := range []string{wsTopicAuthor, wsTopicThread} {
+		if s, ok := strings.CutPrefix(topic, prefix); ok {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return "", false
+			}
+			return prefix + id.String(), true
+		}
+	}
+	return "", false
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -20,7 +22,13 @@ const (
 	TokenTypeAccess TokenType = "chirpy-access"
 )
 
-var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
+// refreshTokenIDBytes is the length of a refresh token's lookup ID.
+const refreshTokenIDBytes = 8
+
+var (
+	ErrNoAuthHeaderIncluded  = errors.New("no auth header included in request")
+	ErrMalformedRefreshToken = errors.New("malformed refresh token")
+)
 
 func HashPassword(password string) (string, error) {
 	hashed_password, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -54,7 +62,61 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 	return token.SignedString([]byte(tokenSecret))
 }
 
+// actorClaims are the claims of an access token that one user, the actor,
+// was given to act as another, as in RFC 8693.
+type actorClaims struct {
+	jwt.RegisteredClaims
+	Actor *actor `json:"act,omitempty"`
+}
+
+type actor struct {
+	Subject string `json:"sub"`
+}
+
+// MakeImpersonationJWT returns an access token for userID that was issued
+// to actorID. ValidateJWT accepts it like MakeJWT's tokens; callers that
+// must not be impersonated use JWTActor to find out who is really using it.
+func MakeImpersonationJWT(userID, actorID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	claims := actorClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(TokenTypeAccess),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Actor: &actor{Subject: actorID.String()},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+// JWTActor returns the actor of a valid token made by MakeImpersonationJWT.
+// It returns false for any other token.
+func JWTActor(tokenString, tokenSecret string) (uuid.UUID, bool) {
+	claims := actorClaims{}
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		&claims,
+		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
+	)
+	if err != nil || claims.Issuer != string(TokenTypeAccess) || claims.Actor == nil {
+		return uuid.Nil, false
+	}
+	actorID, err := uuid.Parse(claims.Actor.Subject)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return actorID, true
+}
+
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	id, _, err := ValidateJWTExpiry(tokenString, tokenSecret)
+	return id, err
+}
+
+// ValidateJWTExpiry is ValidateJWT that also returns when the token expires,
+// for connections that outlive a single request.
+func ValidateJWTExpiry(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
 	claimsStruct := jwt.RegisteredClaims{}
 
 	// parse and validate the token
@@ -66,30 +128,39 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		func(token *jwt.Token) (any, error) { return []byte(tokenSecret), nil },
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 
 	// extract userID
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 
 	// extracts and checks the issuer is us
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return uuid.Nil, time.Time{}, errors.New("invalid issuer")
 	}
 
 	// convert userID string to uuid and return
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return uuid.Nil, time.Time{}, fmt.Errorf("invalid user ID: %w", err)
 	}
-	return id, nil
+
+	// a token without an expiry never expires; the zero time says so
+	expiresAt, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	if expiresAt == nil {
+		return id, time.Time{}, nil
+	}
+	return id, expiresAt.Time, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -106,15 +177,41 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return strings.TrimPrefix(authHeader, "Bearer "), nil
 }
 
+// MakeRefreshToken returns a new refresh token for the client, made of a
+// lookup ID and a secret. Only the ID and HashRefreshToken of the token are
+// stored, so reading the database isn't enough to use a session.
 func MakeRefreshToken() (string, error) {
-	randomData := make([]byte, 32)
-	_, err := rand.Read(randomData) // makes random 32-byte data
+	randomData := make([]byte, refreshTokenIDBytes+32)
+	_, err := rand.Read(randomData) // the ID, then 32 bytes of secret
 	if err != nil {
 		return "", errors.New("error: failed to make refresh token")
 	}
 
-	refreshToken := hex.EncodeToString(randomData)
-	return refreshToken, nil
+	id := hex.EncodeToString(randomData[:refreshTokenIDBytes])
+	secret := hex.EncodeToString(randomData[refreshTokenIDBytes:])
+	return id + "." + secret, nil
+}
+
+// RefreshTokenID returns the lookup ID of a token made by MakeRefreshToken.
+func RefreshTokenID(token string) (string, error) {
+	id, secret, ok := strings.Cut(token, ".")
+	if !ok || len(id) != 2*refreshTokenIDBytes || secret == "" {
+		return "", ErrMalformedRefreshToken
+	}
+	return id, nil
+}
+
+// HashRefreshToken returns the SHA-256 digest of token that is stored in
+// its place.
+func HashRefreshToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// CheckRefreshTokenHash reports whether token has the stored digest hash,
+// in constant time.
+func CheckRefreshTokenHash(token string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashRefreshToken(token), hash) == 1
 }
 
 func GetAPIKey(headers http.Header) (string, error) {
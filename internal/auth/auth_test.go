@@ -197,6 +197,58 @@ func TestValidateJWT(t *testing.T) {
 	}
 }
 
+func TestValidateJWTExpiry(t *testing.T) {
+	userID := uuid.New()
+	before := time.Now().Truncate(time.Second)
+	token, _ := MakeJWT(userID, "secret", time.Hour)
+
+	gotUserID, expiresAt, err := ValidateJWTExpiry(token, "secret")
+	if err != nil {
+		t.Fatalf("ValidateJWTExpiry() error = %v", err)
+	}
+	if gotUserID != userID {
+		t.Errorf("ValidateJWTExpiry() gotUserID = %v, want %v", gotUserID, userID)
+	}
+	if expiresAt.Before(before.Add(time.Hour)) || expiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("ValidateJWTExpiry() expiresAt = %v, want about an hour from now", expiresAt)
+	}
+
+	expired, _ := MakeJWT(userID, "secret", -time.Minute)
+	_, _, err = ValidateJWTExpiry(expired, "secret")
+	if err == nil {
+		t.Error("ValidateJWTExpiry() accepted an expired token")
+	}
+}
+
+func TestImpersonationJWT(t *testing.T) {
+	userID := uuid.New()
+	actorID := uuid.New()
+	token, err := MakeImpersonationJWT(userID, actorID, "secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeImpersonationJWT() error = %v", err)
+	}
+
+	gotUserID, err := ValidateJWT(token, "secret")
+	if err != nil {
+		t.Fatalf("ValidateJWT() error = %v", err)
+	}
+	if gotUserID != userID {
+		t.Errorf("ValidateJWT() gotUserID = %v, want %v", gotUserID, userID)
+	}
+	gotActorID, ok := JWTActor(token, "secret")
+	if !ok || gotActorID != actorID {
+		t.Errorf("JWTActor() = %v, %v, want %v, true", gotActorID, ok, actorID)
+	}
+
+	if _, ok := JWTActor(token, "wrong_secret"); ok {
+		t.Error("JWTActor() accepted a token signed with the wrong secret")
+	}
+	plain, _ := MakeJWT(userID, "secret", time.Hour)
+	if _, ok := JWTActor(plain, "secret"); ok {
+		t.Error("JWTActor() found an actor in an ordinary token")
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	type testCase struct {
 		name    string
@@ -305,3 +357,47 @@ func TestGetBearerToken2(t *testing.T) {
 		})
 	}
 }
+
+func TestRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken() unexpected error: %v", err)
+	}
+	id, err := RefreshTokenID(token)
+	if err != nil {
+		t.Fatalf("RefreshTokenID() unexpected error: %v", err)
+	}
+	hash := HashRefreshToken(token)
+
+	tests := []struct {
+		name      string
+		token     string
+		wantID    bool
+		wantMatch bool
+	}{
+		{name: "same token", token: token, wantID: true, wantMatch: true},
+		{name: "other secret", token: id + ".0000", wantID: true, wantMatch: false},
+		{name: "no secret", token: id + ".", wantID: false, wantMatch: false},
+		{name: "no separator", token: id, wantID: false, wantMatch: false},
+		{name: "short ID", token: "abc.def", wantID: false, wantMatch: false},
+		{name: "empty", token: "", wantID: false, wantMatch: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, err := RefreshTokenID(tt.token)
+			if (err == nil) != tt.wantID {
+				t.Errorf("RefreshTokenID(%q) error = %v, want ID %v", tt.token, err, tt.wantID)
+			}
+			if err == nil && gotID != id {
+				t.Errorf("RefreshTokenID(%q) = %q, want %q", tt.token, gotID, id)
+			}
+			if got := CheckRefreshTokenHash(tt.token, hash); got != tt.wantMatch {
+				t.Errorf("CheckRefreshTokenHash(%q) = %v, want %v", tt.token, got, tt.wantMatch)
+			}
+		})
+	}
+
+	if other, _ := MakeRefreshToken(); other == token {
+		t.Errorf("MakeRefreshToken() returned the same token twice")
+	}
+}
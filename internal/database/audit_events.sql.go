@@ -0,0 +1,134 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: audit_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const createAuditEvent = `-- name: CreateAuditEvent :one
+INSERT INTO audit_events (id, created_at, action, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, created_at, action, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details
+`
+
+type CreateAuditEventParams struct {
+	Action     string
+	Outcome    string
+	ActorID    uuid.NullUUID
+	TargetType sql.NullString
+	TargetID   uuid.NullUUID
+	IP         string
+	UserAgent  string
+	RequestID  string
+	Details    json.RawMessage
+}
+
+func (q *Queries) CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) (AuditEvent, error) {
+	row := q.db.QueryRowContext(ctx, createAuditEvent,
+		arg.Action,
+		arg.Outcome,
+		arg.ActorID,
+		arg.TargetType,
+		arg.TargetID,
+		arg.IP,
+		arg.UserAgent,
+		arg.RequestID,
+		arg.Details,
+	)
+	var i AuditEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Action,
+		&i.Outcome,
+		&i.ActorID,
+		&i.TargetType,
+		&i.TargetID,
+		&i.IP,
+		&i.UserAgent,
+		&i.RequestID,
+		&i.Details,
+	)
+	return i, err
+}
+
+const getAuditEvents = `-- name: GetAuditEvents :many
+SELECT id, created_at, action, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details FROM audit_events
+WHERE ($1::text IS NULL OR audit_events.action = $1)
+  AND ($2::text IS NULL OR audit_events.outcome = $2)
+  AND ($3::uuid IS NULL OR audit_events.actor_id = $3)
+  AND ($4::uuid IS NULL OR audit_events.target_id = $4)
+  AND ($5::timestamp IS NULL OR audit_events.created_at >= $5)
+  AND ($6::timestamp IS NULL OR audit_events.created_at < $6)
+  AND (
+    $7::uuid IS NULL
+    OR (audit_events.created_at, audit_events.id) < (SELECT a.created_at, a.id FROM audit_events AS a WHERE a.id = $7)
+  )
+ORDER BY audit_events.created_at DESC, audit_events.id DESC
+LIMIT $8
+`
+
+type GetAuditEventsParams struct {
+	Action     sql.NullString
+	Outcome    sql.NullString
+	ActorID    uuid.NullUUID
+	TargetID   uuid.NullUUID
+	Since      sql.NullTime
+	Until      sql.NullTime
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Newest first, filtered by whichever of the arguments are set. before is
+// the last event of the previous page.
+func (q *Queries) GetAuditEvents(ctx context.Context, arg GetAuditEventsParams) ([]AuditEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getAuditEvents,
+		arg.Action,
+		arg.Outcome,
+		arg.ActorID,
+		arg.TargetID,
+		arg.Since,
+		arg.Until,
+		arg.Before,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditEvent
+	for rows.Next() {
+		var i AuditEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.Action,
+			&i.Outcome,
+			&i.ActorID,
+			&i.TargetType,
+			&i.TargetID,
+			&i.IP,
+			&i.UserAgent,
+			&i.RequestID,
+			&i.Details,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,143 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: blocks.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const blockExists = `-- name: BlockExists :one
+SELECT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocker_id = $1 AND blocked_id = $2)
+    OR (blocker_id = $2 AND blocked_id = $1)
+)
+`
+
+type BlockExistsParams struct {
+	UserID  uuid.UUID
+	OtherID uuid.UUID
+}
+
+// Whether either user blocked the other.
+func (q *Queries) BlockExists(ctx context.Context, arg BlockExistsParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, blockExists, arg.UserID, arg.OtherID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const createBlock = `-- name: CreateBlock :execrows
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type CreateBlockParams struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+}
+
+// Affects no rows if the user already blocked them.
+func (q *Queries) CreateBlock(ctx context.Context, arg CreateBlockParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createBlock, arg.BlockerID, arg.BlockedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteBlock = `-- name: DeleteBlock :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2
+`
+
+type DeleteBlockParams struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+}
+
+func (q *Queries) DeleteBlock(ctx context.Context, arg DeleteBlockParams) error {
+	_, err := q.db.ExecContext(ctx, deleteBlock, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const getBlockRelatedUserIDs = `-- name: GetBlockRelatedUserIDs :many
+SELECT (CASE WHEN blocker_id = $1 THEN blocked_id ELSE blocker_id END)::uuid AS user_id
+FROM blocks
+WHERE blocker_id = $1 OR blocked_id = $1
+`
+
+// Everyone the user blocked or was blocked by.
+func (q *Queries) GetBlockRelatedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getBlockRelatedUserIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getBlockedUsers = `-- name: GetBlockedUsers :many
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.handle, users.is_admin, users.display_name, users.bio, users.avatar_media_id, users.deletion_scheduled_at, users.suspended_at FROM users
+JOIN blocks ON blocks.blocked_id = users.id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC
+`
+
+// Newest block first.
+func (q *Queries) GetBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getBlockedUsers, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.IsAdmin,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarMediaID,
+			&i.DeletionScheduledAt,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,190 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: chirp_entities.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createChirpHashtag = `-- name: CreateChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, tag)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type CreateChirpHashtagParams struct {
+	ChirpID uuid.UUID
+	Tag     string
+}
+
+func (q *Queries) CreateChirpHashtag(ctx context.Context, arg CreateChirpHashtagParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpHashtag, arg.ChirpID, arg.Tag)
+	return err
+}
+
+const createChirpMention = `-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type CreateChirpMentionParams struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+func (q *Queries) CreateChirpMention(ctx context.Context, arg CreateChirpMentionParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpMention, arg.ChirpID, arg.UserID)
+	return err
+}
+
+const getChirpMentions = `-- name: GetChirpMentions :many
+SELECT chirp_mentions.chirp_id, lower(users.handle)::text AS handle
+FROM chirp_mentions
+JOIN users ON users.id = chirp_mentions.user_id
+WHERE chirp_mentions.chirp_id = ANY($1::uuid[])
+  AND users.handle IS NOT NULL
+ORDER BY chirp_mentions.chirp_id, handle
+`
+
+type GetChirpMentionsRow struct {
+	ChirpID uuid.UUID
+	Handle  string
+}
+
+// The lower-cased handles of the users each chirp mentions. Users without a
+// handle any more are left out, since nothing in the body refers to them.
+func (q *Queries) GetChirpMentions(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpMentionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpMentions, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpMentionsRow
+	for rows.Next() {
+		var i GetChirpMentionsRow
+		if err := rows.Scan(&i.ChirpID, &i.Handle); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByHashtag = `-- name: GetChirpsByHashtag :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.reply_to_id, chirps.thread_id, chirps.hidden_at, chirps.visibility FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = $1
+  AND chirps.visibility = 'public'
+  AND (
+    $2::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = $2)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $3
+`
+
+type GetChirpsByHashtagParams struct {
+	Tag        string
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Public chirps only, newest first. before is the last chirp of the
+// previous page.
+func (q *Queries) GetChirpsByHashtag(ctx context.Context, arg GetChirpsByHashtagParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByHashtag, arg.Tag, arg.Before, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsMentioningUser = `-- name: GetChirpsMentioningUser :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.reply_to_id, chirps.thread_id, chirps.hidden_at, chirps.visibility FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = $1
+  AND (
+    $2::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = $2)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $3
+`
+
+type GetChirpsMentioningUserParams struct {
+	UserID     uuid.UUID
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Newest first. before is the last chirp of the previous page.
+func (q *Queries) GetChirpsMentioningUser(ctx context.Context, arg GetChirpsMentioningUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsMentioningUser, arg.UserID, arg.Before, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,76 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: chirp_likes.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createChirpLike = `-- name: CreateChirpLike :execrows
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type CreateChirpLikeParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+// Affects no rows if the user already likes the chirp.
+func (q *Queries) CreateChirpLike(ctx context.Context, arg CreateChirpLikeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createChirpLike, arg.UserID, arg.ChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteChirpLike = `-- name: DeleteChirpLike :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2
+`
+
+type DeleteChirpLikeParams struct {
+	UserID  uuid.UUID
+	ChirpID uuid.UUID
+}
+
+func (q *Queries) DeleteChirpLike(ctx context.Context, arg DeleteChirpLikeParams) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpLike, arg.UserID, arg.ChirpID)
+	return err
+}
+
+const getChirpLikesByUserID = `-- name: GetChirpLikesByUserID :many
+SELECT user_id, chirp_id, created_at FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetChirpLikesByUserID(ctx context.Context, userID uuid.UUID) ([]ChirpLike, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpLikesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpLike
+	for rows.Next() {
+		var i ChirpLike
+		if err := rows.Scan(&i.UserID, &i.ChirpID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
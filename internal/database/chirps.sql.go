@@ -12,18 +12,29 @@ import (
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, thread_id, visibility)
+SELECT new_chirp.id, NOW(), NOW(), $1, $2, $3, COALESCE(parent.thread_id, new_chirp.id), $4
+FROM (SELECT gen_random_uuid() AS id) AS new_chirp
+LEFT JOIN chirps AS parent ON parent.id = $3
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	ReplyToID  uuid.NullUUID
+	Visibility string
 }
 
+// A reply joins the thread of the chirp it replies to; anything else starts
+// a new thread.
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.ReplyToID,
+		arg.Visibility,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -31,6 +42,10 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.HiddenAt,
+		&i.Visibility,
 	)
 	return i, err
 }
@@ -51,10 +66,12 @@ func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) error
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility FROM chirps
+WHERE visibility = 'public'
 ORDER BY created_at ASC
 `
 
+// Only public chirps are listed.
 func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	rows, err := q.db.QueryContext(ctx, getChirps)
 	if err != nil {
@@ -70,6 +87,10 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
 		); err != nil {
 			return nil, err
 		}
@@ -85,7 +106,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC
 `
@@ -105,6 +126,10 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
 		); err != nil {
 			return nil, err
 		}
@@ -120,7 +145,7 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 }
 
 const getChirpsByID = `-- name: GetChirpsByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility FROM chirps
 WHERE id = $1
 `
 
@@ -133,6 +158,134 @@ func (q *Queries) GetChirpsByID(ctx context.Context, id uuid.UUID) (Chirp, error
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.HiddenAt,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const getChirpsByThreadID = `-- name: GetChirpsByThreadID :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility FROM chirps
+WHERE thread_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) GetChirpsByThreadID(ctx context.Context, threadID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByThreadID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTimeline = `-- name: GetTimeline :many
+SELECT id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility FROM chirps
+WHERE (
+    chirps.user_id = $1
+    OR chirps.user_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+  )
+  AND (
+    $2::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = $2)
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $3
+`
+
+type GetTimelineParams struct {
+	UserID     uuid.UUID
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// The user's own chirps and those of everyone they follow, newest first.
+// before is the last chirp of the previous page.
+func (q *Queries) GetTimeline(ctx context.Context, arg GetTimelineParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getTimeline, arg.UserID, arg.Before, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ReplyToID,
+			&i.ThreadID,
+			&i.HiddenAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setChirpHidden = `-- name: SetChirpHidden :one
+UPDATE chirps
+SET hidden_at = CASE WHEN $1::bool THEN COALESCE(hidden_at, NOW()) END
+WHERE id = $2
+RETURNING id, created_at, updated_at, body, user_id, reply_to_id, thread_id, hidden_at, visibility
+`
+
+type SetChirpHiddenParams struct {
+	Hidden bool
+	ID     uuid.UUID
+}
+
+// Hiding an already hidden chirp keeps the original hidden_at.
+func (q *Queries) SetChirpHidden(ctx context.Context, arg SetChirpHiddenParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, setChirpHidden, arg.Hidden, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ReplyToID,
+		&i.ThreadID,
+		&i.HiddenAt,
+		&i.Visibility,
 	)
 	return i, err
 }
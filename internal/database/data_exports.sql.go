@@ -0,0 +1,196 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: data_exports.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimDataExport = `-- name: ClaimDataExport :one
+UPDATE data_exports
+SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT queued.id FROM data_exports AS queued
+    WHERE queued.status = 'pending'
+      OR (queued.status = 'running' AND queued.started_at < $1::timestamp)
+    ORDER BY queued.created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING id, created_at, user_id, status, started_at, completed_at, expires_at, size_bytes
+`
+
+// Claims the oldest pending export, or one left running since stale_before
+// by a worker that died. Concurrent workers skip each other's claims.
+func (q *Queries) ClaimDataExport(ctx context.Context, staleBefore time.Time) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, claimDataExport, staleBefore)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+		&i.SizeBytes,
+	)
+	return i, err
+}
+
+const completeDataExport = `-- name: CompleteDataExport :one
+UPDATE data_exports
+SET status = 'ready', completed_at = NOW(), expires_at = $1::timestamp, size_bytes = $2::bigint
+WHERE id = $3
+RETURNING id, created_at, user_id, status, started_at, completed_at, expires_at, size_bytes
+`
+
+type CompleteDataExportParams struct {
+	ExpiresAt time.Time
+	SizeBytes int64
+	ID        uuid.UUID
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, completeDataExport, arg.ExpiresAt, arg.SizeBytes, arg.ID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+		&i.SizeBytes,
+	)
+	return i, err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, user_id, status)
+VALUES (gen_random_uuid(), NOW(), $1, 'pending')
+RETURNING id, created_at, user_id, status, started_at, completed_at, expires_at, size_bytes
+`
+
+func (q *Queries) CreateDataExport(ctx context.Context, userID uuid.UUID) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, createDataExport, userID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+		&i.SizeBytes,
+	)
+	return i, err
+}
+
+const deleteExpiredDataExports = `-- name: DeleteExpiredDataExports :many
+DELETE FROM data_exports
+WHERE expires_at <= $1::timestamp
+RETURNING id
+`
+
+func (q *Queries) DeleteExpiredDataExports(ctx context.Context, expiredBefore time.Time) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, deleteExpiredDataExports, expiredBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, failDataExport, id)
+	return err
+}
+
+const getDataExportsByUserID = `-- name: GetDataExportsByUserID :many
+SELECT id, created_at, user_id, status, started_at, completed_at, expires_at, size_bytes FROM data_exports
+WHERE user_id = $1
+`
+
+func (q *Queries) GetDataExportsByUserID(ctx context.Context, userID uuid.UUID) ([]DataExport, error) {
+	rows, err := q.db.QueryContext(ctx, getDataExportsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DataExport
+	for rows.Next() {
+		var i DataExport
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Status,
+			&i.StartedAt,
+			&i.CompletedAt,
+			&i.ExpiresAt,
+			&i.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestDataExport = `-- name: GetLatestDataExport :one
+SELECT id, created_at, user_id, status, started_at, completed_at, expires_at, size_bytes FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestDataExport(ctx context.Context, userID uuid.UUID) (DataExport, error) {
+	row := q.db.QueryRowContext(ctx, getLatestDataExport, userID)
+	var i DataExport
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+		&i.SizeBytes,
+	)
+	return i, err
+}
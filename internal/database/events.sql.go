@@ -0,0 +1,35 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: events.sql
+
+package database
+
+import (
+	"context"
+)
+
+const nextEventID = `-- name: NextEventID :one
+SELECT nextval('event_ids')::bigint AS id
+`
+
+func (q *Queries) NextEventID(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, nextEventID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const notifyEvent = `-- name: NotifyEvent :exec
+SELECT pg_notify($1::text, $2::text)
+`
+
+type NotifyEventParams struct {
+	Channel string
+	Payload string
+}
+
+func (q *Queries) NotifyEvent(ctx context.Context, arg NotifyEventParams) error {
+	_, err := q.db.ExecContext(ctx, notifyEvent, arg.Channel, arg.Payload)
+	return err
+}
@@ -0,0 +1,282 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: jobs.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimJob = `-- name: ClaimJob :one
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_until = $1::timestamp, updated_at = NOW()
+WHERE id = (
+    SELECT queued.id FROM jobs AS queued
+    WHERE (queued.status = 'pending' AND queued.run_at <= $2::timestamp)
+      OR (queued.status = 'running' AND queued.locked_until < $2::timestamp AND queued.attempts < queued.max_attempts)
+    ORDER BY queued.run_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error
+`
+
+type ClaimJobParams struct {
+	LockedUntil time.Time
+	Now         time.Time
+}
+
+// Claims the pending job that has been due longest, or a running one whose
+// worker died without finishing it by locked_until and which has attempts
+// left. Concurrent workers skip each other's claims. Claiming counts as an
+// attempt.
+func (q *Queries) ClaimJob(ctx context.Context, arg ClaimJobParams) (Job, error) {
+	row := q.db.QueryRowContext(ctx, claimJob, arg.LockedUntil, arg.Now)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const completeJob = `-- name: CompleteJob :execrows
+DELETE FROM jobs
+WHERE id = $1 AND attempts = $2 AND status = 'running'
+`
+
+type CompleteJobParams struct {
+	ID       uuid.UUID
+	Attempts int32
+}
+
+// The attempt must match the claim, so a worker whose lease ran out can't
+// finish a job someone else has since claimed.
+func (q *Queries) CompleteJob(ctx context.Context, arg CompleteJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeJob, arg.ID, arg.Attempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createJob = `-- name: CreateJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, max_attempts, run_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, 'pending', $3, $4::timestamp)
+RETURNING id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error
+`
+
+type CreateJobParams struct {
+	Kind        string
+	Payload     json.RawMessage
+	MaxAttempts int32
+	RunAt       time.Time
+}
+
+func (q *Queries) CreateJob(ctx context.Context, arg CreateJobParams) (Job, error) {
+	row := q.db.QueryRowContext(ctx, createJob,
+		arg.Kind,
+		arg.Payload,
+		arg.MaxAttempts,
+		arg.RunAt,
+	)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const getJobByID = `-- name: GetJobByID :one
+SELECT id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error FROM jobs
+WHERE id = $1
+`
+
+func (q *Queries) GetJobByID(ctx context.Context, id uuid.UUID) (Job, error) {
+	row := q.db.QueryRowContext(ctx, getJobByID, id)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const getJobs = `-- name: GetJobs :many
+SELECT id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error FROM jobs
+WHERE ($1::text IS NULL OR jobs.status = $1)
+  AND (
+    $2::uuid IS NULL
+    OR (jobs.created_at, jobs.id) < (SELECT j.created_at, j.id FROM jobs AS j WHERE j.id = $2)
+  )
+ORDER BY jobs.created_at DESC, jobs.id DESC
+LIMIT $3
+`
+
+type GetJobsParams struct {
+	Status     sql.NullString
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Newest first, optionally only those with status. before is the last job
+// of the previous page.
+func (q *Queries) GetJobs(ctx context.Context, arg GetJobsParams) ([]Job, error) {
+	rows, err := q.db.QueryContext(ctx, getJobs, arg.Status, arg.Before, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Job
+	for rows.Next() {
+		var i Job
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Kind,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.MaxAttempts,
+			&i.RunAt,
+			&i.LockedUntil,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const killExpiredJobs = `-- name: KillExpiredJobs :execrows
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = 'lease expired', updated_at = NOW()
+WHERE status = 'running' AND locked_until < $1::timestamp AND attempts >= max_attempts
+`
+
+// Kills running jobs whose worker died without finishing them by
+// locked_until and which have no attempts left, such as a job that
+// crashes the process every time it runs.
+func (q *Queries) KillExpiredJobs(ctx context.Context, now time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, killExpiredJobs, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const killJob = `-- name: KillJob :execrows
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = $1::text, updated_at = NOW()
+WHERE id = $2 AND attempts = $3 AND status = 'running'
+`
+
+type KillJobParams struct {
+	LastError string
+	ID        uuid.UUID
+	Attempts  int32
+}
+
+func (q *Queries) KillJob(ctx context.Context, arg KillJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, killJob, arg.LastError, arg.ID, arg.Attempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requeueJob = `-- name: RequeueJob :one
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'dead'
+RETURNING id, created_at, updated_at, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error
+`
+
+// Gives a dead job a fresh set of attempts, starting now.
+func (q *Queries) RequeueJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	row := q.db.QueryRowContext(ctx, requeueJob, id)
+	var i Job
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Kind,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.MaxAttempts,
+		&i.RunAt,
+		&i.LockedUntil,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const retryJob = `-- name: RetryJob :execrows
+UPDATE jobs
+SET status = 'pending', run_at = $1::timestamp, locked_until = NULL, last_error = $2::text, updated_at = NOW()
+WHERE id = $3 AND attempts = $4 AND status = 'running'
+`
+
+type RetryJobParams struct {
+	RunAt     time.Time
+	LastError string
+	ID        uuid.UUID
+	Attempts  int32
+}
+
+func (q *Queries) RetryJob(ctx context.Context, arg RetryJobParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, retryJob,
+		arg.RunAt,
+		arg.LastError,
+		arg.ID,
+		arg.Attempts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,23 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: locks.sql
+
+package database
+
+import (
+	"context"
+)
+
+const tryAdvisoryXactLock = `-- name: TryAdvisoryXactLock :one
+SELECT pg_try_advisory_xact_lock($1::bigint) AS locked
+`
+
+// Takes a lock held until the end of the transaction, or returns false
+// straight away if another transaction has it.
+func (q *Queries) TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error) {
+	row := q.db.QueryRowContext(ctx, tryAdvisoryXactLock, key)
+	var locked bool
+	err := row.Scan(&locked)
+	return locked, err
+}
@@ -0,0 +1,211 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: media.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const createChirpMedia = `-- name: CreateChirpMedia :exec
+INSERT INTO chirp_media (chirp_id, media_id, position)
+VALUES ($1, $2, $3)
+`
+
+type CreateChirpMediaParams struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int16
+}
+
+func (q *Queries) CreateChirpMedia(ctx context.Context, arg CreateChirpMediaParams) error {
+	_, err := q.db.ExecContext(ctx, createChirpMedia, arg.ChirpID, arg.MediaID, arg.Position)
+	return err
+}
+
+const createMedia = `-- name: CreateMedia :one
+INSERT INTO media (id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes
+`
+
+type CreateMediaParams struct {
+	ID                   uuid.UUID
+	UserID               uuid.UUID
+	ContentType          string
+	ThumbnailContentType string
+	Width                int32
+	Height               int32
+	SizeBytes            int64
+}
+
+func (q *Queries) CreateMedia(ctx context.Context, arg CreateMediaParams) (Media, error) {
+	row := q.db.QueryRowContext(ctx, createMedia,
+		arg.ID,
+		arg.UserID,
+		arg.ContentType,
+		arg.ThumbnailContentType,
+		arg.Width,
+		arg.Height,
+		arg.SizeBytes,
+	)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ContentType,
+		&i.ThumbnailContentType,
+		&i.Width,
+		&i.Height,
+		&i.SizeBytes,
+	)
+	return i, err
+}
+
+const getChirpMedia = `-- name: GetChirpMedia :many
+SELECT chirp_media.chirp_id, media.id, media.created_at, media.user_id, media.content_type, media.thumbnail_content_type, media.width, media.height, media.size_bytes
+FROM chirp_media
+JOIN media ON media.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY($1::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position
+`
+
+type GetChirpMediaRow struct {
+	ChirpID uuid.UUID
+	Media   Media
+}
+
+func (q *Queries) GetChirpMedia(ctx context.Context, chirpIds []uuid.UUID) ([]GetChirpMediaRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpMedia, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpMediaRow
+	for rows.Next() {
+		var i GetChirpMediaRow
+		if err := rows.Scan(
+			&i.ChirpID,
+			&i.Media.ID,
+			&i.Media.CreatedAt,
+			&i.Media.UserID,
+			&i.Media.ContentType,
+			&i.Media.ThumbnailContentType,
+			&i.Media.Width,
+			&i.Media.Height,
+			&i.Media.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMediaByID = `-- name: GetMediaByID :one
+SELECT id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes FROM media
+WHERE id = $1
+`
+
+func (q *Queries) GetMediaByID(ctx context.Context, id uuid.UUID) (Media, error) {
+	row := q.db.QueryRowContext(ctx, getMediaByID, id)
+	var i Media
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ContentType,
+		&i.ThumbnailContentType,
+		&i.Width,
+		&i.Height,
+		&i.SizeBytes,
+	)
+	return i, err
+}
+
+const getMediaByIDs = `-- name: GetMediaByIDs :many
+SELECT id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes FROM media
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetMediaByIDs(ctx context.Context, ids []uuid.UUID) ([]Media, error) {
+	rows, err := q.db.QueryContext(ctx, getMediaByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Media
+	for rows.Next() {
+		var i Media
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.ContentType,
+			&i.ThumbnailContentType,
+			&i.Width,
+			&i.Height,
+			&i.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMediaByUserID = `-- name: GetMediaByUserID :many
+SELECT id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes FROM media
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetMediaByUserID(ctx context.Context, userID uuid.UUID) ([]Media, error) {
+	rows, err := q.db.QueryContext(ctx, getMediaByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Media
+	for rows.Next() {
+		var i Media
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.ContentType,
+			&i.ThumbnailContentType,
+			&i.Width,
+			&i.Height,
+			&i.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
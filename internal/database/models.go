@@ -6,33 +6,196 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	Action     string
+	Outcome    string
+	ActorID    uuid.NullUUID
+	TargetType sql.NullString
+	TargetID   uuid.NullUUID
+	IP         string
+	UserAgent  string
+	RequestID  string
+	Details    json.RawMessage
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	ReplyToID  uuid.NullUUID
+	ThreadID   uuid.UUID
+	HiddenAt   sql.NullTime
+	Visibility string
+}
+
+type ChirpHashtag struct {
+	ChirpID uuid.UUID
+	Tag     string
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMedia struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int16
+}
+
+type ChirpMention struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	StartedAt   sql.NullTime
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+	SizeBytes   sql.NullInt64
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Job struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string
+	Payload     json.RawMessage
+	Status      string
+	Attempts    int32
+	MaxAttempts int32
+	RunAt       time.Time
+	LockedUntil sql.NullTime
+	LastError   sql.NullString
+}
+
+type Media struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UserID               uuid.UUID
+	ContentType          string
+	ThumbnailContentType string
+	Width                int32
+	Height               int32
+	SizeBytes            int64
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type MutedKeyword struct {
+	UserID    uuid.UUID
+	Keyword   string
+	CreatedAt time.Time
+}
+
+type Notification struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
 	UserID    uuid.UUID
+	ActorID   uuid.UUID
+	Type      string
+	ChirpID   uuid.NullUUID
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID    uuid.UUID
+	UpdatedAt time.Time
+	Mentions  bool
+	Replies   bool
+	Likes     bool
+	Follows   bool
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
-	Token     string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	ID        string
+	TokenHash []byte
+}
+
+type ScheduledChirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Body       string
+	ReplyToID  uuid.NullUUID
+	Visibility string
+	MediaIds   []uuid.UUID
+	PublishAt  sql.NullTime
+	Attempts   int32
+	LastError  sql.NullString
+}
+
+type TrendingChirp struct {
+	Period     string
+	ChirpID    uuid.UUID
+	Score      float64
+	ComputedAt time.Time
+}
+
+type TrendingHashtag struct {
+	Period     string
+	Tag        string
+	Score      float64
+	ComputedAt time.Time
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	Handle              sql.NullString
+	IsAdmin             bool
+	DisplayName         string
+	Bio                 string
+	AvatarMediaID       uuid.NullUUID
+	DeletionScheduledAt sql.NullTime
+	SuspendedAt         sql.NullTime
 }
@@ -0,0 +1,184 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: mutes.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createMute = `-- name: CreateMute :execrows
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type CreateMuteParams struct {
+	MuterID uuid.UUID
+	MutedID uuid.UUID
+}
+
+// Affects no rows if the user already muted them.
+func (q *Queries) CreateMute(ctx context.Context, arg CreateMuteParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createMute, arg.MuterID, arg.MutedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createMutedKeyword = `-- name: CreateMutedKeyword :execrows
+INSERT INTO muted_keywords (user_id, keyword, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING
+`
+
+type CreateMutedKeywordParams struct {
+	UserID  uuid.UUID
+	Keyword string
+}
+
+// Affects no rows if the user already muted the keyword.
+func (q *Queries) CreateMutedKeyword(ctx context.Context, arg CreateMutedKeywordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, createMutedKeyword, arg.UserID, arg.Keyword)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteMute = `-- name: DeleteMute :exec
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2
+`
+
+type DeleteMuteParams struct {
+	MuterID uuid.UUID
+	MutedID uuid.UUID
+}
+
+func (q *Queries) DeleteMute(ctx context.Context, arg DeleteMuteParams) error {
+	_, err := q.db.ExecContext(ctx, deleteMute, arg.MuterID, arg.MutedID)
+	return err
+}
+
+const deleteMutedKeyword = `-- name: DeleteMutedKeyword :exec
+DELETE FROM muted_keywords
+WHERE user_id = $1 AND keyword = $2
+`
+
+type DeleteMutedKeywordParams struct {
+	UserID  uuid.UUID
+	Keyword string
+}
+
+func (q *Queries) DeleteMutedKeyword(ctx context.Context, arg DeleteMutedKeywordParams) error {
+	_, err := q.db.ExecContext(ctx, deleteMutedKeyword, arg.UserID, arg.Keyword)
+	return err
+}
+
+const getMutedKeywords = `-- name: GetMutedKeywords :many
+SELECT user_id, keyword, created_at FROM muted_keywords
+WHERE user_id = $1
+ORDER BY keyword
+`
+
+func (q *Queries) GetMutedKeywords(ctx context.Context, userID uuid.UUID) ([]MutedKeyword, error) {
+	rows, err := q.db.QueryContext(ctx, getMutedKeywords, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []MutedKeyword
+	for rows.Next() {
+		var i MutedKeyword
+		if err := rows.Scan(&i.UserID, &i.Keyword, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMutedUserIDs = `-- name: GetMutedUserIDs :many
+SELECT muted_id FROM mutes
+WHERE muter_id = $1
+`
+
+func (q *Queries) GetMutedUserIDs(ctx context.Context, muterID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getMutedUserIDs, muterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var muted_id uuid.UUID
+		if err := rows.Scan(&muted_id); err != nil {
+			return nil, err
+		}
+		items = append(items, muted_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMutedUsers = `-- name: GetMutedUsers :many
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.handle, users.is_admin, users.display_name, users.bio, users.avatar_media_id, users.deletion_scheduled_at, users.suspended_at FROM users
+JOIN mutes ON mutes.muted_id = users.id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC
+`
+
+// Newest mute first.
+func (q *Queries) GetMutedUsers(ctx context.Context, muterID uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getMutedUsers, muterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.IsAdmin,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarMediaID,
+			&i.DeletionScheduledAt,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
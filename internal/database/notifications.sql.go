@@ -0,0 +1,246 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: notifications.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const countUnreadNotifications = `-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE notifications.user_id = $1 AND notifications.read_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+      OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id AND mutes.muted_id = notifications.actor_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM muted_keywords
+    JOIN chirps ON chirps.id = notifications.chirp_id
+    WHERE muted_keywords.user_id = notifications.user_id
+      AND strpos(lower(chirps.body), muted_keywords.keyword) > 0
+  )
+`
+
+// Leaves out the same notifications as GetNotifications.
+func (q *Queries) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnreadNotifications, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createNotification = `-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, user_id, actor_id, type, chirp_id)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4)
+RETURNING id, created_at, user_id, actor_id, type, chirp_id, read_at
+`
+
+type CreateNotificationParams struct {
+	UserID  uuid.UUID
+	ActorID uuid.UUID
+	Type    string
+	ChirpID uuid.NullUUID
+}
+
+func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotificationParams) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, createNotification,
+		arg.UserID,
+		arg.ActorID,
+		arg.Type,
+		arg.ChirpID,
+	)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ActorID,
+		&i.Type,
+		&i.ChirpID,
+		&i.ReadAt,
+	)
+	return i, err
+}
+
+const getNotificationPreferences = `-- name: GetNotificationPreferences :one
+SELECT user_id, updated_at, mentions, replies, likes, follows FROM notification_preferences
+WHERE user_id = $1
+`
+
+func (q *Queries) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) (NotificationPreference, error) {
+	row := q.db.QueryRowContext(ctx, getNotificationPreferences, userID)
+	var i NotificationPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.UpdatedAt,
+		&i.Mentions,
+		&i.Replies,
+		&i.Likes,
+		&i.Follows,
+	)
+	return i, err
+}
+
+const getNotifications = `-- name: GetNotifications :many
+SELECT id, created_at, user_id, actor_id, type, chirp_id, read_at FROM notifications
+WHERE notifications.user_id = $1
+  AND (NOT $2::bool OR notifications.read_at IS NULL)
+  AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+      OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id AND mutes.muted_id = notifications.actor_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM muted_keywords
+    JOIN chirps ON chirps.id = notifications.chirp_id
+    WHERE muted_keywords.user_id = notifications.user_id
+      AND strpos(lower(chirps.body), muted_keywords.keyword) > 0
+  )
+  AND (
+    $3::uuid IS NULL
+    OR (notifications.created_at, notifications.id) < (SELECT n.created_at, n.id FROM notifications AS n WHERE n.id = $3)
+  )
+ORDER BY notifications.created_at DESC, notifications.id DESC
+LIMIT $4
+`
+
+type GetNotificationsParams struct {
+	UserID     uuid.UUID
+	UnreadOnly bool
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Newest first. before is the last notification of the previous page.
+// Notifications from users blocked either way or muted, or about chirps
+// with a muted keyword, are left out.
+func (q *Queries) GetNotifications(ctx context.Context, arg GetNotificationsParams) ([]Notification, error) {
+	rows, err := q.db.QueryContext(ctx, getNotifications,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.Before,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Notification
+	for rows.Next() {
+		var i Notification
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.ActorID,
+			&i.Type,
+			&i.ChirpID,
+			&i.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAllNotificationsRead = `-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL
+`
+
+func (q *Queries) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markAllNotificationsRead, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const markNotificationRead = `-- name: MarkNotificationRead :one
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2
+RETURNING id, created_at, user_id, actor_id, type, chirp_id, read_at
+`
+
+type MarkNotificationReadParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (Notification, error) {
+	row := q.db.QueryRowContext(ctx, markNotificationRead, arg.ID, arg.UserID)
+	var i Notification
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ActorID,
+		&i.Type,
+		&i.ChirpID,
+		&i.ReadAt,
+	)
+	return i, err
+}
+
+const upsertNotificationPreferences = `-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (user_id, updated_at, mentions, replies, likes, follows)
+VALUES ($1, NOW(), $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+  mentions = EXCLUDED.mentions,
+  replies = EXCLUDED.replies,
+  likes = EXCLUDED.likes,
+  follows = EXCLUDED.follows
+RETURNING user_id, updated_at, mentions, replies, likes, follows
+`
+
+type UpsertNotificationPreferencesParams struct {
+	UserID   uuid.UUID
+	Mentions bool
+	Replies  bool
+	Likes    bool
+	Follows  bool
+}
+
+func (q *Queries) UpsertNotificationPreferences(ctx context.Context, arg UpsertNotificationPreferencesParams) (NotificationPreference, error) {
+	row := q.db.QueryRowContext(ctx, upsertNotificationPreferences,
+		arg.UserID,
+		arg.Mentions,
+		arg.Replies,
+		arg.Likes,
+		arg.Follows,
+	)
+	var i NotificationPreference
+	err := row.Scan(
+		&i.UserID,
+		&i.UpdatedAt,
+		&i.Mentions,
+		&i.Replies,
+		&i.Likes,
+		&i.Follows,
+	)
+	return i, err
+}
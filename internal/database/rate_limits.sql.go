@@ -0,0 +1,57 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: rate_limits.sql
+
+package database
+
+import (
+	"context"
+)
+
+const deleteIdleRateLimitBuckets = `-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - make_interval(secs => $1::float8)
+`
+
+func (q *Queries) DeleteIdleRateLimitBuckets(ctx context.Context, idleSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteIdleRateLimitBuckets, idleSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const takeRateLimitToken = `-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES ($1, $2::float8 - 1, true, NOW())
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+    WHEN LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * $3::float8) >= 1
+    THEN LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * $3::float8) - 1
+    ELSE LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * $3::float8)
+  END,
+  allowed = LEAST($2::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * $3::float8) >= 1,
+  updated_at = NOW()
+RETURNING tokens, allowed
+`
+
+type TakeRateLimitTokenParams struct {
+	Key        string
+	Burst      float64
+	RefillRate float64
+}
+
+type TakeRateLimitTokenRow struct {
+	Tokens  float64
+	Allowed bool
+}
+
+// Refills the bucket for the time since it was last used, then takes a
+// token if there is one. allowed records whether a token was taken.
+func (q *Queries) TakeRateLimitToken(ctx context.Context, arg TakeRateLimitTokenParams) (TakeRateLimitTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, takeRateLimitToken, arg.Key, arg.Burst, arg.RefillRate)
+	var i TakeRateLimitTokenRow
+	err := row.Scan(&i.Tokens, &i.Allowed)
+	return i, err
+}
@@ -14,72 +14,173 @@ import (
 
 const createRefreshToken = `-- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens(
-  token, 
+  id,
+  token_hash,
   created_at, 
   updated_at, 
   user_id,
   expires_at,
   revoked_at
 )
-VALUES($1, NOW(), NOW(), $2, $3, NULL
+VALUES($1, $2, NOW(), NOW(), $3, $4, NULL
 )
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	ID        string
+	TokenHash []byte
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	_, err := q.db.ExecContext(ctx, createRefreshToken,
+		arg.ID,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+	)
 	return err
 }
 
+const deleteStaleRefreshTokens = `-- name: DeleteStaleRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE id IN (
+    SELECT stale.id FROM refresh_tokens AS stale
+    WHERE stale.expires_at < $1::timestamp
+      OR stale.revoked_at < $1::timestamp
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+  )
+`
+
+type DeleteStaleRefreshTokensParams struct {
+	StaleBefore time.Time
+	MaxResults  int32
+}
+
+// Deletes up to max_results tokens that expired or were revoked before
+// stale_before. Tokens locked by a concurrent refresh are left for next time.
+func (q *Queries) DeleteStaleRefreshTokens(ctx context.Context, arg DeleteStaleRefreshTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteStaleRefreshTokens, arg.StaleBefore, arg.MaxResults)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, id, token_hash FROM refresh_tokens
+WHERE id = $1
+`
+
+// The caller checks token_hash, so a lookup ID alone is no use.
+func (q *Queries) GetRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, id)
+	var i RefreshToken
+	err := row.Scan(
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.ID,
+		&i.TokenHash,
+	)
+	return i, err
+}
+
+const getRefreshTokensByUserID = `-- name: GetRefreshTokensByUserID :many
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, id, token_hash FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, getRefreshTokensByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.ID,
+			&i.TokenHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red, users.handle, users.is_admin, users.display_name, users.bio, users.avatar_media_id, users.deletion_scheduled_at, users.suspended_at, refresh_tokens.token_hash
 FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.id = $1
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW()
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
-	var i User
+type GetUserFromRefreshTokenRow struct {
+	User      User
+	TokenHash []byte
+}
+
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, id string) (GetUserFromRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, id)
+	var i GetUserFromRefreshTokenRow
 	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Email,
-		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.User.ID,
+		&i.User.CreatedAt,
+		&i.User.UpdatedAt,
+		&i.User.Email,
+		&i.User.HashedPassword,
+		&i.User.IsChirpyRed,
+		&i.User.Handle,
+		&i.User.IsAdmin,
+		&i.User.DisplayName,
+		&i.User.Bio,
+		&i.User.AvatarMediaID,
+		&i.User.DeletionScheduledAt,
+		&i.User.SuspendedAt,
+		&i.TokenHash,
 	)
 	return i, err
 }
 
-const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1
+WHERE user_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
 	return err
 }
 
-const updateRefreshToken = `-- name: UpdateRefreshToken :exec
+const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
-SET token = $1, updated_at = NOW()
-WHERE user_id = $2
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1
 `
 
-type UpdateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
-}
-
-func (q *Queries) UpdateRefreshToken(ctx context.Context, arg UpdateRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, updateRefreshToken, arg.Token, arg.UserID)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, id)
 	return err
 }
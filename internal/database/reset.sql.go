@@ -0,0 +1,43 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: reset.sql
+
+package database
+
+import (
+	"context"
+)
+
+const truncateAllTables = `-- name: TruncateAllTables :exec
+TRUNCATE
+  chirp_media,
+  chirp_hashtags,
+  chirp_mentions,
+  chirp_likes,
+  trending_chirps,
+  notifications,
+  scheduled_chirps,
+  chirps,
+  follows,
+  blocks,
+  mutes,
+  muted_keywords,
+  notification_preferences,
+  refresh_tokens,
+  data_exports,
+  media,
+  users,
+  trending_hashtags,
+  rate_limit_buckets,
+  jobs,
+  audit_events
+`
+
+// Empties every table but goose's. Tables are listed in dependency order,
+// children first; users and media refer to each other, which only one
+// TRUNCATE of them all can handle.
+func (q *Queries) TruncateAllTables(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, truncateAllTables)
+	return err
+}
@@ -0,0 +1,264 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: scheduled_chirps.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimDueScheduledChirp = `-- name: ClaimDueScheduledChirp :one
+SELECT id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at, attempts, last_error FROM scheduled_chirps
+WHERE publish_at <= $1::timestamp
+  AND attempts < $2::int
+  AND NOT (id = ANY(COALESCE($3::uuid[], '{}')))
+ORDER BY publish_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+type ClaimDueScheduledChirpParams struct {
+	DueBefore   time.Time
+	MaxAttempts int32
+	SkipIds     []uuid.UUID
+}
+
+// Locks the chirp due first until the transaction ends. Other replicas
+// skip it, so each chirp is published by exactly one of them. Chirps that
+// have failed max_attempts times, and those in skip_ids, aren't claimed.
+func (q *Queries) ClaimDueScheduledChirp(ctx context.Context, arg ClaimDueScheduledChirpParams) (ScheduledChirp, error) {
+	row := q.db.QueryRowContext(ctx, claimDueScheduledChirp, arg.DueBefore, arg.MaxAttempts, pq.Array(arg.SkipIds))
+	var i ScheduledChirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.ReplyToID,
+		&i.Visibility,
+		pq.Array(&i.MediaIds),
+		&i.PublishAt,
+		&i.Attempts,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const countScheduledChirps = `-- name: CountScheduledChirps :one
+SELECT count(*) FROM scheduled_chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) CountScheduledChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countScheduledChirps, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createScheduledChirp = `-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, $5::uuid[], $6)
+RETURNING id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at, attempts, last_error
+`
+
+type CreateScheduledChirpParams struct {
+	UserID     uuid.UUID
+	Body       string
+	ReplyToID  uuid.NullUUID
+	Visibility string
+	MediaIds   []uuid.UUID
+	PublishAt  sql.NullTime
+}
+
+func (q *Queries) CreateScheduledChirp(ctx context.Context, arg CreateScheduledChirpParams) (ScheduledChirp, error) {
+	row := q.db.QueryRowContext(ctx, createScheduledChirp,
+		arg.UserID,
+		arg.Body,
+		arg.ReplyToID,
+		arg.Visibility,
+		pq.Array(arg.MediaIds),
+		arg.PublishAt,
+	)
+	var i ScheduledChirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.ReplyToID,
+		&i.Visibility,
+		pq.Array(&i.MediaIds),
+		&i.PublishAt,
+		&i.Attempts,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const deleteScheduledChirp = `-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteScheduledChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteScheduledChirp(ctx context.Context, arg DeleteScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getScheduledChirpForUpdate = `-- name: GetScheduledChirpForUpdate :one
+SELECT id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at, attempts, last_error FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2
+FOR UPDATE
+`
+
+type GetScheduledChirpForUpdateParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+// Waits for the scheduler if it is publishing the chirp, in which case
+// there's no row left to get.
+func (q *Queries) GetScheduledChirpForUpdate(ctx context.Context, arg GetScheduledChirpForUpdateParams) (ScheduledChirp, error) {
+	row := q.db.QueryRowContext(ctx, getScheduledChirpForUpdate, arg.ID, arg.UserID)
+	var i ScheduledChirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.ReplyToID,
+		&i.Visibility,
+		pq.Array(&i.MediaIds),
+		&i.PublishAt,
+		&i.Attempts,
+		&i.LastError,
+	)
+	return i, err
+}
+
+const getScheduledChirps = `-- name: GetScheduledChirps :many
+SELECT id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at, attempts, last_error FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at NULLS LAST, created_at
+`
+
+// Scheduled chirps in the order they'll be published, then drafts, oldest
+// first.
+func (q *Queries) GetScheduledChirps(ctx context.Context, userID uuid.UUID) ([]ScheduledChirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirps, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ScheduledChirp
+	for rows.Next() {
+		var i ScheduledChirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Body,
+			&i.ReplyToID,
+			&i.Visibility,
+			pq.Array(&i.MediaIds),
+			&i.PublishAt,
+			&i.Attempts,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordScheduledChirpFailure = `-- name: RecordScheduledChirpFailure :exec
+UPDATE scheduled_chirps
+SET attempts = attempts + 1, last_error = $1::text
+WHERE id = $2
+`
+
+type RecordScheduledChirpFailureParams struct {
+	LastError string
+	ID        uuid.UUID
+}
+
+func (q *Queries) RecordScheduledChirpFailure(ctx context.Context, arg RecordScheduledChirpFailureParams) error {
+	_, err := q.db.ExecContext(ctx, recordScheduledChirpFailure, arg.LastError, arg.ID)
+	return err
+}
+
+const updateScheduledChirp = `-- name: UpdateScheduledChirp :one
+UPDATE scheduled_chirps
+SET body = $1,
+  reply_to_id = $2,
+  visibility = $3,
+  media_ids = $4::uuid[],
+  publish_at = $5,
+  attempts = 0,
+  last_error = NULL,
+  updated_at = NOW()
+WHERE id = $6
+RETURNING id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at, attempts, last_error
+`
+
+type UpdateScheduledChirpParams struct {
+	Body       string
+	ReplyToID  uuid.NullUUID
+	Visibility string
+	MediaIds   []uuid.UUID
+	PublishAt  sql.NullTime
+	ID         uuid.UUID
+}
+
+func (q *Queries) UpdateScheduledChirp(ctx context.Context, arg UpdateScheduledChirpParams) (ScheduledChirp, error) {
+	row := q.db.QueryRowContext(ctx, updateScheduledChirp,
+		arg.Body,
+		arg.ReplyToID,
+		arg.Visibility,
+		pq.Array(arg.MediaIds),
+		arg.PublishAt,
+		arg.ID,
+	)
+	var i ScheduledChirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Body,
+		&i.ReplyToID,
+		&i.Visibility,
+		pq.Array(&i.MediaIds),
+		&i.PublishAt,
+		&i.Attempts,
+		&i.LastError,
+	)
+	return i, err
+}
@@ -0,0 +1,212 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.29.0
+// source: trending.sql
+
+package database
+
+import (
+	"context"
+)
+
+const deleteTrendingChirps = `-- name: DeleteTrendingChirps :exec
+
+DELETE FROM trending_chirps
+WHERE period = $1
+`
+
+// Scores add up engagement within the period, each event weighted by
+// 0.5^(age / half_life) so recent activity counts for more.
+func (q *Queries) DeleteTrendingChirps(ctx context.Context, period string) error {
+	_, err := q.db.ExecContext(ctx, deleteTrendingChirps, period)
+	return err
+}
+
+const deleteTrendingHashtags = `-- name: DeleteTrendingHashtags :exec
+DELETE FROM trending_hashtags
+WHERE period = $1
+`
+
+func (q *Queries) DeleteTrendingHashtags(ctx context.Context, period string) error {
+	_, err := q.db.ExecContext(ctx, deleteTrendingHashtags, period)
+	return err
+}
+
+const getTrendingChirps = `-- name: GetTrendingChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.reply_to_id, chirps.thread_id, chirps.hidden_at, chirps.visibility, trending_chirps.score
+FROM trending_chirps
+JOIN chirps ON chirps.id = trending_chirps.chirp_id
+WHERE trending_chirps.period = $1 AND chirps.hidden_at IS NULL
+ORDER BY trending_chirps.score DESC, chirps.id
+LIMIT $2
+`
+
+type GetTrendingChirpsParams struct {
+	Period string
+	Limit  int32
+}
+
+type GetTrendingChirpsRow struct {
+	Chirp Chirp
+	Score float64
+}
+
+// Chirps hidden since the ranking was computed are left out.
+func (q *Queries) GetTrendingChirps(ctx context.Context, arg GetTrendingChirpsParams) ([]GetTrendingChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getTrendingChirps, arg.Period, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTrendingChirpsRow
+	for rows.Next() {
+		var i GetTrendingChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.ReplyToID,
+			&i.Chirp.ThreadID,
+			&i.Chirp.HiddenAt,
+			&i.Chirp.Visibility,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTrendingHashtags = `-- name: GetTrendingHashtags :many
+SELECT period, tag, score, computed_at FROM trending_hashtags
+WHERE period = $1
+ORDER BY score DESC, tag
+LIMIT $2
+`
+
+type GetTrendingHashtagsParams struct {
+	Period string
+	Limit  int32
+}
+
+func (q *Queries) GetTrendingHashtags(ctx context.Context, arg GetTrendingHashtagsParams) ([]TrendingHashtag, error) {
+	rows, err := q.db.QueryContext(ctx, getTrendingHashtags, arg.Period, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TrendingHashtag
+	for rows.Next() {
+		var i TrendingHashtag
+		if err := rows.Scan(
+			&i.Period,
+			&i.Tag,
+			&i.Score,
+			&i.ComputedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const insertTrendingChirps = `-- name: InsertTrendingChirps :execrows
+INSERT INTO trending_chirps (period, chirp_id, score, computed_at)
+SELECT $1, engagement.chirp_id, SUM(engagement.weight * power(0.5, EXTRACT(EPOCH FROM (NOW() - engagement.at))::float8 / $2::float8)) AS score, NOW()
+FROM (
+    SELECT chirp_likes.chirp_id, chirp_likes.created_at AS at, 1.0::float8 AS weight
+    FROM chirp_likes
+    UNION ALL
+    SELECT replies.reply_to_id, replies.created_at, 2.0::float8
+    FROM chirps AS replies
+    WHERE replies.reply_to_id IS NOT NULL AND replies.hidden_at IS NULL
+  ) AS engagement
+  JOIN chirps ON chirps.id = engagement.chirp_id
+WHERE engagement.at > NOW() - make_interval(secs => $3::float8)
+  AND chirps.hidden_at IS NULL
+  AND chirps.visibility = 'public'
+GROUP BY engagement.chirp_id
+ORDER BY score DESC
+LIMIT $4
+`
+
+type InsertTrendingChirpsParams struct {
+	Period          string
+	HalfLifeSeconds float64
+	PeriodSeconds   float64
+	MaxResults      int32
+}
+
+// A like counts 1 and a reply counts 2. Only public chirps can trend, and
+// replies that are hidden don't count.
+func (q *Queries) InsertTrendingChirps(ctx context.Context, arg InsertTrendingChirpsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertTrendingChirps,
+		arg.Period,
+		arg.HalfLifeSeconds,
+		arg.PeriodSeconds,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const insertTrendingHashtags = `-- name: InsertTrendingHashtags :execrows
+INSERT INTO trending_hashtags (period, tag, score, computed_at)
+SELECT $1, engagement.tag, SUM(engagement.weight * power(0.5, EXTRACT(EPOCH FROM (NOW() - engagement.at))::float8 / $2::float8)) AS score, NOW()
+FROM (
+    SELECT chirp_hashtags.tag, chirps.created_at AS at, 1.0::float8 AS weight
+    FROM chirp_hashtags
+    JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+    WHERE chirps.hidden_at IS NULL AND chirps.visibility = 'public'
+    UNION ALL
+    SELECT chirp_hashtags.tag, chirp_likes.created_at, 0.5::float8
+    FROM chirp_hashtags
+    JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+    JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+    WHERE chirps.hidden_at IS NULL AND chirps.visibility = 'public'
+  ) AS engagement
+WHERE engagement.at > NOW() - make_interval(secs => $3::float8)
+GROUP BY engagement.tag
+ORDER BY score DESC
+LIMIT $4
+`
+
+type InsertTrendingHashtagsParams struct {
+	Period          string
+	HalfLifeSeconds float64
+	PeriodSeconds   float64
+	MaxResults      int32
+}
+
+// Using a tag counts 1 and a like on a chirp with the tag counts 0.5.
+// Only public chirps that aren't hidden count.
+func (q *Queries) InsertTrendingHashtags(ctx context.Context, arg InsertTrendingHashtagsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, insertTrendingHashtags,
+		arg.Period,
+		arg.HalfLifeSeconds,
+		arg.PeriodSeconds,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
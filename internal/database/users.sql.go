@@ -7,23 +7,55 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -32,6 +64,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -45,8 +84,18 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
 WHERE email = $1
 `
 
@@ -60,6 +109,423 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
+WHERE lower(handle) = lower($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, lower)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const getUserStats = `-- name: GetUserStats :one
+SELECT
+  (SELECT count(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.hidden_at IS NULL) AS chirp_count,
+  (SELECT count(*) FROM follows WHERE follows.followee_id = $1) AS follower_count,
+  (SELECT count(*) FROM follows WHERE follows.follower_id = $1) AS following_count
+`
+
+type GetUserStatsRow struct {
+	ChirpCount     int64
+	FollowerCount  int64
+	FollowingCount int64
+}
+
+// Hidden chirps aren't counted.
+func (q *Queries) GetUserStats(ctx context.Context, userID uuid.UUID) (GetUserStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserStats, userID)
+	var i GetUserStatsRow
+	err := row.Scan(&i.ChirpCount, &i.FollowerCount, &i.FollowingCount)
+	return i, err
+}
+
+const getUsersByHandles = `-- name: GetUsersByHandles :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
+WHERE lower(handle) = ANY($1::text[])
+`
+
+// handles must be lower-cased.
+func (q *Queries) GetUsersByHandles(ctx context.Context, handles []string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByHandles, pq.Array(handles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.IsAdmin,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarMediaID,
+			&i.DeletionScheduledAt,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersByIDs = `-- name: GetUsersByIDs :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.IsAdmin,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarMediaID,
+			&i.DeletionScheduledAt,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUsersDueForDeletion = `-- name: GetUsersDueForDeletion :many
+SELECT id FROM users
+WHERE deletion_scheduled_at <= $1::timestamp
+ORDER BY deletion_scheduled_at
+LIMIT $2
+`
+
+type GetUsersDueForDeletionParams struct {
+	DueBefore  time.Time
+	MaxResults int32
+}
+
+func (q *Queries) GetUsersDueForDeletion(ctx context.Context, arg GetUsersDueForDeletionParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, getUsersDueForDeletion, arg.DueBefore, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $1::timestamp, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+type ScheduleUserDeletionParams struct {
+	DeletionScheduledAt time.Time
+	ID                  uuid.UUID
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeletionScheduledAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at FROM users
+WHERE (
+    $1::text = ''
+    OR users.email ILIKE '%' || $1 || '%'
+    OR users.handle ILIKE '%' || $1 || '%'
+  )
+  AND (
+    $2::uuid IS NULL
+    OR (users.created_at, users.id) < (SELECT u.created_at, u.id FROM users AS u WHERE u.id = $2)
+  )
+ORDER BY users.created_at DESC, users.id DESC
+LIMIT $3
+`
+
+type SearchUsersParams struct {
+	Pattern    string
+	Before     uuid.NullUUID
+	MaxResults int32
+}
+
+// Newest first. pattern is matched against emails and handles with ILIKE,
+// so callers escape it; an empty pattern matches everyone. before is the
+// last user of the previous page.
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Pattern, arg.Before, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Handle,
+			&i.IsAdmin,
+			&i.DisplayName,
+			&i.Bio,
+			&i.AvatarMediaID,
+			&i.DeletionScheduledAt,
+			&i.SuspendedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserAdmin = `-- name: SetUserAdmin :one
+UPDATE users
+SET is_admin = $2, updated_at = NOW()
+WHERE email = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+type SetUserAdminParams struct {
+	Email   string
+	IsAdmin bool
+}
+
+func (q *Queries) SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserAdmin, arg.Email, arg.IsAdmin)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+type SetUserChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserChirpyRed, arg.ID, arg.IsChirpyRed)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+// Suspending a suspended user keeps the original time.
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unsuspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -68,7 +534,7 @@ const updateUserEmailAndPassword = `-- name: UpdateUserEmailAndPassword :one
 UPDATE users
 SET email = $1, hashed_password = $2, updated_at = NOW()
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
 `
 
 type UpdateUserEmailAndPasswordParams struct {
@@ -87,6 +553,66 @@ func (q *Queries) UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUser
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET handle = CASE WHEN $1::bool THEN $2 ELSE handle END,
+  display_name = COALESCE($3, display_name),
+  bio = COALESCE($4, bio),
+  avatar_media_id = CASE WHEN $5::bool THEN $6 ELSE avatar_media_id END,
+  updated_at = NOW()
+WHERE id = $7
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
+`
+
+type UpdateUserProfileParams struct {
+	SetHandle     bool
+	Handle        sql.NullString
+	DisplayName   sql.NullString
+	Bio           sql.NullString
+	SetAvatar     bool
+	AvatarMediaID uuid.NullUUID
+	ID            uuid.UUID
+}
+
+// display_name and bio are left as they are when NULL. handle and
+// avatar_media_id can be cleared, so they have flags saying whether to set
+// them.
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.SetHandle,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.SetAvatar,
+		arg.AvatarMediaID,
+		arg.ID,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
@@ -95,7 +621,7 @@ const upgradeUserToChirpyRed = `-- name: UpgradeUserToChirpyRed :one
 UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, is_admin, display_name, bio, avatar_media_id, deletion_scheduled_at, suspended_at
 `
 
 func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -108,6 +634,13 @@ func (q *Queries) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (Use
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.IsAdmin,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.DeletionScheduledAt,
+		&i.SuspendedAt,
 	)
 	return i, err
 }
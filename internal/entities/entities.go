@@ -0,0 +1,163 @@
+// Package entities finds @mentions and #hashtags in chirp bodies.
+package entities
+
+import (
+	"strings"
+	"unicode"
+)
+
+type Type string
+
+const (
+	Mention Type = "mention"
+	Hashtag Type = "hashtag"
+)
+
+const (
+	MaxHandleLength  = 30
+	maxHashtagLength = 100
+)
+
+// Entity is a mention or hashtag in a chirp body. Start and End are offsets
+// in Unicode code points, not bytes, and cover the @ or # as well as Text;
+// End is exclusive.
+type Entity struct {
+	Type  Type   `json:"type"`
+	Text  string `json:"text"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+var urlPrefixes = []string{"http://", "https://", "www."}
+
+// Parse returns the entities in body in order.
+//
+// A mention is @ followed by a handle; a hashtag is # followed by letters,
+// digits, marks and underscores, at least one of them not a digit. Either
+// must start at the beginning of the body or after a character that can't
+// be part of a word, so email addresses and things like C# don't count,
+// and neither does anything inside a URL.
+func Parse(body string) []Entity {
+	runes := []rune(body)
+
+	var found []Entity
+	for i := 0; i < len(runes); i++ {
+		if i > 0 && !boundary(runes[i-1]) {
+			continue
+		}
+
+		if isURL(runes[i:]) {
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			continue
+		}
+
+		var e Entity
+		var ok bool
+		switch runes[i] {
+		case '@':
+			e, ok = parseMention(runes, i)
+		case '#':
+			e, ok = parseHashtag(runes, i)
+		}
+		if ok {
+			found = append(found, e)
+			i = e.End - 1
+		}
+	}
+	return found
+}
+
+func parseMention(runes []rune, start int) (Entity, bool) {
+	end := start + 1
+	for end < len(runes) && isHandleRune(runes[end]) {
+		end++
+	}
+	// a handle can't be cut out of a longer word or email address
+	if end == start+1 || end-start-1 > MaxHandleLength || end < len(runes) && !boundary(runes[end]) {
+		return Entity{}, false
+	}
+	return Entity{Type: Mention, Text: string(runes[start+1 : end]), Start: start, End: end}, true
+}
+
+func parseHashtag(runes []rune, start int) (Entity, bool) {
+	end := start + 1
+	digitsOnly := true
+	for end < len(runes) && isHashtagRune(runes[end]) {
+		if !unicode.IsDigit(runes[end]) {
+			digitsOnly = false
+		}
+		end++
+	}
+	if digitsOnly || end-start-1 > maxHashtagLength || end < len(runes) && (runes[end] == '@' || runes[end] == '#') {
+		return Entity{}, false
+	}
+	return Entity{Type: Hashtag, Text: string(runes[start+1 : end]), Start: start, End: end}, true
+}
+
+// boundary reports whether r can come right before an entity.
+func boundary(r rune) bool {
+	return !isHashtagRune(r) && r != '@' && r != '#' && r != '/' && r != '&'
+}
+
+func isHandleRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'
+}
+
+func isHashtagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == '_'
+}
+
+func isURL(runes []rune) bool {
+	for _, prefix := range urlPrefixes {
+		if len(runes) >= len(prefix) && strings.EqualFold(string(runes[:len(prefix)]), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidHandle reports whether handle can be mentioned.
+func ValidHandle(handle string) bool {
+	if handle == "" || len(handle) > MaxHandleLength {
+		return false
+	}
+	for _, r := range handle {
+		if !isHandleRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Mentions returns the handles mentioned in entities, lower-cased and
+// without duplicates.
+func Mentions(entities []Entity) []string {
+	return texts(entities, Mention)
+}
+
+// Hashtags returns the hashtags in entities, lower-cased and without
+// duplicates. Hashtags are matched case-insensitively.
+func Hashtags(entities []Entity) []string {
+	return texts(entities, Hashtag)
+}
+
+// NormalizeHashtag returns the form a hashtag is stored and looked up in.
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func texts(entities []Entity, t Type) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, e := range entities {
+		text := strings.ToLower(e.Text)
+		if e.Type != t || seen[text] {
+			continue
+		}
+		seen[text] = true
+		out = append(out, text)
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Entity
+	}{
+		{
+			name: "mention and hashtag",
+			body: "hi @alice #golang",
+			want: []Entity{
+				{Type: Mention, Text: "alice", Start: 3, End: 9},
+				{Type: Hashtag, Text: "golang", Start: 10, End: 17},
+			},
+		},
+		{
+			name: "offsets count code points",
+			body: "héllo #café @bob",
+			want: []Entity{
+				{Type: Hashtag, Text: "café", Start: 6, End: 11},
+				{Type: Mention, Text: "bob", Start: 12, End: 16},
+			},
+		},
+		{
+			name: "unicode hashtag",
+			body: "#日本語 and #ñandú_2",
+			want: []Entity{
+				{Type: Hashtag, Text: "日本語", Start: 0, End: 4},
+				{Type: Hashtag, Text: "ñandú_2", Start: 9, End: 17},
+			},
+		},
+		{
+			name: "punctuation ends entities",
+			body: "(@alice), #go!",
+			want: []Entity{
+				{Type: Mention, Text: "alice", Start: 1, End: 7},
+				{Type: Hashtag, Text: "go", Start: 10, End: 13},
+			},
+		},
+		{
+			name: "inside URLs",
+			body: "see https://example.com/@alice#top and www.example.com/#tag",
+			want: nil,
+		},
+		{
+			name: "email address",
+			body: "mail alice@example.com",
+			want: nil,
+		},
+		{
+			name: "inside words",
+			body: "C# and a#b",
+			want: nil,
+		},
+		{
+			name: "digits only hashtag",
+			body: "#1 fan",
+			want: nil,
+		},
+		{
+			name: "handle with non-ASCII letters",
+			body: "@josé",
+			want: nil,
+		},
+		{
+			name: "doubled sigils",
+			body: "##tag @@alice @alice@example.com",
+			want: nil,
+		},
+		{
+			name: "handle too long",
+			body: "@abcdefghijabcdefghijabcdefghijk",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.body)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionsAndHashtags(t *testing.T) {
+	found := Parse("@Alice @alice @bob #Go #go #Rust")
+
+	if got, want := Mentions(found), []string{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Mentions() = %v, want %v", got, want)
+	}
+	if got, want := Hashtags(found), []string{"go", "rust"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Hashtags() = %v, want %v", got, want)
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{"alice", true},
+		{"Alice_99", true},
+		{"", false},
+		{"al ice", false},
+		{"josé", false},
+		{"abcdefghijabcdefghijabcdefghijk", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidHandle(tt.handle); got != tt.want {
+			t.Errorf("ValidHandle(%q) = %v, want %v", tt.handle, got, tt.want)
+		}
+	}
+}
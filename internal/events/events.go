@@ -0,0 +1,47 @@
+// Package events fans out chirp activity to streaming clients. A Hub
+// delivers events to subscribers in this process; a Publisher gets events
+// to the Hub of every replica.
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	ChirpCreated Type = "chirp.created"
+	ChirpDeleted Type = "chirp.deleted"
+
+	NotificationCreated Type = "notification.created"
+)
+
+// Event is a single change. IDs increase over time and are shared by all
+// replicas, so a client can resume from any of them.
+//
+// Events with a RecipientID are private to that user and must only be sent
+// to connections authenticated as them. Visibility is that of the chirp an
+// event is about, for subscribers to decide who may see it.
+type Event struct {
+	ID          int64           `json:"id"`
+	Type        Type            `json:"type"`
+	AuthorID    uuid.UUID       `json:"author_id"`
+	ThreadID    uuid.UUID       `json:"thread_id"`
+	RecipientID uuid.UUID       `json:"recipient_id"`
+	Visibility  string          `json:"visibility,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Private reports whether e is meant for a single user.
+func (e Event) Private() bool {
+	return e.RecipientID != uuid.Nil
+}
+
+// Publisher assigns an event its ID and delivers it to subscribers on every
+// replica.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
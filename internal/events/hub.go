@@ -0,0 +1,106 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is disconnected. Disconnected clients resume from the hub's history.
+const subscriberBuffer = 64
+
+// Hub delivers events to the subscribers in this process and keeps the most
+// recent ones so reconnecting clients can catch up.
+type Hub struct {
+	mu          sync.Mutex
+	history     []Event
+	historySize int
+	lastID      int64
+	subs        map[*Subscription]struct{}
+}
+
+// Subscription receives events until it is closed. C is closed when the
+// subscriber falls too far behind or unsubscribes.
+type Subscription struct {
+	C <-chan Event
+	c chan Event
+}
+
+// Hub can publish on its own when there is a single replica.
+var _ Publisher = (*Hub)(nil)
+
+func NewHub(historySize int) *Hub {
+	return &Hub{
+		historySize: historySize,
+		subs:        map[*Subscription]struct{}{},
+	}
+}
+
+// Publish assigns the next local ID and delivers e.
+func (h *Hub) Publish(ctx context.Context, e Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e.ID = h.lastID + 1
+	h.deliver(e)
+	return nil
+}
+
+// Deliver sends an event that already has an ID, e.g. one received from
+// another replica, to every subscriber.
+func (h *Hub) Deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.deliver(e)
+}
+
+func (h *Hub) deliver(e Event) {
+	h.lastID = max(h.lastID, e.ID)
+
+	h.history = append(h.history, e)
+	if len(h.history) > h.historySize {
+		h.history = h.history[len(h.history)-h.historySize:]
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.c <- e:
+		default:
+			// too slow; drop it rather than block everyone else
+			delete(h.subs, sub)
+			close(sub.c)
+		}
+	}
+}
+
+// Subscribe starts receiving events. Events after afterID that are still in
+// the history are returned as missed, in delivery order; pass 0 to skip
+// the history.
+func (h *Hub) Subscribe(afterID int64) (sub *Subscription, missed []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c}
+	h.subs[sub] = struct{}{}
+
+	if afterID > 0 {
+		for _, e := range h.history {
+			if e.ID > afterID {
+				missed = append(missed, e)
+			}
+		}
+	}
+	return sub, missed
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.c)
+	}
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHubReplaysMissedEvents(t *testing.T) {
+	h := NewHub(2)
+	for range 3 {
+		err := h.Publish(context.Background(), Event{Type: ChirpCreated})
+		if err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		afterID int64
+		wantIDs []int64
+	}{
+		{"fresh subscriber", 0, nil},
+		{"caught up", 3, nil},
+		{"one behind", 2, []int64{3}},
+		{"beyond history", 1, []int64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, missed := h.Subscribe(tt.afterID)
+			defer h.Unsubscribe(sub)
+
+			var gotIDs []int64
+			for _, e := range missed {
+				gotIDs = append(gotIDs, e.ID)
+			}
+			if len(gotIDs) != len(tt.wantIDs) {
+				t.Fatalf("missed IDs = %v, want %v", gotIDs, tt.wantIDs)
+			}
+			for i := range gotIDs {
+				if gotIDs[i] != tt.wantIDs[i] {
+					t.Fatalf("missed IDs = %v, want %v", gotIDs, tt.wantIDs)
+				}
+			}
+		})
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	h := NewHub(10)
+	slow, _ := h.Subscribe(0)
+	fast, _ := h.Subscribe(0)
+
+	for i := range subscriberBuffer + 1 {
+		h.Deliver(Event{ID: int64(i + 1), Type: ChirpCreated})
+		<-fast.C
+	}
+
+	for range subscriberBuffer {
+		<-slow.C
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("slow subscriber received an event after overflowing, want closed channel")
+	}
+
+	h.Deliver(Event{ID: subscriberBuffer + 2, Type: ChirpCreated})
+	if e := <-fast.C; e.ID != subscriberBuffer+2 {
+		t.Errorf("fast subscriber received event %d, want %d", e.ID, subscriberBuffer+2)
+	}
+	h.Unsubscribe(fast)
+	h.Unsubscribe(slow)
+}
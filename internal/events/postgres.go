@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// channel is the Postgres NOTIFY channel events are sent on.
+const channel = "chirpy_events"
+
+// PostgresPublisher sends events through Postgres NOTIFY so the Listen loop
+// of every replica, including this one, delivers them to its Hub.
+type PostgresPublisher struct {
+	queries *database.Queries
+}
+
+var _ Publisher = (*PostgresPublisher)(nil)
+
+func NewPostgresPublisher(queries *database.Queries) *PostgresPublisher {
+	return &PostgresPublisher{queries: queries}
+}
+
+func (p *PostgresPublisher) Publish(ctx context.Context, e Event) error {
+	id, err := p.queries.NextEventID(ctx)
+	if err != nil {
+		return err
+	}
+	e.ID = id
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return p.queries.NotifyEvent(ctx, database.NotifyEventParams{
+		Channel: channel,
+		Payload: string(payload),
+	})
+}
+
+// Listen delivers events published by any replica to hub until ctx is done.
+// The connection is re-established automatically if it drops, but events
+// sent while it was down never reach this replica.
+func Listen(ctx context.Context, dbURL string, hub *Hub) error {
+	listener := pq.NewListener(dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Event listener: %s", err)
+		}
+	})
+	defer listener.Close()
+
+	err := listener.Listen(channel)
+	if err != nil {
+		return err
+	}
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil means the connection was re-established
+			if n == nil {
+				continue
+			}
+			var e Event
+			err := json.Unmarshal([]byte(n.Extra), &e)
+			if err != nil {
+				log.Printf("Event listener: invalid payload: %s", err)
+				continue
+			}
+			hub.Deliver(e)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package jobs runs background work from a queue kept in the jobs table, so
+// work that is enqueued in a transaction survives restarts and is done by
+// whichever replica claims it first.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+const (
+	// DefaultMaxAttempts is used for kinds that don't set MaxAttempts.
+	DefaultMaxAttempts = 5
+
+	// lease is how long a worker has to finish a job before another may
+	// claim it. Handlers get a context that ends when the lease does.
+	lease = 5 * time.Minute
+
+	// pollInterval is how often idle workers look for due jobs when they
+	// aren't woken.
+	pollInterval = 5 * time.Second
+
+	backoffBase = 10 * time.Second
+	backoffMax  = time.Hour
+)
+
+// Kind identifies a type of job whose payload is a T, marshalled as JSON.
+type Kind[T any] struct {
+	Name        string
+	MaxAttempts int32
+}
+
+// Enqueue adds a job to run as soon as a worker is free. Passing the Store
+// of a transaction enqueues the job only if the transaction commits.
+func (k Kind[T]) Enqueue(ctx context.Context, s store.JobStore, payload T) (database.Job, error) {
+	return k.EnqueueAt(ctx, s, payload, time.Now())
+}
+
+// EnqueueAt adds a job that won't run before runAt.
+func (k Kind[T]) EnqueueAt(ctx context.Context, s store.JobStore, payload T, runAt time.Time) (database.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return database.Job{}, fmt.Errorf("marshalling %s payload: %w", k.Name, err)
+	}
+	maxAttempts := k.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	return s.CreateJob(ctx, database.CreateJobParams{
+		Kind:        k.Name,
+		Payload:     data,
+		MaxAttempts: maxAttempts,
+		RunAt:       runAt.UTC(),
+	})
+}
+
+// permanentError marks a failure that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails straight away instead of being
+// retried.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Backoff is how long to wait before retrying a job that has failed
+// attempts times: doubling from ten seconds up to an hour, with up to a
+// quarter again added at random so failures don't retry in lockstep.
+func Backoff(attempts int32) time.Duration {
+	d := backoffMax
+	if attempts < 20 {
+		d = min(backoffBase<<max(attempts-1, 0), backoffMax)
+	}
+	return d + rand.N(d/4)
+}
+
+type handler func(ctx context.Context, payload json.RawMessage) error
+
+// Queue claims jobs from the store and runs them with the handler
+// registered for their kind.
+type Queue struct {
+	store    store.JobStore
+	handlers map[string]handler
+	wake     chan struct{}
+}
+
+func NewQueue(s store.JobStore) *Queue {
+	return &Queue{
+		store:    s,
+		handlers: map[string]handler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle registers fn to run jobs of kind k. It must be called before the
+// queue is run.
+func Handle[T any](q *Queue, k Kind[T], fn func(ctx context.Context, payload T) error) {
+	q.handlers[k.Name] = func(ctx context.Context, data json.RawMessage) error {
+		var payload T
+		err := json.Unmarshal(data, &payload)
+		if err != nil {
+			return Permanent(fmt.Errorf("unmarshalling payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+// Wake tells an idle worker to look for jobs now rather than at its next
+// poll, such as after committing a transaction that enqueued one.
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts workers that run jobs until ctx is cancelled, and waits for
+// them to stop.
+func (q *Queue) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		ran, err := q.RunOnce(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error running job: %s", err)
+		}
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// RunOnce claims a job that is due at now and runs it, returning false if
+// none was due. A job that fails is retried after Backoff until it runs out
+// of attempts, then it is kept as dead. So is one whose lease ran out on its
+// last attempt, since its worker died running it.
+func (q *Queue) RunOnce(ctx context.Context, now time.Time) (bool, error) {
+	now = now.UTC()
+	killed, err := q.store.KillExpiredJobs(ctx, now)
+	if err != nil {
+		return false, err
+	}
+	if killed > 0 {
+		log.Printf("Killed %d jobs whose lease ran out on their last attempt", killed)
+	}
+	job, err := q.store.ClaimJob(ctx, database.ClaimJobParams{
+		Now:         now,
+		LockedUntil: now.Add(lease),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	jobErr := q.run(ctx, job, time.Now().Add(lease))
+
+	// the outcome is recorded even if we're shutting down, so the job
+	// isn't left waiting for its lease to run out
+	ctx = context.WithoutCancel(ctx)
+	var updated int64
+	switch {
+	case jobErr == nil:
+		updated, err = q.store.CompleteJob(ctx, database.CompleteJobParams{
+			ID:       job.ID,
+			Attempts: job.Attempts,
+		})
+	case job.Attempts >= job.MaxAttempts || errors.As(jobErr, new(permanentError)):
+		log.Printf("Job %s (%s) failed for good after %d attempts: %s", job.ID, job.Kind, job.Attempts, jobErr)
+		updated, err = q.store.KillJob(ctx, database.KillJobParams{
+			ID:        job.ID,
+			Attempts:  job.Attempts,
+			LastError: jobErr.Error(),
+		})
+	default:
+		log.Printf("Job %s (%s) failed on attempt %d, retrying: %s", job.ID, job.Kind, job.Attempts, jobErr)
+		updated, err = q.store.RetryJob(ctx, database.RetryJobParams{
+			ID:        job.ID,
+			Attempts:  job.Attempts,
+			RunAt:     now.Add(Backoff(job.Attempts)),
+			LastError: jobErr.Error(),
+		})
+	}
+	if err != nil {
+		return true, err
+	}
+	if updated == 0 {
+		return true, fmt.Errorf("job %s (%s) outlived its lease and was claimed again", job.ID, job.Kind)
+	}
+	return true, nil
+}
+
+// run calls the job's handler, turning a panic into an error.
+func (q *Queue) run(ctx context.Context, job database.Job, deadline time.Time) (err error) {
+	fn, ok := q.handlers[job.Kind]
+	if !ok {
+		// another replica may be running a newer version that knows it
+		return fmt.Errorf("no handler for kind %q", job.Kind)
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s (%s) panicked: %v\n%s", job.ID, job.Kind, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, job.Payload)
+}
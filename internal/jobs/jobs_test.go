@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+var greet = Kind[greeting]{Name: "greet", MaxAttempts: 3}
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+
+	tests := []struct {
+		name         string
+		fn           func(ctx context.Context, g greeting) error
+		runs         []time.Duration
+		wantCalls    int
+		wantStatus   string // "" when the job is deleted
+		wantAttempts int32
+	}{
+		{
+			name:      "succeeds",
+			fn:        func(ctx context.Context, g greeting) error { return nil },
+			runs:      []time.Duration{0},
+			wantCalls: 1,
+		},
+		{
+			name:         "retried after backoff",
+			fn:           func(ctx context.Context, g greeting) error { return errors.New("try again") },
+			runs:         []time.Duration{0, backoffBase / 2},
+			wantCalls:    1,
+			wantStatus:   "pending",
+			wantAttempts: 1,
+		},
+		{
+			name:         "dead after max attempts",
+			fn:           func(ctx context.Context, g greeting) error { return errors.New("try again") },
+			runs:         []time.Duration{0, time.Hour, 3 * time.Hour, 6 * time.Hour},
+			wantCalls:    3,
+			wantStatus:   "dead",
+			wantAttempts: 3,
+		},
+		{
+			name:         "permanent error isn't retried",
+			fn:           func(ctx context.Context, g greeting) error { return Permanent(errors.New("no")) },
+			runs:         []time.Duration{0, time.Hour},
+			wantCalls:    1,
+			wantStatus:   "dead",
+			wantAttempts: 1,
+		},
+		{
+			name:         "panic is retried",
+			fn:           func(ctx context.Context, g greeting) error { panic("oops") },
+			runs:         []time.Duration{0},
+			wantCalls:    1,
+			wantStatus:   "pending",
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := store.NewMemory()
+			q := NewQueue(s)
+			calls := 0
+			Handle(q, greet, func(ctx context.Context, g greeting) error {
+				calls++
+				if g.Name != "chirpy" {
+					t.Errorf("handler got name %q, want %q", g.Name, "chirpy")
+				}
+				return tt.fn(ctx, g)
+			})
+
+			job, err := greet.EnqueueAt(ctx, s, greeting{Name: "chirpy"}, start)
+			if err != nil {
+				t.Fatalf("EnqueueAt() unexpected error: %v", err)
+			}
+			for _, at := range tt.runs {
+				if _, err := q.RunOnce(ctx, start.Add(at)); err != nil {
+					t.Fatalf("RunOnce() unexpected error: %v", err)
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			got, err := s.GetJobByID(ctx, job.ID)
+			if tt.wantStatus == "" {
+				if err == nil {
+					t.Errorf("job still exists with status %q, want it deleted", got.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetJobByID() unexpected error: %v", err)
+			}
+			if got.Status != tt.wantStatus || got.Attempts != tt.wantAttempts {
+				t.Errorf("job status = %q after %d attempts, want %q after %d", got.Status, got.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if !got.LastError.Valid {
+				t.Errorf("job has no last error")
+			}
+		})
+	}
+}
+
+func TestRunOnceNotDue(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	q := NewQueue(s)
+	Handle(q, greet, func(ctx context.Context, g greeting) error { return nil })
+
+	start := time.Now()
+	if _, err := greet.EnqueueAt(ctx, s, greeting{}, start.Add(time.Minute)); err != nil {
+		t.Fatalf("EnqueueAt() unexpected error: %v", err)
+	}
+
+	ran, err := q.RunOnce(ctx, start)
+	if err != nil || ran {
+		t.Errorf("RunOnce() before the job is due = %v, %v, want false, nil", ran, err)
+	}
+	ran, err = q.RunOnce(ctx, start.Add(time.Minute))
+	if err != nil || !ran {
+		t.Errorf("RunOnce() once the job is due = %v, %v, want true, nil", ran, err)
+	}
+}
+
+// TestRunOnceLeaseExpired claims a job as a worker that dies running it
+// would, never recording the outcome.
+func TestRunOnceLeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	q := NewQueue(s)
+	calls := 0
+	Handle(q, greet, func(ctx context.Context, g greeting) error {
+		calls++
+		return nil
+	})
+
+	at := time.Now().UTC()
+	job, err := greet.EnqueueAt(ctx, s, greeting{}, at)
+	if err != nil {
+		t.Fatalf("EnqueueAt() unexpected error: %v", err)
+	}
+	for range greet.MaxAttempts {
+		if _, err := s.ClaimJob(ctx, database.ClaimJobParams{Now: at, LockedUntil: at.Add(lease)}); err != nil {
+			t.Fatalf("ClaimJob() unexpected error: %v", err)
+		}
+		at = at.Add(lease + time.Second)
+	}
+
+	ran, err := q.RunOnce(ctx, at)
+	if err != nil || ran || calls != 0 {
+		t.Errorf("RunOnce() after the last lease expired = %v, %v with %d calls, want false, nil with none", ran, err, calls)
+	}
+	got, err := s.GetJobByID(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJobByID() unexpected error: %v", err)
+	}
+	if got.Status != "dead" || got.Attempts != greet.MaxAttempts || got.LastError.String != "lease expired" {
+		t.Errorf("job = %q after %d attempts with error %q, want dead after %d with %q", got.Status, got.Attempts, got.LastError.String, greet.MaxAttempts, "lease expired")
+	}
+}
+
+func TestRunOnceLeaseExpiredWithAttemptsLeft(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	q := NewQueue(s)
+	Handle(q, greet, func(ctx context.Context, g greeting) error { return nil })
+
+	at := time.Now().UTC()
+	job, err := greet.EnqueueAt(ctx, s, greeting{}, at)
+	if err != nil {
+		t.Fatalf("EnqueueAt() unexpected error: %v", err)
+	}
+	if _, err := s.ClaimJob(ctx, database.ClaimJobParams{Now: at, LockedUntil: at.Add(lease)}); err != nil {
+		t.Fatalf("ClaimJob() unexpected error: %v", err)
+	}
+
+	ran, err := q.RunOnce(ctx, at.Add(lease+time.Second))
+	if err != nil || !ran {
+		t.Errorf("RunOnce() after the lease expired = %v, %v, want true, nil", ran, err)
+	}
+	if _, err := s.GetJobByID(ctx, job.ID); err == nil {
+		t.Errorf("job still exists, want it run again and deleted")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int32
+		want     time.Duration
+	}{
+		{attempts: 1, want: 10 * time.Second},
+		{attempts: 2, want: 20 * time.Second},
+		{attempts: 5, want: 160 * time.Second},
+		{attempts: 10, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		got := Backoff(tt.attempts)
+		if got < tt.want || got > tt.want+tt.want/4 {
+			t.Errorf("Backoff(%d) = %s, want between %s and %s", tt.attempts, got, tt.want, tt.want+tt.want/4)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package media turns uploaded images into files that are safe to serve,
+// and stores them in a BlobStore.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxUploadBytes is the largest file Process accepts.
+	MaxUploadBytes = 8 << 20
+	// MaxPixels bounds the decoded size, which a small compressed file can
+	// make huge.
+	MaxPixels = 24_000_000
+	// ThumbnailSize is the longest side of a thumbnail.
+	ThumbnailSize = 320
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("media: unsupported image type")
+	ErrInvalidImage    = errors.New("media: invalid image")
+	ErrTooLarge        = errors.New("media: image too large")
+)
+
+// Image is an upload that has been re-encoded, which drops EXIF and any
+// other metadata, and a thumbnail of it.
+type Image struct {
+	ContentType string
+	Data        []byte
+	Width       int
+	Height      int
+
+	ThumbnailContentType string
+	Thumbnail            []byte
+}
+
+// Process checks data is a JPEG, PNG or GIF of at most MaxPixels, judging
+// by its contents rather than what the client claims. JPEGs are rotated
+// upright according to their EXIF orientation before it is stripped.
+// Animated GIFs keep their animation; their thumbnail is the first frame.
+func Process(data []byte) (*Image, error) {
+	if len(data) > MaxUploadBytes {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, len(data))
+	}
+	contentType := http.DetectContentType(data)
+
+	var img image.Image
+	var out bytes.Buffer
+	switch contentType {
+	case "image/jpeg", "image/png":
+		err := checkSize(data)
+		if err != nil {
+			return nil, err
+		}
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+		}
+		if contentType == "image/jpeg" {
+			img = orient(img, jpegOrientation(data))
+			err = jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality})
+		} else {
+			err = png.Encode(&out, img)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case "image/gif":
+		err := checkGIFSize(data)
+		if err != nil {
+			return nil, err
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+		}
+		err = gif.EncodeAll(&out, g)
+		if err != nil {
+			return nil, err
+		}
+		// frames can be smaller than the canvas
+		canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+		draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+		img = canvas
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	result := &Image{
+		ContentType: contentType,
+		Data:        out.Bytes(),
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+	}
+
+	var thumb bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		result.ThumbnailContentType = "image/jpeg"
+		err = jpeg.Encode(&thumb, thumbnail(img), &jpeg.Options{Quality: jpegQuality})
+	} else {
+		// PNG keeps transparency
+		result.ThumbnailContentType = "image/png"
+		err = png.Encode(&thumb, thumbnail(img))
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Thumbnail = thumb.Bytes()
+	return result, nil
+}
+
+// checkSize rejects images too large to decode before decoding them.
+func checkSize(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+	return nil
+}
+
+// checkGIFSize is checkSize for GIFs, counting every frame as the whole
+// canvas. Frames are counted without being decompressed, so a small file
+// of thousands of frames is rejected before any are decoded.
+func checkGIFSize(data []byte) error {
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+	maxFrames := MaxPixels / max(1, config.Width*config.Height)
+	frames, err := gifFrames(data, maxFrames+1)
+	if err != nil {
+		return err
+	}
+	if frames > maxFrames {
+		return fmt.Errorf("%w: more than %d frames of %dx%d", ErrTooLarge, maxFrames, config.Width, config.Height)
+	}
+	return nil
+}
+
+// gifFrames counts the frames of a GIF by walking its blocks, stopping
+// once it has counted limit. A file that ends early has as many frames as
+// were counted; gif.DecodeAll decides whether it is valid.
+func gifFrames(data []byte, limit int) (int, error) {
+	const (
+		headerSize     = 13 // signature and logical screen descriptor
+		descriptorSize = 10
+		extension      = 0x21
+		imageSeparator = 0x2C
+		trailer        = 0x3B
+	)
+	// colorTableSize is the size of the color table a packed fields byte
+	// says follows, if any
+	colorTableSize := func(flags byte) int {
+		if flags&0x80 == 0 {
+			return 0
+		}
+		return 3 << (flags&0x07 + 1)
+	}
+	skipSubBlocks := func(pos int) int {
+		for pos < len(data) && data[pos] != 0 {
+			pos += 1 + int(data[pos])
+		}
+		return pos + 1
+	}
+
+	if len(data) < headerSize {
+		return 0, ErrInvalidImage
+	}
+	pos := headerSize + colorTableSize(data[10])
+	frames := 0
+	for pos < len(data) && frames < limit {
+		switch data[pos] {
+		case extension:
+			pos = skipSubBlocks(pos + 2)
+		case imageSeparator:
+			frames++
+			if pos+descriptorSize > len(data) {
+				return frames, nil
+			}
+			pos += descriptorSize + colorTableSize(data[pos+descriptorSize-1])
+			// the LZW minimum code size comes before the image data
+			pos = skipSubBlocks(pos + 1)
+		case trailer:
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("%w: unknown GIF block 0x%02x", ErrInvalidImage, data[pos])
+		}
+	}
+	return frames, nil
+}
+
+// thumbnail scales img down to fit in a ThumbnailSize square. Smaller
+// images aren't scaled up.
+func thumbnail(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if longest := max(w, h); longest > ThumbnailSize {
+		w = max(1, w*ThumbnailSize/longest)
+		h = max(1, h*ThumbnailSize/longest)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
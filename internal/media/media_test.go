@@ -0,0 +1,266 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// withOrientation inserts an EXIF segment with the given orientation after
+// the start of image marker of a JPEG.
+func withOrientation(t *testing.T, data []byte, orientation uint16) []byte {
+	t.Helper()
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM")
+	binary.Write(&tiff, binary.BigEndian, uint16(42))
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{exifOrientationTag, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+	return out.Bytes()
+}
+
+func encode(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	// mark the top left corner so rotations can be checked
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatalf("Failed to encode %s: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+// animatedGIF encodes frames 1x1 frames on a w by h canvas, which is tiny
+// however many pixels decoding it would take.
+func animatedGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+
+	g := &gif.GIF{Config: image.Config{Width: w, Height: h, ColorModel: color.Palette{color.Black, color.White}}}
+	for range frames {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	data := animatedGIF(t, 10, 10, 7)
+	if got, err := gifFrames(data, 100); err != nil || got != 7 {
+		t.Errorf("gifFrames() = %d, %v, want 7, nil", got, err)
+	}
+	if got, _ := gifFrames(data, 3); got != 3 {
+		t.Errorf("gifFrames() with limit 3 = %d, want 3", got)
+	}
+	corrupt := append(data[:len(data)-1:len(data)-1], 0x99)
+	if _, err := gifFrames(corrupt, 100); !errors.Is(err, ErrInvalidImage) {
+		t.Errorf("gifFrames() of a corrupt GIF error = %v, want %v", err, ErrInvalidImage)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          []byte
+		wantType      string
+		wantThumbType string
+		wantWidth     int
+		wantHeight    int
+		wantErr       error
+	}{
+		{
+			name:          "jpeg",
+			data:          encode(t, "jpeg", 640, 480),
+			wantType:      "image/jpeg",
+			wantThumbType: "image/jpeg",
+			wantWidth:     640,
+			wantHeight:    480,
+		},
+		{
+			name:          "jpeg needing rotation",
+			data:          withOrientation(t, encode(t, "jpeg", 640, 480), 6),
+			wantType:      "image/jpeg",
+			wantThumbType: "image/jpeg",
+			wantWidth:     480,
+			wantHeight:    640,
+		},
+		{
+			name:          "png",
+			data:          encode(t, "png", 100, 50),
+			wantType:      "image/png",
+			wantThumbType: "image/png",
+			wantWidth:     100,
+			wantHeight:    50,
+		},
+		{
+			name:          "gif",
+			data:          encode(t, "gif", 20, 20),
+			wantType:      "image/gif",
+			wantThumbType: "image/png",
+			wantWidth:     20,
+			wantHeight:    20,
+		},
+		{
+			name:          "animated gif",
+			data:          animatedGIF(t, 20, 20, 3),
+			wantType:      "image/gif",
+			wantThumbType: "image/png",
+			wantWidth:     20,
+			wantHeight:    20,
+		},
+		{
+			// 1000 frames of a million pixels, in a few kilobytes
+			name:    "too many gif frames",
+			data:    animatedGIF(t, 1000, 1000, 1000),
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "not an image",
+			data:    []byte("<html><body>hi</body></html>"),
+			wantErr: ErrUnsupportedType,
+		},
+		{
+			name:    "truncated",
+			data:    encode(t, "png", 100, 50)[:60],
+			wantErr: ErrInvalidImage,
+		},
+		{
+			name:    "too many pixels",
+			data:    encode(t, "png", 6000, 4001),
+			wantErr: ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Process(tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Process() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Process() unexpected error: %v", err)
+			}
+			if img.ContentType != tt.wantType || img.ThumbnailContentType != tt.wantThumbType {
+				t.Errorf("Process() types = %s and %s, want %s and %s", img.ContentType, img.ThumbnailContentType, tt.wantType, tt.wantThumbType)
+			}
+			if img.Width != tt.wantWidth || img.Height != tt.wantHeight {
+				t.Errorf("Process() size = %dx%d, want %dx%d", img.Width, img.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if bytes.Contains(img.Data, []byte("Exif")) {
+				t.Error("Process() kept the EXIF data")
+			}
+
+			thumb, _, err := image.DecodeConfig(bytes.NewReader(img.Thumbnail))
+			if err != nil {
+				t.Fatalf("thumbnail is invalid: %v", err)
+			}
+			if thumb.Width > ThumbnailSize || thumb.Height > ThumbnailSize || thumb.Width*tt.wantHeight != thumb.Height*tt.wantWidth {
+				t.Errorf("thumbnail is %dx%d, want the same aspect ratio within %d", thumb.Width, thumb.Height, ThumbnailSize)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	red := color.RGBA{R: 255, A: 255}
+	img.Set(0, 0, red)
+
+	tests := []struct {
+		orientation int
+		wantX       int
+		wantY       int
+	}{
+		{1, 0, 0},
+		{2, 2, 0},
+		{3, 2, 1},
+		{4, 0, 1},
+		{5, 0, 0},
+		{6, 1, 0},
+		{7, 1, 2},
+		{8, 0, 2},
+	}
+	for _, tt := range tests {
+		got := orient(img, tt.orientation)
+		if c := color.RGBAModel.Convert(got.At(tt.wantX, tt.wantY)); c != red {
+			t.Errorf("orient(%d) moved the top left pixel away from (%d, %d)", tt.orientation, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore() unexpected error: %v", err)
+	}
+
+	err = s.Put(ctx, "abc.jpg", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatalf("Put() unexpected error: %v", err)
+	}
+	f, err := s.Open(ctx, "abc.jpg")
+	if err != nil {
+		t.Fatalf("Open() unexpected error: %v", err)
+	}
+	got, _ := io.ReadAll(f)
+	f.Close()
+	if string(got) != "data" {
+		t.Errorf("Open() read %q, want %q", got, "data")
+	}
+
+	err = s.Delete(ctx, "abc.jpg")
+	if err != nil {
+		t.Fatalf("Delete() unexpected error: %v", err)
+	}
+	if _, err := s.Open(ctx, "abc.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "abc.jpg"); err != nil {
+		t.Errorf("Delete() of a missing blob unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"../escape", "a/b", "", ".hidden"} {
+		if err := s.Put(ctx, key, bytes.NewReader(nil)); err == nil {
+			t.Errorf("Put(%q) should fail", key)
+		}
+	}
+}
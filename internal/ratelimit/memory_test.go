@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryAllow(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 2, Period: 10 * time.Second}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		at             time.Duration
+		key            string
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}{
+		{name: "first request", at: 0, key: "a", wantAllowed: true, wantRemaining: 1},
+		{name: "second request", at: 0, key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "bucket empty", at: time.Second, key: "a", wantAllowed: false, wantRemaining: 0, wantRetryAfter: 4 * time.Second},
+		{name: "other key", at: time.Second, key: "b", wantAllowed: true, wantRemaining: 1},
+		{name: "refilled one token", at: 5 * time.Second, key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "refill is capped at limit", at: time.Hour, key: "a", wantAllowed: true, wantRemaining: 1},
+	}
+
+	m := NewMemory()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.now = func() time.Time { return start.Add(tt.at) }
+
+			res, err := m.Allow(context.Background(), tt.key, policy)
+			if err != nil {
+				t.Fatalf("Allow() unexpected error: %v", err)
+			}
+			if res.Allowed != tt.wantAllowed {
+				t.Errorf("Allow() allowed = %v, want %v", res.Allowed, tt.wantAllowed)
+			}
+			if res.Remaining != tt.wantRemaining {
+				t.Errorf("Allow() remaining = %d, want %d", res.Remaining, tt.wantRemaining)
+			}
+			if res.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("Allow() retry after = %s, want %s", res.RetryAfter, tt.wantRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// idleBucketTTL is how long an unused bucket is kept. It must be longer than
+// the longest policy period, or a bucket could be forgotten before it refills.
+const idleBucketTTL = 24 * time.Hour
+
+// Postgres keeps buckets in the rate_limit_buckets table so every replica
+// shares the same limits. Each request is a single atomic upsert.
+type Postgres struct {
+	queries *database.Queries
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+var _ Limiter = (*Postgres)(nil)
+
+func NewPostgres(queries *database.Queries) *Postgres {
+	return &Postgres{queries: queries}
+}
+
+func (p *Postgres) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	p.sweep(ctx)
+
+	row, err := p.queries.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:        key,
+		Burst:      float64(policy.Limit),
+		RefillRate: policy.refillRate(),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(policy, row.Tokens, row.Allowed), nil
+}
+
+// sweep deletes idle buckets at most once per sweepInterval per replica.
+func (p *Postgres) sweep(ctx context.Context) {
+	p.mu.Lock()
+	now := time.Now()
+	if now.Sub(p.lastSweep) < sweepInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = now
+	p.mu.Unlock()
+
+	_, err := p.queries.DeleteIdleRateLimitBuckets(ctx, idleBucketTTL.Seconds())
+	if err != nil {
+		log.Printf("Error deleting idle rate limit buckets: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Package ratelimit implements token bucket rate limiting with an in-memory
+// backend for single instances and a Postgres backend shared by replicas.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy allows Limit requests per Period. Buckets hold at most Limit tokens
+// and refill continuously, so short bursts up to Limit are allowed.
+type Policy struct {
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// refillRate is the number of tokens added per second.
+func (p Policy) refillRate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is how long until the next request would be allowed. It
+	// is zero when Allowed is true.
+	RetryAfter time.Duration
+}
+
+// Limiter takes a token from the bucket identified by key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// newResult describes a bucket holding tokens after a request was or wasn't
+// allowed.
+func newResult(p Policy, tokens float64, allowed bool) Result {
+	rate := p.refillRate()
+	res := Result{
+		Allowed:    allowed,
+		Limit:      p.Limit,
+		Remaining:  int(math.Floor(math.Max(tokens, 0))),
+		ResetAfter: secondsToDuration((float64(p.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,919 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// Memory is a Store that keeps everything in maps guarded by a single lock.
+// It mirrors the semantics of the SQL queries (ordering, cascades, unique
+// constraints) closely enough to run the HTTP handlers without Postgres.
+type Memory struct {
+	mu sync.RWMutex
+	tables
+
+	// txMu serializes transactions.
+	txMu sync.Mutex
+}
+
+type followKey struct {
+	followerID, followeeID uuid.UUID
+}
+
+type blockKey struct {
+	blockerID, blockedID uuid.UUID
+}
+
+type muteKey struct {
+	muterID, mutedID uuid.UUID
+}
+
+type mutedKeywordKey struct {
+	userID  uuid.UUID
+	keyword string
+}
+
+type likeKey struct {
+	userID, chirpID uuid.UUID
+}
+
+type mentionKey struct {
+	chirpID, userID uuid.UUID
+}
+
+type hashtagKey struct {
+	chirpID uuid.UUID
+	tag     string
+}
+
+type trendingChirpKey struct {
+	period  string
+	chirpID uuid.UUID
+}
+
+type trendingHashtagKey struct {
+	period, tag string
+}
+
+type chirpMediaKey struct {
+	chirpID  uuid.UUID
+	position int16
+}
+
+type tables struct {
+	users                   map[uuid.UUID]database.User
+	chirps                  map[uuid.UUID]database.Chirp
+	refreshTokens           map[string]database.RefreshToken
+	follows                 map[followKey]database.Follow
+	blocks                  map[blockKey]database.Block
+	mutes                   map[muteKey]database.Mute
+	mutedKeywords           map[mutedKeywordKey]database.MutedKeyword
+	chirpLikes              map[likeKey]database.ChirpLike
+	chirpMentions           map[mentionKey]struct{}
+	chirpHashtags           map[hashtagKey]struct{}
+	notifications           map[uuid.UUID]database.Notification
+	notificationPreferences map[uuid.UUID]database.NotificationPreference
+	trendingChirps          map[trendingChirpKey]database.TrendingChirp
+	trendingHashtags        map[trendingHashtagKey]database.TrendingHashtag
+	media                   map[uuid.UUID]database.Media
+	chirpMedia              map[chirpMediaKey]database.ChirpMedia
+	dataExports             map[uuid.UUID]database.DataExport
+	scheduledChirps         map[uuid.UUID]database.ScheduledChirp
+	jobs                    map[uuid.UUID]database.Job
+	auditEvents             map[uuid.UUID]database.AuditEvent
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{tables: newTables()}
+}
+
+func newTables() tables {
+	return tables{
+		users:                   map[uuid.UUID]database.User{},
+		chirps:                  map[uuid.UUID]database.Chirp{},
+		refreshTokens:           map[string]database.RefreshToken{},
+		follows:                 map[followKey]database.Follow{},
+		blocks:                  map[blockKey]database.Block{},
+		mutes:                   map[muteKey]database.Mute{},
+		mutedKeywords:           map[mutedKeywordKey]database.MutedKeyword{},
+		chirpLikes:              map[likeKey]database.ChirpLike{},
+		chirpMentions:           map[mentionKey]struct{}{},
+		chirpHashtags:           map[hashtagKey]struct{}{},
+		notifications:           map[uuid.UUID]database.Notification{},
+		notificationPreferences: map[uuid.UUID]database.NotificationPreference{},
+		trendingChirps:          map[trendingChirpKey]database.TrendingChirp{},
+		trendingHashtags:        map[trendingHashtagKey]database.TrendingHashtag{},
+		media:                   map[uuid.UUID]database.Media{},
+		chirpMedia:              map[chirpMediaKey]database.ChirpMedia{},
+		dataExports:             map[uuid.UUID]database.DataExport{},
+		scheduledChirps:         map[uuid.UUID]database.ScheduledChirp{},
+		jobs:                    map[uuid.UUID]database.Job{},
+		auditEvents:             map[uuid.UUID]database.AuditEvent{},
+	}
+}
+
+func (t tables) clone() tables {
+	return tables{
+		users:                   maps.Clone(t.users),
+		chirps:                  maps.Clone(t.chirps),
+		refreshTokens:           maps.Clone(t.refreshTokens),
+		follows:                 maps.Clone(t.follows),
+		blocks:                  maps.Clone(t.blocks),
+		mutes:                   maps.Clone(t.mutes),
+		mutedKeywords:           maps.Clone(t.mutedKeywords),
+		chirpLikes:              maps.Clone(t.chirpLikes),
+		chirpMentions:           maps.Clone(t.chirpMentions),
+		chirpHashtags:           maps.Clone(t.chirpHashtags),
+		notifications:           maps.Clone(t.notifications),
+		notificationPreferences: maps.Clone(t.notificationPreferences),
+		trendingChirps:          maps.Clone(t.trendingChirps),
+		trendingHashtags:        maps.Clone(t.trendingHashtags),
+		media:                   maps.Clone(t.media),
+		chirpMedia:              maps.Clone(t.chirpMedia),
+		dataExports:             maps.Clone(t.dataExports),
+		scheduledChirps:         maps.Clone(t.scheduledChirps),
+		jobs:                    maps.Clone(t.jobs),
+		auditEvents:             maps.Clone(t.auditEvents),
+	}
+}
+
+// WithTx runs transactions one at a time and rolls back by restoring a
+// snapshot. Writes made outside a transaction while it runs are lost if it
+// rolls back, which is fine for tests but not for real concurrency.
+func (m *Memory) WithTx(ctx context.Context, fn func(Store) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.RLock()
+	saved := m.tables.clone()
+	m.mu.RUnlock()
+
+	err := fn(memoryTx{m})
+	if err != nil {
+		m.mu.Lock()
+		m.tables = saved
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// memoryTx is the Store given to a transaction's fn. Nested transactions
+// join the outer one rather than waiting for it.
+type memoryTx struct {
+	*Memory
+}
+
+func (tx memoryTx) WithTx(ctx context.Context, fn func(Store) error) error {
+	return fn(tx)
+}
+
+func (m *Memory) TruncateAllTables(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tables = newTables()
+	return nil
+}
+
+// TryAdvisoryXactLock always succeeds because transactions already run
+// one at a time.
+func (m *Memory) TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error) {
+	return true, nil
+}
+
+// now matches the precision of Postgres timestamps.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    "duplicate key value violates unique constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    "insert or update violates foreign key constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+func checkViolation(constraint string) error {
+	return &pq.Error{
+		Code:       "23514",
+		Message:    "new row violates check constraint \"" + constraint + "\"",
+		Constraint: constraint,
+	}
+}
+
+func sortChirps(chirps []database.Chirp) {
+	sort.SliceStable(chirps, func(i, j int) bool {
+		return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
+	})
+}
+
+// newerFirst orders rows by (created_at, id) descending like the paginated
+// queries, comparing UUIDs bytewise as Postgres does.
+func newerFirst(aCreatedAt time.Time, aID uuid.UUID, bCreatedAt time.Time, bID uuid.UUID) bool {
+	if !aCreatedAt.Equal(bCreatedAt) {
+		return aCreatedAt.After(bCreatedAt)
+	}
+	return bytes.Compare(aID[:], bID[:]) > 0
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, uniqueViolation("users_email_key")
+	}
+	if arg.Handle.Valid && m.handleTaken(arg.Handle.String, uuid.Nil) {
+		return database.User{}, uniqueViolation("users_handle_key")
+	}
+
+	t := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Handle:         arg.Handle,
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) emailTaken(email string, except uuid.UUID) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTaken compares handles case-insensitively, like the users_handle_key
+// index on lower(handle).
+func (m *Memory) handleTaken(handle string, except uuid.UUID) bool {
+	for _, u := range m.users {
+		if u.Handle.Valid && strings.EqualFold(u.Handle.String, handle) && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) GetUsersByHandles(ctx context.Context, handles []string) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []database.User
+	for _, u := range m.users {
+		if u.Handle.Valid && slices.Contains(handles, strings.ToLower(u.Handle.String)) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (m *Memory) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []database.User
+	for id, u := range m.users {
+		if slices.Contains(ids, id) {
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Handle.Valid && strings.EqualFold(u.Handle.String, handle) {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+// GetUserStats doesn't count hidden chirps.
+func (m *Memory) GetUserStats(ctx context.Context, userID uuid.UUID) (database.GetUserStatsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var stats database.GetUserStatsRow
+	for _, c := range m.chirps {
+		if c.UserID == userID && !c.HiddenAt.Valid {
+			stats.ChirpCount++
+		}
+	}
+	for key := range m.follows {
+		if key.followeeID == userID {
+			stats.FollowerCount++
+		}
+		if key.followerID == userID {
+			stats.FollowingCount++
+		}
+	}
+	return stats, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if m.emailTaken(arg.Email, arg.ID) {
+		return database.User{}, uniqueViolation("users_email_key")
+	}
+
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.UpdatedAt = now()
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if arg.SetHandle {
+		if arg.Handle.Valid && m.handleTaken(arg.Handle.String, arg.ID) {
+			return database.User{}, uniqueViolation("users_handle_key")
+		}
+		user.Handle = arg.Handle
+	}
+	if arg.SetAvatar {
+		if _, ok := m.media[arg.AvatarMediaID.UUID]; arg.AvatarMediaID.Valid && !ok {
+			return database.User{}, foreignKeyViolation("users_avatar_media_id_fkey")
+		}
+		user.AvatarMediaID = arg.AvatarMediaID
+	}
+	if arg.DisplayName.Valid {
+		user.DisplayName = arg.DisplayName.String
+	}
+	if arg.Bio.Valid {
+		user.Bio = arg.Bio.String
+	}
+	user.UpdatedAt = now()
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsChirpyRed = true
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, user := range m.users {
+		if user.Email == arg.Email {
+			user.IsAdmin = arg.IsAdmin
+			user.UpdatedAt = now()
+			m.users[id] = user
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DeletionScheduledAt = sql.NullTime{Time: arg.DeletionScheduledAt, Valid: true}
+	user.UpdatedAt = now()
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) CancelUserDeletion(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DeletionScheduledAt = sql.NullTime{}
+	user.UpdatedAt = now()
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) GetUsersDueForDeletion(ctx context.Context, arg database.GetUsersDueForDeletionParams) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var due []database.User
+	for _, user := range m.users {
+		if user.DeletionScheduledAt.Valid && !user.DeletionScheduledAt.Time.After(arg.DueBefore) {
+			due = append(due, user)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].DeletionScheduledAt.Time.Before(due[j].DeletionScheduledAt.Time)
+	})
+
+	ids := []uuid.UUID{}
+	for _, user := range due {
+		if len(ids) == int(arg.MaxResults) {
+			break
+		}
+		ids = append(ids, user.ID)
+	}
+	return ids, nil
+}
+
+// DeleteUser also removes everything that references the user, like the
+// foreign keys do: their chirps (with those chirps' own cascades), tokens,
+// follows, blocks, mutes, likes, mentions, notifications, media and
+// exports. Avatars set
+// to their media are cleared.
+func (m *Memory) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[id]; !ok {
+		return nil
+	}
+	delete(m.users, id)
+
+	for chirpID, c := range m.chirps {
+		if c.UserID == id {
+			m.deleteChirp(chirpID)
+		}
+	}
+	for token, t := range m.refreshTokens {
+		if t.UserID == id {
+			delete(m.refreshTokens, token)
+		}
+	}
+	for key := range m.follows {
+		if key.followerID == id || key.followeeID == id {
+			delete(m.follows, key)
+		}
+	}
+	for key := range m.blocks {
+		if key.blockerID == id || key.blockedID == id {
+			delete(m.blocks, key)
+		}
+	}
+	for key := range m.mutes {
+		if key.muterID == id || key.mutedID == id {
+			delete(m.mutes, key)
+		}
+	}
+	for key := range m.mutedKeywords {
+		if key.userID == id {
+			delete(m.mutedKeywords, key)
+		}
+	}
+	for key := range m.chirpLikes {
+		if key.userID == id {
+			delete(m.chirpLikes, key)
+		}
+	}
+	for key := range m.chirpMentions {
+		if key.userID == id {
+			delete(m.chirpMentions, key)
+		}
+	}
+	for nID, n := range m.notifications {
+		if n.UserID == id || n.ActorID == id {
+			delete(m.notifications, nID)
+		}
+	}
+	delete(m.notificationPreferences, id)
+	for mediaID, media := range m.media {
+		if media.UserID != id {
+			continue
+		}
+		delete(m.media, mediaID)
+		for key, cm := range m.chirpMedia {
+			if cm.MediaID == mediaID {
+				delete(m.chirpMedia, key)
+			}
+		}
+		for userID, user := range m.users {
+			if user.AvatarMediaID.Valid && user.AvatarMediaID.UUID == mediaID {
+				user.AvatarMediaID = uuid.NullUUID{}
+				m.users[userID] = user
+			}
+		}
+	}
+	for exportID, export := range m.dataExports {
+		if export.UserID == id {
+			delete(m.dataExports, exportID)
+		}
+	}
+	for scheduledID, c := range m.scheduledChirps {
+		if c.UserID == id {
+			delete(m.scheduledChirps, scheduledID)
+		}
+	}
+	return nil
+}
+
+// DeleteAllUsers also removes everything that references a user, like the
+// ON DELETE CASCADE foreign keys do.
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tables = newTables()
+	return nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, foreignKeyViolation("chirps_user_id_fkey")
+	}
+	if !validVisibility(arg.Visibility) {
+		return database.Chirp{}, checkViolation("chirps_visibility_check")
+	}
+
+	t := now()
+	chirp := database.Chirp{
+		ID:         uuid.New(),
+		CreatedAt:  t,
+		UpdatedAt:  t,
+		Body:       arg.Body,
+		UserID:     arg.UserID,
+		ReplyToID:  arg.ReplyToID,
+		Visibility: arg.Visibility,
+	}
+	chirp.ThreadID = chirp.ID
+	if arg.ReplyToID.Valid {
+		parent, ok := m.chirps[arg.ReplyToID.UUID]
+		if !ok {
+			return database.Chirp{}, foreignKeyViolation("chirps_reply_to_id_fkey")
+		}
+		chirp.ThreadID = parent.ThreadID
+	}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) GetChirps(ctx context.Context) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chirps []database.Chirp
+	for _, c := range m.chirps {
+		if c.Visibility == "public" {
+			chirps = append(chirps, c)
+		}
+	}
+	sortChirps(chirps)
+	return chirps, nil
+}
+
+func (m *Memory) GetChirpsByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chirps []database.Chirp
+	for _, c := range m.chirps {
+		if c.UserID == userID {
+			chirps = append(chirps, c)
+		}
+	}
+	sortChirps(chirps)
+	return chirps, nil
+}
+
+func (m *Memory) GetChirpsByThreadID(ctx context.Context, threadID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var chirps []database.Chirp
+	for _, c := range m.chirps {
+		if c.ThreadID == threadID {
+			chirps = append(chirps, c)
+		}
+	}
+	sortChirps(chirps)
+	return chirps, nil
+}
+
+func (m *Memory) GetTimeline(ctx context.Context, arg database.GetTimelineParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.chirpsPage(arg.Before, arg.MaxResults, func(c database.Chirp) bool {
+		_, following := m.follows[followKey{arg.UserID, c.UserID}]
+		return c.UserID == arg.UserID || following
+	}), nil
+}
+
+// chirpsPage returns up to limit chirps matching keep that come after
+// before, newest first, like the paginated chirp queries.
+func (m *Memory) chirpsPage(before uuid.NullUUID, limit int32, keep func(database.Chirp) bool) []database.Chirp {
+	var cursor database.Chirp
+	if before.Valid {
+		var ok bool
+		cursor, ok = m.chirps[before.UUID]
+		// the query compares against NULL, which matches nothing
+		if !ok {
+			return nil
+		}
+	}
+
+	var chirps []database.Chirp
+	for _, c := range m.chirps {
+		if !keep(c) {
+			continue
+		}
+		if before.Valid && !newerFirst(cursor.CreatedAt, cursor.ID, c.CreatedAt, c.ID) {
+			continue
+		}
+		chirps = append(chirps, c)
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return newerFirst(chirps[i].CreatedAt, chirps[i].ID, chirps[j].CreatedAt, chirps[j].ID)
+	})
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+	}
+	return chirps
+}
+
+// DeleteChirp also removes the chirp's likes, notifications, trending
+// entries and media attachments and detaches its replies, like the foreign
+// keys do.
+func (m *Memory) DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirp, ok := m.chirps[arg.ID]
+	if !ok || chirp.UserID != arg.UserID {
+		return nil
+	}
+	m.deleteChirp(arg.ID)
+	return nil
+}
+
+// deleteChirp cascades a chirp's deletion. The caller must hold m.mu.
+func (m *Memory) deleteChirp(chirpID uuid.UUID) {
+	delete(m.chirps, chirpID)
+
+	for id, c := range m.chirps {
+		if c.ReplyToID.Valid && c.ReplyToID.UUID == chirpID {
+			c.ReplyToID = uuid.NullUUID{}
+			m.chirps[id] = c
+		}
+	}
+	for key := range m.chirpLikes {
+		if key.chirpID == chirpID {
+			delete(m.chirpLikes, key)
+		}
+	}
+	for key := range m.chirpMentions {
+		if key.chirpID == chirpID {
+			delete(m.chirpMentions, key)
+		}
+	}
+	for key := range m.chirpHashtags {
+		if key.chirpID == chirpID {
+			delete(m.chirpHashtags, key)
+		}
+	}
+	for id, n := range m.notifications {
+		if n.ChirpID.Valid && n.ChirpID.UUID == chirpID {
+			delete(m.notifications, id)
+		}
+	}
+	for key := range m.trendingChirps {
+		if key.chirpID == chirpID {
+			delete(m.trendingChirps, key)
+		}
+	}
+	for key := range m.chirpMedia {
+		if key.chirpID == chirpID {
+			delete(m.chirpMedia, key)
+		}
+	}
+	for id, c := range m.scheduledChirps {
+		if c.ReplyToID.Valid && c.ReplyToID.UUID == chirpID {
+			c.ReplyToID = uuid.NullUUID{}
+			m.scheduledChirps[id] = c
+		}
+	}
+}
+
+func (m *Memory) SetChirpHidden(ctx context.Context, arg database.SetChirpHiddenParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirp, ok := m.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	switch {
+	case !arg.Hidden:
+		chirp.HiddenAt = sql.NullTime{}
+	case !chirp.HiddenAt.Valid:
+		chirp.HiddenAt = sql.NullTime{Time: now(), Valid: true}
+	}
+	m.chirps[arg.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("refresh_tokens_user_id_fkey")
+	}
+	if _, ok := m.refreshTokens[arg.ID]; ok {
+		return uniqueViolation("refresh_tokens_pkey")
+	}
+
+	t := now()
+	m.refreshTokens[arg.ID] = database.RefreshToken{
+		ID:        arg.ID,
+		TokenHash: bytes.Clone(arg.TokenHash),
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, id string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	refreshToken, ok := m.refreshTokens[id]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refreshToken, nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	refreshToken, ok := m.refreshTokens[id]
+	if !ok || refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now()) {
+		return database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+	}
+	user, ok := m.users[refreshToken.UserID]
+	if !ok {
+		return database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+	}
+	return database.GetUserFromRefreshTokenRow{User: user, TokenHash: refreshToken.TokenHash}, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refreshToken, ok := m.refreshTokens[id]
+	if !ok {
+		return nil
+	}
+	t := now()
+	refreshToken.RevokedAt = sql.NullTime{Time: t, Valid: true}
+	refreshToken.UpdatedAt = t
+	m.refreshTokens[id] = refreshToken
+	return nil
+}
+
+func (m *Memory) GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tokens []database.RefreshToken
+	for _, t := range m.refreshTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+func (m *Memory) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	for id, refreshToken := range m.refreshTokens {
+		if refreshToken.UserID != userID || refreshToken.RevokedAt.Valid {
+			continue
+		}
+		refreshToken.RevokedAt = sql.NullTime{Time: t, Valid: true}
+		refreshToken.UpdatedAt = t
+		m.refreshTokens[id] = refreshToken
+	}
+	return nil
+}
+
+func (m *Memory) DeleteStaleRefreshTokens(ctx context.Context, arg database.DeleteStaleRefreshTokensParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, refreshToken := range m.refreshTokens {
+		if deleted >= int64(arg.MaxResults) {
+			break
+		}
+		if refreshToken.ExpiresAt.Before(arg.StaleBefore) ||
+			refreshToken.RevokedAt.Valid && refreshToken.RevokedAt.Time.Before(arg.StaleBefore) {
+			delete(m.refreshTokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
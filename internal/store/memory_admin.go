@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// ilikeContains reports whether s contains pattern, ignoring case, as
+// ILIKE '%' || pattern || '%' does for a pattern whose wildcards are
+// escaped with backslashes.
+func ilikeContains(s, pattern string) bool {
+	var literal strings.Builder
+	escaped := false
+	for _, r := range pattern {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		literal.WriteRune(r)
+	}
+	return strings.Contains(strings.ToLower(s), strings.ToLower(literal.String()))
+}
+
+func (m *Memory) SearchUsers(ctx context.Context, arg database.SearchUsersParams) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var before database.User
+	if arg.Before.Valid {
+		var ok bool
+		before, ok = m.users[arg.Before.UUID]
+		// the query compares against NULL, which matches nothing
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	var users []database.User
+	for _, user := range m.users {
+		if arg.Pattern != "" && !ilikeContains(user.Email, arg.Pattern) &&
+			!(user.Handle.Valid && ilikeContains(user.Handle.String, arg.Pattern)) {
+			continue
+		}
+		if arg.Before.Valid && !newerFirst(before.CreatedAt, before.ID, user.CreatedAt, user.ID) {
+			continue
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return newerFirst(users[i].CreatedAt, users[i].ID, users[j].CreatedAt, users[j].ID)
+	})
+	if len(users) > int(arg.MaxResults) {
+		users = users[:arg.MaxResults]
+	}
+	return users, nil
+}
+
+func (m *Memory) SetUserChirpyRed(ctx context.Context, arg database.SetUserChirpyRedParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.IsChirpyRed = arg.IsChirpyRed
+	user.UpdatedAt = now()
+	m.users[arg.ID] = user
+	return user, nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	t := now()
+	if !user.SuspendedAt.Valid {
+		user.SuspendedAt = sql.NullTime{Time: t, Valid: true}
+	}
+	user.UpdatedAt = t
+	m.users[id] = user
+	return user, nil
+}
+
+func (m *Memory) UnsuspendUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.SuspendedAt = sql.NullTime{}
+	user.UpdatedAt = now()
+	m.users[id] = user
+	return user, nil
+}
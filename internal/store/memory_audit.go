@@ -0,0 +1,73 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.Outcome != "success" && arg.Outcome != "failure" {
+		return database.AuditEvent{}, checkViolation("audit_events_outcome_check")
+	}
+
+	e := database.AuditEvent{
+		ID:         uuid.New(),
+		CreatedAt:  now(),
+		Action:     arg.Action,
+		Outcome:    arg.Outcome,
+		ActorID:    arg.ActorID,
+		TargetType: arg.TargetType,
+		TargetID:   arg.TargetID,
+		IP:         arg.IP,
+		UserAgent:  arg.UserAgent,
+		RequestID:  arg.RequestID,
+		Details:    bytes.Clone(arg.Details),
+	}
+	m.auditEvents[e.ID] = e
+	return e, nil
+}
+
+func (m *Memory) GetAuditEvents(ctx context.Context, arg database.GetAuditEventsParams) ([]database.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var before database.AuditEvent
+	if arg.Before.Valid {
+		var ok bool
+		before, ok = m.auditEvents[arg.Before.UUID]
+		// the query compares against NULL, which matches nothing
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	var events []database.AuditEvent
+	for _, e := range m.auditEvents {
+		if arg.Action.Valid && e.Action != arg.Action.String ||
+			arg.Outcome.Valid && e.Outcome != arg.Outcome.String ||
+			arg.ActorID.Valid && e.ActorID != arg.ActorID ||
+			arg.TargetID.Valid && e.TargetID != arg.TargetID ||
+			arg.Since.Valid && e.CreatedAt.Before(arg.Since.Time) ||
+			arg.Until.Valid && !e.CreatedAt.Before(arg.Until.Time) {
+			continue
+		}
+		if arg.Before.Valid && !newerFirst(before.CreatedAt, before.ID, e.CreatedAt, e.ID) {
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return newerFirst(events[i].CreatedAt, events[i].ID, events[j].CreatedAt, events[j].ID)
+	})
+	if len(events) > int(arg.MaxResults) {
+		events = events[:arg.MaxResults]
+	}
+	return events, nil
+}
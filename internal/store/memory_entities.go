@@ -0,0 +1,81 @@
+package store
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateChirpMention(ctx context.Context, arg database.CreateChirpMentionParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_mentions_chirp_id_fkey")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return foreignKeyViolation("chirp_mentions_user_id_fkey")
+	}
+	m.chirpMentions[mentionKey{arg.ChirpID, arg.UserID}] = struct{}{}
+	return nil
+}
+
+func (m *Memory) GetChirpMentions(ctx context.Context, chirpIDs []uuid.UUID) ([]database.GetChirpMentionsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.GetChirpMentionsRow
+	for key := range m.chirpMentions {
+		user := m.users[key.userID]
+		if !slices.Contains(chirpIDs, key.chirpID) || !user.Handle.Valid {
+			continue
+		}
+		rows = append(rows, database.GetChirpMentionsRow{
+			ChirpID: key.chirpID,
+			Handle:  strings.ToLower(user.Handle.String),
+		})
+	}
+	slices.SortFunc(rows, func(a, b database.GetChirpMentionsRow) int {
+		if c := bytes.Compare(a.ChirpID[:], b.ChirpID[:]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Handle, b.Handle)
+	})
+	return rows, nil
+}
+
+func (m *Memory) CreateChirpHashtag(ctx context.Context, arg database.CreateChirpHashtagParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_hashtags_chirp_id_fkey")
+	}
+	m.chirpHashtags[hashtagKey{arg.ChirpID, arg.Tag}] = struct{}{}
+	return nil
+}
+
+func (m *Memory) GetChirpsByHashtag(ctx context.Context, arg database.GetChirpsByHashtagParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.chirpsPage(arg.Before, arg.MaxResults, func(c database.Chirp) bool {
+		_, ok := m.chirpHashtags[hashtagKey{c.ID, arg.Tag}]
+		return ok && c.Visibility == "public"
+	}), nil
+}
+
+func (m *Memory) GetChirpsMentioningUser(ctx context.Context, arg database.GetChirpsMentioningUserParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.chirpsPage(arg.Before, arg.MaxResults, func(c database.Chirp) bool {
+		_, ok := m.chirpMentions[mentionKey{c.ID, arg.UserID}]
+		return ok
+	}), nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return database.DataExport{}, foreignKeyViolation("data_exports_user_id_fkey")
+	}
+
+	export := database.DataExport{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    userID,
+		Status:    "pending",
+	}
+	m.dataExports[export.ID] = export
+	return export, nil
+}
+
+func (m *Memory) GetLatestDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var latest database.DataExport
+	found := false
+	for _, export := range m.dataExports {
+		if export.UserID == userID && (!found || export.CreatedAt.After(latest.CreatedAt)) {
+			latest = export
+			found = true
+		}
+	}
+	if !found {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (m *Memory) GetDataExportsByUserID(ctx context.Context, userID uuid.UUID) ([]database.DataExport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var exports []database.DataExport
+	for _, export := range m.dataExports {
+		if export.UserID == userID {
+			exports = append(exports, export)
+		}
+	}
+	return exports, nil
+}
+
+func (m *Memory) ClaimDataExport(ctx context.Context, staleBefore time.Time) (database.DataExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var queued []database.DataExport
+	for _, export := range m.dataExports {
+		if export.Status == "pending" || (export.Status == "running" && export.StartedAt.Time.Before(staleBefore)) {
+			queued = append(queued, export)
+		}
+	}
+	if len(queued) == 0 {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].CreatedAt.Before(queued[j].CreatedAt)
+	})
+
+	export := queued[0]
+	export.Status = "running"
+	export.StartedAt = sql.NullTime{Time: now(), Valid: true}
+	m.dataExports[export.ID] = export
+	return export, nil
+}
+
+func (m *Memory) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) (database.DataExport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	export, ok := m.dataExports[arg.ID]
+	if !ok {
+		return database.DataExport{}, sql.ErrNoRows
+	}
+	export.Status = "ready"
+	export.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+	export.ExpiresAt = sql.NullTime{Time: arg.ExpiresAt, Valid: true}
+	export.SizeBytes = sql.NullInt64{Int64: arg.SizeBytes, Valid: true}
+	m.dataExports[export.ID] = export
+	return export, nil
+}
+
+func (m *Memory) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	export, ok := m.dataExports[id]
+	if !ok {
+		return nil
+	}
+	export.Status = "failed"
+	export.CompletedAt = sql.NullTime{Time: now(), Valid: true}
+	m.dataExports[id] = export
+	return nil
+}
+
+func (m *Memory) DeleteExpiredDataExports(ctx context.Context, expiredBefore time.Time) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := []uuid.UUID{}
+	for id, export := range m.dataExports {
+		if export.ExpiresAt.Valid && !export.ExpiresAt.Time.After(expiredBefore) {
+			delete(m.dataExports, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
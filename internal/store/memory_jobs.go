@@ -0,0 +1,192 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateJob(ctx context.Context, arg database.CreateJobParams) (database.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.MaxAttempts <= 0 {
+		return database.Job{}, checkViolation("jobs_max_attempts_check")
+	}
+
+	t := now()
+	job := database.Job{
+		ID:          uuid.New(),
+		CreatedAt:   t,
+		UpdatedAt:   t,
+		Kind:        arg.Kind,
+		Payload:     bytes.Clone(arg.Payload),
+		Status:      "pending",
+		MaxAttempts: arg.MaxAttempts,
+		RunAt:       arg.RunAt,
+	}
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *Memory) KillExpiredJobs(ctx context.Context, t time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var killed int64
+	for id, job := range m.jobs {
+		if job.Status != "running" || !job.LockedUntil.Time.Before(t) || job.Attempts < job.MaxAttempts {
+			continue
+		}
+		job.Status = "dead"
+		job.LockedUntil = sql.NullTime{}
+		job.LastError = sql.NullString{String: "lease expired", Valid: true}
+		job.UpdatedAt = now()
+		m.jobs[id] = job
+		killed++
+	}
+	return killed, nil
+}
+
+func (m *Memory) ClaimJob(ctx context.Context, arg database.ClaimJobParams) (database.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var queued []database.Job
+	for _, job := range m.jobs {
+		if job.Status == "pending" && !job.RunAt.After(arg.Now) ||
+			job.Status == "running" && job.LockedUntil.Time.Before(arg.Now) && job.Attempts < job.MaxAttempts {
+			queued = append(queued, job)
+		}
+	}
+	if len(queued) == 0 {
+		return database.Job{}, sql.ErrNoRows
+	}
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].RunAt.Before(queued[j].RunAt)
+	})
+
+	job := queued[0]
+	job.Status = "running"
+	job.Attempts++
+	job.LockedUntil = sql.NullTime{Time: arg.LockedUntil, Valid: true}
+	job.UpdatedAt = now()
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+// claimedJob returns the job if it is still running the given attempt.
+func (m *Memory) claimedJob(id uuid.UUID, attempts int32) (database.Job, bool) {
+	job, ok := m.jobs[id]
+	return job, ok && job.Attempts == attempts && job.Status == "running"
+}
+
+func (m *Memory) CompleteJob(ctx context.Context, arg database.CompleteJobParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.claimedJob(arg.ID, arg.Attempts); !ok {
+		return 0, nil
+	}
+	delete(m.jobs, arg.ID)
+	return 1, nil
+}
+
+func (m *Memory) RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.claimedJob(arg.ID, arg.Attempts)
+	if !ok {
+		return 0, nil
+	}
+	job.Status = "pending"
+	job.RunAt = arg.RunAt
+	job.LockedUntil = sql.NullTime{}
+	job.LastError = sql.NullString{String: arg.LastError, Valid: true}
+	job.UpdatedAt = now()
+	m.jobs[job.ID] = job
+	return 1, nil
+}
+
+func (m *Memory) KillJob(ctx context.Context, arg database.KillJobParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.claimedJob(arg.ID, arg.Attempts)
+	if !ok {
+		return 0, nil
+	}
+	job.Status = "dead"
+	job.LockedUntil = sql.NullTime{}
+	job.LastError = sql.NullString{String: arg.LastError, Valid: true}
+	job.UpdatedAt = now()
+	m.jobs[job.ID] = job
+	return 1, nil
+}
+
+func (m *Memory) GetJobByID(ctx context.Context, id uuid.UUID) (database.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return database.Job{}, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+func (m *Memory) GetJobs(ctx context.Context, arg database.GetJobsParams) ([]database.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var before database.Job
+	if arg.Before.Valid {
+		var ok bool
+		before, ok = m.jobs[arg.Before.UUID]
+		// the query compares against NULL, which matches nothing
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	var jobs []database.Job
+	for _, job := range m.jobs {
+		if arg.Status.Valid && job.Status != arg.Status.String {
+			continue
+		}
+		if arg.Before.Valid && !newerFirst(before.CreatedAt, before.ID, job.CreatedAt, job.ID) {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return newerFirst(jobs[i].CreatedAt, jobs[i].ID, jobs[j].CreatedAt, jobs[j].ID)
+	})
+	if len(jobs) > int(arg.MaxResults) {
+		jobs = jobs[:arg.MaxResults]
+	}
+	return jobs, nil
+}
+
+func (m *Memory) RequeueJob(ctx context.Context, id uuid.UUID) (database.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Status != "dead" {
+		return database.Job{}, sql.ErrNoRows
+	}
+	t := now()
+	job.Status = "pending"
+	job.Attempts = 0
+	job.RunAt = t
+	job.UpdatedAt = t
+	m.jobs[job.ID] = job
+	return job, nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Media, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Media{}, foreignKeyViolation("media_user_id_fkey")
+	}
+	if _, ok := m.media[arg.ID]; ok {
+		return database.Media{}, uniqueViolation("media_pkey")
+	}
+
+	media := database.Media{
+		ID:                   arg.ID,
+		CreatedAt:            now(),
+		UserID:               arg.UserID,
+		ContentType:          arg.ContentType,
+		ThumbnailContentType: arg.ThumbnailContentType,
+		Width:                arg.Width,
+		Height:               arg.Height,
+		SizeBytes:            arg.SizeBytes,
+	}
+	m.media[media.ID] = media
+	return media, nil
+}
+
+func (m *Memory) GetMediaByID(ctx context.Context, id uuid.UUID) (database.Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	media, ok := m.media[id]
+	if !ok {
+		return database.Media{}, sql.ErrNoRows
+	}
+	return media, nil
+}
+
+func (m *Memory) GetMediaByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []database.Media
+	for id, media := range m.media {
+		if slices.Contains(ids, id) {
+			found = append(found, media)
+		}
+	}
+	return found, nil
+}
+
+func (m *Memory) GetMediaByUserID(ctx context.Context, userID uuid.UUID) ([]database.Media, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []database.Media
+	for _, media := range m.media {
+		if media.UserID == userID {
+			found = append(found, media)
+		}
+	}
+	slices.SortFunc(found, func(a, b database.Media) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return found, nil
+}
+
+func (m *Memory) CreateChirpMedia(ctx context.Context, arg database.CreateChirpMediaParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.Position < 0 || arg.Position > 3 {
+		return checkViolation("chirp_media_position_check")
+	}
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return foreignKeyViolation("chirp_media_chirp_id_fkey")
+	}
+	if _, ok := m.media[arg.MediaID]; !ok {
+		return foreignKeyViolation("chirp_media_media_id_fkey")
+	}
+	key := chirpMediaKey{arg.ChirpID, arg.Position}
+	if _, ok := m.chirpMedia[key]; ok {
+		return uniqueViolation("chirp_media_pkey")
+	}
+	for k, cm := range m.chirpMedia {
+		if k.chirpID == arg.ChirpID && cm.MediaID == arg.MediaID {
+			return uniqueViolation("chirp_media_chirp_id_media_id_key")
+		}
+	}
+
+	m.chirpMedia[key] = database.ChirpMedia(arg)
+	return nil
+}
+
+func (m *Memory) GetChirpMedia(ctx context.Context, chirpIDs []uuid.UUID) ([]database.GetChirpMediaRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keys []chirpMediaKey
+	for key := range m.chirpMedia {
+		if slices.Contains(chirpIDs, key.chirpID) {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b chirpMediaKey) int {
+		if c := bytes.Compare(a.chirpID[:], b.chirpID[:]); c != 0 {
+			return c
+		}
+		return int(a.position) - int(b.position)
+	})
+
+	var rows []database.GetChirpMediaRow
+	for _, key := range keys {
+		rows = append(rows, database.GetChirpMediaRow{
+			ChirpID: key.chirpID,
+			Media:   m.media[m.chirpMedia[key].MediaID],
+		})
+	}
+	return rows, nil
+}
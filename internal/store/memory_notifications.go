@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+var notificationTypes = map[string]bool{
+	"mention": true,
+	"reply":   true,
+	"like":    true,
+	"follow":  true,
+}
+
+func (m *Memory) CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !notificationTypes[arg.Type] {
+		return database.Notification{}, checkViolation("notifications_type_check")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Notification{}, foreignKeyViolation("notifications_user_id_fkey")
+	}
+	if _, ok := m.users[arg.ActorID]; !ok {
+		return database.Notification{}, foreignKeyViolation("notifications_actor_id_fkey")
+	}
+	if arg.ChirpID.Valid {
+		if _, ok := m.chirps[arg.ChirpID.UUID]; !ok {
+			return database.Notification{}, foreignKeyViolation("notifications_chirp_id_fkey")
+		}
+	}
+
+	n := database.Notification{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		ActorID:   arg.ActorID,
+		Type:      arg.Type,
+		ChirpID:   arg.ChirpID,
+	}
+	m.notifications[n.ID] = n
+	return n, nil
+}
+
+func (m *Memory) GetNotifications(ctx context.Context, arg database.GetNotificationsParams) ([]database.Notification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var before database.Notification
+	if arg.Before.Valid {
+		var ok bool
+		before, ok = m.notifications[arg.Before.UUID]
+		// the query compares against NULL, which matches nothing
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	var notifications []database.Notification
+	for _, n := range m.notifications {
+		if n.UserID != arg.UserID || arg.UnreadOnly && n.ReadAt.Valid || m.notificationHidden(n) {
+			continue
+		}
+		if arg.Before.Valid && !newerFirst(before.CreatedAt, before.ID, n.CreatedAt, n.ID) {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return newerFirst(notifications[i].CreatedAt, notifications[i].ID, notifications[j].CreatedAt, notifications[j].ID)
+	})
+	if len(notifications) > int(arg.MaxResults) {
+		notifications = notifications[:arg.MaxResults]
+	}
+	return notifications, nil
+}
+
+func (m *Memory) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var count int64
+	for _, n := range m.notifications {
+		if n.UserID == userID && !n.ReadAt.Valid && !m.notificationHidden(n) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// notificationHidden reports whether the notification queries leave n out
+// because of the recipient's blocks and mutes. The caller must hold m.mu.
+func (m *Memory) notificationHidden(n database.Notification) bool {
+	if m.blocked(n.UserID, n.ActorID) {
+		return true
+	}
+	if _, ok := m.mutes[muteKey{n.UserID, n.ActorID}]; ok {
+		return true
+	}
+	if !n.ChirpID.Valid {
+		return false
+	}
+	chirp, ok := m.chirps[n.ChirpID.UUID]
+	return ok && m.hasMutedKeyword(n.UserID, chirp.Body)
+}
+
+func (m *Memory) MarkNotificationRead(ctx context.Context, arg database.MarkNotificationReadParams) (database.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notifications[arg.ID]
+	if !ok || n.UserID != arg.UserID {
+		return database.Notification{}, sql.ErrNoRows
+	}
+	if !n.ReadAt.Valid {
+		n.ReadAt = sql.NullTime{Time: now(), Valid: true}
+		m.notifications[n.ID] = n
+	}
+	return n, nil
+}
+
+func (m *Memory) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	var count int64
+	for id, n := range m.notifications {
+		if n.UserID == userID && !n.ReadAt.Valid {
+			n.ReadAt = sql.NullTime{Time: t, Valid: true}
+			m.notifications[id] = n
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) (database.NotificationPreference, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefs, ok := m.notificationPreferences[userID]
+	if !ok {
+		return database.NotificationPreference{}, sql.ErrNoRows
+	}
+	return prefs, nil
+}
+
+func (m *Memory) UpsertNotificationPreferences(ctx context.Context, arg database.UpsertNotificationPreferencesParams) (database.NotificationPreference, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.NotificationPreference{}, foreignKeyViolation("notification_preferences_user_id_fkey")
+	}
+
+	prefs := database.NotificationPreference{
+		UserID:    arg.UserID,
+		UpdatedAt: now(),
+		Mentions:  arg.Mentions,
+		Replies:   arg.Replies,
+		Likes:     arg.Likes,
+		Follows:   arg.Follows,
+	}
+	m.notificationPreferences[arg.UserID] = prefs
+	return prefs, nil
+}
@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func validVisibility(visibility string) bool {
+	return visibility == "public" || visibility == "followers" || visibility == "unlisted"
+}
+
+func (m *Memory) CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.ScheduledChirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.ScheduledChirp{}, foreignKeyViolation("scheduled_chirps_user_id_fkey")
+	}
+	if _, ok := m.chirps[arg.ReplyToID.UUID]; arg.ReplyToID.Valid && !ok {
+		return database.ScheduledChirp{}, foreignKeyViolation("scheduled_chirps_reply_to_id_fkey")
+	}
+	if !validVisibility(arg.Visibility) {
+		return database.ScheduledChirp{}, checkViolation("scheduled_chirps_visibility_check")
+	}
+
+	t := now()
+	c := database.ScheduledChirp{
+		ID:         uuid.New(),
+		CreatedAt:  t,
+		UpdatedAt:  t,
+		UserID:     arg.UserID,
+		Body:       arg.Body,
+		ReplyToID:  arg.ReplyToID,
+		Visibility: arg.Visibility,
+		MediaIds:   slices.Clone(arg.MediaIds),
+		PublishAt:  arg.PublishAt,
+	}
+	m.scheduledChirps[c.ID] = c
+	return c, nil
+}
+
+func (m *Memory) GetScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var scheduled []database.ScheduledChirp
+	for _, c := range m.scheduledChirps {
+		if c.UserID == userID {
+			scheduled = append(scheduled, c)
+		}
+	}
+	sort.Slice(scheduled, func(i, j int) bool {
+		a, b := scheduled[i], scheduled[j]
+		if a.PublishAt.Valid != b.PublishAt.Valid {
+			return a.PublishAt.Valid
+		}
+		if a.PublishAt.Valid && !a.PublishAt.Time.Equal(b.PublishAt.Time) {
+			return a.PublishAt.Time.Before(b.PublishAt.Time)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return scheduled, nil
+}
+
+func (m *Memory) CountScheduledChirps(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var n int64
+	for _, c := range m.scheduledChirps {
+		if c.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetScheduledChirpForUpdate doesn't need to lock anything because
+// transactions already run one at a time.
+func (m *Memory) GetScheduledChirpForUpdate(ctx context.Context, arg database.GetScheduledChirpForUpdateParams) (database.ScheduledChirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.scheduledChirps[arg.ID]
+	if !ok || c.UserID != arg.UserID {
+		return database.ScheduledChirp{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (m *Memory) UpdateScheduledChirp(ctx context.Context, arg database.UpdateScheduledChirpParams) (database.ScheduledChirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.scheduledChirps[arg.ID]
+	if !ok {
+		return database.ScheduledChirp{}, sql.ErrNoRows
+	}
+	if _, ok := m.chirps[arg.ReplyToID.UUID]; arg.ReplyToID.Valid && !ok {
+		return database.ScheduledChirp{}, foreignKeyViolation("scheduled_chirps_reply_to_id_fkey")
+	}
+	if !validVisibility(arg.Visibility) {
+		return database.ScheduledChirp{}, checkViolation("scheduled_chirps_visibility_check")
+	}
+
+	c.Body = arg.Body
+	c.ReplyToID = arg.ReplyToID
+	c.Visibility = arg.Visibility
+	c.MediaIds = slices.Clone(arg.MediaIds)
+	c.PublishAt = arg.PublishAt
+	c.Attempts = 0
+	c.LastError = sql.NullString{}
+	c.UpdatedAt = now()
+	m.scheduledChirps[c.ID] = c
+	return c, nil
+}
+
+func (m *Memory) DeleteScheduledChirp(ctx context.Context, arg database.DeleteScheduledChirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.scheduledChirps[arg.ID]
+	if !ok || c.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.scheduledChirps, arg.ID)
+	return 1, nil
+}
+
+func (m *Memory) ClaimDueScheduledChirp(ctx context.Context, arg database.ClaimDueScheduledChirpParams) (database.ScheduledChirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var due database.ScheduledChirp
+	found := false
+	for _, c := range m.scheduledChirps {
+		if !c.PublishAt.Valid || c.PublishAt.Time.After(arg.DueBefore) {
+			continue
+		}
+		if c.Attempts >= arg.MaxAttempts || slices.Contains(arg.SkipIds, c.ID) {
+			continue
+		}
+		if !found || c.PublishAt.Time.Before(due.PublishAt.Time) {
+			due = c
+			found = true
+		}
+	}
+	if !found {
+		return database.ScheduledChirp{}, sql.ErrNoRows
+	}
+	return due, nil
+}
+
+func (m *Memory) RecordScheduledChirpFailure(ctx context.Context, arg database.RecordScheduledChirpFailureParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.scheduledChirps[arg.ID]
+	if !ok {
+		return nil
+	}
+	c.Attempts++
+	c.LastError = sql.NullString{String: arg.LastError, Valid: true}
+	m.scheduledChirps[c.ID] = c
+	return nil
+}
@@ -0,0 +1,342 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func (m *Memory) CreateFollow(ctx context.Context, arg database.CreateFollowParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Postgres checks CHECK constraints before foreign keys
+	if arg.FollowerID == arg.FolloweeID {
+		return 0, checkViolation("follows_check")
+	}
+	if _, ok := m.users[arg.FollowerID]; !ok {
+		return 0, foreignKeyViolation("follows_follower_id_fkey")
+	}
+	if _, ok := m.users[arg.FolloweeID]; !ok {
+		return 0, foreignKeyViolation("follows_followee_id_fkey")
+	}
+
+	key := followKey{arg.FollowerID, arg.FolloweeID}
+	if _, ok := m.follows[key]; ok {
+		return 0, nil
+	}
+	m.follows[key] = database.Follow{
+		FollowerID: arg.FollowerID,
+		FolloweeID: arg.FolloweeID,
+		CreatedAt:  now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) DeleteFollow(ctx context.Context, arg database.DeleteFollowParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.follows, followKey{arg.FollowerID, arg.FolloweeID})
+	return nil
+}
+
+func (m *Memory) GetFollowsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Follow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var follows []database.Follow
+	for key, f := range m.follows {
+		if key.followerID == userID || key.followeeID == userID {
+			follows = append(follows, f)
+		}
+	}
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].CreatedAt.Before(follows[j].CreatedAt)
+	})
+	return follows, nil
+}
+
+func (m *Memory) GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for key := range m.follows {
+		if key.followerID == followerID {
+			ids = append(ids, key.followeeID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) FollowExists(ctx context.Context, arg database.FollowExistsParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.follows[followKey{arg.FollowerID, arg.FolloweeID}]
+	return ok, nil
+}
+
+func (m *Memory) CreateChirpLike(ctx context.Context, arg database.CreateChirpLikeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, foreignKeyViolation("chirp_likes_user_id_fkey")
+	}
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return 0, foreignKeyViolation("chirp_likes_chirp_id_fkey")
+	}
+
+	key := likeKey{arg.UserID, arg.ChirpID}
+	if _, ok := m.chirpLikes[key]; ok {
+		return 0, nil
+	}
+	m.chirpLikes[key] = database.ChirpLike{
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) DeleteChirpLike(ctx context.Context, arg database.DeleteChirpLikeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.chirpLikes, likeKey{arg.UserID, arg.ChirpID})
+	return nil
+}
+
+func (m *Memory) GetChirpLikesByUserID(ctx context.Context, userID uuid.UUID) ([]database.ChirpLike, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var likes []database.ChirpLike
+	for key, like := range m.chirpLikes {
+		if key.userID == userID {
+			likes = append(likes, like)
+		}
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		return likes[i].CreatedAt.Before(likes[j].CreatedAt)
+	})
+	return likes, nil
+}
+
+func (m *Memory) CreateBlock(ctx context.Context, arg database.CreateBlockParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.BlockerID == arg.BlockedID {
+		return 0, checkViolation("blocks_check")
+	}
+	if _, ok := m.users[arg.BlockerID]; !ok {
+		return 0, foreignKeyViolation("blocks_blocker_id_fkey")
+	}
+	if _, ok := m.users[arg.BlockedID]; !ok {
+		return 0, foreignKeyViolation("blocks_blocked_id_fkey")
+	}
+
+	key := blockKey{arg.BlockerID, arg.BlockedID}
+	if _, ok := m.blocks[key]; ok {
+		return 0, nil
+	}
+	m.blocks[key] = database.Block{
+		BlockerID: arg.BlockerID,
+		BlockedID: arg.BlockedID,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) DeleteBlock(ctx context.Context, arg database.DeleteBlockParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.blocks, blockKey{arg.BlockerID, arg.BlockedID})
+	return nil
+}
+
+func (m *Memory) GetBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var blocks []database.Block
+	for key, b := range m.blocks {
+		if key.blockerID == blockerID {
+			blocks = append(blocks, b)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].CreatedAt.After(blocks[j].CreatedAt)
+	})
+
+	var users []database.User
+	for _, b := range blocks {
+		users = append(users, m.users[b.BlockedID])
+	}
+	return users, nil
+}
+
+func (m *Memory) GetBlockRelatedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for key := range m.blocks {
+		switch userID {
+		case key.blockerID:
+			ids = append(ids, key.blockedID)
+		case key.blockedID:
+			ids = append(ids, key.blockerID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) BlockExists(ctx context.Context, arg database.BlockExistsParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.blocked(arg.UserID, arg.OtherID), nil
+}
+
+// blocked reports whether either user blocked the other. The caller must
+// hold m.mu.
+func (m *Memory) blocked(a, b uuid.UUID) bool {
+	_, ab := m.blocks[blockKey{a, b}]
+	_, ba := m.blocks[blockKey{b, a}]
+	return ab || ba
+}
+
+func (m *Memory) CreateMute(ctx context.Context, arg database.CreateMuteParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.MuterID == arg.MutedID {
+		return 0, checkViolation("mutes_check")
+	}
+	if _, ok := m.users[arg.MuterID]; !ok {
+		return 0, foreignKeyViolation("mutes_muter_id_fkey")
+	}
+	if _, ok := m.users[arg.MutedID]; !ok {
+		return 0, foreignKeyViolation("mutes_muted_id_fkey")
+	}
+
+	key := muteKey{arg.MuterID, arg.MutedID}
+	if _, ok := m.mutes[key]; ok {
+		return 0, nil
+	}
+	m.mutes[key] = database.Mute{
+		MuterID:   arg.MuterID,
+		MutedID:   arg.MutedID,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) DeleteMute(ctx context.Context, arg database.DeleteMuteParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mutes, muteKey{arg.MuterID, arg.MutedID})
+	return nil
+}
+
+func (m *Memory) GetMutedUsers(ctx context.Context, muterID uuid.UUID) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var mutes []database.Mute
+	for key, mute := range m.mutes {
+		if key.muterID == muterID {
+			mutes = append(mutes, mute)
+		}
+	}
+	sort.Slice(mutes, func(i, j int) bool {
+		return mutes[i].CreatedAt.After(mutes[j].CreatedAt)
+	})
+
+	var users []database.User
+	for _, mute := range mutes {
+		users = append(users, m.users[mute.MutedID])
+	}
+	return users, nil
+}
+
+func (m *Memory) GetMutedUserIDs(ctx context.Context, muterID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []uuid.UUID
+	for key := range m.mutes {
+		if key.muterID == muterID {
+			ids = append(ids, key.mutedID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) CreateMutedKeyword(ctx context.Context, arg database.CreateMutedKeywordParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if arg.Keyword == "" || arg.Keyword != strings.ToLower(arg.Keyword) {
+		return 0, checkViolation("muted_keywords_keyword_check")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return 0, foreignKeyViolation("muted_keywords_user_id_fkey")
+	}
+
+	key := mutedKeywordKey{arg.UserID, arg.Keyword}
+	if _, ok := m.mutedKeywords[key]; ok {
+		return 0, nil
+	}
+	m.mutedKeywords[key] = database.MutedKeyword{
+		UserID:    arg.UserID,
+		Keyword:   arg.Keyword,
+		CreatedAt: now(),
+	}
+	return 1, nil
+}
+
+func (m *Memory) DeleteMutedKeyword(ctx context.Context, arg database.DeleteMutedKeywordParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mutedKeywords, mutedKeywordKey{arg.UserID, arg.Keyword})
+	return nil
+}
+
+func (m *Memory) GetMutedKeywords(ctx context.Context, userID uuid.UUID) ([]database.MutedKeyword, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var keywords []database.MutedKeyword
+	for key, k := range m.mutedKeywords {
+		if key.userID == userID {
+			keywords = append(keywords, k)
+		}
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		return keywords[i].Keyword < keywords[j].Keyword
+	})
+	return keywords, nil
+}
+
+// hasMutedKeyword reports whether body contains a keyword the user muted.
+// The caller must hold m.mu.
+func (m *Memory) hasMutedKeyword(userID uuid.UUID, body string) bool {
+	body = strings.ToLower(body)
+	for key := range m.mutedKeywords {
+		if key.userID == userID && strings.Contains(body, key.keyword) {
+			return true
+		}
+	}
+	return false
+}
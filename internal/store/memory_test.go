@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+func TestMemoryCreateUser(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	_, err := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode pq.ErrorCode
+	}{
+		{
+			name:     "duplicate email",
+			email:    "a@example.com",
+			wantCode: "23505",
+		},
+		{
+			name:     "new email",
+			email:    "b@example.com",
+			wantCode: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.CreateUser(ctx, database.CreateUserParams{Email: tt.email, HashedPassword: "hash"})
+			var pqErr *pq.Error
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("CreateUser() unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &pqErr) || pqErr.Code != tt.wantCode {
+				t.Errorf("CreateUser() error = %v, want pq code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMemoryChirps(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	user, err := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() unexpected error: %v", err)
+	}
+
+	_, err = m.CreateChirp(ctx, database.CreateChirpParams{Body: "orphan", UserID: uuid.New(), Visibility: "public"})
+	if err == nil {
+		t.Error("CreateChirp() should fail for an unknown user")
+	}
+	_, err = m.CreateChirp(ctx, database.CreateChirpParams{Body: "secret", UserID: user.ID, Visibility: "private"})
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23514" {
+		t.Errorf("CreateChirp() with an unknown visibility error = %v, want pq code 23514", err)
+	}
+
+	bodies := []string{"first", "second", "third"}
+	for _, body := range bodies {
+		_, err := m.CreateChirp(ctx, database.CreateChirpParams{Body: body, UserID: user.ID, Visibility: "public"})
+		if err != nil {
+			t.Fatalf("CreateChirp() unexpected error: %v", err)
+		}
+	}
+
+	chirps, err := m.GetChirpsByAuthorID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetChirpsByAuthorID() unexpected error: %v", err)
+	}
+	if len(chirps) != len(bodies) {
+		t.Fatalf("GetChirpsByAuthorID() returned %d chirps, want %d", len(chirps), len(bodies))
+	}
+	for i, c := range chirps {
+		if c.Body != bodies[i] {
+			t.Errorf("GetChirpsByAuthorID()[%d] = %q, want %q", i, c.Body, bodies[i])
+		}
+	}
+
+	err = m.DeleteAllUsers(ctx)
+	if err != nil {
+		t.Fatalf("DeleteAllUsers() unexpected error: %v", err)
+	}
+	_, err = m.GetChirpsByID(ctx, chirps[0].ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirpsByID() after DeleteAllUsers error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemoryWithTx(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	errRollback := errors.New("rollback")
+	err := m.WithTx(ctx, func(tx Store) error {
+		_, err := tx.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash"})
+		if err != nil {
+			return err
+		}
+		// nested transactions join the outer one instead of deadlocking
+		return tx.WithTx(ctx, func(tx Store) error {
+			return errRollback
+		})
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx() error = %v, want %v", err, errRollback)
+	}
+	_, err = m.GetUserByEmail(ctx, "a@example.com")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserByEmail() after rollback error = %v, want sql.ErrNoRows", err)
+	}
+
+	err = m.WithTx(ctx, func(tx Store) error {
+		_, err := tx.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash"})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx() unexpected error: %v", err)
+	}
+	_, err = m.GetUserByEmail(ctx, "a@example.com")
+	if err != nil {
+		t.Errorf("GetUserByEmail() after commit unexpected error: %v", err)
+	}
+}
+
+func TestMemoryDeleteChirpCascades(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash"})
+	root, _ := m.CreateChirp(ctx, database.CreateChirpParams{Body: "root", UserID: alice.ID, Visibility: "public"})
+	reply, err := m.CreateChirp(ctx, database.CreateChirpParams{
+		Body:       "reply",
+		UserID:     bob.ID,
+		ReplyToID:  uuid.NullUUID{UUID: root.ID, Valid: true},
+		Visibility: "public",
+	})
+	if err != nil {
+		t.Fatalf("CreateChirp() unexpected error: %v", err)
+	}
+	if reply.ThreadID != root.ID {
+		t.Errorf("reply ThreadID = %s, want %s", reply.ThreadID, root.ID)
+	}
+
+	_, err = m.CreateChirpLike(ctx, database.CreateChirpLikeParams{UserID: bob.ID, ChirpID: root.ID})
+	if err != nil {
+		t.Fatalf("CreateChirpLike() unexpected error: %v", err)
+	}
+	_, err = m.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID:  alice.ID,
+		ActorID: bob.ID,
+		Type:    "like",
+		ChirpID: uuid.NullUUID{UUID: root.ID, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateNotification() unexpected error: %v", err)
+	}
+
+	err = m.DeleteChirp(ctx, database.DeleteChirpParams{UserID: alice.ID, ID: root.ID})
+	if err != nil {
+		t.Fatalf("DeleteChirp() unexpected error: %v", err)
+	}
+
+	reply, _ = m.GetChirpsByID(ctx, reply.ID)
+	if reply.ReplyToID.Valid || reply.ThreadID != root.ID {
+		t.Errorf("reply after deleting its parent = %+v, want no reply_to_id and the same thread", reply)
+	}
+	if n, _ := m.CountUnreadNotifications(ctx, alice.ID); n != 0 {
+		t.Errorf("CountUnreadNotifications() = %d, want 0", n)
+	}
+	if len(m.chirpLikes) != 0 {
+		t.Errorf("%d likes left after deleting the chirp, want 0", len(m.chirpLikes))
+	}
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// decayed weighs engagement at time at the way the trending queries do.
+func decayed(weight float64, at, computedAt time.Time, halfLifeSeconds float64) float64 {
+	return weight * math.Pow(0.5, computedAt.Sub(at).Seconds()/halfLifeSeconds)
+}
+
+func (m *Memory) DeleteTrendingChirps(ctx context.Context, period string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.trendingChirps {
+		if key.period == period {
+			delete(m.trendingChirps, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) InsertTrendingChirps(ctx context.Context, arg database.InsertTrendingChirpsParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	since := t.Add(-time.Duration(arg.PeriodSeconds * float64(time.Second)))
+	scores := map[trendingChirpKey]float64{}
+	add := func(chirpKey trendingChirpKey, weight float64, at time.Time) {
+		chirp, ok := m.chirps[chirpKey.chirpID]
+		if !ok || chirp.HiddenAt.Valid || chirp.Visibility != "public" || !at.After(since) {
+			return
+		}
+		scores[chirpKey] += decayed(weight, at, t, arg.HalfLifeSeconds)
+	}
+	for _, like := range m.chirpLikes {
+		add(trendingChirpKey{arg.Period, like.ChirpID}, 1, like.CreatedAt)
+	}
+	for _, reply := range m.chirps {
+		if reply.ReplyToID.Valid && !reply.HiddenAt.Valid {
+			add(trendingChirpKey{arg.Period, reply.ReplyToID.UUID}, 2, reply.CreatedAt)
+		}
+	}
+
+	rows := make([]database.TrendingChirp, 0, len(scores))
+	for key, score := range scores {
+		if _, ok := m.trendingChirps[key]; ok {
+			return 0, uniqueViolation("trending_chirps_pkey")
+		}
+		rows = append(rows, database.TrendingChirp{Period: key.period, ChirpID: key.chirpID, Score: score, ComputedAt: t})
+	}
+	slices.SortFunc(rows, func(a, b database.TrendingChirp) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	rows = rows[:min(len(rows), int(arg.MaxResults))]
+	for _, row := range rows {
+		m.trendingChirps[trendingChirpKey{row.Period, row.ChirpID}] = row
+	}
+	return int64(len(rows)), nil
+}
+
+func (m *Memory) GetTrendingChirps(ctx context.Context, arg database.GetTrendingChirpsParams) ([]database.GetTrendingChirpsRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.GetTrendingChirpsRow
+	for key, trending := range m.trendingChirps {
+		chirp, ok := m.chirps[key.chirpID]
+		if key.period != arg.Period || !ok || chirp.HiddenAt.Valid {
+			continue
+		}
+		rows = append(rows, database.GetTrendingChirpsRow{Chirp: chirp, Score: trending.Score})
+	}
+	slices.SortFunc(rows, func(a, b database.GetTrendingChirpsRow) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return slices.Compare(a.Chirp.ID[:], b.Chirp.ID[:])
+	})
+	return rows[:min(len(rows), int(arg.Limit))], nil
+}
+
+func (m *Memory) DeleteTrendingHashtags(ctx context.Context, period string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.trendingHashtags {
+		if key.period == period {
+			delete(m.trendingHashtags, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) InsertTrendingHashtags(ctx context.Context, arg database.InsertTrendingHashtagsParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	since := t.Add(-time.Duration(arg.PeriodSeconds * float64(time.Second)))
+	scores := map[trendingHashtagKey]float64{}
+	add := func(tag string, weight float64, at time.Time) {
+		if at.After(since) {
+			scores[trendingHashtagKey{arg.Period, tag}] += decayed(weight, at, t, arg.HalfLifeSeconds)
+		}
+	}
+	for key := range m.chirpHashtags {
+		chirp, ok := m.chirps[key.chirpID]
+		if !ok || chirp.HiddenAt.Valid || chirp.Visibility != "public" {
+			continue
+		}
+		add(key.tag, 1, chirp.CreatedAt)
+		for _, like := range m.chirpLikes {
+			if like.ChirpID == chirp.ID {
+				add(key.tag, 0.5, like.CreatedAt)
+			}
+		}
+	}
+
+	rows := make([]database.TrendingHashtag, 0, len(scores))
+	for key, score := range scores {
+		if _, ok := m.trendingHashtags[key]; ok {
+			return 0, uniqueViolation("trending_hashtags_pkey")
+		}
+		rows = append(rows, database.TrendingHashtag{Period: key.period, Tag: key.tag, Score: score, ComputedAt: t})
+	}
+	slices.SortFunc(rows, func(a, b database.TrendingHashtag) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	rows = rows[:min(len(rows), int(arg.MaxResults))]
+	for _, row := range rows {
+		m.trendingHashtags[trendingHashtagKey{row.Period, row.Tag}] = row
+	}
+	return int64(len(rows)), nil
+}
+
+func (m *Memory) GetTrendingHashtags(ctx context.Context, arg database.GetTrendingHashtagsParams) ([]database.TrendingHashtag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rows []database.TrendingHashtag
+	for key, row := range m.trendingHashtags {
+		if key.period == arg.Period {
+			rows = append(rows, row)
+		}
+	}
+	slices.SortFunc(rows, func(a, b database.TrendingHashtag) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Tag, b.Tag)
+	})
+	return rows[:min(len(rows), int(arg.Limit))], nil
+}
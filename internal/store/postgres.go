@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// Postgres is the Store backed by the sqlc generated queries.
+type Postgres struct {
+	*database.Queries
+
+	// db is nil inside a transaction.
+	db *sql.DB
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{
+		Queries: database.New(db),
+		db:      db,
+	}
+}
+
+func (p *Postgres) WithTx(ctx context.Context, fn func(Store) error) error {
+	if p.db == nil {
+		return fn(p)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&Postgres{Queries: p.Queries.WithTx(tx)})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
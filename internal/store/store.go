@@ -0,0 +1,212 @@
+// Package store defines the storage interfaces the HTTP handlers depend on,
+// with a Postgres implementation backed by the sqlc queries and an in-memory
+// implementation for tests.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+// UserStore persists user accounts.
+type UserStore interface {
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (database.User, error)
+	GetUsersByHandles(ctx context.Context, handles []string) ([]database.User, error)
+	GetUserStats(ctx context.Context, userID uuid.UUID) (database.GetUserStatsRow, error)
+	UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) (database.User, error)
+	UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.User, error)
+	UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetUserAdmin(ctx context.Context, arg database.SetUserAdminParams) (database.User, error)
+	SearchUsers(ctx context.Context, arg database.SearchUsersParams) ([]database.User, error)
+	SetUserChirpyRed(ctx context.Context, arg database.SetUserChirpyRedParams) (database.User, error)
+	SuspendUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	UnsuspendUser(ctx context.Context, id uuid.UUID) (database.User, error)
+	ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error)
+	CancelUserDeletion(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUsersDueForDeletion(ctx context.Context, arg database.GetUsersDueForDeletionParams) ([]uuid.UUID, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	DeleteAllUsers(ctx context.Context) error
+}
+
+// ChirpStore persists chirps.
+type ChirpStore interface {
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirps(ctx context.Context) ([]database.Chirp, error)
+	GetChirpsByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	GetChirpsByThreadID(ctx context.Context, threadID uuid.UUID) ([]database.Chirp, error)
+	GetTimeline(ctx context.Context, arg database.GetTimelineParams) ([]database.Chirp, error)
+	DeleteChirp(ctx context.Context, arg database.DeleteChirpParams) error
+	SetChirpHidden(ctx context.Context, arg database.SetChirpHiddenParams) (database.Chirp, error)
+
+	CreateChirpMention(ctx context.Context, arg database.CreateChirpMentionParams) error
+	GetChirpMentions(ctx context.Context, chirpIDs []uuid.UUID) ([]database.GetChirpMentionsRow, error)
+	CreateChirpHashtag(ctx context.Context, arg database.CreateChirpHashtagParams) error
+	GetChirpsByHashtag(ctx context.Context, arg database.GetChirpsByHashtagParams) ([]database.Chirp, error)
+	GetChirpsMentioningUser(ctx context.Context, arg database.GetChirpsMentioningUserParams) ([]database.Chirp, error)
+}
+
+// FollowStore persists who follows whom.
+type FollowStore interface {
+	CreateFollow(ctx context.Context, arg database.CreateFollowParams) (int64, error)
+	DeleteFollow(ctx context.Context, arg database.DeleteFollowParams) error
+	GetFollowsByUserID(ctx context.Context, userID uuid.UUID) ([]database.Follow, error)
+	GetFolloweeIDs(ctx context.Context, followerID uuid.UUID) ([]uuid.UUID, error)
+	FollowExists(ctx context.Context, arg database.FollowExistsParams) (bool, error)
+}
+
+// BlockStore persists blocks between users.
+type BlockStore interface {
+	CreateBlock(ctx context.Context, arg database.CreateBlockParams) (int64, error)
+	DeleteBlock(ctx context.Context, arg database.DeleteBlockParams) error
+	GetBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]database.User, error)
+	GetBlockRelatedUserIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	BlockExists(ctx context.Context, arg database.BlockExistsParams) (bool, error)
+}
+
+// MuteStore persists the users and keywords each user has muted.
+type MuteStore interface {
+	CreateMute(ctx context.Context, arg database.CreateMuteParams) (int64, error)
+	DeleteMute(ctx context.Context, arg database.DeleteMuteParams) error
+	GetMutedUsers(ctx context.Context, muterID uuid.UUID) ([]database.User, error)
+	GetMutedUserIDs(ctx context.Context, muterID uuid.UUID) ([]uuid.UUID, error)
+	CreateMutedKeyword(ctx context.Context, arg database.CreateMutedKeywordParams) (int64, error)
+	DeleteMutedKeyword(ctx context.Context, arg database.DeleteMutedKeywordParams) error
+	GetMutedKeywords(ctx context.Context, userID uuid.UUID) ([]database.MutedKeyword, error)
+}
+
+// LikeStore persists chirp likes.
+type LikeStore interface {
+	CreateChirpLike(ctx context.Context, arg database.CreateChirpLikeParams) (int64, error)
+	DeleteChirpLike(ctx context.Context, arg database.DeleteChirpLikeParams) error
+	GetChirpLikesByUserID(ctx context.Context, userID uuid.UUID) ([]database.ChirpLike, error)
+}
+
+// NotificationStore persists notifications and the preferences that decide
+// which ones a user gets.
+type NotificationStore interface {
+	CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error)
+	GetNotifications(ctx context.Context, arg database.GetNotificationsParams) ([]database.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkNotificationRead(ctx context.Context, arg database.MarkNotificationReadParams) (database.Notification, error)
+	MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetNotificationPreferences(ctx context.Context, userID uuid.UUID) (database.NotificationPreference, error)
+	UpsertNotificationPreferences(ctx context.Context, arg database.UpsertNotificationPreferencesParams) (database.NotificationPreference, error)
+}
+
+// MediaStore persists uploaded media and which chirps they're attached
+// to. The files themselves are kept in a media.BlobStore.
+type MediaStore interface {
+	CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Media, error)
+	GetMediaByID(ctx context.Context, id uuid.UUID) (database.Media, error)
+	GetMediaByIDs(ctx context.Context, ids []uuid.UUID) ([]database.Media, error)
+	GetMediaByUserID(ctx context.Context, userID uuid.UUID) ([]database.Media, error)
+	CreateChirpMedia(ctx context.Context, arg database.CreateChirpMediaParams) error
+	GetChirpMedia(ctx context.Context, chirpIDs []uuid.UUID) ([]database.GetChirpMediaRow, error)
+}
+
+// TrendingStore persists the periodically recomputed trending rankings.
+type TrendingStore interface {
+	DeleteTrendingChirps(ctx context.Context, period string) error
+	InsertTrendingChirps(ctx context.Context, arg database.InsertTrendingChirpsParams) (int64, error)
+	GetTrendingChirps(ctx context.Context, arg database.GetTrendingChirpsParams) ([]database.GetTrendingChirpsRow, error)
+	DeleteTrendingHashtags(ctx context.Context, period string) error
+	InsertTrendingHashtags(ctx context.Context, arg database.InsertTrendingHashtagsParams) (int64, error)
+	GetTrendingHashtags(ctx context.Context, arg database.GetTrendingHashtagsParams) ([]database.TrendingHashtag, error)
+}
+
+// TokenStore persists refresh tokens, by lookup ID and digest.
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error
+	GetRefreshToken(ctx context.Context, id string) (database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, id string) (database.GetUserFromRefreshTokenRow, error)
+	RevokeRefreshToken(ctx context.Context, id string) error
+	GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+	DeleteStaleRefreshTokens(ctx context.Context, arg database.DeleteStaleRefreshTokensParams) (int64, error)
+}
+
+// ExportStore persists requests for archives of a user's data, which are
+// generated in the background and kept in a media.BlobStore.
+type ExportStore interface {
+	CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error)
+	GetLatestDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error)
+	GetDataExportsByUserID(ctx context.Context, userID uuid.UUID) ([]database.DataExport, error)
+	ClaimDataExport(ctx context.Context, staleBefore time.Time) (database.DataExport, error)
+	CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) (database.DataExport, error)
+	FailDataExport(ctx context.Context, id uuid.UUID) error
+	DeleteExpiredDataExports(ctx context.Context, expiredBefore time.Time) ([]uuid.UUID, error)
+}
+
+// ScheduleStore persists chirps waiting to be published and drafts.
+type ScheduleStore interface {
+	CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.ScheduledChirp, error)
+	GetScheduledChirps(ctx context.Context, userID uuid.UUID) ([]database.ScheduledChirp, error)
+	CountScheduledChirps(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetScheduledChirpForUpdate(ctx context.Context, arg database.GetScheduledChirpForUpdateParams) (database.ScheduledChirp, error)
+	UpdateScheduledChirp(ctx context.Context, arg database.UpdateScheduledChirpParams) (database.ScheduledChirp, error)
+	DeleteScheduledChirp(ctx context.Context, arg database.DeleteScheduledChirpParams) (int64, error)
+	ClaimDueScheduledChirp(ctx context.Context, arg database.ClaimDueScheduledChirpParams) (database.ScheduledChirp, error)
+	RecordScheduledChirpFailure(ctx context.Context, arg database.RecordScheduledChirpFailureParams) error
+}
+
+// JobStore persists the background job queue.
+type JobStore interface {
+	CreateJob(ctx context.Context, arg database.CreateJobParams) (database.Job, error)
+	KillExpiredJobs(ctx context.Context, now time.Time) (int64, error)
+	ClaimJob(ctx context.Context, arg database.ClaimJobParams) (database.Job, error)
+	CompleteJob(ctx context.Context, arg database.CompleteJobParams) (int64, error)
+	RetryJob(ctx context.Context, arg database.RetryJobParams) (int64, error)
+	KillJob(ctx context.Context, arg database.KillJobParams) (int64, error)
+	GetJobByID(ctx context.Context, id uuid.UUID) (database.Job, error)
+	GetJobs(ctx context.Context, arg database.GetJobsParams) ([]database.Job, error)
+	RequeueJob(ctx context.Context, id uuid.UUID) (database.Job, error)
+}
+
+// AuditStore persists the append-only log of security-sensitive actions.
+type AuditStore interface {
+	CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error)
+	GetAuditEvents(ctx context.Context, arg database.GetAuditEventsParams) ([]database.AuditEvent, error)
+}
+
+// Store is everything the server needs from storage.
+//
+// Implementations report missing rows with sql.ErrNoRows and constraint
+// violations with *pq.Error, the same way the sqlc queries do, so callers
+// handle errors identically whichever implementation they are given.
+type Store interface {
+	UserStore
+	ChirpStore
+	TokenStore
+	FollowStore
+	BlockStore
+	MuteStore
+	LikeStore
+	NotificationStore
+	TrendingStore
+	MediaStore
+	ExportStore
+	ScheduleStore
+	JobStore
+	AuditStore
+
+	// TruncateAllTables empties the database, keeping its schema.
+	TruncateAllTables(ctx context.Context) error
+
+	// TryAdvisoryXactLock takes the lock identified by key until the
+	// current transaction ends, returning false if another transaction
+	// holds it. Outside a transaction the lock is released straight away.
+	TryAdvisoryXactLock(ctx context.Context, key int64) (bool, error)
+
+	// WithTx runs fn in a transaction that commits if fn returns nil and
+	// rolls back otherwise. Calling WithTx on the Store given to fn joins
+	// the same transaction.
+	WithTx(ctx context.Context, fn func(Store) error) error
+}
@@ -0,0 +1,232 @@
+// Package validate checks structs against declarative `validate` struct tags.
+//
+// Rules are comma separated, e.g. `validate:"required,email,max=254"`:
+//
+//	required  the value must not be the zero value
+//	email     the string must look like an email address
+//	uuid      the string must be a UUID
+//	min=N     strings have at least N characters, numbers are >= N, slices have at least N items
+//	max=N     strings have at most N characters, numbers are <= N, slices have at most N items
+//	maxbytes=N strings are at most N bytes long once UTF-8 encoded
+//	oneof=a b the value must be one of the space separated options
+//
+// Only required applies to zero values; an empty optional field is valid.
+// Nested structs are validated recursively and reported with dotted field
+// names taken from their json tags.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// FieldError describes why a single field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors lists every invalid field of a struct.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Struct validates v, which must be a struct or a pointer to one. It returns
+// nil when every field is valid.
+func Struct(v any) Errors {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: Struct called with %s", rv.Kind()))
+	}
+
+	var errs Errors
+	validateStruct(rv, "", &errs)
+	return errs
+}
+
+func validateStruct(rv reflect.Value, prefix string, errs *Errors) {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		value := rv.Field(i)
+		if tag, ok := field.Tag.Lookup("validate"); ok {
+			if msg := checkRules(value, tag); msg != "" {
+				*errs = append(*errs, FieldError{Field: name, Message: msg})
+				continue
+			}
+		}
+
+		for value.Kind() == reflect.Pointer && !value.IsNil() {
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.Struct && value.Type().PkgPath() != "time" {
+			validateStruct(value, name, errs)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// checkRules returns a message for the first rule value breaks, or "".
+func checkRules(value reflect.Value, tag string) string {
+	if value.IsZero() {
+		for _, rule := range strings.Split(tag, ",") {
+			if rule == "required" {
+				return "is required"
+			}
+		}
+		return ""
+	}
+
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		var msg string
+		switch name {
+		case "required", "":
+		case "email":
+			msg = checkEmail(value)
+		case "uuid":
+			msg = checkUUID(value)
+		case "min":
+			msg = checkBound(value, arg, true)
+		case "max":
+			msg = checkBound(value, arg, false)
+		case "maxbytes":
+			msg = checkMaxBytes(value, arg)
+		case "oneof":
+			msg = checkOneOf(value, strings.Fields(arg))
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+		if msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func checkEmail(value reflect.Value) string {
+	if value.Kind() != reflect.String {
+		panic("validate: email rule on non-string field")
+	}
+	addr, err := mail.ParseAddress(value.String())
+	if err != nil || addr.Address != value.String() {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func checkUUID(value reflect.Value) string {
+	if value.Kind() != reflect.String {
+		panic("validate: uuid rule on non-string field")
+	}
+	if _, err := uuid.Parse(value.String()); err != nil {
+		return "must be a valid UUID"
+	}
+	return ""
+}
+
+func checkBound(value reflect.Value, arg string, isMin bool) string {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid bound %q", arg))
+	}
+
+	var n float64
+	var unit string
+	switch value.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(value.String()))
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(value.Len())
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("validate: min/max rule on %s field", value.Kind()))
+	}
+
+	if isMin && n < bound {
+		if unit == "" {
+			return "must be at least " + arg
+		}
+		return "must be at least " + arg + unit
+	}
+	if !isMin && n > bound {
+		if unit == "" {
+			return "must be at most " + arg
+		}
+		return "must be at most " + arg + unit
+	}
+	return ""
+}
+
+// checkMaxBytes is for limits on the encoded size of a string rather than
+// its length, such as bcrypt's 72 bytes.
+func checkMaxBytes(value reflect.Value, arg string) string {
+	if value.Kind() != reflect.String {
+		panic("validate: maxbytes rule on non-string field")
+	}
+	bound, err := strconv.Atoi(arg)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid bound %q", arg))
+	}
+	if len(value.String()) > bound {
+		return "must be at most " + arg + " bytes"
+	}
+	return ""
+}
+
+func checkOneOf(value reflect.Value, options []string) string {
+	s := fmt.Sprint(value.Interface())
+	for _, option := range options {
+		if s == option {
+			return ""
+		}
+	}
+	return "must be one of: " + strings.Join(options, ", ")
+}
@@ -0,0 +1,91 @@
+package validate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type signup struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,maxbytes=72"`
+	Handle   string `json:"handle" validate:"max=5"`
+	Sort     string `json:"sort" validate:"oneof=asc desc"`
+	Data     struct {
+		UserID string `json:"user_id" validate:"required,uuid"`
+	} `json:"data"`
+}
+
+func validSignup() signup {
+	s := signup{Email: "user@example.com", Password: "password"}
+	s.Data.UserID = "5f4b3c5a-7a0e-4c1c-9a66-2d5f8f3b1a11"
+	return s
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *signup)
+		want   Errors
+	}{
+		{
+			name:   "valid",
+			modify: func(s *signup) {},
+			want:   nil,
+		},
+		{
+			name:   "missing required fields",
+			modify: func(s *signup) { s.Email = ""; s.Password = "" },
+			want: Errors{
+				{Field: "email", Message: "is required"},
+				{Field: "password", Message: "is required"},
+			},
+		},
+		{
+			name:   "invalid email",
+			modify: func(s *signup) { s.Email = "Alice <alice@example.com>" },
+			want:   Errors{{Field: "email", Message: "must be a valid email address"}},
+		},
+		{
+			name:   "password too short",
+			modify: func(s *signup) { s.Password = "short" },
+			want:   Errors{{Field: "password", Message: "must be at least 8 characters"}},
+		},
+		{
+			name:   "max counts characters not bytes",
+			modify: func(s *signup) { s.Handle = "héllö" },
+			want:   nil,
+		},
+		{
+			name:   "maxbytes counts bytes not characters",
+			modify: func(s *signup) { s.Password = strings.Repeat("é", 37) },
+			want:   Errors{{Field: "password", Message: "must be at most 72 bytes"}},
+		},
+		{
+			name:   "optional field too long",
+			modify: func(s *signup) { s.Handle = "toolong" },
+			want:   Errors{{Field: "handle", Message: "must be at most 5 characters"}},
+		},
+		{
+			name:   "oneof",
+			modify: func(s *signup) { s.Sort = "sideways" },
+			want:   Errors{{Field: "sort", Message: "must be one of: asc, desc"}},
+		},
+		{
+			name:   "nested field",
+			modify: func(s *signup) { s.Data.UserID = "nope" },
+			want:   Errors{{Field: "data.user_id", Message: "must be a valid UUID"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSignup()
+			tt.modify(&s)
+			got := Struct(&s)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
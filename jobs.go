@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+
+	"github.com/lordbaldwin1/chirpy/internal/jobs"
+)
+
+// jobWorkers is how many jobs each replica runs at once.
+const jobWorkers = 4
+
+type deleteBlobsPayload struct {
+	Keys []string `json:"keys"`
+}
+
+// deleteBlobsJob removes files from the blob store once the rows that
+// referenced them are gone. Enqueueing it in the same transaction as the
+// delete means the files are removed even if we crash straight after.
+var deleteBlobsJob = jobs.Kind[deleteBlobsPayload]{Name: "delete_blobs"}
+
+// newJobQueue returns a queue with a handler for every kind of job.
+func (cfg *apiConfig) newJobQueue() *jobs.Queue {
+	q := jobs.NewQueue(cfg.store)
+	jobs.Handle(q, deleteBlobsJob, cfg.deleteBlobs)
+	return q
+}
+
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, p deleteBlobsPayload) error {
+	for _, key := range p.Keys {
+		// deleting a blob that is already gone succeeds, so a retry
+		// doesn't trip over the keys deleted last time
+		err := cfg.blobs.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
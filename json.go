@@ -6,24 +6,6 @@ import (
 	"net/http"
 )
 
-func respondWithError(w http.ResponseWriter, code int, message string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
-
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", err)
-	}
-
-	type errorResponse struct {
-		Error string `json:"error"`
-	}
-
-	respondWithJSON(w, code, errorResponse{
-		Error: message,
-	})
-}
-
 func respondWithJSON(w http.ResponseWriter, code int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	data, err := json.Marshal(payload)
@@ -1,26 +1,71 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+	"github.com/lordbaldwin1/chirpy/internal/jobs"
+	"github.com/lordbaldwin1/chirpy/internal/media"
+	"github.com/lordbaldwin1/chirpy/internal/ratelimit"
+	"github.com/lordbaldwin1/chirpy/internal/store"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
-	queries        *database.Queries
-	platform       string
-	jwtSecret      string
-	polkaAPIKey    string
+	// refreshTokensPurged counts the refresh tokens the cleanup deleted.
+	refreshTokensPurged atomic.Int64
+	store               store.Store
+	platform            string
+	jwtSecret           string
+	polkaAPIKey         string
+	// seedDir holds the fixtures a reset can load.
+	seedDir string
+
+	// blobs holds uploaded media files and data exports.
+	blobs media.BlobStore
+	// exportQueued wakes the export worker when a user asks for an export.
+	exportQueued chan struct{}
+	// jobs runs background work enqueued with the store.
+	jobs *jobs.Queue
+
+	readinessChecks []readinessCheck
+	shuttingDown    atomic.Bool
+
+	// events publishes chirp changes to the eventHub of every replica.
+	events   events.Publisher
+	eventHub *events.Hub
+
+	// rateLimiter is nil when rate limiting is disabled.
+	rateLimiter    ratelimit.Limiter
+	trustedProxies []netip.Prefix
 }
 
+const (
+	// shutdownDrainDelay is how long we keep serving while reporting
+	// not-ready, so load balancers stop routing to us before we close.
+	shutdownDrainDelay = 5 * time.Second
+	shutdownTimeout    = 10 * time.Second
+)
+
 func main() {
+	autoMigrateFlag := flag.Bool("auto-migrate", false, "apply pending database migrations before serving")
+	flag.Parse()
+
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("fatal: %s", err)
@@ -30,6 +75,40 @@ func main() {
 	if dbURL == "" {
 		log.Fatal("DB_URL must be set")
 	}
+
+	dbConn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		log.Fatalf("fatal: %s", err)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		err = runMigrateCommand(context.Background(), dbConn, flag.Args()[1:])
+		dbConn.Close()
+		if err != nil {
+			log.Fatalf("fatal: %s", err)
+		}
+		return
+	}
+	if flag.Arg(0) == "admin" {
+		err = runAdminCommand(context.Background(), store.NewPostgres(dbConn), flag.Args()[1:])
+		dbConn.Close()
+		if err != nil {
+			log.Fatalf("fatal: %s", err)
+		}
+		return
+	}
+	if flag.Arg(0) == "seed" {
+		err = runSeedCommand(context.Background(), dbConn, flag.Args()[1:])
+		dbConn.Close()
+		if err != nil {
+			log.Fatalf("fatal: %s", err)
+		}
+		return
+	}
+	if flag.NArg() > 0 {
+		log.Fatalf("fatal: unknown command %q", flag.Arg(0))
+	}
+
 	platform := os.Getenv("PLATFORM")
 	if platform == "" {
 		log.Fatal("PLATFORM must be set")
@@ -43,47 +122,193 @@ func main() {
 		log.Fatal("POLKA_KEY must be set")
 	}
 
-	dbConn, err := sql.Open("postgres", dbURL)
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	blobs, err := media.NewLocalBlobStore(mediaDir)
+	if err != nil {
+		log.Fatalf("fatal: %s", err)
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("fatal: %s", err)
+	}
+
+	var rateLimiter ratelimit.Limiter
+	switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+	case "", "memory":
+		rateLimiter = ratelimit.NewMemory()
+	case "postgres":
+		rateLimiter = ratelimit.NewPostgres(database.New(dbConn))
+	case "off":
+	default:
+		log.Fatalf("RATE_LIMIT_BACKEND must be memory, postgres or off, got %q", backend)
+	}
+
+	if *autoMigrateFlag {
+		err = autoMigrate(context.Background(), dbConn)
+		if err != nil {
+			log.Fatalf("fatal: couldn't migrate database: %s", err)
+		}
+	}
+
+	schemaVersion, err := latestSchemaVersion()
 	if err != nil {
 		log.Fatalf("fatal: %s", err)
 	}
-	dbQueries := database.New(dbConn)
 
 	const filePathRoot = "."
 	const port = "8080"
+	const eventHistorySize = 1000
 
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
-		queries:        dbQueries,
+		store:          store.NewPostgres(dbConn),
 		platform:       platform,
 		jwtSecret:      jwtSecret,
 		polkaAPIKey:    polkaAPIKey,
+		seedDir:        seedDirFromEnv(),
+		blobs:          blobs,
+		exportQueued:   make(chan struct{}, 1),
+		readinessChecks: []readinessCheck{
+			databaseReadinessCheck(dbConn),
+			migrationsReadinessCheck(dbConn, schemaVersion),
+		},
+		events:         events.NewPostgresPublisher(database.New(dbConn)),
+		eventHub:       events.NewHub(eventHistorySize),
+		rateLimiter:    rateLimiter,
+		trustedProxies: trustedProxies,
+	}
+	apiCfg.jobs = apiCfg.newJobQueue()
+
+	// cancelled when shutdown starts, so long-lived streams end and don't
+	// hold up server.Shutdown
+	serverCtx, cancelServerCtx := context.WithCancel(context.Background())
+	defer cancelServerCtx()
+
+	server := &http.Server{
+		Addr:        ":" + port,
+		Handler:     apiCfg.routes(filePathRoot),
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
+	}
+	server.RegisterOnShutdown(cancelServerCtx)
+
+	go func() {
+		err := events.Listen(serverCtx, dbURL, apiCfg.eventHub)
+		if err != nil {
+			log.Printf("Error listening for events, streams won't receive updates: %s", err)
+		}
+	}()
+
+	go apiCfg.runTrendingJob(serverCtx, trendingInterval)
+	go apiCfg.runPurgeJob(serverCtx, purgeInterval)
+	go apiCfg.runExportWorker(serverCtx, exportInterval)
+	go apiCfg.runScheduler(serverCtx, scheduleInterval)
+	go apiCfg.jobs.Run(serverCtx, jobWorkers)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Printf("Serving files from %s on port %s\n", filePathRoot, port)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("fatal: %s", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	apiCfg.shuttingDown.Store(true)
+	log.Printf("Shutting down, draining for %s\n", shutdownDrainDelay)
+	time.Sleep(shutdownDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("Error shutting down server: %s", err)
 	}
+	dbConn.Close()
+}
 
+// routes registers every handler; filePathRoot is served under /app/.
+func (cfg *apiConfig) routes(filePathRoot string) http.Handler {
 	mux := http.NewServeMux()
 
 	fileServerHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filePathRoot)))
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(fileServerHandler))
+	mux.Handle("/app/", cfg.middlewareMetricsInc(fileServerHandler))
+	mux.HandleFunc("GET /media/{mediaID}", cfg.handlerMediaGet)
+	mux.HandleFunc("GET /media/{mediaID}/thumbnail", cfg.handlerMediaThumbnail)
 
 	mux.HandleFunc("GET /api/healthz", healthzHandler)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
-	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
-	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsGet)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGetByID)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerUsersLogin)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handleRefreshToken)
-	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpsDelete)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerUsersUpgrade)
-
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
-	}
+	mux.HandleFunc("GET /api/livez", livezHandler)
+	mux.HandleFunc("GET /api/readyz", cfg.handlerReadyz)
+	mux.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
+	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/hide", cfg.handlerAdminChirpsHide)
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/unhide", cfg.handlerAdminChirpsUnhide)
+	mux.HandleFunc("GET /admin/jobs", cfg.handlerAdminJobsGet)
+	mux.HandleFunc("GET /admin/jobs/{jobID}", cfg.handlerAdminJobGet)
+	mux.HandleFunc("POST /admin/jobs/{jobID}/retry", cfg.handlerAdminJobRetry)
+	mux.HandleFunc("POST /admin/refresh-tokens/purge", cfg.handlerAdminRefreshTokensPurge)
+	mux.HandleFunc("GET /admin/audit-events", cfg.handlerAdminAuditEventsGet)
+	mux.HandleFunc("GET /admin/users", cfg.handlerAdminUsersGet)
+	mux.HandleFunc("GET /admin/users/{userID}", cfg.handlerAdminUserGet)
+	mux.HandleFunc("GET /admin/users/{userID}/sessions", cfg.handlerAdminUserSessionsGet)
+	mux.HandleFunc("POST /admin/users/{userID}/logout", cfg.handlerAdminUserLogout)
+	mux.HandleFunc("POST /admin/users/{userID}/chirpy-red", cfg.handlerAdminUserChirpyRedGrant)
+	mux.HandleFunc("DELETE /admin/users/{userID}/chirpy-red", cfg.handlerAdminUserChirpyRedRevoke)
+	mux.HandleFunc("POST /admin/users/{userID}/suspension", cfg.handlerAdminUserSuspend)
+	mux.HandleFunc("DELETE /admin/users/{userID}/suspension", cfg.handlerAdminUserUnsuspend)
+	mux.HandleFunc("POST /admin/users/{userID}/impersonate", cfg.handlerAdminUserImpersonate)
+	mux.Handle("POST /api/users", cfg.middlewareRateLimit(rateLimitSignup, cfg.handlerCreateUser))
+	mux.Handle("POST /api/chirps", cfg.middlewareRateLimit(rateLimitChirpsCreate, cfg.handlerChirpsCreate))
+	mux.HandleFunc("GET /api/chirps", cfg.handlerChirpsGet)
+	mux.Handle("POST /api/media", cfg.middlewareRateLimit(rateLimitMediaUpload, cfg.handlerMediaUpload))
+	mux.HandleFunc("GET /api/chirps/stream", cfg.handlerChirpsStream)
+	mux.HandleFunc("GET /api/ws", cfg.handlerWebSocket)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerChirpsGetByID)
+	mux.Handle("POST /api/login", cfg.middlewareRateLimit(rateLimitLogin, cfg.handlerUsersLogin))
+	mux.Handle("POST /api/refresh", cfg.middlewareRateLimit(rateLimitRefresh, cfg.handleRefreshToken))
+	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("PUT /api/users", cfg.handlerUsersUpdate)
+	mux.HandleFunc("PATCH /api/users/profile", cfg.handlerUsersProfileUpdate)
+	mux.HandleFunc("DELETE /api/users/me", cfg.handlerUsersDelete)
+	mux.HandleFunc("POST /api/users/me/cancel-deletion", cfg.handlerUsersCancelDeletion)
+	mux.HandleFunc("GET /api/users/me/export", cfg.handlerUsersExport)
+	mux.HandleFunc("GET /api/users/me/export/download", cfg.handlerUsersExportDownload)
+	mux.HandleFunc("GET /api/users/me/scheduled-chirps", cfg.handlerScheduledChirpsGet)
+	mux.HandleFunc("PATCH /api/users/me/scheduled-chirps/{scheduledID}", cfg.handlerScheduledChirpsUpdate)
+	mux.HandleFunc("DELETE /api/users/me/scheduled-chirps/{scheduledID}", cfg.handlerScheduledChirpsDelete)
+	mux.HandleFunc("GET /api/users/{handle}", cfg.handlerUsersProfile)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerChirpsDelete)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.handlerChirpsThread)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.handlerChirpsLike)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.handlerChirpsUnlike)
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.handlerUsersFollow)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.handlerUsersUnfollow)
+	mux.HandleFunc("POST /api/users/{userID}/block", cfg.handlerUsersBlock)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", cfg.handlerUsersUnblock)
+	mux.HandleFunc("POST /api/users/{userID}/mute", cfg.handlerUsersMute)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", cfg.handlerUsersUnmute)
+	mux.HandleFunc("GET /api/users/me/blocks", cfg.handlerUsersBlocks)
+	mux.HandleFunc("GET /api/users/me/mutes", cfg.handlerUsersMutes)
+	mux.HandleFunc("POST /api/users/me/mutes/keywords", cfg.handlerMutedKeywordsCreate)
+	mux.HandleFunc("DELETE /api/users/me/mutes/keywords/{keyword}", cfg.handlerMutedKeywordsDelete)
+	mux.HandleFunc("GET /api/timeline", cfg.handlerTimeline)
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", cfg.handlerHashtagChirps)
+	mux.HandleFunc("GET /api/users/{userID}/mentions", cfg.handlerUserMentions)
+	mux.HandleFunc("GET /api/trending", cfg.handlerTrending)
+	mux.HandleFunc("GET /api/notifications", cfg.handlerNotificationsGet)
+	mux.HandleFunc("POST /api/notifications/read", cfg.handlerNotificationsReadAll)
+	mux.HandleFunc("POST /api/notifications/{notificationID}/read", cfg.handlerNotificationsRead)
+	mux.HandleFunc("GET /api/notifications/preferences", cfg.handlerNotificationPreferencesGet)
+	mux.HandleFunc("PUT /api/notifications/preferences", cfg.handlerNotificationPreferencesUpdate)
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerUsersUpgrade)
 
-	log.Printf("Serving files from %s on port %s\n", filePathRoot, port)
-	log.Fatal(server.ListenAndServe())
+	return middlewareRequestID(cfg.middlewareImpersonationAudit(mux))
 }
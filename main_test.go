@@ -0,0 +1,2977 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	imgpng "image/png"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+	"github.com/lordbaldwin1/chirpy/internal/events"
+	"github.com/lordbaldwin1/chirpy/internal/jobs"
+	"github.com/lordbaldwin1/chirpy/internal/media"
+	"github.com/lordbaldwin1/chirpy/internal/ratelimit"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// The suite runs against the in-memory store by default. Set
+// CHIRPY_TEST_DB_URL to a disposable Postgres database to run it against the
+// real queries instead; migrations are applied and all data is wiped before
+// each test.
+const testDBURLEnv = "CHIRPY_TEST_DB_URL"
+
+const (
+	testJWTSecret   = "test-jwt-secret"
+	testPolkaAPIKey = "test-polka-key"
+)
+
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	dbURL := os.Getenv(testDBURLEnv)
+	if dbURL == "" {
+		return store.NewMemory()
+	}
+
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = autoMigrate(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	s := store.NewPostgres(db)
+	err = s.TruncateAllTables(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to reset test database: %v", err)
+	}
+	return s
+}
+
+type testClient struct {
+	t   *testing.T
+	srv *httptest.Server
+}
+
+// newTestClient starts a server; opts can adjust its config before routes
+// are built.
+func newTestClient(t *testing.T, opts ...func(cfg *apiConfig)) *testClient {
+	t.Helper()
+
+	hub := events.NewHub(100)
+	blobs, err := media.NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	cfg := &apiConfig{
+		store:       newTestStore(t),
+		platform:    "dev",
+		jwtSecret:   testJWTSecret,
+		polkaAPIKey: testPolkaAPIKey,
+		blobs:       blobs,
+		events:      hub,
+		eventHub:    hub,
+	}
+	cfg.jobs = cfg.newJobQueue()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	srv := httptest.NewServer(cfg.routes(t.TempDir()))
+	t.Cleanup(srv.Close)
+
+	return &testClient{t: t, srv: srv}
+}
+
+// do sends body as JSON (unless it is nil) with the given Authorization
+// header value and decodes a JSON response into out (unless it is nil).
+func (c *testClient) do(method, path, authorization string, body, out any) int {
+	c.t.Helper()
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatalf("Failed to marshal request body: %v", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.srv.URL+path, reqBody)
+	if err != nil {
+		c.t.Fatalf("Failed to build request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("Failed to read response body: %v", err)
+	}
+	if out != nil && len(data) > 0 {
+		err = json.Unmarshal(data, out)
+		if err != nil {
+			c.t.Fatalf("%s %s returned invalid JSON %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type testUser struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func bearer(token string) string {
+	return "Bearer " + token
+}
+
+// signup creates a user and logs them in.
+func (c *testClient) signup(email, password string) testUser {
+	c.t.Helper()
+
+	return c.signupWithHandle(email, password, "")
+}
+
+func (c *testClient) signupWithHandle(email, password, handle string) testUser {
+	c.t.Helper()
+
+	creds := map[string]string{"email": email, "password": password}
+	params := map[string]string{"email": email, "password": password}
+	if handle != "" {
+		params["handle"] = handle
+	}
+	code := c.do("POST", "/api/users", "", params, nil)
+	if code != http.StatusCreated {
+		c.t.Fatalf("POST /api/users for %s returned %d, want %d", email, code, http.StatusCreated)
+	}
+
+	var user testUser
+	code = c.do("POST", "/api/login", "", creds, &user)
+	if code != http.StatusOK {
+		c.t.Fatalf("POST /api/login for %s returned %d, want %d", email, code, http.StatusOK)
+	}
+	return user
+}
+
+func (c *testClient) createChirp(user testUser, body string) Chirp {
+	c.t.Helper()
+
+	var chirp Chirp
+	code := c.do("POST", "/api/chirps", bearer(user.Token), map[string]string{"body": body}, &chirp)
+	if code != http.StatusCreated {
+		c.t.Fatalf("POST /api/chirps returned %d, want %d", code, http.StatusCreated)
+	}
+	return chirp
+}
+
+func TestHealthAndAdmin(t *testing.T) {
+	c := newTestClient(t)
+	c.signup("admin@example.com", "password")
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+	}{
+		{name: "healthz", method: "GET", path: "/api/healthz", wantCode: http.StatusOK},
+		{name: "livez", method: "GET", path: "/api/livez", wantCode: http.StatusOK},
+		{name: "readyz", method: "GET", path: "/api/readyz", wantCode: http.StatusOK},
+		{name: "metrics", method: "GET", path: "/admin/metrics", wantCode: http.StatusOK},
+		{name: "reset", method: "POST", path: "/admin/reset", wantCode: http.StatusOK},
+		{name: "login after reset", method: "POST", path: "/api/login", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body any
+			if tt.path == "/api/login" {
+				body = map[string]string{"email": "admin@example.com", "password": "password"}
+			}
+			code := c.do(tt.method, tt.path, "", body, nil)
+			if code != tt.wantCode {
+				t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUsers(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+
+	if alice.ID == uuid.Nil || alice.Token == "" || alice.RefreshToken == "" {
+		t.Fatalf("login response is missing fields: %+v", alice)
+	}
+	if alice.IsChirpyRed {
+		t.Error("new users should not be Chirpy Red")
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		body          map[string]string
+		wantCode      int
+		wantEmail     string
+	}{
+		{
+			name:     "login with wrong password",
+			method:   "POST",
+			path:     "/api/login",
+			body:     map[string]string{"email": "alice@example.com", "password": "wrong"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "login with unknown email",
+			method:   "POST",
+			path:     "/api/login",
+			body:     map[string]string{"email": "nobody@example.com", "password": "alicePassword"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "update without token",
+			method:   "PUT",
+			path:     "/api/users",
+			body:     map[string]string{"email": "alice2@example.com", "password": "newPassword"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "update with refresh token",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(alice.RefreshToken),
+			body:          map[string]string{"email": "alice2@example.com", "password": "newPassword"},
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "update email and password",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(alice.Token),
+			body:          map[string]string{"email": "alice2@example.com", "password": "newPassword"},
+			wantCode:      http.StatusOK,
+			wantEmail:     "alice2@example.com",
+		},
+		{
+			name:     "login with old password",
+			method:   "POST",
+			path:     "/api/login",
+			body:     map[string]string{"email": "alice2@example.com", "password": "alicePassword"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:      "login with new credentials",
+			method:    "POST",
+			path:      "/api/login",
+			body:      map[string]string{"email": "alice2@example.com", "password": "newPassword"},
+			wantCode:  http.StatusOK,
+			wantEmail: "alice2@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user testUser
+			code := c.do(tt.method, tt.path, tt.authorization, tt.body, &user)
+			if code != tt.wantCode {
+				t.Fatalf("%s %s returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+			if tt.wantEmail != "" && user.Email != tt.wantEmail {
+				t.Errorf("%s %s returned email %q, want %q", tt.method, tt.path, user.Email, tt.wantEmail)
+			}
+		})
+	}
+
+	// an unknown email looks the same as a wrong password
+	var unknown, wrong problem
+	c.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "newPassword"}, &unknown)
+	c.do("POST", "/api/login", "", map[string]string{"email": "alice2@example.com", "password": "wrongPassword"}, &wrong)
+	if unknown.Code != codeInvalidCredentials || unknown.Code != wrong.Code || unknown.Detail != wrong.Detail {
+		t.Errorf("login with an unknown email = %q %q, want the same as a wrong password's %q %q", unknown.Code, unknown.Detail, wrong.Code, wrong.Detail)
+	}
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	// the right lookup ID with the wrong secret
+	id, _, _ := strings.Cut(alice.RefreshToken, ".")
+	forged := id + "." + strings.Repeat("0", 64)
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "refresh without token", path: "/api/refresh", wantCode: http.StatusUnauthorized},
+		{name: "refresh with forged token", path: "/api/refresh", authorization: bearer(forged), wantCode: http.StatusUnauthorized},
+		{name: "refresh with malformed token", path: "/api/refresh", authorization: bearer("not-a-token"), wantCode: http.StatusUnauthorized},
+		{name: "revoke with forged token", path: "/api/revoke", authorization: bearer(forged), wantCode: http.StatusNoContent},
+		{name: "refresh with access token", path: "/api/refresh", authorization: bearer(alice.Token), wantCode: http.StatusUnauthorized},
+		{name: "refresh", path: "/api/refresh", authorization: bearer(alice.RefreshToken), wantCode: http.StatusOK},
+		{name: "refresh again", path: "/api/refresh", authorization: bearer(alice.RefreshToken), wantCode: http.StatusOK},
+		{name: "revoke without token", path: "/api/revoke", wantCode: http.StatusUnauthorized},
+		{name: "revoke", path: "/api/revoke", authorization: bearer(alice.RefreshToken), wantCode: http.StatusNoContent},
+		{name: "refresh after revoke", path: "/api/refresh", authorization: bearer(alice.RefreshToken), wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Token string `json:"token"`
+			}
+			code := c.do("POST", tt.path, tt.authorization, nil, &resp)
+			if code != tt.wantCode {
+				t.Fatalf("POST %s returned %d, want %d", tt.path, code, tt.wantCode)
+			}
+			if tt.path != "/api/refresh" || code != http.StatusOK {
+				return
+			}
+
+			// the new access token must be usable
+			code = c.do("POST", "/api/chirps", bearer(resp.Token), map[string]string{"body": "refreshed"}, nil)
+			if code != http.StatusCreated {
+				t.Errorf("POST /api/chirps with refreshed token returned %d, want %d", code, http.StatusCreated)
+			}
+		})
+	}
+}
+
+func TestChirpsCreateAndGet(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	chirp := c.createChirp(alice, "I hear Mastodon is better than Chirpy. sharbert I need to migrate")
+
+	if chirp.UserID != alice.ID {
+		t.Errorf("chirp user_id = %s, want %s", chirp.UserID, alice.ID)
+	}
+	if chirp.Body != "I hear Mastodon is better than Chirpy. **** I need to migrate" {
+		t.Errorf("chirp body = %q, profanity was not filtered", chirp.Body)
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		{
+			name:     "create without token",
+			method:   "POST",
+			path:     "/api/chirps",
+			body:     map[string]string{"body": "hello"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "create with invalid token",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer("not-a-jwt"),
+			body:          map[string]string{"body": "hello"},
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "create too long",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(alice.Token),
+			body:          map[string]string{"body": strings.Repeat("a", 141)},
+			wantCode:      http.StatusBadRequest,
+		},
+		{
+			name:     "get by id",
+			method:   "GET",
+			path:     "/api/chirps/" + chirp.ID.String(),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "get unknown id",
+			method:   "GET",
+			path:     "/api/chirps/" + uuid.NewString(),
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "get invalid id",
+			method:   "GET",
+			path:     "/api/chirps/not-a-uuid",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "list with invalid author",
+			method:   "GET",
+			path:     "/api/chirps?author_id=not-a-uuid",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Chirp
+			code := c.do(tt.method, tt.path, tt.authorization, tt.body, &got)
+			if code != tt.wantCode {
+				t.Fatalf("%s %s returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+			if tt.name == "get by id" && !reflect.DeepEqual(got, chirp) {
+				t.Errorf("GET %s = %+v, want %+v", tt.path, got, chirp)
+			}
+		})
+	}
+}
+
+func TestChirpsListFilterAndSort(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	c.createChirp(alice, "alice 1")
+	c.createChirp(bob, "bob 1")
+	c.createChirp(alice, "alice 2")
+
+	tests := []struct {
+		name       string
+		query      string
+		wantBodies []string
+	}{
+		{name: "all", query: "", wantBodies: []string{"alice 1", "bob 1", "alice 2"}},
+		{name: "asc", query: "?sort=asc", wantBodies: []string{"alice 1", "bob 1", "alice 2"}},
+		{name: "desc", query: "?sort=desc", wantBodies: []string{"alice 2", "bob 1", "alice 1"}},
+		{name: "by author", query: "?author_id=" + alice.ID.String(), wantBodies: []string{"alice 1", "alice 2"}},
+		{name: "by author desc", query: "?author_id=" + alice.ID.String() + "&sort=desc", wantBodies: []string{"alice 2", "alice 1"}},
+		{name: "by author without chirps", query: "?author_id=" + uuid.NewString(), wantBodies: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chirps []Chirp
+			code := c.do("GET", "/api/chirps"+tt.query, "", nil, &chirps)
+			if code != http.StatusOK {
+				t.Fatalf("GET /api/chirps%s returned %d, want %d", tt.query, code, http.StatusOK)
+			}
+
+			var bodies []string
+			for _, chirp := range chirps {
+				bodies = append(bodies, chirp.Body)
+			}
+			if strings.Join(bodies, ",") != strings.Join(tt.wantBodies, ",") {
+				t.Errorf("GET /api/chirps%s = %v, want %v", tt.query, bodies, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestChirpsDelete(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+	chirp := c.createChirp(alice, "delete me")
+	path := "/api/chirps/" + chirp.ID.String()
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "without token", method: "DELETE", path: path, wantCode: http.StatusUnauthorized},
+		{name: "invalid id", method: "DELETE", path: "/api/chirps/not-a-uuid", authorization: bearer(alice.Token), wantCode: http.StatusBadRequest},
+		{name: "unknown chirp", method: "DELETE", path: "/api/chirps/" + uuid.NewString(), authorization: bearer(alice.Token), wantCode: http.StatusNotFound},
+		{name: "not the author", method: "DELETE", path: path, authorization: bearer(bob.Token), wantCode: http.StatusForbidden},
+		{name: "still there", method: "GET", path: path, wantCode: http.StatusOK},
+		{name: "author", method: "DELETE", path: path, authorization: bearer(alice.Token), wantCode: http.StatusNoContent},
+		{name: "gone", method: "GET", path: path, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := c.do(tt.method, tt.path, tt.authorization, nil, nil)
+			if code != tt.wantCode {
+				t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPolkaWebhook(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+
+	event := func(name string, userID string) map[string]any {
+		return map[string]any{
+			"event": name,
+			"data":  map[string]string{"user_id": userID},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		{name: "without api key", body: event("user.upgraded", alice.ID.String()), wantCode: http.StatusUnauthorized},
+		{name: "wrong api key", authorization: "ApiKey wrong", body: event("user.upgraded", alice.ID.String()), wantCode: http.StatusUnauthorized},
+		{name: "ignored event", authorization: "ApiKey " + testPolkaAPIKey, body: event("user.payment_failed", alice.ID.String()), wantCode: http.StatusNoContent},
+		{name: "unknown user", authorization: "ApiKey " + testPolkaAPIKey, body: event("user.upgraded", uuid.NewString()), wantCode: http.StatusNotFound},
+		{name: "upgrade", authorization: "ApiKey " + testPolkaAPIKey, body: event("user.upgraded", alice.ID.String()), wantCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := c.do("POST", "/api/polka/webhooks", tt.authorization, tt.body, nil)
+			if code != tt.wantCode {
+				t.Errorf("POST /api/polka/webhooks returned %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var user testUser
+	code := c.do("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "alicePassword"}, &user)
+	if code != http.StatusOK {
+		t.Fatalf("POST /api/login returned %d, want %d", code, http.StatusOK)
+	}
+	if !user.IsChirpyRed {
+		t.Error("user should be Chirpy Red after the upgrade webhook")
+	}
+
+	// Polka's bodies may carry fields we don't know and no JSON Content-Type
+	bob := c.signup("bob@example.com", "bobPassword")
+	for _, contentType := range []string{"", "text/plain", "application/json; charset=utf-8"} {
+		body := `{"event": "user.upgraded", "id": "evt_1", "data": {"user_id": "` + bob.ID.String() + `", "plan": "red"}}`
+		req, err := http.NewRequest("POST", c.srv.URL+"/api/polka/webhooks", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Authorization", "ApiKey "+testPolkaAPIKey)
+		resp, err := c.srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("POST /api/polka/webhooks failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("POST /api/polka/webhooks with Content-Type %q returned %d, want %d", contentType, resp.StatusCode, http.StatusNoContent)
+		}
+	}
+	if code := c.do("POST", "/api/login", "", map[string]string{"email": "bob@example.com", "password": "bobPassword"}, &user); code != http.StatusOK {
+		t.Fatalf("POST /api/login returned %d, want %d", code, http.StatusOK)
+	}
+	if !user.IsChirpyRed {
+		t.Error("user should be Chirpy Red after a webhook with extra fields")
+	}
+
+	if code := c.do("POST", "/api/polka/webhooks", "ApiKey "+testPolkaAPIKey, "not an object", nil); code != http.StatusBadRequest {
+		t.Errorf("POST /api/polka/webhooks with a malformed body returned %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		contentType   string
+		body          string
+		wantCode      int
+		wantErrCode   errorCode
+		wantFields    []string
+	}{
+		{
+			name:        "malformed JSON",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": `,
+			wantCode:    http.StatusBadRequest,
+			wantErrCode: codeInvalidJSON,
+		},
+		{
+			name:        "unknown field",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": "bob@example.com", "password": "password", "admin": true}`,
+			wantCode:    http.StatusBadRequest,
+			wantErrCode: codeInvalidJSON,
+		},
+		{
+			name:        "empty body",
+			method:      "POST",
+			path:        "/api/login",
+			body:        ``,
+			wantCode:    http.StatusBadRequest,
+			wantErrCode: codeInvalidJSON,
+		},
+		{
+			name:        "wrong content type",
+			method:      "POST",
+			path:        "/api/users",
+			contentType: "text/plain",
+			body:        `{"email": "bob@example.com", "password": "password"}`,
+			wantCode:    http.StatusUnsupportedMediaType,
+			wantErrCode: codeUnsupportedMedia,
+		},
+		{
+			name:        "body too large",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`,
+			wantCode:    http.StatusRequestEntityTooLarge,
+			wantErrCode: codeBodyTooLarge,
+		},
+		{
+			name:        "validation errors",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": "not-an-email", "password": ""}`,
+			wantCode:    http.StatusUnprocessableEntity,
+			wantErrCode: codeValidationFailed,
+			wantFields:  []string{"email", "password"},
+		},
+		{
+			name:        "multibyte password over 72 bytes",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": "bob@example.com", "password": "` + strings.Repeat("é", 40) + `"}`,
+			wantCode:    http.StatusUnprocessableEntity,
+			wantErrCode: codeValidationFailed,
+			wantFields:  []string{"password"},
+		},
+		{
+			name:          "multibyte new password over 72 bytes",
+			method:        "PUT",
+			path:          "/api/users",
+			authorization: bearer(alice.Token),
+			body:          `{"email": "alice@example.com", "password": "` + strings.Repeat("é", 40) + `"}`,
+			wantCode:      http.StatusUnprocessableEntity,
+			wantErrCode:   codeValidationFailed,
+			wantFields:    []string{"password"},
+		},
+		{
+			name:          "empty chirp",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(alice.Token),
+			body:          `{"body": ""}`,
+			wantCode:      http.StatusUnprocessableEntity,
+			wantErrCode:   codeValidationFailed,
+			wantFields:    []string{"body"},
+		},
+		{
+			name:        "duplicate email",
+			method:      "POST",
+			path:        "/api/users",
+			body:        `{"email": "alice@example.com", "password": "password"}`,
+			wantCode:    http.StatusConflict,
+			wantErrCode: codeConflict,
+		},
+		{
+			name:          "chirp too long",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer(alice.Token),
+			body:          `{"body": "` + strings.Repeat("a", 141) + `"}`,
+			wantCode:      http.StatusBadRequest,
+			wantErrCode:   codeChirpTooLong,
+		},
+		{
+			name:          "invalid token",
+			method:        "POST",
+			path:          "/api/chirps",
+			authorization: bearer("not-a-jwt"),
+			body:          `{"body": "hello"}`,
+			wantCode:      http.StatusUnauthorized,
+			wantErrCode:   codeInvalidToken,
+		},
+		{
+			name:        "chirp not found",
+			method:      "GET",
+			path:        "/api/chirps/" + uuid.NewString(),
+			wantCode:    http.StatusNotFound,
+			wantErrCode: codeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, c.srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to build request: %v", err)
+			}
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("X-Request-ID", "test-request-id")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			resp, err := c.srv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("%s %s failed: %v", tt.method, tt.path, err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, resp.StatusCode, tt.wantCode)
+			}
+			if got := resp.Header.Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+
+			var p problem
+			err = json.NewDecoder(resp.Body).Decode(&p)
+			if err != nil {
+				t.Fatalf("Failed to decode problem: %v", err)
+			}
+			want := problem{
+				Type:      problemTypePrefix + string(tt.wantErrCode),
+				Title:     errorTitles[tt.wantErrCode],
+				Status:    tt.wantCode,
+				Detail:    p.Detail,
+				Instance:  tt.path,
+				Code:      tt.wantErrCode,
+				RequestID: "test-request-id",
+				Errors:    p.Errors,
+			}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("problem = %+v, want %+v", p, want)
+			}
+
+			var fields []string
+			for _, fe := range p.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("problem errors for fields %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c := newTestClient(t, func(cfg *apiConfig) {
+		cfg.rateLimiter = ratelimit.NewMemory()
+	})
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	post := func(path, authorization string, body any) *http.Response {
+		t.Helper()
+
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal request body: %v", err)
+		}
+		req, err := http.NewRequest("POST", c.srv.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := c.srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// signup already used two logins from this IP
+	creds := map[string]string{"email": "alice@example.com", "password": "wrong"}
+	for i := 2; i < rateLimitLogin.Limit; i++ {
+		resp := post("/api/login", "", creds)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("login attempt %d returned %d, want %d", i+1, resp.StatusCode, http.StatusUnauthorized)
+		}
+		if got, want := resp.Header.Get("RateLimit-Remaining"), strconv.Itoa(rateLimitLogin.Limit-i-1); got != want {
+			t.Errorf("login attempt %d RateLimit-Remaining = %s, want %s", i+1, got, want)
+		}
+	}
+
+	resp := post("/api/login", "", creds)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("login over the limit returned %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Error("429 response is missing Retry-After")
+	}
+
+	// authenticated requests are limited per user, not per IP
+	for i := range rateLimitChirpsCreate.Limit {
+		resp := post("/api/chirps", bearer(alice.Token), map[string]string{"body": "spam"})
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("chirp %d returned %d, want %d", i+1, resp.StatusCode, http.StatusCreated)
+		}
+	}
+	resp = post("/api/chirps", bearer(alice.Token), map[string]string{"body": "spam"})
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("chirp over the limit returned %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	resp = post("/api/chirps", bearer(bob.Token), map[string]string{"body": "not spam"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("chirp from another user returned %d, want %d", resp.StatusCode, http.StatusCreated)
+	}
+}
+
+type sseEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// openStream connects to the chirp stream and returns a channel of the
+// events it receives.
+func (c *testClient) openStream(path, lastEventID string) <-chan sseEvent {
+	c.t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.srv.URL+path, nil)
+	if err != nil {
+		c.t.Fatalf("Failed to build request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("GET %s failed: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		c.t.Fatalf("GET %s returned %d, want %d", path, resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		c.t.Errorf("GET %s Content-Type = %q, want text/event-stream", path, got)
+	}
+
+	ch := make(chan sseEvent)
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		var e sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			field, value, _ := strings.Cut(scanner.Text(), ": ")
+			switch field {
+			case "id":
+				e.ID = value
+			case "event":
+				e.Type = value
+			case "data":
+				e.Data = value
+			case "":
+				if e.Type != "" {
+					ch <- e
+				}
+				e = sseEvent{}
+			}
+		}
+	}()
+	return ch
+}
+
+func receiveEvent(t *testing.T, ch <-chan sseEvent) sseEvent {
+	t.Helper()
+
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("Stream closed before the next event")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+func TestChirpsStream(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	if code := c.do("GET", "/api/chirps/stream?author_id=nope", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("GET /api/chirps/stream with a bad author_id returned %d, want %d", code, http.StatusBadRequest)
+	}
+
+	stream := c.openStream("/api/chirps/stream?author_id="+alice.ID.String(), "")
+
+	c.createChirp(bob, "not from alice")
+	chirp := c.createChirp(alice, "hello stream")
+	if code := c.do("DELETE", "/api/chirps/"+chirp.ID.String(), bearer(alice.Token), nil, nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE /api/chirps/%s returned %d, want %d", chirp.ID, code, http.StatusNoContent)
+	}
+
+	created := receiveEvent(t, stream)
+	if created.Type != "chirp.created" {
+		t.Fatalf("first event type = %q, want chirp.created", created.Type)
+	}
+	var got Chirp
+	err := json.Unmarshal([]byte(created.Data), &got)
+	if err != nil {
+		t.Fatalf("chirp.created data %q is not a chirp: %v", created.Data, err)
+	}
+	if got.ID != chirp.ID || got.Body != chirp.Body {
+		t.Errorf("chirp.created data = %+v, want %+v", got, chirp)
+	}
+
+	deleted := receiveEvent(t, stream)
+	if deleted.Type != "chirp.deleted" {
+		t.Fatalf("second event type = %q, want chirp.deleted", deleted.Type)
+	}
+
+	// resuming after the created event replays only the delete
+	resumed := c.openStream("/api/chirps/stream?author_id="+alice.ID.String(), created.ID)
+	replayed := receiveEvent(t, resumed)
+	if replayed != deleted {
+		t.Errorf("resumed stream replayed %+v, want %+v", replayed, deleted)
+	}
+}
+
+// dialWebSocket connects to the WebSocket API as user.
+func (c *testClient) dialWebSocket(user testUser) *websocket.Conn {
+	c.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, c.srv.URL+"/api/ws", &websocket.DialOptions{
+		HTTPHeader: http.Header{"Authorization": {bearer(user.Token)}},
+	})
+	if err != nil {
+		c.t.Fatalf("Failed to dial /api/ws: %v", err)
+	}
+	c.t.Cleanup(func() { conn.CloseNow() })
+	return conn
+}
+
+// wsRoundTrip sends msg, if it isn't nil, and returns the next message from
+// the server.
+func wsRoundTrip(t *testing.T, conn *websocket.Conn, msg any) wsServerMessage {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if msg != nil {
+		err := wsjson.Write(ctx, conn, msg)
+		if err != nil {
+			t.Fatalf("Failed to send %+v: %v", msg, err)
+		}
+	}
+	var resp wsServerMessage
+	err := wsjson.Read(ctx, conn, &resp)
+	if err != nil {
+		t.Fatalf("Failed to read WebSocket message: %v", err)
+	}
+	return resp
+}
+
+func TestWebSocket(t *testing.T) {
+	var hub *events.Hub
+	c := newTestClient(t, func(cfg *apiConfig) {
+		hub = cfg.eventHub
+	})
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	if code := c.do("GET", "/api/ws", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET /api/ws without a token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	conn := c.dialWebSocket(alice)
+
+	protocolTests := []struct {
+		name     string
+		msg      wsClientMessage
+		wantType string
+		wantCode errorCode
+	}{
+		{"unknown message", wsClientMessage{Type: "shout"}, "error", codeBadRequest},
+		{"unknown topic", wsClientMessage{Type: wsSubscribe, Topic: "everything"}, "error", codeBadRequest},
+		{"bad author ID", wsClientMessage{Type: wsSubscribe, Topic: "author:nope"}, "error", codeBadRequest},
+		{"bad token", wsClientMessage{Type: wsAuth, Token: "nope"}, "error", codeInvalidToken},
+		{"another user's token", wsClientMessage{Type: wsAuth, Token: bob.Token}, "error", codeForbidden},
+		{"re-authenticate", wsClientMessage{Type: wsAuth, Token: alice.Token}, "authenticated", ""},
+		{"ping", wsClientMessage{Type: wsPing}, "pong", ""},
+	}
+	for _, tt := range protocolTests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := wsRoundTrip(t, conn, tt.msg)
+			if resp.Type != tt.wantType || resp.Code != tt.wantCode {
+				t.Errorf("response = %+v, want type %q code %q", resp, tt.wantType, tt.wantCode)
+			}
+		})
+	}
+
+	resp := wsRoundTrip(t, conn, wsClientMessage{Type: wsSubscribe, Topic: "author:" + bob.ID.String()})
+	if resp.Type != "subscribed" {
+		t.Fatalf("subscribe response = %+v, want subscribed", resp)
+	}
+
+	c.createChirp(alice, "not from bob")
+	chirp := c.createChirp(bob, "hello socket")
+	resp = wsRoundTrip(t, conn, nil)
+	if resp.Type != "event" || resp.Event != events.ChirpCreated {
+		t.Fatalf("message after bob's chirp = %+v, want a chirp.created event", resp)
+	}
+	var got Chirp
+	err := json.Unmarshal(resp.Data, &got)
+	if err != nil || got.ID != chirp.ID {
+		t.Errorf("event data = %s, want chirp %s", resp.Data, chirp.ID)
+	}
+
+	// notifications reach only their recipient, with no subscription needed
+	for _, recipient := range []uuid.UUID{bob.ID, alice.ID} {
+		err = hub.Publish(context.Background(), events.Event{
+			Type:        events.NotificationCreated,
+			RecipientID: recipient,
+			Data:        json.RawMessage(`{"recipient":"` + recipient.String() + `"}`),
+		})
+		if err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	resp = wsRoundTrip(t, conn, nil)
+	if resp.Type != "notification" || !strings.Contains(string(resp.Data), alice.ID.String()) {
+		t.Errorf("message after notifications = %+v, want alice's notification", resp)
+	}
+
+	resp = wsRoundTrip(t, conn, wsClientMessage{Type: wsUnsubscribe, Topic: "author:" + bob.ID.String()})
+	if resp.Type != "unsubscribed" {
+		t.Fatalf("unsubscribe response = %+v, want unsubscribed", resp)
+	}
+	c.createChirp(bob, "nobody is listening")
+	resp = wsRoundTrip(t, conn, wsClientMessage{Type: wsPing})
+	if resp.Type != "pong" {
+		t.Errorf("message after unsubscribing = %+v, want pong", resp)
+	}
+}
+
+func TestWebSocketTokenExpiry(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+
+	token, err := auth.MakeJWT(alice.ID, testJWTSecret, 2*time.Second)
+	if err != nil {
+		t.Fatalf("MakeJWT failed: %v", err)
+	}
+	conn := c.dialWebSocket(testUser{User: alice.User, Token: token})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err = conn.Read(ctx)
+	if got := websocket.CloseStatus(err); got != wsStatusTokenExpired {
+		t.Errorf("connection closed with %v (%v), want %v", got, err, wsStatusTokenExpired)
+	}
+}
+
+func TestRepliesFollowsAndTimeline(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+	carol := c.signup("carol@example.com", "carolPassword")
+
+	root := c.createChirp(alice, "root")
+	var reply Chirp
+	code := c.do("POST", "/api/chirps", bearer(bob.Token), map[string]string{"body": "reply", "reply_to_id": root.ID.String()}, &reply)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /api/chirps reply returned %d, want %d", code, http.StatusCreated)
+	}
+	if reply.ReplyToID == nil || *reply.ReplyToID != root.ID || reply.ThreadID != root.ID {
+		t.Errorf("reply = %+v, want reply_to_id and thread_id %s", reply, root.ID)
+	}
+	var nested Chirp
+	c.do("POST", "/api/chirps", bearer(carol.Token), map[string]string{"body": "nested", "reply_to_id": reply.ID.String()}, &nested)
+	if nested.ThreadID != root.ID {
+		t.Errorf("nested reply thread_id = %s, want %s", nested.ThreadID, root.ID)
+	}
+	c.createChirp(carol, "unrelated")
+
+	code = c.do("POST", "/api/chirps", bearer(bob.Token), map[string]string{"body": "orphan", "reply_to_id": uuid.NewString()}, nil)
+	if code != http.StatusNotFound {
+		t.Errorf("reply to a missing chirp returned %d, want %d", code, http.StatusNotFound)
+	}
+
+	var thread []Chirp
+	c.do("GET", "/api/chirps/"+nested.ID.String()+"/thread", "", nil, &thread)
+	if len(thread) != 3 || thread[0].ID != root.ID || thread[1].ID != reply.ID || thread[2].ID != nested.ID {
+		t.Errorf("thread = %+v, want root, reply, nested", thread)
+	}
+
+	followTests := []struct {
+		name   string
+		method string
+		user   testUser
+		target string
+		want   int
+	}{
+		{"follow", "POST", alice, bob.ID.String(), http.StatusNoContent},
+		{"follow again", "POST", alice, bob.ID.String(), http.StatusNoContent},
+		{"follow self", "POST", alice, alice.ID.String(), http.StatusBadRequest},
+		{"follow missing user", "POST", alice, uuid.NewString(), http.StatusNotFound},
+		{"bad user ID", "POST", alice, "nope", http.StatusBadRequest},
+		{"unauthenticated", "POST", testUser{}, bob.ID.String(), http.StatusUnauthorized},
+	}
+	for _, tt := range followTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var authorization string
+			if tt.user.Token != "" {
+				authorization = bearer(tt.user.Token)
+			}
+			if code := c.do(tt.method, "/api/users/"+tt.target+"/follow", authorization, nil, nil); code != tt.want {
+				t.Errorf("%s /api/users/%s/follow returned %d, want %d", tt.method, tt.target, code, tt.want)
+			}
+		})
+	}
+
+	type timeline struct {
+		Chirps     []Chirp    `json:"chirps"`
+		NextCursor *uuid.UUID `json:"next_cursor"`
+	}
+	var first timeline
+	c.do("GET", "/api/timeline?limit=1", bearer(alice.Token), nil, &first)
+	if len(first.Chirps) != 1 || first.Chirps[0].ID != reply.ID || first.NextCursor == nil {
+		t.Fatalf("first timeline page = %+v, want bob's reply and a cursor", first)
+	}
+	var second timeline
+	c.do("GET", "/api/timeline?limit=1&before="+first.NextCursor.String(), bearer(alice.Token), nil, &second)
+	if len(second.Chirps) != 1 || second.Chirps[0].ID != root.ID {
+		t.Fatalf("second timeline page = %+v, want alice's root chirp", second)
+	}
+	var last timeline
+	c.do("GET", "/api/timeline?limit=1&before="+second.NextCursor.String(), bearer(alice.Token), nil, &last)
+	if len(last.Chirps) != 0 || last.NextCursor != nil {
+		t.Errorf("timeline after the last page = %+v, want nothing", last)
+	}
+
+	if code := c.do("DELETE", "/api/users/"+bob.ID.String()+"/follow", bearer(alice.Token), nil, nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE /api/users/%s/follow returned %d, want %d", bob.ID, code, http.StatusNoContent)
+	}
+	var unfollowed timeline
+	c.do("GET", "/api/timeline", bearer(alice.Token), nil, &unfollowed)
+	if len(unfollowed.Chirps) != 1 || unfollowed.Chirps[0].ID != root.ID {
+		t.Errorf("timeline after unfollowing = %+v, want only alice's chirp", unfollowed)
+	}
+}
+
+type notificationsPage struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unread_count"`
+	NextCursor    *uuid.UUID     `json:"next_cursor"`
+}
+
+func TestNotifications(t *testing.T) {
+	var hub *events.Hub
+	c := newTestClient(t, func(cfg *apiConfig) {
+		hub = cfg.eventHub
+	})
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+	sub, _ := hub.Subscribe(0)
+	defer hub.Unsubscribe(sub)
+
+	chirp := c.createChirp(alice, "like me")
+	c.do("POST", "/api/chirps", bearer(bob.Token), map[string]string{"body": "reply", "reply_to_id": chirp.ID.String()}, nil)
+	c.do("POST", "/api/chirps/"+chirp.ID.String()+"/like", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/chirps/"+chirp.ID.String()+"/like", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/chirps/"+chirp.ID.String()+"/like", bearer(alice.Token), nil, nil)
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+
+	var got notificationsPage
+	code := c.do("GET", "/api/notifications", bearer(alice.Token), nil, &got)
+	if code != http.StatusOK {
+		t.Fatalf("GET /api/notifications returned %d, want %d", code, http.StatusOK)
+	}
+	var gotTypes []string
+	for _, n := range got.Notifications {
+		gotTypes = append(gotTypes, n.Type)
+		if n.ActorID != bob.ID {
+			t.Errorf("%s notification actor = %s, want bob", n.Type, n.ActorID)
+		}
+	}
+	// newest first; liking twice or your own chirp doesn't notify
+	if want := []string{"follow", "like", "reply"}; !reflect.DeepEqual(gotTypes, want) {
+		t.Fatalf("notification types = %v, want %v", gotTypes, want)
+	}
+	if got.UnreadCount != 3 {
+		t.Errorf("unread_count = %d, want 3", got.UnreadCount)
+	}
+
+	var published int
+	for len(sub.C) > 0 {
+		if e := <-sub.C; e.Type == events.NotificationCreated && e.RecipientID == alice.ID {
+			published++
+		}
+	}
+	if published != 3 {
+		t.Errorf("published %d notification events for alice, want 3", published)
+	}
+
+	var page notificationsPage
+	c.do("GET", "/api/notifications?limit=2", bearer(alice.Token), nil, &page)
+	if len(page.Notifications) != 2 || page.NextCursor == nil {
+		t.Fatalf("first page = %+v, want 2 notifications and a cursor", page)
+	}
+	c.do("GET", "/api/notifications?limit=2&before="+page.NextCursor.String(), bearer(alice.Token), nil, &page)
+	if len(page.Notifications) != 1 || page.Notifications[0].Type != "reply" || page.NextCursor != nil {
+		t.Fatalf("second page = %+v, want just the reply", page)
+	}
+
+	readPath := "/api/notifications/" + got.Notifications[0].ID.String() + "/read"
+	if code := c.do("POST", readPath, bearer(bob.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("POST %s as another user returned %d, want %d", readPath, code, http.StatusNotFound)
+	}
+	var read Notification
+	if code := c.do("POST", readPath, bearer(alice.Token), nil, &read); code != http.StatusOK || read.ReadAt == nil {
+		t.Errorf("POST %s returned %d %+v, want 200 with read_at", readPath, code, read)
+	}
+	c.do("GET", "/api/notifications?unread=true", bearer(alice.Token), nil, &page)
+	if len(page.Notifications) != 2 || page.UnreadCount != 2 {
+		t.Errorf("unread notifications = %+v, want 2", page)
+	}
+
+	var marked struct {
+		Marked int64 `json:"marked"`
+	}
+	c.do("POST", "/api/notifications/read", bearer(alice.Token), nil, &marked)
+	if marked.Marked != 2 {
+		t.Errorf("marked %d notifications read, want 2", marked.Marked)
+	}
+
+	// turning likes off stops new like notifications
+	prefs := map[string]bool{"mentions": true, "replies": true, "likes": false, "follows": true}
+	if code := c.do("PUT", "/api/notifications/preferences", bearer(alice.Token), prefs, nil); code != http.StatusOK {
+		t.Fatalf("PUT /api/notifications/preferences returned %d, want %d", code, http.StatusOK)
+	}
+	var gotPrefs NotificationPreferences
+	c.do("GET", "/api/notifications/preferences", bearer(alice.Token), nil, &gotPrefs)
+	if gotPrefs != (NotificationPreferences{Mentions: true, Replies: true, Likes: false, Follows: true}) {
+		t.Errorf("preferences = %+v, want likes off", gotPrefs)
+	}
+	second := c.createChirp(alice, "don't tell me")
+	c.do("POST", "/api/chirps/"+second.ID.String()+"/like", bearer(bob.Token), nil, nil)
+	c.do("GET", "/api/notifications", bearer(alice.Token), nil, &page)
+	if page.UnreadCount != 0 {
+		t.Errorf("unread_count after a muted like = %d, want 0", page.UnreadCount)
+	}
+
+	code = c.do("PUT", "/api/notifications/preferences", bearer(alice.Token), map[string]bool{"likes": true}, nil)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /api/notifications/preferences without every field returned %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMentionsAndHashtags(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "Alice")
+	bob := c.signupWithHandle("bob@example.com", "bobPassword", "bob")
+	carol := c.signup("carol@example.com", "carolPassword")
+
+	if alice.Handle == nil || *alice.Handle != "Alice" {
+		t.Errorf("alice's handle = %v, want Alice", alice.Handle)
+	}
+
+	handleTests := []struct {
+		name   string
+		handle string
+		want   int
+	}{
+		{"taken in another case", "ALICE", http.StatusConflict},
+		{"invalid characters", "not a handle", http.StatusUnprocessableEntity},
+		{"too long", strings.Repeat("a", 31), http.StatusUnprocessableEntity},
+	}
+	for i, tt := range handleTests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{
+				"email":    fmt.Sprintf("user%d@example.com", i),
+				"password": "password",
+				"handle":   tt.handle,
+			}
+			if code := c.do("POST", "/api/users", "", params, nil); code != tt.want {
+				t.Errorf("POST /api/users with handle %q returned %d, want %d", tt.handle, code, tt.want)
+			}
+		})
+	}
+
+	chirp := c.createChirp(carol, "hey @alice and @BOB, #Go #go #日本")
+	wantEntities := []entities.Entity{
+		{Type: entities.Mention, Text: "alice", Start: 4, End: 10},
+		{Type: entities.Mention, Text: "BOB", Start: 15, End: 19},
+		{Type: entities.Hashtag, Text: "Go", Start: 21, End: 24},
+		{Type: entities.Hashtag, Text: "go", Start: 25, End: 28},
+		{Type: entities.Hashtag, Text: "日本", Start: 29, End: 32},
+	}
+	if !reflect.DeepEqual(chirp.Entities, wantEntities) {
+		t.Errorf("entities = %+v, want %+v", chirp.Entities, wantEntities)
+	}
+	c.createChirp(carol, "#golang is a different tag, @nobody isn't a user")
+	// bob is replied to and mentioned, but only gets the reply notification
+	bobsChirp := c.createChirp(bob, "#go")
+	var reply Chirp
+	c.do("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": "@bob #go", "reply_to_id": bobsChirp.ID.String()}, &reply)
+
+	var tagged chirpPage
+	if code := c.do("GET", "/api/hashtags/GO/chirps", "", nil, &tagged); code != http.StatusOK {
+		t.Fatalf("GET /api/hashtags/GO/chirps returned %d, want %d", code, http.StatusOK)
+	}
+	if len(tagged.Chirps) != 3 || tagged.Chirps[0].ID != reply.ID || tagged.Chirps[1].ID != bobsChirp.ID || tagged.Chirps[2].ID != chirp.ID {
+		t.Errorf("#go chirps = %+v, want the reply, bob's chirp and carol's first chirp", tagged.Chirps)
+	}
+	c.do("GET", "/api/hashtags/%23日本/chirps", "", nil, &tagged)
+	if len(tagged.Chirps) != 1 || tagged.Chirps[0].ID != chirp.ID {
+		t.Errorf("#日本 chirps = %+v, want the first chirp", tagged.Chirps)
+	}
+
+	var mentions chirpPage
+	if code := c.do("GET", "/api/users/"+bob.ID.String()+"/mentions", "", nil, &mentions); code != http.StatusOK {
+		t.Fatalf("GET /api/users/%s/mentions returned %d, want %d", bob.ID, code, http.StatusOK)
+	}
+	if len(mentions.Chirps) != 2 {
+		t.Errorf("bob's mentions = %+v, want 2 chirps", mentions.Chirps)
+	}
+
+	var page notificationsPage
+	c.do("GET", "/api/notifications", bearer(bob.Token), nil, &page)
+	var gotTypes []string
+	for _, n := range page.Notifications {
+		gotTypes = append(gotTypes, n.Type)
+	}
+	if want := []string{"reply", "mention"}; !reflect.DeepEqual(gotTypes, want) {
+		t.Errorf("bob's notification types = %v, want %v", gotTypes, want)
+	}
+
+	// mentions of handles nobody has, or of users blocked either way, are
+	// plain text wherever the chirp is read
+	if code := c.do("POST", "/api/users/"+carol.ID.String()+"/block", bearer(alice.Token), nil, nil); code != http.StatusNoContent {
+		t.Fatalf("POST /api/users/%s/block returned %d, want %d", carol.ID, code, http.StatusNoContent)
+	}
+	unlinked := c.createChirp(carol, "@nobody @alice @bob #go")
+	wantEntities = []entities.Entity{
+		{Type: entities.Mention, Text: "bob", Start: 15, End: 19},
+		{Type: entities.Hashtag, Text: "go", Start: 20, End: 23},
+	}
+	if !reflect.DeepEqual(unlinked.Entities, wantEntities) {
+		t.Errorf("created chirp entities = %+v, want %+v", unlinked.Entities, wantEntities)
+	}
+	var got Chirp
+	c.do("GET", "/api/chirps/"+unlinked.ID.String(), "", nil, &got)
+	if !reflect.DeepEqual(got.Entities, wantEntities) {
+		t.Errorf("GET /api/chirps/%s entities = %+v, want %+v", unlinked.ID, got.Entities, wantEntities)
+	}
+	c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil, &got)
+	if len(got.Entities) != 5 {
+		t.Errorf("GET /api/chirps/%s entities = %+v, want the mentions from before the block kept", chirp.ID, got.Entities)
+	}
+}
+
+func TestTrending(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	quiet := c.createChirp(alice, "#go is fine")
+	busy := c.createChirp(alice, "#go #trending")
+	c.do("POST", "/api/chirps/"+busy.ID.String()+"/like", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/chirps", bearer(bob.Token), map[string]string{"body": "agreed", "reply_to_id": busy.ID.String()}, nil)
+	c.do("POST", "/api/chirps/"+quiet.ID.String()+"/like", bearer(bob.Token), nil, nil)
+
+	type trending struct {
+		Window   string            `json:"window"`
+		Hashtags []TrendingHashtag `json:"hashtags"`
+		Chirps   []TrendingChirp   `json:"chirps"`
+	}
+	var got trending
+	c.do("GET", "/api/trending", "", nil, &got)
+	if got.Window != "24h" || len(got.Hashtags) != 0 || len(got.Chirps) != 0 {
+		t.Errorf("trending before the job ran = %+v, want nothing in the 24h window", got)
+	}
+
+	ctx := context.Background()
+	if err := cfg.refreshTrending(ctx); err != nil {
+		t.Fatalf("refreshTrending() unexpected error: %v", err)
+	}
+	if code := c.do("GET", "/api/trending?window=1h", "", nil, &got); code != http.StatusOK {
+		t.Fatalf("GET /api/trending returned %d, want %d", code, http.StatusOK)
+	}
+	if len(got.Chirps) != 2 || got.Chirps[0].ID != busy.ID || got.Chirps[1].ID != quiet.ID {
+		t.Errorf("trending chirps = %+v, want the liked and replied to chirp first", got.Chirps)
+	}
+	if len(got.Hashtags) != 2 || got.Hashtags[0].Tag != "go" || got.Hashtags[1].Tag != "trending" {
+		t.Errorf("trending hashtags = %+v, want go then trending", got.Hashtags)
+	}
+	if got.Chirps[0].Score <= got.Chirps[1].Score || got.Chirps[1].Score > 1 {
+		t.Errorf("trending scores = %v and %v, want decayed and decreasing", got.Chirps[0].Score, got.Chirps[1].Score)
+	}
+
+	hidePath := "/admin/chirps/" + busy.ID.String() + "/hide"
+	if code := c.do("POST", hidePath, bearer(alice.Token), nil, nil); code != http.StatusForbidden {
+		t.Errorf("POST %s by a non-admin returned %d, want %d", hidePath, code, http.StatusForbidden)
+	}
+	if _, err := cfg.store.SetUserAdmin(ctx, database.SetUserAdminParams{Email: bob.Email, IsAdmin: true}); err != nil {
+		t.Fatalf("SetUserAdmin() unexpected error: %v", err)
+	}
+	if code := c.do("POST", hidePath, bearer(bob.Token), nil, nil); code != http.StatusNoContent {
+		t.Fatalf("POST %s returned %d, want %d", hidePath, code, http.StatusNoContent)
+	}
+
+	// hidden chirps drop out straight away, and out of the scores once
+	// the job runs again
+	c.do("GET", "/api/trending?window=1h", "", nil, &got)
+	if len(got.Chirps) != 1 || got.Chirps[0].ID != quiet.ID {
+		t.Errorf("trending chirps after hiding = %+v, want only the other chirp", got.Chirps)
+	}
+	if err := cfg.refreshTrending(ctx); err != nil {
+		t.Fatalf("refreshTrending() unexpected error: %v", err)
+	}
+	c.do("GET", "/api/trending?window=1h", "", nil, &got)
+	if len(got.Hashtags) != 1 || got.Hashtags[0].Tag != "go" {
+		t.Errorf("trending hashtags after hiding = %+v, want only go", got.Hashtags)
+	}
+
+	c.do("POST", "/admin/chirps/"+busy.ID.String()+"/unhide", bearer(bob.Token), nil, nil)
+	cfg.refreshTrending(ctx)
+	c.do("GET", "/api/trending?window=7d&limit=1", "", nil, &got)
+	if len(got.Chirps) != 1 || got.Chirps[0].ID != busy.ID {
+		t.Errorf("trending chirps after unhiding = %+v, want the busy chirp", got.Chirps)
+	}
+
+	for _, query := range []string{"window=2h", "limit=0", "limit=101"} {
+		if code := c.do("GET", "/api/trending?"+query, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET /api/trending?%s returned %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+// uploadMedia posts data as the file of a multipart form.
+func (c *testClient) uploadMedia(user testUser, data []byte) (Media, int) {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload")
+	if err != nil {
+		c.t.Fatalf("Failed to build form: %v", err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, _ := http.NewRequest("POST", c.srv.URL+"/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", bearer(user.Token))
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("POST /api/media failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var m Media
+	if resp.StatusCode == http.StatusCreated {
+		json.NewDecoder(resp.Body).Decode(&m)
+	}
+	return m, resp.StatusCode
+}
+
+func TestMedia(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	var png bytes.Buffer
+	if err := imgpng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 640, 320))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	uploaded, code := c.uploadMedia(alice, png.Bytes())
+	if code != http.StatusCreated {
+		t.Fatalf("POST /api/media returned %d, want %d", code, http.StatusCreated)
+	}
+	if uploaded.ContentType != "image/png" || uploaded.Width != 640 || uploaded.Height != 320 {
+		t.Errorf("uploaded media = %+v, want a 640x320 PNG", uploaded)
+	}
+	if _, code := c.uploadMedia(alice, []byte("<svg onload=alert(1)>")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("uploading a non-image returned %d, want %d", code, http.StatusUnsupportedMediaType)
+	}
+	if code := c.do("POST", "/api/media", bearer(alice.Token), map[string]string{}, nil); code != http.StatusUnsupportedMediaType {
+		t.Errorf("POST /api/media with JSON returned %d, want %d", code, http.StatusUnsupportedMediaType)
+	}
+
+	resp, err := c.srv.Client().Get(c.srv.URL + uploaded.ThumbnailURL)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", uploaded.ThumbnailURL, err)
+	}
+	thumb, _, err := image.DecodeConfig(resp.Body)
+	resp.Body.Close()
+	if err != nil || thumb.Width != media.ThumbnailSize || thumb.Height != media.ThumbnailSize/2 {
+		t.Errorf("thumbnail = %+v (%v), want %dx%d", thumb, err, media.ThumbnailSize, media.ThumbnailSize/2)
+	}
+	if got := resp.Header.Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("Cache-Control = %q, want it cached for good", got)
+	}
+
+	req, _ := http.NewRequest("GET", c.srv.URL+uploaded.URL, nil)
+	req.Header.Set("If-None-Match", `"`+uploaded.ID.String()+`"`)
+	resp, err = c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", uploaded.URL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("conditional GET %s returned %d, want %d", uploaded.URL, resp.StatusCode, http.StatusNotModified)
+	}
+
+	attachTests := []struct {
+		name     string
+		user     testUser
+		mediaIDs []string
+		want     int
+	}{
+		{"someone else's media", bob, []string{uploaded.ID.String()}, http.StatusUnprocessableEntity},
+		{"unknown media", alice, []string{uuid.NewString()}, http.StatusUnprocessableEntity},
+		{"duplicates", alice, []string{uploaded.ID.String(), uploaded.ID.String()}, http.StatusUnprocessableEntity},
+		{"too many", alice, []string{uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString(), uuid.NewString()}, http.StatusUnprocessableEntity},
+		{"own media", alice, []string{uploaded.ID.String()}, http.StatusCreated},
+	}
+	var chirp Chirp
+	for _, tt := range attachTests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]any{"body": "look", "media_ids": tt.mediaIDs}
+			if code := c.do("POST", "/api/chirps", bearer(tt.user.Token), params, &chirp); code != tt.want {
+				t.Errorf("POST /api/chirps returned %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	var got Chirp
+	c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil, &got)
+	if len(got.Media) != 1 || got.Media[0] != uploaded {
+		t.Errorf("chirp media = %+v, want the upload", got.Media)
+	}
+	other := c.createChirp(bob, "no media")
+	if len(other.Media) != 0 || other.Media == nil {
+		t.Errorf("chirp without media has media %v, want []", other.Media)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	c.createChirp(alice, "first")
+	c.createChirp(alice, "second")
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+
+	var png bytes.Buffer
+	imgpng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 64, 64)))
+	avatar, _ := c.uploadMedia(alice, png.Bytes())
+	bobsMedia, _ := c.uploadMedia(bob, png.Bytes())
+
+	var updated testUser
+	params := map[string]string{"display_name": " Alice A. ", "bio": "Hi!", "avatar_media_id": avatar.ID.String()}
+	if code := c.do("PATCH", "/api/users/profile", bearer(alice.Token), params, &updated); code != http.StatusOK {
+		t.Fatalf("PATCH /api/users/profile returned %d, want %d", code, http.StatusOK)
+	}
+	if updated.DisplayName != "Alice A." || updated.Bio != "Hi!" || updated.AvatarURL == nil || *updated.AvatarURL != avatar.URL {
+		t.Errorf("updated user = %+v, want the new profile", updated.User)
+	}
+	if updated.Handle == nil || *updated.Handle != "alice" {
+		t.Errorf("updated handle = %v, want it unchanged", updated.Handle)
+	}
+
+	getProfile := func(path, authorization string) Profile {
+		t.Helper()
+		var profile Profile
+		c.do("GET", path, authorization, nil, &profile)
+		return profile
+	}
+
+	var profile Profile
+	if code := c.do("GET", "/api/users/@ALICE", "", nil, &profile); code != http.StatusOK {
+		t.Fatalf("GET /api/users/@ALICE returned %d, want %d", code, http.StatusOK)
+	}
+	want := Profile{
+		ID:            alice.ID,
+		CreatedAt:     alice.CreatedAt,
+		Handle:        updated.Handle,
+		DisplayName:   "Alice A.",
+		Bio:           "Hi!",
+		AvatarURL:     updated.AvatarURL,
+		ChirpCount:    2,
+		FollowerCount: 1,
+	}
+	if !reflect.DeepEqual(profile, want) {
+		t.Errorf("profile = %+v, want %+v", profile, want)
+	}
+	if profile := getProfile("/api/users/alice", bearer(bob.Token)); profile.Email != "" {
+		t.Errorf("profile shown to another user has email %q, want none", profile.Email)
+	}
+	if profile := getProfile("/api/users/alice", bearer(alice.Token)); profile.Email != alice.Email {
+		t.Errorf("profile shown to its owner has email %q, want %q", profile.Email, alice.Email)
+	}
+	if profile := getProfile("/api/users/"+bob.ID.String(), ""); profile.ID != bob.ID || profile.Handle != nil || profile.FollowingCount != 1 {
+		t.Errorf("bob's profile = %+v, want him by ID, following 1", profile)
+	}
+
+	updateTests := []struct {
+		name   string
+		params map[string]string
+		want   int
+	}{
+		{"handle taken in another case", map[string]string{"handle": "ALICE"}, http.StatusConflict},
+		{"invalid handle", map[string]string{"handle": "b o b"}, http.StatusUnprocessableEntity},
+		{"someone else's avatar", map[string]string{"avatar_media_id": avatar.ID.String()}, http.StatusUnprocessableEntity},
+		{"bio too long", map[string]string{"bio": strings.Repeat("a", 161)}, http.StatusUnprocessableEntity},
+		{"new handle and avatar", map[string]string{"handle": "bob", "avatar_media_id": bobsMedia.ID.String()}, http.StatusOK},
+		{"no avatar", map[string]string{"avatar_media_id": ""}, http.StatusOK},
+	}
+	for _, tt := range updateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := c.do("PATCH", "/api/users/profile", bearer(bob.Token), tt.params, nil); code != tt.want {
+				t.Errorf("PATCH /api/users/profile returned %d, want %d", code, tt.want)
+			}
+		})
+	}
+	if profile := getProfile("/api/users/bob", ""); profile.ID != bob.ID || profile.AvatarURL != nil {
+		t.Errorf("bob's profile = %+v, want his new handle and no avatar", profile)
+	}
+	if code := c.do("GET", "/api/users/nobody", "", nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET /api/users/nobody returned %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestExpandAuthor(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signup("bob@example.com", "bobPassword")
+	c.do("PATCH", "/api/users/profile", bearer(alice.Token), map[string]string{"display_name": "Alice"}, nil)
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+
+	chirp := c.createChirp(alice, "hello")
+	c.createChirp(bob, "hi")
+
+	handle := "alice"
+	wantAlice := &Author{ID: alice.ID, Handle: &handle, DisplayName: "Alice"}
+	wantBob := &Author{ID: bob.ID}
+
+	var chirps []Chirp
+	c.do("GET", "/api/chirps?expand=author&sort=asc", "", nil, &chirps)
+	if len(chirps) != 2 || !reflect.DeepEqual(chirps[0].Author, wantAlice) || !reflect.DeepEqual(chirps[1].Author, wantBob) {
+		t.Errorf("GET /api/chirps?expand=author = %+v, want alice's and bob's summaries", chirps)
+	}
+
+	var raw []map[string]any
+	c.do("GET", "/api/chirps?expand=author", "", nil, &raw)
+	if author, ok := raw[0]["author"].(map[string]any); !ok || author["email"] != nil {
+		t.Errorf("embedded author = %v, want a summary without email", raw[0]["author"])
+	}
+	var plain []map[string]any
+	c.do("GET", "/api/chirps", "", nil, &plain)
+	if _, ok := plain[0]["author"]; ok {
+		t.Error("GET /api/chirps without expand embedded the author")
+	}
+
+	var got Chirp
+	c.do("GET", "/api/chirps/"+chirp.ID.String()+"?expand=author", "", nil, &got)
+	if !reflect.DeepEqual(got.Author, wantAlice) {
+		t.Errorf("GET /api/chirps/{id}?expand=author author = %+v, want %+v", got.Author, wantAlice)
+	}
+
+	var timeline chirpPage
+	c.do("GET", "/api/timeline?expand=author", bearer(bob.Token), nil, &timeline)
+	if len(timeline.Chirps) != 2 || !reflect.DeepEqual(timeline.Chirps[1].Author, wantAlice) {
+		t.Errorf("timeline with expand=author = %+v, want alice's summary on her chirp", timeline.Chirps)
+	}
+
+	if code := c.do("GET", "/api/chirps?expand=author,likes", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("GET /api/chirps?expand=author,likes returned %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestAccountDeletion(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	chirp := c.createChirp(alice, "soon gone")
+	c.do("POST", "/api/chirps/"+chirp.ID.String()+"/like", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+	var png bytes.Buffer
+	if err := imgpng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	avatar, _ := c.uploadMedia(alice, png.Bytes())
+
+	tests := []struct {
+		name     string
+		body     any
+		wantCode int
+	}{
+		{name: "no password", body: map[string]string{}, wantCode: http.StatusUnprocessableEntity},
+		{name: "wrong password", body: map[string]string{"password": "bobPassword"}, wantCode: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := c.do("DELETE", "/api/users/me", bearer(alice.Token), tt.body, nil); code != tt.wantCode {
+				t.Errorf("DELETE /api/users/me returned %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var user User
+	code := c.do("DELETE", "/api/users/me", bearer(alice.Token), map[string]string{"password": "alicePassword"}, &user)
+	if code != http.StatusAccepted {
+		t.Fatalf("DELETE /api/users/me returned %d, want %d", code, http.StatusAccepted)
+	}
+	if user.DeletionScheduledAt == nil || time.Until(*user.DeletionScheduledAt) < accountDeletionGracePeriod-time.Minute {
+		t.Errorf("deletion_scheduled_at = %v, want the end of the grace period", user.DeletionScheduledAt)
+	}
+	if code := c.do("POST", "/api/refresh", bearer(alice.RefreshToken), nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST /api/refresh after deleting returned %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	ctx := context.Background()
+	if err := cfg.purgeDeletedAccounts(ctx, time.Now()); err != nil {
+		t.Fatalf("purgeDeletedAccounts() unexpected error: %v", err)
+	}
+	if code := c.do("GET", "/api/chirps/"+chirp.ID.String(), "", nil, nil); code != http.StatusOK {
+		t.Errorf("GET chirp during the grace period returned %d, want %d", code, http.StatusOK)
+	}
+
+	var cancelled User
+	code = c.do("POST", "/api/users/me/cancel-deletion", bearer(alice.Token), nil, &cancelled)
+	if code != http.StatusOK || cancelled.DeletionScheduledAt != nil {
+		t.Errorf("POST /api/users/me/cancel-deletion returned %d and %v, want %d and no deletion", code, cancelled.DeletionScheduledAt, http.StatusOK)
+	}
+	cfg.purgeDeletedAccounts(ctx, time.Now().Add(2*accountDeletionGracePeriod))
+	if code := c.do("GET", "/api/users/alice", "", nil, nil); code != http.StatusOK {
+		t.Errorf("GET profile after cancelling returned %d, want %d", code, http.StatusOK)
+	}
+
+	c.do("DELETE", "/api/users/me", bearer(alice.Token), map[string]string{"password": "alicePassword"}, nil)
+	if err := cfg.purgeDeletedAccounts(ctx, time.Now().Add(accountDeletionGracePeriod+time.Minute)); err != nil {
+		t.Fatalf("purgeDeletedAccounts() unexpected error: %v", err)
+	}
+	for _, path := range []string{"/api/users/alice", "/api/chirps/" + chirp.ID.String(), avatar.URL, avatar.ThumbnailURL} {
+		if code := c.do("GET", path, "", nil, nil); code != http.StatusNotFound {
+			t.Errorf("GET %s after the purge returned %d, want %d", path, code, http.StatusNotFound)
+		}
+	}
+	creds := map[string]string{"email": "alice@example.com", "password": "alicePassword"}
+	if code := c.do("POST", "/api/login", "", creds, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST /api/login after the purge returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	if _, err := cfg.jobs.RunOnce(ctx, time.Now()); err != nil {
+		t.Fatalf("RunOnce() unexpected error: %v", err)
+	}
+	if _, err := cfg.blobs.Open(ctx, mediaBlobKey(avatar.ID, false)); err == nil {
+		t.Errorf("avatar file still exists after the purge job ran")
+	}
+	var profile Profile
+	c.do("GET", "/api/users/"+bob.ID.String(), "", nil, &profile)
+	if profile.FollowingCount != 0 {
+		t.Errorf("bob's following_count = %d, want 0", profile.FollowingCount)
+	}
+}
+
+func TestAdminJobs(t *testing.T) {
+	flaky := jobs.Kind[struct{}]{Name: "flaky", MaxAttempts: 1}
+	failures := 1
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) {
+		cfg = c
+		jobs.Handle(c.jobs, flaky, func(ctx context.Context, _ struct{}) error {
+			if failures > 0 {
+				failures--
+				return errors.New("flaked")
+			}
+			return nil
+		})
+	})
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+	ctx := context.Background()
+	if _, err := cfg.store.SetUserAdmin(ctx, database.SetUserAdminParams{Email: alice.Email, IsAdmin: true}); err != nil {
+		t.Fatalf("SetUserAdmin() unexpected error: %v", err)
+	}
+
+	job, err := flaky.Enqueue(ctx, cfg.store, struct{}{})
+	if err != nil {
+		t.Fatalf("Enqueue() unexpected error: %v", err)
+	}
+	if _, err := cfg.jobs.RunOnce(ctx, time.Now()); err != nil {
+		t.Fatalf("RunOnce() unexpected error: %v", err)
+	}
+	jobPath := "/admin/jobs/" + job.ID.String()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		user     testUser
+		wantCode int
+	}{
+		{name: "list as non-admin", method: "GET", path: "/admin/jobs", user: bob, wantCode: http.StatusForbidden},
+		{name: "unknown status", method: "GET", path: "/admin/jobs?status=done", user: alice, wantCode: http.StatusBadRequest},
+		{name: "get as non-admin", method: "GET", path: jobPath, user: bob, wantCode: http.StatusForbidden},
+		{name: "get unknown job", method: "GET", path: "/admin/jobs/" + uuid.NewString(), user: alice, wantCode: http.StatusNotFound},
+		{name: "get invalid ID", method: "GET", path: "/admin/jobs/nope", user: alice, wantCode: http.StatusBadRequest},
+		{name: "retry as non-admin", method: "POST", path: jobPath + "/retry", user: bob, wantCode: http.StatusForbidden},
+		{name: "retry unknown job", method: "POST", path: "/admin/jobs/" + uuid.NewString() + "/retry", user: alice, wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := c.do(tt.method, tt.path, bearer(tt.user.Token), nil, nil); code != tt.wantCode {
+				t.Errorf("%s %s returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+		})
+	}
+
+	var page struct {
+		Jobs []Job `json:"jobs"`
+	}
+	if code := c.do("GET", "/admin/jobs?status=dead", bearer(alice.Token), nil, &page); code != http.StatusOK {
+		t.Fatalf("GET /admin/jobs?status=dead returned %d, want %d", code, http.StatusOK)
+	}
+	if len(page.Jobs) != 1 || page.Jobs[0].ID != job.ID || page.Jobs[0].LastError == nil || *page.Jobs[0].LastError != "flaked" {
+		t.Fatalf("dead jobs = %+v, want the flaky job and its error", page.Jobs)
+	}
+	c.do("GET", "/admin/jobs?status=pending", bearer(alice.Token), nil, &page)
+	if len(page.Jobs) != 0 {
+		t.Errorf("pending jobs = %+v, want none", page.Jobs)
+	}
+
+	var retried Job
+	if code := c.do("POST", jobPath+"/retry", bearer(alice.Token), nil, &retried); code != http.StatusOK {
+		t.Fatalf("POST %s/retry returned %d, want %d", jobPath, code, http.StatusOK)
+	}
+	if retried.Status != "pending" || retried.Attempts != 0 {
+		t.Errorf("retried job = %+v, want pending with no attempts", retried)
+	}
+	if code := c.do("POST", jobPath+"/retry", bearer(alice.Token), nil, nil); code != http.StatusConflict {
+		t.Errorf("POST %s/retry of a pending job returned %d, want %d", jobPath, code, http.StatusConflict)
+	}
+
+	if _, err := cfg.jobs.RunOnce(ctx, time.Now()); err != nil {
+		t.Fatalf("RunOnce() unexpected error: %v", err)
+	}
+	if code := c.do("GET", jobPath, bearer(alice.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET %s after it succeeded returned %d, want %d", jobPath, code, http.StatusNotFound)
+	}
+}
+
+func TestRefreshTokenPurge(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signup("alice@example.com", "alicePassword")
+	ctx := context.Background()
+	if _, err := cfg.store.SetUserAdmin(ctx, database.SetUserAdminParams{Email: alice.Email, IsAdmin: true}); err != nil {
+		t.Fatalf("SetUserAdmin() unexpected error: %v", err)
+	}
+	bob := c.signup("bob@example.com", "bobPassword")
+	c.do("POST", "/api/revoke", bearer(bob.RefreshToken), nil, nil)
+
+	type purgeResponse struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if code := c.do("POST", "/admin/refresh-tokens/purge", bearer(bob.Token), nil, nil); code != http.StatusForbidden {
+		t.Errorf("POST /admin/refresh-tokens/purge by a non-admin returned %d, want %d", code, http.StatusForbidden)
+	}
+	var resp purgeResponse
+	if code := c.do("POST", "/admin/refresh-tokens/purge", bearer(alice.Token), nil, &resp); code != http.StatusOK {
+		t.Fatalf("POST /admin/refresh-tokens/purge returned %d, want %d", code, http.StatusOK)
+	}
+	if resp.Deleted != 0 {
+		t.Errorf("purge deleted %d tokens, want 0 while the revoked token is retained", resp.Deleted)
+	}
+
+	deleted, err := cfg.purgeRefreshTokens(ctx, time.Now().Add(refreshTokenRetention+time.Minute))
+	if err != nil {
+		t.Fatalf("purgeRefreshTokens() unexpected error: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("purgeRefreshTokens() deleted %d tokens, want bob's revoked token", deleted)
+	}
+	tokens, _ := cfg.store.GetRefreshTokensByUserID(ctx, bob.ID)
+	if len(tokens) != 0 {
+		t.Errorf("bob has %d refresh tokens after the purge, want 0", len(tokens))
+	}
+	if code := c.do("POST", "/api/refresh", bearer(alice.RefreshToken), nil, nil); code != http.StatusOK {
+		t.Errorf("POST /api/refresh with a live token after the purge returned %d, want %d", code, http.StatusOK)
+	}
+
+	// a token that expired, rather than being revoked, goes once the
+	// retention after its expiry has passed
+	deleted, _ = cfg.purgeRefreshTokens(ctx, time.Now().AddDate(0, 0, 60).Add(refreshTokenRetention+time.Minute))
+	if deleted != 1 {
+		t.Errorf("purgeRefreshTokens() long after expiry deleted %d tokens, want alice's", deleted)
+	}
+	if got := cfg.refreshTokensPurged.Load(); got != 2 {
+		t.Errorf("refreshTokensPurged = %d, want 2", got)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+	ctx := context.Background()
+	if _, err := cfg.store.SetUserAdmin(ctx, database.SetUserAdminParams{Email: bob.Email, IsAdmin: true}); err != nil {
+		t.Fatalf("SetUserAdmin() unexpected error: %v", err)
+	}
+
+	c.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": "wrongPassword"}, nil)
+	c.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "nobodyPassword"}, nil)
+	c.do("POST", "/api/refresh", bearer("not-a-token"), nil, nil)
+	c.do("PUT", "/api/users", bearer(alice.Token), map[string]string{"email": "alice@example.org", "password": "newPassword"}, nil)
+	deleted := c.createChirp(alice, "delete me")
+	c.do("DELETE", "/api/chirps/"+deleted.ID.String(), bearer(alice.Token), nil, nil)
+	hidden := c.createChirp(alice, "hide me")
+	c.do("POST", "/admin/chirps/"+hidden.ID.String()+"/hide", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/revoke", bearer(alice.RefreshToken), nil, nil)
+	c.do("DELETE", "/api/users/me", bearer(alice.Token), map[string]string{"password": "wrongPassword"}, nil)
+	c.do("DELETE", "/api/users/me", bearer(alice.Token), map[string]string{"password": "newPassword"}, nil)
+	c.do("POST", "/api/users/me/cancel-deletion", bearer(alice.Token), nil, nil)
+	for _, args := range [][]string{{"grant", "alice@example.org"}, {"revoke", "alice@example.org"}} {
+		if err := runAdminCommand(ctx, cfg.store, args); err != nil {
+			t.Fatalf("runAdminCommand(%v) unexpected error: %v", args, err)
+		}
+	}
+
+	type page struct {
+		Events     []AuditEvent `json:"events"`
+		NextCursor *uuid.UUID   `json:"next_cursor"`
+	}
+	tests := []struct {
+		name        string
+		query       string
+		wantActions []string
+	}{
+		{name: "failed logins", query: "action=user.login&outcome=failure", wantActions: []string{auditLogin, auditLogin}},
+		{name: "by actor", query: "actor_id=" + alice.ID.String(), wantActions: []string{auditDeletionCancel, auditDeletionRequest, auditDeletionRequest, auditRevoke, auditChirpDelete, auditUpdateCredentials, auditLogin}},
+		{name: "failed deletion", query: "action=user.deletion_request&outcome=failure", wantActions: []string{auditDeletionRequest}},
+		{name: "by target", query: "target_id=" + hidden.ID.String(), wantActions: []string{auditChirpHide}},
+		{name: "failed refresh", query: "action=token.refresh&outcome=failure", wantActions: []string{auditRefresh}},
+		{name: "since the future", query: "since=" + time.Now().Add(time.Hour).Format(time.RFC3339), wantActions: []string{}},
+		{name: "until the past", query: "until=2000-01-01T00:00:00Z", wantActions: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got page
+			path := "/admin/audit-events?" + tt.query
+			if code := c.do("GET", path, bearer(bob.Token), nil, &got); code != http.StatusOK {
+				t.Fatalf("GET %s returned %d, want %d", path, code, http.StatusOK)
+			}
+			actions := []string{}
+			for _, e := range got.Events {
+				actions = append(actions, e.Action)
+				if e.IP == "" || e.RequestID == "" || e.UserAgent == "" {
+					t.Errorf("event %+v is missing the IP, request ID or user agent", e)
+				}
+			}
+			if !slices.Equal(actions, tt.wantActions) {
+				t.Errorf("GET %s actions = %v, want %v", path, actions, tt.wantActions)
+			}
+		})
+	}
+
+	var got page
+	c.do("GET", "/admin/audit-events?action=user.update_credentials", bearer(bob.Token), nil, &got)
+	var details map[string]any
+	if len(got.Events) == 1 {
+		json.Unmarshal(got.Events[0].Details, &details)
+	}
+	if details["email_changed"] != true || details["new_email"] != "alice@example.org" {
+		t.Errorf("update_credentials details = %v, want the email change", details)
+	}
+	for _, action := range []string{auditAdminGrant, auditAdminRevoke} {
+		c.do("GET", "/admin/audit-events?action="+action, bearer(bob.Token), nil, &got)
+		var details map[string]any
+		if len(got.Events) == 1 {
+			json.Unmarshal(got.Events[0].Details, &details)
+		}
+		if len(got.Events) != 1 || got.Events[0].ActorID != nil || got.Events[0].TargetID == nil || *got.Events[0].TargetID != alice.ID || details["source"] != "cli" {
+			t.Errorf("%s events = %+v, want one from the CLI on alice", action, got.Events)
+		}
+	}
+	c.do("GET", "/admin/audit-events?action=user.login&outcome=failure", bearer(bob.Token), nil, &got)
+	if got.Events[1].TargetID == nil || *got.Events[1].TargetID != alice.ID || got.Events[0].TargetID != nil {
+		t.Errorf("failed logins = %+v, want alice as the target of the wrong password only", got.Events)
+	}
+
+	for _, query := range []string{"outcome=maybe", "actor_id=nope", "since=yesterday", "format=xml", "limit=0"} {
+		if code := c.do("GET", "/admin/audit-events?"+query, bearer(bob.Token), nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET /admin/audit-events?%s returned %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+	if code := c.do("GET", "/admin/audit-events", bearer(alice.Token), nil, nil); code != http.StatusForbidden {
+		t.Errorf("GET /admin/audit-events by a non-admin returned %d, want %d", code, http.StatusForbidden)
+	}
+
+	c.do("GET", "/admin/audit-events?limit=100", bearer(bob.Token), nil, &got)
+	req, _ := http.NewRequest("GET", c.srv.URL+"/admin/audit-events?format=csv&limit=1", nil)
+	req.Header.Set("Authorization", bearer(bob.Token))
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET /admin/audit-events?format=csv failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("GET /admin/audit-events?format=csv returned %d with %q, want %d with CSV", resp.StatusCode, resp.Header.Get("Content-Type"), http.StatusOK)
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("audit CSV is invalid: %v", err)
+	}
+	// every event, whatever the limit, after the header
+	if len(records) != len(got.Events)+1 || !slices.Equal(records[0], auditCSVHeader) || records[1][0] != got.Events[0].ID.String() {
+		t.Errorf("audit CSV has %d rows starting %v, want the header and %d events", len(records), records[0], len(got.Events))
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice_w")
+	bob := c.signup("bob@example.com", "bobPassword")
+	carol := c.signupWithHandle("carol@example.org", "carolPassword", "carol")
+	ctx := context.Background()
+	if _, err := cfg.store.SetUserAdmin(ctx, database.SetUserAdminParams{Email: bob.Email, IsAdmin: true}); err != nil {
+		t.Fatalf("SetUserAdmin() unexpected error: %v", err)
+	}
+
+	type usersPage struct {
+		Users      []AdminUser `json:"users"`
+		NextCursor *uuid.UUID  `json:"next_cursor"`
+	}
+	searches := []struct {
+		query string
+		want  []uuid.UUID
+	}{
+		{query: "", want: []uuid.UUID{carol.ID, bob.ID, alice.ID}},
+		{query: "q=EXAMPLE.COM", want: []uuid.UUID{bob.ID, alice.ID}},
+		{query: "q=carol", want: []uuid.UUID{carol.ID}},
+		{query: "q=e_w", want: []uuid.UUID{alice.ID}},
+		// _ matches only itself, not any character
+		{query: "q=o_", want: []uuid.UUID{}},
+		{query: "q=%25", want: []uuid.UUID{}},
+		{query: "limit=2&before=" + carol.ID.String(), want: []uuid.UUID{bob.ID, alice.ID}},
+	}
+	for _, tt := range searches {
+		var got usersPage
+		path := "/admin/users?" + tt.query
+		if code := c.do("GET", path, bearer(bob.Token), nil, &got); code != http.StatusOK {
+			t.Fatalf("GET %s returned %d, want %d", path, code, http.StatusOK)
+		}
+		ids := []uuid.UUID{}
+		for _, u := range got.Users {
+			ids = append(ids, u.ID)
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("GET %s = %v, want %v", path, ids, tt.want)
+		}
+	}
+
+	var details AdminUser
+	c.do("GET", "/admin/users/"+bob.ID.String(), bearer(bob.Token), nil, &details)
+	if details.Email != bob.Email || !details.IsAdmin || details.SuspendedAt != nil {
+		t.Errorf("GET /admin/users/{bob} = %+v, want bob as an active admin", details)
+	}
+
+	userPath := "/admin/users/" + alice.ID.String()
+	endpoints := []struct {
+		method, path string
+	}{
+		{"GET", "/admin/users"},
+		{"GET", userPath},
+		{"GET", userPath + "/sessions"},
+		{"POST", userPath + "/logout"},
+		{"POST", userPath + "/chirpy-red"},
+		{"DELETE", userPath + "/chirpy-red"},
+		{"POST", userPath + "/suspension"},
+		{"DELETE", userPath + "/suspension"},
+		{"POST", userPath + "/impersonate"},
+	}
+	for _, e := range endpoints {
+		if code := c.do(e.method, e.path, bearer(alice.Token), nil, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s by a non-admin returned %d, want %d", e.method, e.path, code, http.StatusForbidden)
+		}
+	}
+	missing := "/admin/users/" + uuid.NewString()
+	for _, path := range []string{missing + "/logout", missing + "/chirpy-red", missing + "/suspension", missing + "/impersonate"} {
+		if code := c.do("POST", path, bearer(bob.Token), nil, nil); code != http.StatusNotFound {
+			t.Errorf("POST %s returned %d, want %d", path, code, http.StatusNotFound)
+		}
+	}
+
+	var red AdminUser
+	if code := c.do("POST", userPath+"/chirpy-red", bearer(bob.Token), nil, &red); code != http.StatusOK || !red.IsChirpyRed {
+		t.Errorf("POST %s/chirpy-red returned %d with is_chirpy_red %v, want %d with true", userPath, code, red.IsChirpyRed, http.StatusOK)
+	}
+	if code := c.do("DELETE", userPath+"/chirpy-red", bearer(bob.Token), nil, &red); code != http.StatusOK || red.IsChirpyRed {
+		t.Errorf("DELETE %s/chirpy-red returned %d with is_chirpy_red %v, want %d with false", userPath, code, red.IsChirpyRed, http.StatusOK)
+	}
+
+	// alice logs in on a second device, then is logged out of both
+	var second testUser
+	c.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": "alicePassword"}, &second)
+	var sessions struct {
+		Sessions []Session `json:"sessions"`
+	}
+	c.do("GET", userPath+"/sessions", bearer(bob.Token), nil, &sessions)
+	if len(sessions.Sessions) != 2 || sessions.Sessions[0].RevokedAt != nil {
+		t.Fatalf("GET %s/sessions = %+v, want 2 live sessions", userPath, sessions.Sessions)
+	}
+	if code := c.do("POST", userPath+"/logout", bearer(bob.Token), nil, nil); code != http.StatusNoContent {
+		t.Errorf("POST %s/logout returned %d, want %d", userPath, code, http.StatusNoContent)
+	}
+	for _, token := range []string{alice.RefreshToken, second.RefreshToken} {
+		if code := c.do("POST", "/api/refresh", bearer(token), nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("POST /api/refresh after a forced logout returned %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+	c.do("GET", userPath+"/sessions", bearer(bob.Token), nil, &sessions)
+	for _, session := range sessions.Sessions {
+		if session.RevokedAt == nil {
+			t.Errorf("session %s wasn't revoked by the forced logout", session.ID)
+		}
+	}
+
+	soon := time.Now().Add(time.Hour)
+	c.do("POST", "/api/chirps", bearer(carol.Token), map[string]any{"body": "scheduled before suspension", "publish_at": soon}, nil)
+	c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "scheduled after carol's", "publish_at": soon.Add(time.Minute)}, nil)
+
+	carolPath := "/admin/users/" + carol.ID.String()
+	var suspended AdminUser
+	if code := c.do("POST", carolPath+"/suspension", bearer(bob.Token), nil, &suspended); code != http.StatusOK || suspended.SuspendedAt == nil {
+		t.Fatalf("POST %s/suspension returned %d with suspended_at %v, want %d with a time", carolPath, code, suspended.SuspendedAt, http.StatusOK)
+	}
+	creds := map[string]string{"email": carol.Email, "password": "carolPassword"}
+	if code := c.do("POST", "/api/login", "", creds, nil); code != http.StatusForbidden {
+		t.Errorf("POST /api/login while suspended returned %d, want %d", code, http.StatusForbidden)
+	}
+	if code := c.do("POST", "/api/refresh", bearer(carol.RefreshToken), nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST /api/refresh while suspended returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	// the access token carol already had stops working too
+	suspendedCalls := []struct {
+		method, path string
+		body         any
+	}{
+		{"POST", "/api/chirps", map[string]string{"body": "still here"}},
+		{"GET", "/api/timeline", nil},
+		{"PUT", "/api/users", map[string]string{"email": carol.Email, "password": "carolPassword2"}},
+		{"POST", "/api/users/" + alice.ID.String() + "/follow", nil},
+		{"DELETE", "/api/chirps/" + uuid.NewString(), nil},
+		{"GET", "/api/ws", nil},
+	}
+	for _, e := range suspendedCalls {
+		if code := c.do(e.method, e.path, bearer(carol.Token), e.body, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s with a suspended user's access token returned %d, want %d", e.method, e.path, code, http.StatusForbidden)
+		}
+	}
+	// carol's scheduled chirp waits without holding up alice's
+	if err := cfg.publishDueChirps(ctx, soon.Add(time.Hour)); err != nil {
+		t.Errorf("publishDueChirps() with a suspended author returned %v, want nil", err)
+	}
+	if ids := c.chirpIDs(alice, "/api/chirps?author_id="+carol.ID.String()); len(ids) != 0 {
+		t.Errorf("suspended carol's chirps = %v, want her scheduled chirp left unpublished", ids)
+	}
+	if ids := c.chirpIDs(alice, "/api/chirps?author_id="+alice.ID.String()); len(ids) != 1 {
+		t.Errorf("alice's chirps = %v, want hers published", ids)
+	}
+	if scheduled, err := cfg.store.GetScheduledChirps(ctx, carol.ID); err != nil || len(scheduled) != 1 || scheduled[0].Attempts != 0 {
+		t.Errorf("carol's scheduled chirps = %+v, %v, want hers kept without a failed attempt", scheduled, err)
+	}
+
+	var again AdminUser
+	c.do("POST", carolPath+"/suspension", bearer(bob.Token), nil, &again)
+	if again.SuspendedAt == nil || !again.SuspendedAt.Equal(*suspended.SuspendedAt) {
+		t.Errorf("suspending twice moved suspended_at from %v to %v", suspended.SuspendedAt, again.SuspendedAt)
+	}
+	if code := c.do("DELETE", carolPath+"/suspension", bearer(bob.Token), nil, &again); code != http.StatusOK || again.SuspendedAt != nil {
+		t.Errorf("DELETE %s/suspension returned %d with suspended_at %v, want %d with null", carolPath, code, again.SuspendedAt, http.StatusOK)
+	}
+	if code := c.do("POST", "/api/login", "", creds, nil); code != http.StatusOK {
+		t.Errorf("POST /api/login after unsuspending returned %d, want %d", code, http.StatusOK)
+	}
+	if err := cfg.publishDueChirps(ctx, soon.Add(time.Hour)); err != nil {
+		t.Errorf("publishDueChirps() after unsuspending returned %v, want nil", err)
+	}
+	if ids := c.chirpIDs(alice, "/api/chirps?author_id="+carol.ID.String()); len(ids) != 1 {
+		t.Errorf("carol's chirps after unsuspending = %v, want her scheduled chirp published", ids)
+	}
+
+	var impersonation struct {
+		AdminUser
+		Token string `json:"token"`
+	}
+	if code := c.do("POST", carolPath+"/impersonate", bearer(bob.Token), nil, &impersonation); code != http.StatusOK || impersonation.ID != carol.ID {
+		t.Fatalf("POST %s/impersonate returned %d for %v, want %d for carol", carolPath, code, impersonation.ID, http.StatusOK)
+	}
+	chirp := c.createChirp(testUser{Token: impersonation.Token}, "posted by support")
+	if chirp.UserID != carol.ID {
+		t.Errorf("chirp made with an impersonation token belongs to %v, want carol", chirp.UserID)
+	}
+	c.do("DELETE", "/api/chirps/"+chirp.ID.String(), bearer(impersonation.Token), nil, nil)
+	// support can't take the account over
+	ownerOnly := []struct {
+		method, path string
+		body         any
+	}{
+		{"PUT", "/api/users", map[string]string{"email": "support@example.com", "password": "takenOver1"}},
+		{"DELETE", "/api/users/me", map[string]string{"password": "carolPassword"}},
+		{"POST", "/api/users/me/cancel-deletion", nil},
+		{"GET", "/api/users/me/export", nil},
+		{"GET", "/api/users/me/export/download", nil},
+	}
+	for _, e := range ownerOnly {
+		if code := c.do(e.method, e.path, bearer(impersonation.Token), e.body, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s with an impersonation token returned %d, want %d", e.method, e.path, code, http.StatusForbidden)
+		}
+	}
+	if code := c.do("POST", "/api/login", "", creds, nil); code != http.StatusOK {
+		t.Errorf("POST /api/login after impersonation returned %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do("POST", "/admin/users/"+bob.ID.String()+"/impersonate", bearer(bob.Token), nil, nil); code != http.StatusForbidden {
+		t.Errorf("impersonating an admin returned %d, want %d", code, http.StatusForbidden)
+	}
+
+	var audit struct {
+		Events []AuditEvent `json:"events"`
+	}
+	c.do("GET", "/admin/audit-events?target_id="+carol.ID.String(), bearer(bob.Token), nil, &audit)
+	actions := []string{}
+	for _, e := range audit.Events {
+		actions = append(actions, e.Action)
+	}
+	want := []string{auditLogin}
+	// the requests made while impersonating, newest first
+	for range len(ownerOnly) + 2 {
+		want = append(want, auditImpersonatedCall)
+	}
+	want = append(want, auditImpersonate, auditLogin, auditUnsuspend, auditSuspend, auditLogin, auditSuspend, auditLogin)
+	if !slices.Equal(actions, want) {
+		t.Fatalf("audit events for carol = %v, want %v", actions, want)
+	}
+	var requestDetails map[string]any
+	json.Unmarshal(audit.Events[1].Details, &requestDetails)
+	if audit.Events[1].ActorID == nil || *audit.Events[1].ActorID != bob.ID || requestDetails["path"] != "/api/users/me/export/download" {
+		t.Errorf("latest impersonated request = %+v, want bob downloading the export", audit.Events[1])
+	}
+	c.do("GET", "/admin/audit-events?action=chirp.delete", bearer(bob.Token), nil, &audit)
+	var deleteDetails map[string]any
+	if len(audit.Events) == 1 {
+		json.Unmarshal(audit.Events[0].Details, &deleteDetails)
+	}
+	if deleteDetails["impersonator_id"] != bob.ID.String() {
+		t.Errorf("chirp.delete details = %v, want bob as the impersonator", deleteDetails)
+	}
+}
+
+func TestResetWithFixture(t *testing.T) {
+	dir := t.TempDir()
+	fixtures := map[string]string{
+		"unknown_author.json": `{"users": [{"email": "a@example.com", "password": "password123"}], "chirps": [{"author": "b@example.com", "body": "hi"}]}`,
+		"unknown_field.yaml":  "users:\n  - email: a@example.com\n    password: password123\n    role: admin\n",
+		"duplicate.yml":       "users:\n  - {email: a@example.com, password: password123}\n  - {email: a@example.com, password: password123}\n",
+	}
+	for name, data := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write fixture: %v", err)
+		}
+	}
+	demo, err := os.ReadFile(filepath.Join(defaultSeedDir, "demo.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read the demo fixture: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "demo.yaml"), demo, 0o644)
+
+	c := newTestClient(t, func(c *apiConfig) { c.seedDir = dir })
+	existing := c.signup("existing@example.com", "existingPassword")
+
+	for _, tt := range []struct {
+		fixture  string
+		wantCode int
+	}{
+		{fixture: "missing", wantCode: http.StatusNotFound},
+		{fixture: "..%2Fdemo", wantCode: http.StatusBadRequest},
+		{fixture: "unknown_author", wantCode: http.StatusBadRequest},
+		{fixture: "unknown_field", wantCode: http.StatusBadRequest},
+		{fixture: "duplicate", wantCode: http.StatusBadRequest},
+	} {
+		if code := c.do("POST", "/admin/reset?fixture="+tt.fixture, "", nil, nil); code != tt.wantCode {
+			t.Errorf("POST /admin/reset?fixture=%s returned %d, want %d", tt.fixture, code, tt.wantCode)
+		}
+	}
+	// a fixture that can't be loaded doesn't reset anything
+	if code := c.do("POST", "/api/login", "", map[string]string{"email": existing.Email, "password": "existingPassword"}, nil); code != http.StatusOK {
+		t.Fatalf("POST /api/login after failed resets returned %d, want %d", code, http.StatusOK)
+	}
+
+	if code := c.do("POST", "/admin/reset?fixture=demo", "", nil, nil); code != http.StatusOK {
+		t.Fatalf("POST /admin/reset?fixture=demo returned %d, want %d", code, http.StatusOK)
+	}
+	if code := c.do("POST", "/api/login", "", map[string]string{"email": existing.Email, "password": "existingPassword"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("POST /api/login for a user from before the reset returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	var alice, admin testUser
+	c.do("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "password123"}, &alice)
+	c.do("POST", "/api/login", "", map[string]string{"email": "admin@example.com", "password": "password123"}, &admin)
+	if !alice.IsChirpyRed || alice.Handle == nil || *alice.Handle != "alice" {
+		t.Errorf("alice from the fixture = %+v, want Chirpy Red with handle alice", alice.User)
+	}
+	if code := c.do("GET", "/admin/users", bearer(admin.Token), nil, nil); code != http.StatusOK {
+		t.Errorf("GET /admin/users by the fixture's admin returned %d, want %d", code, http.StatusOK)
+	}
+	if got := c.chirpIDs(testUser{}, "/api/chirps"); len(got) != 3 {
+		t.Errorf("GET /api/chirps after loading the fixture returned %d chirps, want the 3 public ones", len(got))
+	}
+	if got := c.chirpIDs(alice, "/api/hashtags/introductions/chirps"); len(got) != 2 {
+		t.Errorf("GET /api/hashtags/introductions/chirps returned %d chirps, want 2", len(got))
+	}
+	if got := c.chirpIDs(alice, "/api/timeline"); len(got) != 3 {
+		t.Errorf("alice's timeline has %d chirps, want her 2 and bob's 1", len(got))
+	}
+}
+
+// TestTruncateAllTablesCoversSchema checks a reset empties every table the
+// migrations create, so a new table can't survive a reset unnoticed.
+func TestTruncateAllTablesCoversSchema(t *testing.T) {
+	createTable := regexp.MustCompile(`(?i)CREATE TABLE\s+([a-z_]+)`)
+	migrations, err := fs.Glob(schemaFS, "sql/schema/*.sql")
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+	var tables []string
+	for _, name := range migrations {
+		data, err := fs.ReadFile(schemaFS, name)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		up, _, _ := strings.Cut(string(data), "-- +goose Down")
+		for _, m := range createTable.FindAllStringSubmatch(up, -1) {
+			tables = append(tables, m[1])
+		}
+	}
+
+	query, err := os.ReadFile("sql/queries/reset.sql")
+	if err != nil {
+		t.Fatalf("Failed to read reset.sql: %v", err)
+	}
+	_, truncated, _ := strings.Cut(string(query), "TRUNCATE")
+	for _, table := range tables {
+		if !regexp.MustCompile(`\b` + table + `\b`).MatchString(truncated) {
+			t.Errorf("TruncateAllTables doesn't truncate %s", table)
+		}
+	}
+}
+
+func TestGenerateSeedFixture(t *testing.T) {
+	opts := seedOptions{Users: 50, ChirpsPerUser: 3, FollowsPerUser: 10, Password: "password123", ChirpyRedChance: 0.1}
+	f := generateSeedFixture(rand.New(rand.NewPCG(1, 1)), opts)
+	if err := f.validate(); err != nil {
+		t.Fatalf("generated fixture is invalid: %v", err)
+	}
+	if len(f.Users) != 50 || len(f.Chirps) != 150 || len(f.Follows) != 500 {
+		t.Errorf("generated %d users, %d chirps and %d follows, want 50, 150 and 500", len(f.Users), len(f.Chirps), len(f.Follows))
+	}
+	again := generateSeedFixture(rand.New(rand.NewPCG(1, 1)), opts)
+	if !reflect.DeepEqual(f, again) {
+		t.Error("generating with the same seed made different data")
+	}
+
+	// more follows than there are other users to follow
+	small := generateSeedFixture(rand.New(rand.NewPCG(2, 2)), seedOptions{Users: 3, FollowsPerUser: 10, Password: "password123"})
+	if len(small.Follows) != 6 {
+		t.Errorf("3 users made %d follows, want 6", len(small.Follows))
+	}
+
+	s := store.NewMemory()
+	err := s.WithTx(context.Background(), func(tx store.Store) error {
+		return applySeedFixture(context.Background(), tx, f)
+	})
+	if err != nil {
+		t.Fatalf("applySeedFixture() unexpected error: %v", err)
+	}
+	user, err := s.GetUserByEmail(context.Background(), f.Users[0].Email)
+	if err != nil || auth.CheckPasswordHash("password123", user.HashedPassword) != nil {
+		t.Errorf("generated user %s can't log in: %v", f.Users[0].Email, err)
+	}
+}
+
+func TestDataExport(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signup("alice@example.com", "alicePassword")
+	bob := c.signup("bob@example.com", "bobPassword")
+
+	chirp := c.createChirp(bob, "like me")
+	c.createChirp(alice, "my chirp")
+	c.do("POST", "/api/chirps/"+chirp.ID.String()+"/like", bearer(alice.Token), nil, nil)
+	var png bytes.Buffer
+	if err := imgpng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	uploaded, _ := c.uploadMedia(alice, png.Bytes())
+
+	if code := c.do("GET", "/api/users/me/export", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("GET /api/users/me/export without a token returned %d, want %d", code, http.StatusUnauthorized)
+	}
+	var queued, again DataExport
+	code := c.do("GET", "/api/users/me/export", bearer(alice.Token), nil, &queued)
+	if code != http.StatusAccepted || queued.Status != "pending" || queued.DownloadURL != nil {
+		t.Fatalf("GET /api/users/me/export returned %d and %+v, want %d and a pending export", code, queued, http.StatusAccepted)
+	}
+	c.do("GET", "/api/users/me/export", bearer(alice.Token), nil, &again)
+	if again.ID != queued.ID {
+		t.Errorf("asking again queued export %s, want the pending %s", again.ID, queued.ID)
+	}
+	if code := c.do("GET", exportDownloadPath, bearer(alice.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET %s before it is ready returned %d, want %d", exportDownloadPath, code, http.StatusNotFound)
+	}
+
+	ctx := context.Background()
+	if err := cfg.processDataExports(ctx); err != nil {
+		t.Fatalf("processDataExports() unexpected error: %v", err)
+	}
+	var ready DataExport
+	code = c.do("GET", "/api/users/me/export", bearer(alice.Token), nil, &ready)
+	if code != http.StatusOK || ready.Status != "ready" || ready.DownloadURL == nil || ready.SizeBytes == nil {
+		t.Fatalf("GET /api/users/me/export returned %d and %+v, want %d and a ready export", code, ready, http.StatusOK)
+	}
+	if code := c.do("GET", exportDownloadPath, bearer(bob.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET %s as someone else returned %d, want %d", exportDownloadPath, code, http.StatusNotFound)
+	}
+
+	req, _ := http.NewRequest("GET", c.srv.URL+*ready.DownloadURL, nil)
+	req.Header.Set("Authorization", bearer(alice.Token))
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", *ready.DownloadURL, err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("GET %s returned %d with %q, want %d with a zip", *ready.DownloadURL, resp.StatusCode, resp.Header.Get("Content-Type"), http.StatusOK)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("export isn't a valid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	wantContents := map[string]string{
+		"profile.json":                           "alice@example.com",
+		"chirps.json":                            "my chirp",
+		"likes.json":                             chirp.ID.String(),
+		"sessions.json":                          "expires_at",
+		"follows.json":                           "followers",
+		"media.json":                             uploaded.ID.String(),
+		"media/" + uploaded.ID.String() + ".png": "PNG",
+	}
+	for name, want := range wantContents {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s in the export = %q, want it to contain %q", name, files[name], want)
+		}
+	}
+	for name, content := range files {
+		if strings.Contains(content, alice.RefreshToken) || strings.Contains(content, "like me") {
+			t.Errorf("%s in the export contains a token or someone else's chirp", name)
+		}
+	}
+
+	if err := cfg.purgeExpiredExports(ctx, time.Now().Add(exportLifetime+time.Minute)); err != nil {
+		t.Fatalf("purgeExpiredExports() unexpected error: %v", err)
+	}
+	if code := c.do("GET", exportDownloadPath, bearer(alice.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("GET %s after it expired returned %d, want %d", exportDownloadPath, code, http.StatusNotFound)
+	}
+	var requeued DataExport
+	code = c.do("GET", "/api/users/me/export", bearer(alice.Token), nil, &requeued)
+	if code != http.StatusAccepted || requeued.ID == ready.ID {
+		t.Errorf("GET /api/users/me/export after expiry returned %d and %s, want %d and a new export", code, requeued.ID, http.StatusAccepted)
+	}
+}
+
+// chirpIDs returns the IDs of the chirps listed at path as viewed by user,
+// or anonymously if user has no token.
+func (c *testClient) chirpIDs(user testUser, path string) []uuid.UUID {
+	c.t.Helper()
+
+	authorization := ""
+	if user.Token != "" {
+		authorization = bearer(user.Token)
+	}
+	var list []Chirp
+	var page chirpPage
+	var code int
+	if strings.HasPrefix(path, "/api/chirps?") || path == "/api/chirps" || strings.HasSuffix(path, "/thread") {
+		code = c.do("GET", path, authorization, nil, &list)
+	} else {
+		code = c.do("GET", path, authorization, nil, &page)
+		list = page.Chirps
+	}
+	if code != http.StatusOK {
+		c.t.Fatalf("GET %s returned %d, want %d", path, code, http.StatusOK)
+	}
+	ids := []uuid.UUID{}
+	for _, chirp := range list {
+		ids = append(ids, chirp.ID)
+	}
+	return ids
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signupWithHandle("bob@example.com", "bobPassword", "bob")
+	carol := c.signupWithHandle("carol@example.com", "carolPassword", "carol")
+	anonymous := testUser{}
+
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(carol.Token), nil, nil)
+	aliceChirp := c.createChirp(alice, "hello from alice")
+	c.do("POST", "/api/chirps/"+aliceChirp.ID.String()+"/like", bearer(bob.Token), nil, nil)
+
+	if code := c.do("POST", "/api/users/"+alice.ID.String()+"/block", bearer(alice.Token), nil, nil); code != http.StatusBadRequest {
+		t.Errorf("blocking yourself returned %d, want %d", code, http.StatusBadRequest)
+	}
+	for range 2 {
+		if code := c.do("POST", "/api/users/"+bob.ID.String()+"/block", bearer(alice.Token), nil, nil); code != http.StatusNoContent {
+			t.Fatalf("POST /api/users/{bob}/block returned %d, want %d", code, http.StatusNoContent)
+		}
+	}
+
+	chirpPath := "/api/chirps/" + aliceChirp.ID.String()
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		wantCode int
+	}{
+		{"get chirp", "GET", chirpPath, nil, http.StatusNotFound},
+		{"get thread", "GET", chirpPath + "/thread", nil, http.StatusNotFound},
+		{"like", "POST", chirpPath + "/like", nil, http.StatusNotFound},
+		{"reply", "POST", "/api/chirps", map[string]string{"body": "hi", "reply_to_id": aliceChirp.ID.String()}, http.StatusNotFound},
+		{"follow", "POST", "/api/users/" + alice.ID.String() + "/follow", nil, http.StatusForbidden},
+		{"mention", "POST", "/api/chirps", map[string]string{"body": "hey @alice"}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run("blocked "+tt.name, func(t *testing.T) {
+			if code := c.do(tt.method, tt.path, bearer(bob.Token), tt.body, nil); code != tt.wantCode {
+				t.Errorf("%s %s as a blocked user returned %d, want %d", tt.method, tt.path, code, tt.wantCode)
+			}
+		})
+	}
+
+	if ids := c.chirpIDs(bob, "/api/chirps"); slices.Contains(ids, aliceChirp.ID) {
+		t.Error("GET /api/chirps as bob lists alice's chirp")
+	}
+	if ids := c.chirpIDs(bob, "/api/timeline"); len(ids) != 1 {
+		t.Errorf("bob's timeline = %v, want only his mention, the follow having been removed", ids)
+	}
+	if ids := c.chirpIDs(anonymous, "/api/chirps?author_id="+alice.ID.String()); len(ids) != 1 {
+		t.Errorf("alice's chirps anonymously = %v, want her chirp", ids)
+	}
+	if ids := c.chirpIDs(anonymous, "/api/users/"+alice.ID.String()+"/mentions"); len(ids) != 0 {
+		t.Errorf("alice's mentions = %v, want none from the blocked bob", ids)
+	}
+	var notifications notificationsPage
+	c.do("GET", "/api/notifications", bearer(alice.Token), nil, &notifications)
+	// only carol's follow is left
+	if len(notifications.Notifications) != 1 || notifications.Notifications[0].ActorID != carol.ID || notifications.UnreadCount != 1 {
+		t.Errorf("alice's notifications = %+v, want bob's follow and like hidden", notifications)
+	}
+	var blocks struct {
+		Users []Author `json:"users"`
+	}
+	c.do("GET", "/api/users/me/blocks", bearer(alice.Token), nil, &blocks)
+	if len(blocks.Users) != 1 || blocks.Users[0].ID != bob.ID {
+		t.Errorf("alice's blocks = %+v, want bob", blocks.Users)
+	}
+
+	c.do("DELETE", "/api/users/"+bob.ID.String()+"/block", bearer(alice.Token), nil, nil)
+	if code := c.do("GET", chirpPath, bearer(bob.Token), nil, nil); code != http.StatusOK {
+		t.Errorf("GET chirp after unblocking returned %d, want %d", code, http.StatusOK)
+	}
+
+	// carol mutes alice, and a keyword
+	spoiler := c.createChirp(bob, "SPOILER: it was a sled")
+	carolChirp := c.createChirp(carol, "carol's chirp")
+	c.do("POST", "/api/users/"+alice.ID.String()+"/mute", bearer(carol.Token), nil, nil)
+	if code := c.do("POST", "/api/users/me/mutes/keywords", bearer(carol.Token), map[string]string{"keyword": " Spoiler "}, nil); code != http.StatusNoContent {
+		t.Fatalf("POST /api/users/me/mutes/keywords returned %d, want %d", code, http.StatusNoContent)
+	}
+	if code := c.do("POST", "/api/users/me/mutes/keywords", bearer(carol.Token), map[string]string{"keyword": "  "}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("muting a blank keyword returned %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+	c.do("POST", "/api/chirps/"+carolChirp.ID.String()+"/like", bearer(alice.Token), nil, nil)
+
+	if ids := c.chirpIDs(carol, "/api/chirps"); slices.Contains(ids, aliceChirp.ID) || slices.Contains(ids, spoiler.ID) || !slices.Contains(ids, carolChirp.ID) {
+		t.Errorf("GET /api/chirps as carol = %v, want no muted chirps but her own", ids)
+	}
+	if ids := c.chirpIDs(carol, "/api/timeline"); !reflect.DeepEqual(ids, []uuid.UUID{carolChirp.ID}) {
+		t.Errorf("carol's timeline = %v, want only her chirp", ids)
+	}
+	if ids := c.chirpIDs(carol, "/api/chirps?author_id="+alice.ID.String()); len(ids) != 1 {
+		t.Errorf("alice's chirps as carol = %v, want her chirp despite the mute", ids)
+	}
+	if code := c.do("GET", chirpPath, bearer(carol.Token), nil, nil); code != http.StatusOK {
+		t.Errorf("GET a muted user's chirp returned %d, want %d", code, http.StatusOK)
+	}
+	if ids := c.chirpIDs(alice, "/api/chirps"); !slices.Contains(ids, carolChirp.ID) {
+		t.Error("muting changed what the muted user sees")
+	}
+	c.do("GET", "/api/notifications", bearer(carol.Token), nil, &notifications)
+	if len(notifications.Notifications) != 0 {
+		t.Errorf("carol's notifications = %+v, want the muted user's like hidden", notifications.Notifications)
+	}
+
+	var mutes struct {
+		Users    []Author       `json:"users"`
+		Keywords []MutedKeyword `json:"keywords"`
+	}
+	c.do("GET", "/api/users/me/mutes", bearer(carol.Token), nil, &mutes)
+	if len(mutes.Users) != 1 || mutes.Users[0].ID != alice.ID || len(mutes.Keywords) != 1 || mutes.Keywords[0].Keyword != "spoiler" {
+		t.Errorf("carol's mutes = %+v, want alice and spoiler", mutes)
+	}
+
+	c.do("DELETE", "/api/users/me/mutes/keywords/SPOILER", bearer(carol.Token), nil, nil)
+	c.do("DELETE", "/api/users/"+alice.ID.String()+"/mute", bearer(carol.Token), nil, nil)
+	if ids := c.chirpIDs(carol, "/api/chirps"); !slices.Contains(ids, aliceChirp.ID) || !slices.Contains(ids, spoiler.ID) {
+		t.Errorf("GET /api/chirps as carol after unmuting = %v, want every chirp", ids)
+	}
+}
+
+func TestChirpVisibility(t *testing.T) {
+	c := newTestClient(t)
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signupWithHandle("bob@example.com", "bobPassword", "bob")
+	carol := c.signupWithHandle("carol@example.com", "carolPassword", "carol")
+	anonymous := testUser{}
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+
+	create := func(body, visibility string) Chirp {
+		t.Helper()
+		var chirp Chirp
+		code := c.do("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": body, "visibility": visibility}, &chirp)
+		if code != http.StatusCreated {
+			t.Fatalf("POST /api/chirps with visibility %q returned %d, want %d", visibility, code, http.StatusCreated)
+		}
+		return chirp
+	}
+	public := create("#news for everyone", "")
+	followers := create("#news for followers, hi @carol", "followers")
+	unlisted := create("#news for those with the link", "unlisted")
+	if public.Visibility != "public" || followers.Visibility != "followers" {
+		t.Errorf("visibilities = %q, %q, want public and followers", public.Visibility, followers.Visibility)
+	}
+	if code := c.do("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": "hi", "visibility": "private"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("POST /api/chirps with an unknown visibility returned %d, want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	tests := []struct {
+		name     string
+		user     testUser
+		chirp    Chirp
+		wantCode int
+	}{
+		{"author sees followers-only", alice, followers, http.StatusOK},
+		{"follower sees followers-only", bob, followers, http.StatusOK},
+		{"other user can't see followers-only", carol, followers, http.StatusNotFound},
+		{"anonymous can't see followers-only", anonymous, followers, http.StatusNotFound},
+		{"anonymous sees unlisted", anonymous, unlisted, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization := ""
+			if tt.user.Token != "" {
+				authorization = bearer(tt.user.Token)
+			}
+			for _, path := range []string{"/api/chirps/" + tt.chirp.ID.String(), "/api/chirps/" + tt.chirp.ID.String() + "/thread"} {
+				if code := c.do("GET", path, authorization, nil, nil); code != tt.wantCode {
+					t.Errorf("GET %s returned %d, want %d", path, code, tt.wantCode)
+				}
+			}
+		})
+	}
+
+	followersPath := "/api/chirps/" + followers.ID.String()
+	if code := c.do("POST", followersPath+"/like", bearer(carol.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("liking a chirp you can't see returned %d, want %d", code, http.StatusNotFound)
+	}
+	if code := c.do("DELETE", followersPath, bearer(carol.Token), nil, nil); code != http.StatusNotFound {
+		t.Errorf("deleting a chirp you can't see returned %d, want %d", code, http.StatusNotFound)
+	}
+	if code := c.do("DELETE", "/api/chirps/"+public.ID.String(), bearer(carol.Token), nil, nil); code != http.StatusForbidden {
+		t.Errorf("deleting someone else's chirp you can see returned %d, want %d", code, http.StatusForbidden)
+	}
+	reply := map[string]string{"body": "hi", "reply_to_id": followers.ID.String()}
+	if code := c.do("POST", "/api/chirps", bearer(carol.Token), reply, nil); code != http.StatusNotFound {
+		t.Errorf("replying to a chirp you can't see returned %d, want %d", code, http.StatusNotFound)
+	}
+	if code := c.do("POST", "/api/chirps", bearer(bob.Token), reply, nil); code != http.StatusCreated {
+		t.Errorf("replying to a followers-only chirp as a follower returned %d, want %d", code, http.StatusCreated)
+	}
+
+	if ids := c.chirpIDs(bob, "/api/chirps"); !slices.Contains(ids, public.ID) || slices.Contains(ids, followers.ID) || slices.Contains(ids, unlisted.ID) {
+		t.Errorf("GET /api/chirps = %v, want only public chirps", ids)
+	}
+	if ids := c.chirpIDs(bob, "/api/hashtags/news/chirps"); !reflect.DeepEqual(ids, []uuid.UUID{public.ID}) {
+		t.Errorf("#news = %v, want only the public chirp", ids)
+	}
+	if ids := c.chirpIDs(bob, "/api/timeline"); !slices.Contains(ids, followers.ID) || !slices.Contains(ids, unlisted.ID) {
+		t.Errorf("bob's timeline = %v, want alice's followers-only and unlisted chirps", ids)
+	}
+	if ids := c.chirpIDs(carol, "/api/chirps?author_id="+alice.ID.String()); len(ids) != 2 || slices.Contains(ids, followers.ID) {
+		t.Errorf("alice's chirps as carol = %v, want the public and unlisted ones", ids)
+	}
+	if ids := c.chirpIDs(carol, "/api/users/"+carol.ID.String()+"/mentions"); len(ids) != 0 {
+		t.Errorf("carol's mentions = %v, want the followers-only mention hidden", ids)
+	}
+	var notifications notificationsPage
+	c.do("GET", "/api/notifications", bearer(carol.Token), nil, &notifications)
+	if len(notifications.Notifications) != 0 {
+		t.Errorf("carol's notifications = %+v, want none for a chirp she can't see", notifications.Notifications)
+	}
+
+	// following makes followers-only chirps visible
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(carol.Token), nil, nil)
+	if code := c.do("GET", followersPath, bearer(carol.Token), nil, nil); code != http.StatusOK {
+		t.Errorf("GET a followers-only chirp after following returned %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestScheduledChirps(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) { cfg = c })
+	alice := c.signupWithHandle("alice@example.com", "alicePassword", "alice")
+	bob := c.signupWithHandle("bob@example.com", "bobPassword", "bob")
+	c.do("POST", "/api/users/"+alice.ID.String()+"/follow", bearer(bob.Token), nil, nil)
+
+	soon := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		body     map[string]any
+		wantCode int
+	}{
+		{"in the past", map[string]any{"body": "late", "publish_at": time.Now().Add(-time.Minute)}, http.StatusUnprocessableEntity},
+		{"draft with a time", map[string]any{"body": "both", "publish_at": soon, "draft": true}, http.StatusUnprocessableEntity},
+		{"too long", map[string]any{"body": strings.Repeat("a", maxChirpLength+1), "draft": true}, http.StatusBadRequest},
+		{"reply to a missing chirp", map[string]any{"body": "hi", "reply_to_id": uuid.NewString(), "draft": true}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := c.do("POST", "/api/chirps", bearer(alice.Token), tt.body, nil); code != tt.wantCode {
+				t.Errorf("POST /api/chirps returned %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+
+	var scheduled, draft ScheduledChirp
+	if code := c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "see you soon @bob", "publish_at": soon}, &scheduled); code != http.StatusAccepted {
+		t.Fatalf("POST /api/chirps with publish_at returned %d, want %d", code, http.StatusAccepted)
+	}
+	if code := c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "half an idea", "draft": true}, &draft); code != http.StatusAccepted {
+		t.Fatalf("POST /api/chirps with draft returned %d, want %d", code, http.StatusAccepted)
+	}
+	if draft.PublishAt != nil || scheduled.PublishAt == nil || scheduled.PublishAt.Sub(soon).Abs() > time.Millisecond {
+		t.Errorf("publish_at = %v and %v, want %v and null", scheduled.PublishAt, draft.PublishAt, soon)
+	}
+
+	if ids := c.chirpIDs(bob, "/api/chirps?author_id="+alice.ID.String()); len(ids) != 0 {
+		t.Errorf("alice's chirps = %v, want none published yet", ids)
+	}
+	var list []ScheduledChirp
+	c.do("GET", "/api/users/me/scheduled-chirps", bearer(alice.Token), nil, &list)
+	if len(list) != 2 || list[0].ID != scheduled.ID || list[1].ID != draft.ID {
+		t.Errorf("alice's scheduled chirps = %+v, want the scheduled one then the draft", list)
+	}
+	c.do("GET", "/api/users/me/scheduled-chirps", bearer(bob.Token), nil, &list)
+	if len(list) != 0 {
+		t.Errorf("bob's scheduled chirps = %+v, want none", list)
+	}
+
+	draftPath := "/api/users/me/scheduled-chirps/" + draft.ID.String()
+	if code := c.do("PATCH", draftPath, bearer(bob.Token), map[string]any{"body": "mine now"}, nil); code != http.StatusNotFound {
+		t.Errorf("PATCH someone else's draft returned %d, want %d", code, http.StatusNotFound)
+	}
+	if code := c.do("PATCH", draftPath, bearer(alice.Token), map[string]any{"body": "a whole idea", "visibility": "followers", "publish_at": soon.Add(time.Minute)}, &draft); code != http.StatusOK {
+		t.Fatalf("PATCH %s returned %d, want %d", draftPath, code, http.StatusOK)
+	}
+	if draft.Body != "a whole idea" || draft.Visibility != "followers" || draft.PublishAt == nil {
+		t.Errorf("updated draft = %+v, want the new body and visibility, scheduled", draft)
+	}
+
+	// publishing twice, as two replicas would, publishes each chirp once
+	for range 2 {
+		if err := cfg.publishDueChirps(context.Background(), soon.Add(time.Hour)); err != nil {
+			t.Fatalf("publishDueChirps() unexpected error: %v", err)
+		}
+	}
+	var published []Chirp
+	c.do("GET", "/api/chirps?author_id="+alice.ID.String()+"&sort=asc", bearer(bob.Token), nil, &published)
+	if len(published) != 2 || published[0].Body != "see you soon @bob" || published[1].Visibility != "followers" {
+		t.Errorf("alice's chirps after publishing = %+v, want both scheduled chirps", published)
+	}
+	var notifications notificationsPage
+	c.do("GET", "/api/notifications", bearer(bob.Token), nil, &notifications)
+	if len(notifications.Notifications) != 1 || notifications.Notifications[0].Type != notificationMention {
+		t.Errorf("bob's notifications = %+v, want the mention", notifications.Notifications)
+	}
+	c.do("GET", "/api/users/me/scheduled-chirps", bearer(alice.Token), nil, &list)
+	if len(list) != 0 {
+		t.Errorf("alice's scheduled chirps after publishing = %+v, want none", list)
+	}
+	if code := c.do("PATCH", draftPath, bearer(alice.Token), map[string]any{"body": "too late"}, nil); code != http.StatusNotFound {
+		t.Errorf("PATCH a published chirp returned %d, want %d", code, http.StatusNotFound)
+	}
+
+	var cancelled ScheduledChirp
+	c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "never mind", "publish_at": soon}, &cancelled)
+	for _, wantCode := range []int{http.StatusNoContent, http.StatusNotFound} {
+		if code := c.do("DELETE", "/api/users/me/scheduled-chirps/"+cancelled.ID.String(), bearer(alice.Token), nil, nil); code != wantCode {
+			t.Errorf("DELETE scheduled chirp returned %d, want %d", code, wantCode)
+		}
+	}
+}
+
+// failingChirpStore fails to create chirps with failBody, inside
+// transactions too.
+type failingChirpStore struct {
+	store.Store
+	failBody string
+}
+
+func (s failingChirpStore) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	if arg.Body == s.failBody {
+		// looks like nothing being due, if it isn't told apart
+		return database.Chirp{}, fmt.Errorf("injected failure: %w", sql.ErrNoRows)
+	}
+	return s.Store.CreateChirp(ctx, arg)
+}
+
+func (s failingChirpStore) WithTx(ctx context.Context, fn func(store.Store) error) error {
+	return s.Store.WithTx(ctx, func(tx store.Store) error {
+		return fn(failingChirpStore{Store: tx, failBody: s.failBody})
+	})
+}
+
+func TestScheduledChirpFailures(t *testing.T) {
+	var cfg *apiConfig
+	c := newTestClient(t, func(c *apiConfig) {
+		cfg = c
+		c.store = failingChirpStore{Store: c.store, failBody: "doomed"}
+	})
+	alice := c.signup("alice@example.com", "alicePassword")
+
+	soon := time.Now().Add(time.Hour)
+	var doomed, fine ScheduledChirp
+	c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "doomed", "publish_at": soon}, &doomed)
+	c.do("POST", "/api/chirps", bearer(alice.Token), map[string]any{"body": "fine", "publish_at": soon.Add(time.Minute)}, &fine)
+
+	// the chirp due first failing doesn't hold up the next
+	if err := cfg.publishDueChirps(context.Background(), soon.Add(time.Hour)); err == nil {
+		t.Errorf("publishDueChirps() with a failing chirp returned no error")
+	}
+	var list []ScheduledChirp
+	c.do("GET", "/api/users/me/scheduled-chirps", bearer(alice.Token), nil, &list)
+	if len(list) != 1 || list[0].ID != doomed.ID || list[0].Failed {
+		t.Errorf("scheduled chirps after one failure = %+v, want only the failing one, not given up on", list)
+	}
+
+	for range maxPublishAttempts - 1 {
+		if err := cfg.publishDueChirps(context.Background(), soon.Add(time.Hour)); err == nil {
+			t.Errorf("publishDueChirps() with a failing chirp returned no error")
+		}
+	}
+	if err := cfg.publishDueChirps(context.Background(), soon.Add(time.Hour)); err != nil {
+		t.Errorf("publishDueChirps() after giving up on the failing chirp returned %v, want nil", err)
+	}
+	c.do("GET", "/api/users/me/scheduled-chirps", bearer(alice.Token), nil, &list)
+	if len(list) != 1 || !list[0].Failed {
+		t.Errorf("scheduled chirps after %d failures = %+v, want the failing one marked failed", maxPublishAttempts, list)
+	}
+
+	// editing it tries again
+	path := "/api/users/me/scheduled-chirps/" + doomed.ID.String()
+	if code := c.do("PATCH", path, bearer(alice.Token), map[string]any{"body": "saved"}, &doomed); code != http.StatusOK || doomed.Failed {
+		t.Errorf("PATCH %s = %d with failed %t, want %d and not failed", path, code, doomed.Failed, http.StatusOK)
+	}
+	if err := cfg.publishDueChirps(context.Background(), soon.Add(time.Hour)); err != nil {
+		t.Errorf("publishDueChirps() after editing returned %v, want nil", err)
+	}
+	var published []Chirp
+	c.do("GET", "/api/chirps?author_id="+alice.ID.String()+"&sort=asc", "", nil, &published)
+	if len(published) != 2 || published[0].Body != "fine" || published[1].Body != "saved" {
+		t.Errorf("alice's chirps = %+v, want fine then saved", published)
+	}
+}
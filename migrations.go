@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+//go:embed sql/schema/*.sql
+var schemaFS embed.FS
+
+const schemaDir = "sql/schema"
+
+// latestSchemaVersion returns the highest goose version among the embedded
+// migrations, i.e. the schema version this binary expects.
+func latestSchemaVersion() (int64, error) {
+	entries, err := fs.ReadDir(schemaFS, schemaDir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if path.Ext(name) != ".sql" {
+			continue
+		}
+		prefix, _, found := strings.Cut(name, "_")
+		if !found {
+			return 0, fmt.Errorf("migration %s has no version prefix", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has invalid version: %w", name, err)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// newMigrator returns a goose provider over the embedded migrations. Every
+// run that changes the schema holds a Postgres advisory lock, so replicas
+// starting at the same time apply migrations one after another instead of
+// racing each other.
+func newMigrator(db *sql.DB) (*goose.Provider, error) {
+	migrations, err := fs.Sub(schemaFS, schemaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	locker, err := lock.NewPostgresSessionLocker()
+	if err != nil {
+		return nil, err
+	}
+
+	return goose.NewProvider(goose.DialectPostgres, db, migrations,
+		goose.WithSessionLocker(locker),
+	)
+}
+
+// runMigrateCommand implements `chirpy migrate up|down|status|redo`.
+func runMigrateCommand(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chirpy migrate up|down|status|redo")
+	}
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return fmt.Errorf("couldn't load migrations: %w", err)
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := migrator.Up(ctx)
+		logMigrationResults(results...)
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			log.Println("No pending migrations")
+		}
+	case "down":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		logMigrationResults(result)
+	case "redo":
+		result, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		logMigrationResults(result)
+		result, err = migrator.UpByOne(ctx)
+		if err != nil {
+			return err
+		}
+		logMigrationResults(result)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.State == goose.StateApplied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", appliedAt, path.Base(s.Source.Path))
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or redo", args[0])
+	}
+	return nil
+}
+
+// autoMigrate applies all pending migrations before the server starts.
+func autoMigrate(ctx context.Context, db *sql.DB) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return fmt.Errorf("couldn't load migrations: %w", err)
+	}
+
+	results, err := migrator.Up(ctx)
+	logMigrationResults(results...)
+	return err
+}
+
+func logMigrationResults(results ...*goose.MigrationResult) {
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if r.Error != nil {
+			log.Printf("Migration %s %s failed: %s", r.Direction, path.Base(r.Source.Path), r.Error)
+			continue
+		}
+		log.Printf("Migration %s %s applied in %s", r.Direction, path.Base(r.Source.Path), r.Duration)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// page is a request for one page of a newest-first list. Before is the ID
+// of the last item of the previous page, which clients get as next_cursor.
+type page struct {
+	Limit  int32
+	Before uuid.NullUUID
+}
+
+// parsePage reads the limit and before query parameters. If either is
+// invalid it responds with 400 and returns false.
+func parsePage(w http.ResponseWriter, r *http.Request) (page, bool) {
+	p := page{Limit: defaultPageSize}
+
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), err)
+			return page{}, false
+		}
+		p.Limit = int32(limit)
+	}
+
+	if s := r.URL.Query().Get("before"); s != "" {
+		before, err := uuid.Parse(s)
+		if err != nil {
+			respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Couldn't parse before", err)
+			return page{}, false
+		}
+		p.Before = uuid.NullUUID{UUID: before, Valid: true}
+	}
+	return p, true
+}
+
+// chirpPage is one page of a newest-first list of chirps.
+type chirpPage struct {
+	Chirps     []Chirp    `json:"chirps"`
+	NextCursor *uuid.UUID `json:"next_cursor"`
+}
+
+// newChirpPage leaves out the chirps f says the viewer doesn't want. The
+// cursor still comes from the unfiltered page, so a page can be short, or
+// even empty, without being the last.
+func (cfg *apiConfig) newChirpPage(ctx context.Context, p page, dbChirps []database.Chirp, f chirpFilter, exp expansion) (chirpPage, error) {
+	chirps, err := cfg.chirpsFromDB(ctx, f.wanted(dbChirps), exp)
+	if err != nil {
+		return chirpPage{}, err
+	}
+
+	resp := chirpPage{Chirps: chirps}
+	if len(dbChirps) > 0 {
+		resp.NextCursor = p.nextCursor(len(dbChirps), dbChirps[len(dbChirps)-1].ID)
+	}
+	return resp, nil
+}
+
+// nextCursor is the cursor for the page after one with n items whose last
+// item has ID last, or nil if it was the last page.
+func (p page) nextCursor(n int, last uuid.UUID) *uuid.UUID {
+	if n < int(p.Limit) {
+		return nil
+	}
+	return &last
+}
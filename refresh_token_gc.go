@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+const (
+	// refreshTokenRetention is how long tokens are kept after they expire
+	// or are revoked, so recent sessions can still be looked into.
+	refreshTokenRetention = 7 * 24 * time.Hour
+	// maxTokenPurgeBatch is how many tokens are deleted per query, so one
+	// run doesn't lock a huge number of rows at once.
+	maxTokenPurgeBatch = 1000
+)
+
+// purgeStaleRefreshTokens deletes the tokens that expired or were revoked
+// more than refreshTokenRetention before now, and returns how many it
+// deleted.
+func purgeStaleRefreshTokens(ctx context.Context, s store.TokenStore, now time.Time) (int64, error) {
+	var total int64
+	for {
+		deleted, err := s.DeleteStaleRefreshTokens(ctx, database.DeleteStaleRefreshTokensParams{
+			StaleBefore: now.Add(-refreshTokenRetention),
+			MaxResults:  maxTokenPurgeBatch,
+		})
+		total += deleted
+		if err != nil || deleted < maxTokenPurgeBatch {
+			return total, err
+		}
+	}
+}
+
+// purgeRefreshTokens runs purgeStaleRefreshTokens and adds what it deleted
+// to the metrics.
+func (cfg *apiConfig) purgeRefreshTokens(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := purgeStaleRefreshTokens(ctx, cfg.store, now)
+	cfg.refreshTokensPurged.Add(deleted)
+	return deleted, err
+}
+
+// handlerAdminRefreshTokensPurge runs the refresh token cleanup now rather
+// than waiting for the purge job.
+func (cfg *apiConfig) handlerAdminRefreshTokensPurge(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Deleted int64 `json:"deleted"`
+	}
+
+	adminID, ok := cfg.authenticateAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.purgeRefreshTokens(r.Context(), time.Now())
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't purge refresh tokens", err)
+		return
+	}
+	cfg.audit(r, auditEvent{
+		Action:  auditPurgeTokens,
+		ActorID: adminID,
+		Details: map[string]any{"deleted": deleted},
+	})
+	respondWithJSON(w, http.StatusOK, response{Deleted: deleted})
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+	"github.com/lordbaldwin1/chirpy/internal/validate"
+)
+
+const (
+	scheduleInterval = 15 * time.Second
+	// maxScheduledChirps is how many scheduled chirps and drafts a user
+	// can have at once.
+	maxScheduledChirps = 100
+	// maxPublishAttempts is how many times the scheduler tries to publish
+	// a chirp before leaving it for its author to edit.
+	maxPublishAttempts = 5
+)
+
+// ScheduledChirp is a chirp waiting to be published, or a draft if
+// PublishAt is nil. Only its author can see it.
+type ScheduledChirp struct {
+	ID         uuid.UUID   `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	Body       string      `json:"body"`
+	ReplyToID  *uuid.UUID  `json:"reply_to_id"`
+	Visibility string      `json:"visibility"`
+	MediaIDs   []uuid.UUID `json:"media_ids"`
+	PublishAt  *time.Time  `json:"publish_at"`
+	// Failed is set once the scheduler has given up publishing it.
+	// Editing it clears it and tries again.
+	Failed bool `json:"failed"`
+}
+
+func scheduledChirpFromDB(c database.ScheduledChirp) ScheduledChirp {
+	scheduled := ScheduledChirp{
+		ID:         c.ID,
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+		Body:       c.Body,
+		Visibility: c.Visibility,
+		MediaIDs:   c.MediaIds,
+		Failed:     c.Attempts >= maxPublishAttempts,
+	}
+	if scheduled.MediaIDs == nil {
+		scheduled.MediaIDs = []uuid.UUID{}
+	}
+	if c.ReplyToID.Valid {
+		scheduled.ReplyToID = &c.ReplyToID.UUID
+	}
+	if c.PublishAt.Valid {
+		scheduled.PublishAt = &c.PublishAt.Time
+	}
+	return scheduled
+}
+
+// parsePublishAt returns when a chirp should be published: at publishAt,
+// which must be in the future, or never for a draft. If the two conflict
+// or publishAt has passed it responds with 422 and returns false.
+func parsePublishAt(w http.ResponseWriter, r *http.Request, publishAt *time.Time, draft bool) (sql.NullTime, bool) {
+	if draft {
+		if publishAt != nil {
+			respondWithValidationErrors(w, r, validate.Errors{{Field: "publish_at", Message: "must not be set for a draft"}})
+			return sql.NullTime{}, false
+		}
+		return sql.NullTime{}, true
+	}
+	if !publishAt.After(time.Now()) {
+		respondWithValidationErrors(w, r, validate.Errors{{Field: "publish_at", Message: "must be in the future"}})
+		return sql.NullTime{}, false
+	}
+	return sql.NullTime{Time: publishAt.UTC(), Valid: true}, true
+}
+
+// mediaIDs is the IDs of media, never nil so it can be stored.
+func mediaIDs(media []database.Media) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(media))
+	for _, m := range media {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+// scheduleChirp saves c to be published at publishAt, or as a draft. It is
+// checked like a chirp created straight away, so it can't fail later for
+// being invalid.
+func (cfg *apiConfig) scheduleChirp(w http.ResponseWriter, r *http.Request, c newChirp, publishAt *time.Time, draft bool) {
+	at, ok := parsePublishAt(w, r, publishAt, draft)
+	if !ok {
+		return
+	}
+	if c.ReplyToID.Valid {
+		_, ok := cfg.viewableChirp(w, r, uuid.NullUUID{UUID: c.UserID, Valid: true}, c.ReplyToID.UUID)
+		if !ok {
+			return
+		}
+	}
+
+	count, err := cfg.store.CountScheduledChirps(r.Context(), c.UserID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't count scheduled chirps", err)
+		return
+	}
+	if count >= maxScheduledChirps {
+		respondWithError(w, r, http.StatusConflict, codeConflict, fmt.Sprintf("You can have at most %d scheduled chirps and drafts", maxScheduledChirps), nil)
+		return
+	}
+
+	scheduled, err := cfg.store.CreateScheduledChirp(r.Context(), database.CreateScheduledChirpParams{
+		UserID:     c.UserID,
+		Body:       c.Body,
+		ReplyToID:  c.ReplyToID,
+		Visibility: c.Visibility,
+		MediaIds:   mediaIDs(c.Media),
+		PublishAt:  at,
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't schedule chirp", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, scheduledChirpFromDB(scheduled))
+}
+
+// handlerScheduledChirpsGet lists the user's scheduled chirps in the order
+// they'll be published, then their drafts.
+func (cfg *apiConfig) handlerScheduledChirpsGet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	dbScheduled, err := cfg.store.GetScheduledChirps(r.Context(), userID)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get scheduled chirps", err)
+		return
+	}
+	scheduled := make([]ScheduledChirp, 0, len(dbScheduled))
+	for _, c := range dbScheduled {
+		scheduled = append(scheduled, scheduledChirpFromDB(c))
+	}
+	respondWithJSON(w, http.StatusOK, scheduled)
+}
+
+// handlerScheduledChirpsUpdate changes the fields of a scheduled chirp or
+// draft that are in the request. A chirp that has already been published
+// can't be changed this way and gets a 404.
+func (cfg *apiConfig) handlerScheduledChirpsUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body       *string    `json:"body"`
+		MediaIDs   *[]string  `json:"media_ids" validate:"max=4"`
+		Visibility *string    `json:"visibility" validate:"oneof=public followers unlisted"`
+		PublishAt  *time.Time `json:"publish_at"`
+		Draft      bool       `json:"draft"`
+	}
+
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid scheduled chirp ID", err)
+		return
+	}
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	params, ok := decodeAndValidate[parameters](w, r)
+	if !ok {
+		return
+	}
+
+	var body string
+	if params.Body != nil {
+		if *params.Body == "" {
+			respondWithValidationErrors(w, r, validate.Errors{{Field: "body", Message: "is required"}})
+			return
+		}
+		body, ok = cleanChirpBody(w, r, *params.Body)
+		if !ok {
+			return
+		}
+	}
+	var attached []database.Media
+	if params.MediaIDs != nil {
+		attached, ok = cfg.mediaToAttach(w, r, userID, *params.MediaIDs)
+		if !ok {
+			return
+		}
+	}
+	var publishAt sql.NullTime
+	if params.PublishAt != nil || params.Draft {
+		publishAt, ok = parsePublishAt(w, r, params.PublishAt, params.Draft)
+		if !ok {
+			return
+		}
+	}
+
+	var scheduled database.ScheduledChirp
+	err = cfg.store.WithTx(r.Context(), func(tx store.Store) error {
+		// locking the row means either the scheduler published it first
+		// and it's gone, or it waits for this change
+		current, err := tx.GetScheduledChirpForUpdate(r.Context(), database.GetScheduledChirpForUpdateParams{
+			ID:     scheduledID,
+			UserID: userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		arg := database.UpdateScheduledChirpParams{
+			ID:         current.ID,
+			Body:       current.Body,
+			ReplyToID:  current.ReplyToID,
+			Visibility: current.Visibility,
+			MediaIds:   current.MediaIds,
+			PublishAt:  current.PublishAt,
+		}
+		if params.Body != nil {
+			arg.Body = body
+		}
+		if params.MediaIDs != nil {
+			arg.MediaIds = mediaIDs(attached)
+		}
+		if params.Visibility != nil {
+			arg.Visibility = *params.Visibility
+		}
+		if params.PublishAt != nil || params.Draft {
+			arg.PublishAt = publishAt
+		}
+		scheduled, err = tx.UpdateScheduledChirp(r.Context(), arg)
+		return err
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't update scheduled chirp", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, scheduledChirpFromDB(scheduled))
+}
+
+// handlerScheduledChirpsDelete cancels a scheduled chirp or deletes a
+// draft.
+func (cfg *apiConfig) handlerScheduledChirpsDelete(w http.ResponseWriter, r *http.Request) {
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondWithError(w, r, http.StatusBadRequest, codeInvalidID, "Invalid scheduled chirp ID", err)
+		return
+	}
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := cfg.store.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID:     scheduledID,
+		UserID: userID,
+	})
+	if err == nil && deleted == 0 {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't cancel scheduled chirp", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runScheduler publishes scheduled chirps as they fall due, every interval
+// until ctx is cancelled.
+func (cfg *apiConfig) runScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := cfg.publishDueChirps(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error publishing scheduled chirps: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueChirps publishes every scheduled chirp due at or before now.
+// A chirp that fails to publish is skipped for the rest of the run, so it
+// doesn't hold up the others, and retried on the next run until it has
+// failed maxPublishAttempts times. Chirps by suspended users are skipped
+// too, without counting as failures, and wait until they are unsuspended.
+func (cfg *apiConfig) publishDueChirps(ctx context.Context, now time.Time) error {
+	var skip []uuid.UUID
+	var errs []error
+	for {
+		scheduledID, err := cfg.publishDueChirp(ctx, now.UTC(), skip)
+		if err == nil && scheduledID == uuid.Nil {
+			return errors.Join(errs...)
+		}
+		if err == nil {
+			continue
+		}
+		// nothing was claimed, so there's nothing to skip past
+		if scheduledID == uuid.Nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		skip = append(skip, scheduledID)
+		if errors.Is(err, errAccountSuspended) {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("scheduled chirp %s: %w", scheduledID, err))
+		err = cfg.store.RecordScheduledChirpFailure(ctx, database.RecordScheduledChirpFailureParams{
+			ID:        scheduledID,
+			LastError: err.Error(),
+		})
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+}
+
+// publishDueChirp publishes the scheduled chirp due first, if any, other
+// than those in skip. It returns the ID of the scheduled chirp it claimed,
+// or uuid.Nil if none was due. The chirp is created and the scheduled chirp
+// deleted in the transaction that locked it, so each is published exactly
+// once however many replicas run the scheduler.
+func (cfg *apiConfig) publishDueChirp(ctx context.Context, now time.Time, skip []uuid.UUID) (uuid.UUID, error) {
+	var scheduledID uuid.UUID
+	var chirp database.Chirp
+	var attached []database.Media
+	var notifications []database.Notification
+	err := cfg.store.WithTx(ctx, func(tx store.Store) error {
+		scheduled, err := tx.ClaimDueScheduledChirp(ctx, database.ClaimDueScheduledChirpParams{
+			DueBefore:   now,
+			MaxAttempts: maxPublishAttempts,
+			SkipIds:     skip,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		scheduledID = scheduled.ID
+
+		_, err = activeUser(ctx, tx, scheduled.UserID)
+		if err != nil {
+			return err
+		}
+
+		// media the author deleted since scheduling is left out
+		found, err := tx.GetMediaByIDs(ctx, scheduled.MediaIds)
+		if err != nil {
+			return err
+		}
+		for _, id := range scheduled.MediaIds {
+			i := slices.IndexFunc(found, func(m database.Media) bool { return m.ID == id })
+			if i >= 0 && found[i].UserID == scheduled.UserID {
+				attached = append(attached, found[i])
+			}
+		}
+
+		// a chirp replying to one the author can no longer see is
+		// published on its own, as if it had been deleted
+		c := newChirp{
+			Body:       scheduled.Body,
+			UserID:     scheduled.UserID,
+			ReplyToID:  scheduled.ReplyToID,
+			Visibility: scheduled.Visibility,
+			Media:      attached,
+		}
+		if c.ReplyToID.Valid {
+			parent, err := tx.GetChirpsByID(ctx, c.ReplyToID.UUID)
+			if err != nil {
+				return err
+			}
+			visible, err := canView(ctx, tx, uuid.NullUUID{UUID: c.UserID, Valid: true}, parent)
+			if err != nil {
+				return err
+			}
+			if !visible {
+				c.ReplyToID = uuid.NullUUID{}
+			}
+		}
+
+		chirp, notifications, err = createChirp(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+		_, err = tx.DeleteScheduledChirp(ctx, database.DeleteScheduledChirpParams{
+			ID:     scheduled.ID,
+			UserID: scheduled.UserID,
+		})
+		return err
+	})
+	if err != nil || scheduledID == uuid.Nil {
+		return scheduledID, err
+	}
+
+	cfg.announceChirp(ctx, chirp, notifications)
+	return scheduledID, nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/auth"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/entities"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSeedDir is where named fixtures are found if SEED_DIR isn't set.
+const defaultSeedDir = "seeds"
+
+// seedFixture is data to load into an empty database, read from a JSON or
+// YAML file. Chirps and follows refer to users by email.
+type seedFixture struct {
+	Users   []seedUser   `json:"users" yaml:"users"`
+	Chirps  []seedChirp  `json:"chirps" yaml:"chirps"`
+	Follows []seedFollow `json:"follows" yaml:"follows"`
+}
+
+type seedUser struct {
+	Email       string `json:"email" yaml:"email"`
+	Password    string `json:"password" yaml:"password"`
+	Handle      string `json:"handle" yaml:"handle"`
+	IsAdmin     bool   `json:"is_admin" yaml:"is_admin"`
+	IsChirpyRed bool   `json:"is_chirpy_red" yaml:"is_chirpy_red"`
+}
+
+type seedChirp struct {
+	Author string `json:"author" yaml:"author"`
+	Body   string `json:"body" yaml:"body"`
+	// Visibility defaults to public.
+	Visibility string `json:"visibility" yaml:"visibility"`
+}
+
+type seedFollow struct {
+	Follower string `json:"follower" yaml:"follower"`
+	Followee string `json:"followee" yaml:"followee"`
+}
+
+var (
+	errFixtureNotFound = errors.New("fixture not found")
+	// fixtureName keeps fixture names from reaching outside the seed
+	// directory.
+	fixtureName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// loadSeedFixture reads the fixture called name from dir, whichever of
+// name.json, name.yaml or name.yml exists, and checks it can be loaded.
+func loadSeedFixture(dir, name string) (seedFixture, error) {
+	if !fixtureName.MatchString(name) {
+		return seedFixture{}, fmt.Errorf("fixture name %q must be letters, digits, dashes or underscores", name)
+	}
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return seedFixture{}, err
+		}
+
+		var f seedFixture
+		if ext == ".json" {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			err = dec.Decode(&f)
+		} else {
+			dec := yaml.NewDecoder(bytes.NewReader(data))
+			dec.KnownFields(true)
+			err = dec.Decode(&f)
+		}
+		if err != nil {
+			return seedFixture{}, fmt.Errorf("couldn't parse fixture %s: %w", name+ext, err)
+		}
+		err = f.validate()
+		if err != nil {
+			return seedFixture{}, fmt.Errorf("fixture %s: %w", name+ext, err)
+		}
+		return f, nil
+	}
+	return seedFixture{}, fmt.Errorf("%w: %s", errFixtureNotFound, name)
+}
+
+// validate checks f only refers to its own users and everything in it
+// would pass the API's validation.
+func (f seedFixture) validate() error {
+	emails := map[string]bool{}
+	for i, u := range f.Users {
+		if u.Email == "" || len(u.Password) < 8 || len(u.Password) > 72 {
+			return fmt.Errorf("user %d needs an email and a password of 8 to 72 bytes", i)
+		}
+		if emails[u.Email] {
+			return fmt.Errorf("user %s is listed twice", u.Email)
+		}
+		if u.Handle != "" && !entities.ValidHandle(u.Handle) {
+			return fmt.Errorf("user %s: handle %s", u.Email, invalidHandleMessage)
+		}
+		emails[u.Email] = true
+	}
+	for i, c := range f.Chirps {
+		if !emails[c.Author] {
+			return fmt.Errorf("chirp %d: unknown author %q", i, c.Author)
+		}
+		if c.Body == "" || utf8.RuneCountInString(c.Body) > maxChirpLength {
+			return fmt.Errorf("chirp %d must be 1 to %d characters", i, maxChirpLength)
+		}
+		switch c.Visibility {
+		case "", visibilityPublic, visibilityFollowers, visibilityUnlisted:
+		default:
+			return fmt.Errorf("chirp %d: visibility must be public, followers or unlisted", i)
+		}
+	}
+	for i, follow := range f.Follows {
+		if !emails[follow.Follower] || !emails[follow.Followee] {
+			return fmt.Errorf("follow %d: unknown user", i)
+		}
+		if follow.Follower == follow.Followee {
+			return fmt.Errorf("follow %d: users can't follow themselves", i)
+		}
+	}
+	return nil
+}
+
+// applySeedFixture creates everything in f with s, which should be a
+// transaction so a failure leaves nothing behind. Chirps are created as
+// if they were posted, with their hashtags, mentions and notifications.
+func applySeedFixture(ctx context.Context, s store.Store, f seedFixture) error {
+	// bcrypt is slow on purpose, and generated users share a password
+	hashes := map[string]string{}
+	userIDs := map[string]uuid.UUID{}
+	for _, u := range f.Users {
+		hash, ok := hashes[u.Password]
+		if !ok {
+			var err error
+			hash, err = auth.HashPassword(u.Password)
+			if err != nil {
+				return err
+			}
+			hashes[u.Password] = hash
+		}
+
+		var handle sql.NullString
+		if u.Handle != "" {
+			handle = sql.NullString{String: u.Handle, Valid: true}
+		}
+		user, err := s.CreateUser(ctx, database.CreateUserParams{
+			Email:          u.Email,
+			HashedPassword: hash,
+			Handle:         handle,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create user %s: %w", u.Email, err)
+		}
+		userIDs[u.Email] = user.ID
+
+		if u.IsAdmin {
+			_, err = s.SetUserAdmin(ctx, database.SetUserAdminParams{Email: u.Email, IsAdmin: true})
+			if err != nil {
+				return err
+			}
+		}
+		if u.IsChirpyRed {
+			_, err = s.UpgradeUserToChirpyRed(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, follow := range f.Follows {
+		_, err := s.CreateFollow(ctx, database.CreateFollowParams{
+			FollowerID: userIDs[follow.Follower],
+			FolloweeID: userIDs[follow.Followee],
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't make %s follow %s: %w", follow.Follower, follow.Followee, err)
+		}
+	}
+
+	for _, c := range f.Chirps {
+		visibility := c.Visibility
+		if visibility == "" {
+			visibility = visibilityPublic
+		}
+		_, _, err := createChirp(ctx, s, newChirp{
+			Body:       removeProfanity(c.Body),
+			UserID:     userIDs[c.Author],
+			Visibility: visibility,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't create chirp by %s: %w", c.Author, err)
+		}
+	}
+	return nil
+}
+
+// seedOptions is how much data generateSeedFixture makes.
+type seedOptions struct {
+	Users           int
+	ChirpsPerUser   int
+	FollowsPerUser  int
+	Password        string
+	ChirpyRedChance float64
+}
+
+var (
+	seedFirstNames = []string{"ada", "alan", "barbara", "claude", "donald", "edsger", "frances", "grace", "hedy", "ken", "linus", "margaret", "niklaus", "radia", "rob", "sophie", "tim", "yukihiro"}
+	seedLastNames  = []string{"allen", "berners_lee", "hamilton", "hopper", "kernighan", "knuth", "lamarr", "liskov", "lovelace", "matsumoto", "perlman", "pike", "shannon", "thompson", "turing", "wilson", "wirth"}
+	seedHashtags   = []string{"golang", "postgres", "coffee", "running", "music", "weekend", "books", "travel", "cooking", "gaming", "photography", "devops"}
+	seedActivities = []string{"shipped a release", "fixed a flaky test", "made sourdough", "finished a 10k", "read a great book", "reviewed a huge PR", "tried a new cafe", "refactored the parser", "went hiking", "learned a new chord"}
+	seedFeelings   = []string{"Feeling great.", "Long day.", "Highly recommend.", "Never again.", "Would do it again.", "Not bad at all.", "Send coffee."}
+)
+
+// generateSeedFixture makes realistic looking users who chirp about their
+// day, with hashtags and mentions, and follow each other. A few users are
+// followed by many, as on a real network.
+func generateSeedFixture(rng *rand.Rand, opts seedOptions) seedFixture {
+	var f seedFixture
+	for i := range opts.Users {
+		first := seedFirstNames[rng.IntN(len(seedFirstNames))]
+		last := seedLastNames[rng.IntN(len(seedLastNames))]
+		// the index keeps handles and emails unique
+		handle := fmt.Sprintf("%s_%s%d", first, last, i)
+		if len(handle) > entities.MaxHandleLength {
+			handle = fmt.Sprintf("%s%d", first, i)
+		}
+		f.Users = append(f.Users, seedUser{
+			Email:       handle + "@example.com",
+			Password:    opts.Password,
+			Handle:      handle,
+			IsChirpyRed: rng.Float64() < opts.ChirpyRedChance,
+		})
+	}
+	if opts.Users == 0 {
+		return f
+	}
+
+	// popular picks users skewed towards the first ones
+	popular := func() int {
+		u := rng.Float64()
+		return int(u * u * u * float64(opts.Users))
+	}
+	for i, u := range f.Users {
+		following := map[int]bool{i: true}
+		for range min(opts.FollowsPerUser, opts.Users-1) {
+			j := popular()
+			for following[j] {
+				j = rng.IntN(opts.Users)
+			}
+			following[j] = true
+			f.Follows = append(f.Follows, seedFollow{Follower: u.Email, Followee: f.Users[j].Email})
+		}
+
+		for range opts.ChirpsPerUser {
+			body := fmt.Sprintf("Just %s. %s #%s",
+				seedActivities[rng.IntN(len(seedActivities))],
+				seedFeelings[rng.IntN(len(seedFeelings))],
+				seedHashtags[rng.IntN(len(seedHashtags))])
+			if opts.Users > 1 && rng.IntN(4) == 0 {
+				mentioned := f.Users[popular()]
+				if mentioned.Email != u.Email {
+					body = fmt.Sprintf("@%s %s", mentioned.Handle, body)
+				}
+			}
+			visibility := visibilityPublic
+			if rng.IntN(10) == 0 {
+				visibility = visibilityFollowers
+			}
+			f.Chirps = append(f.Chirps, seedChirp{Author: u.Email, Body: body, Visibility: visibility})
+		}
+	}
+	return f
+}
+
+const seedUsage = "usage: chirpy seed [-users n] [-chirps n] [-follows n] [-password p] [-rand-seed n] [-reset] | chirpy seed [-reset] -fixture <name>"
+
+// runSeedCommand runs `chirpy seed`, which fills a dev database with fake
+// data for load testing, or loads a named fixture.
+func runSeedCommand(ctx context.Context, db *sql.DB, args []string) error {
+	if os.Getenv("PLATFORM") != "dev" {
+		return errors.New("seeding is only allowed in dev environment")
+	}
+
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	opts := seedOptions{ChirpyRedChance: 0.05}
+	flags.IntVar(&opts.Users, "users", 100, "number of users to create")
+	flags.IntVar(&opts.ChirpsPerUser, "chirps", 10, "number of chirps each user posts")
+	flags.IntVar(&opts.FollowsPerUser, "follows", 20, "number of users each user follows")
+	flags.StringVar(&opts.Password, "password", "password123", "password of every user")
+	randSeed := flags.Uint64("rand-seed", 1, "seed of the random data, so runs can be repeated")
+	reset := flags.Bool("reset", false, "empty the database first")
+	fixture := flags.String("fixture", "", "load this fixture from SEED_DIR instead of generating data")
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() > 0 {
+		return errors.New(seedUsage)
+	}
+	if opts.Users < 0 || opts.ChirpsPerUser < 0 || opts.FollowsPerUser < 0 {
+		return errors.New("-users, -chirps and -follows can't be negative")
+	}
+
+	var f seedFixture
+	if *fixture != "" {
+		f, err = loadSeedFixture(seedDirFromEnv(), *fixture)
+	} else {
+		f = generateSeedFixture(rand.New(rand.NewPCG(*randSeed, *randSeed)), opts)
+		err = f.validate()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = store.NewPostgres(db).WithTx(ctx, func(tx store.Store) error {
+		if *reset {
+			err := tx.TruncateAllTables(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return applySeedFixture(ctx, tx, f)
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Created %d users, %d chirps and %d follows", len(f.Users), len(f.Chirps), len(f.Follows))
+	return nil
+}
+
+// seedDirFromEnv is the directory named fixtures are loaded from.
+func seedDirFromEnv() string {
+	if dir := os.Getenv("SEED_DIR"); dir != "" {
+		return dir
+	}
+	return defaultSeedDir
+}
@@ -0,0 +1,21 @@
+-- name: CreateAuditEvent :one
+INSERT INTO audit_events (id, created_at, action, outcome, actor_id, target_type, target_id, ip, user_agent, request_id, details)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING *;
+
+-- name: GetAuditEvents :many
+-- Newest first, filtered by whichever of the arguments are set. before is
+-- the last event of the previous page.
+SELECT * FROM audit_events
+WHERE (sqlc.narg(action)::text IS NULL OR audit_events.action = sqlc.narg(action))
+  AND (sqlc.narg(outcome)::text IS NULL OR audit_events.outcome = sqlc.narg(outcome))
+  AND (sqlc.narg(actor_id)::uuid IS NULL OR audit_events.actor_id = sqlc.narg(actor_id))
+  AND (sqlc.narg(target_id)::uuid IS NULL OR audit_events.target_id = sqlc.narg(target_id))
+  AND (sqlc.narg(since)::timestamp IS NULL OR audit_events.created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamp IS NULL OR audit_events.created_at < sqlc.narg(until))
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (audit_events.created_at, audit_events.id) < (SELECT a.created_at, a.id FROM audit_events AS a WHERE a.id = sqlc.narg(before))
+  )
+ORDER BY audit_events.created_at DESC, audit_events.id DESC
+LIMIT sqlc.arg(max_results);
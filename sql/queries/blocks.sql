@@ -0,0 +1,30 @@
+-- name: CreateBlock :execrows
+-- Affects no rows if the user already blocked them.
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: GetBlockedUsers :many
+-- Newest block first.
+SELECT users.* FROM users
+JOIN blocks ON blocks.blocked_id = users.id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC;
+
+-- name: GetBlockRelatedUserIDs :many
+-- Everyone the user blocked or was blocked by.
+SELECT (CASE WHEN blocker_id = sqlc.arg(user_id) THEN blocked_id ELSE blocker_id END)::uuid AS user_id
+FROM blocks
+WHERE blocker_id = sqlc.arg(user_id) OR blocked_id = sqlc.arg(user_id);
+
+-- name: BlockExists :one
+-- Whether either user blocked the other.
+SELECT EXISTS (
+  SELECT 1 FROM blocks
+  WHERE (blocker_id = sqlc.arg(user_id) AND blocked_id = sqlc.arg(other_id))
+    OR (blocker_id = sqlc.arg(other_id) AND blocked_id = sqlc.arg(user_id))
+);
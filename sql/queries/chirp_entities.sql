@@ -0,0 +1,45 @@
+-- name: CreateChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: GetChirpMentions :many
+-- The lower-cased handles of the users each chirp mentions. Users without a
+-- handle any more are left out, since nothing in the body refers to them.
+SELECT chirp_mentions.chirp_id, lower(users.handle)::text AS handle
+FROM chirp_mentions
+JOIN users ON users.id = chirp_mentions.user_id
+WHERE chirp_mentions.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+  AND users.handle IS NOT NULL
+ORDER BY chirp_mentions.chirp_id, handle;
+
+-- name: CreateChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, tag)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: GetChirpsByHashtag :many
+-- Public chirps only, newest first. before is the last chirp of the
+-- previous page.
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+WHERE chirp_hashtags.tag = sqlc.arg(tag)
+  AND chirps.visibility = 'public'
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = sqlc.narg(before))
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: GetChirpsMentioningUser :many
+-- Newest first. before is the last chirp of the previous page.
+SELECT chirps.* FROM chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE chirp_mentions.user_id = sqlc.arg(user_id)
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = sqlc.narg(before))
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(max_results);
@@ -0,0 +1,14 @@
+-- name: CreateChirpLike :execrows
+-- Affects no rows if the user already likes the chirp.
+INSERT INTO chirp_likes (user_id, chirp_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteChirpLike :exec
+DELETE FROM chirp_likes
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetChirpLikesByUserID :many
+SELECT * FROM chirp_likes
+WHERE user_id = $1
+ORDER BY created_at;
@@ -1,10 +1,16 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+-- A reply joins the thread of the chirp it replies to; anything else starts
+-- a new thread.
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, reply_to_id, thread_id, visibility)
+SELECT new_chirp.id, NOW(), NOW(), sqlc.arg(body), sqlc.arg(user_id), sqlc.narg(reply_to_id), COALESCE(parent.thread_id, new_chirp.id), sqlc.arg(visibility)
+FROM (SELECT gen_random_uuid() AS id) AS new_chirp
+LEFT JOIN chirps AS parent ON parent.id = sqlc.narg(reply_to_id)
 RETURNING *;
 
 -- name: GetChirps :many
+-- Only public chirps are listed.
 SELECT * FROM chirps
+WHERE visibility = 'public'
 ORDER BY created_at ASC;
 
 -- name: GetChirpsByID :one
@@ -18,4 +24,31 @@ WHERE user_id = $1 AND id = $2;
 -- name: GetChirpsByAuthorID :many
 SELECT * FROM chirps
 WHERE user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+ORDER BY created_at ASC;
+
+-- name: GetChirpsByThreadID :many
+SELECT * FROM chirps
+WHERE thread_id = $1
+ORDER BY created_at ASC;
+
+-- name: GetTimeline :many
+-- The user's own chirps and those of everyone they follow, newest first.
+-- before is the last chirp of the previous page.
+SELECT * FROM chirps
+WHERE (
+    chirps.user_id = sqlc.arg(user_id)
+    OR chirps.user_id IN (SELECT followee_id FROM follows WHERE follower_id = sqlc.arg(user_id))
+  )
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (chirps.created_at, chirps.id) < (SELECT c.created_at, c.id FROM chirps AS c WHERE c.id = sqlc.narg(before))
+  )
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: SetChirpHidden :one
+-- Hiding an already hidden chirp keeps the original hidden_at.
+UPDATE chirps
+SET hidden_at = CASE WHEN sqlc.arg(hidden)::bool THEN COALESCE(hidden_at, NOW()) END
+WHERE id = sqlc.arg(id)
+RETURNING *;
@@ -0,0 +1,45 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, user_id, status)
+VALUES (gen_random_uuid(), NOW(), $1, 'pending')
+RETURNING *;
+
+-- name: GetLatestDataExport :one
+SELECT * FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExportsByUserID :many
+SELECT * FROM data_exports
+WHERE user_id = $1;
+
+-- name: ClaimDataExport :one
+-- Claims the oldest pending export, or one left running since stale_before
+-- by a worker that died. Concurrent workers skip each other's claims.
+UPDATE data_exports
+SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT queued.id FROM data_exports AS queued
+    WHERE queued.status = 'pending'
+      OR (queued.status = 'running' AND queued.started_at < sqlc.arg(stale_before)::timestamp)
+    ORDER BY queued.created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING *;
+
+-- name: CompleteDataExport :one
+UPDATE data_exports
+SET status = 'ready', completed_at = NOW(), expires_at = sqlc.arg(expires_at)::timestamp, size_bytes = sqlc.arg(size_bytes)::bigint
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :many
+DELETE FROM data_exports
+WHERE expires_at <= sqlc.arg(expired_before)::timestamp
+RETURNING id;
@@ -0,0 +1,5 @@
+-- name: NextEventID :one
+SELECT nextval('event_ids')::bigint AS id;
+
+-- name: NotifyEvent :exec
+SELECT pg_notify(sqlc.arg(channel)::text, sqlc.arg(payload)::text);
@@ -0,0 +1,25 @@
+-- name: CreateFollow :execrows
+-- Affects no rows if the user already follows the followee.
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteFollow :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowsByUserID :many
+-- Both who the user follows and who follows them.
+SELECT * FROM follows
+WHERE follower_id = $1 OR followee_id = $1
+ORDER BY created_at;
+
+-- name: GetFolloweeIDs :many
+SELECT followee_id FROM follows
+WHERE follower_id = $1;
+
+-- name: FollowExists :one
+SELECT EXISTS (
+  SELECT 1 FROM follows
+  WHERE follower_id = $1 AND followee_id = $2
+);
@@ -0,0 +1,68 @@
+-- name: CreateJob :one
+INSERT INTO jobs (id, created_at, updated_at, kind, payload, status, max_attempts, run_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, 'pending', $3, sqlc.arg(run_at)::timestamp)
+RETURNING *;
+
+-- name: KillExpiredJobs :execrows
+-- Kills running jobs whose worker died without finishing them by
+-- locked_until and which have no attempts left, such as a job that
+-- crashes the process every time it runs.
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = 'lease expired', updated_at = NOW()
+WHERE status = 'running' AND locked_until < sqlc.arg(now)::timestamp AND attempts >= max_attempts;
+
+-- name: ClaimJob :one
+-- Claims the pending job that has been due longest, or a running one whose
+-- worker died without finishing it by locked_until and which has attempts
+-- left. Concurrent workers skip each other's claims. Claiming counts as an
+-- attempt.
+UPDATE jobs
+SET status = 'running', attempts = attempts + 1, locked_until = sqlc.arg(locked_until)::timestamp, updated_at = NOW()
+WHERE id = (
+    SELECT queued.id FROM jobs AS queued
+    WHERE (queued.status = 'pending' AND queued.run_at <= sqlc.arg(now)::timestamp)
+      OR (queued.status = 'running' AND queued.locked_until < sqlc.arg(now)::timestamp AND queued.attempts < queued.max_attempts)
+    ORDER BY queued.run_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING *;
+
+-- name: CompleteJob :execrows
+-- The attempt must match the claim, so a worker whose lease ran out can't
+-- finish a job someone else has since claimed.
+DELETE FROM jobs
+WHERE id = $1 AND attempts = $2 AND status = 'running';
+
+-- name: RetryJob :execrows
+UPDATE jobs
+SET status = 'pending', run_at = sqlc.arg(run_at)::timestamp, locked_until = NULL, last_error = sqlc.arg(last_error)::text, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND attempts = sqlc.arg(attempts) AND status = 'running';
+
+-- name: KillJob :execrows
+UPDATE jobs
+SET status = 'dead', locked_until = NULL, last_error = sqlc.arg(last_error)::text, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND attempts = sqlc.arg(attempts) AND status = 'running';
+
+-- name: GetJobByID :one
+SELECT * FROM jobs
+WHERE id = $1;
+
+-- name: GetJobs :many
+-- Newest first, optionally only those with status. before is the last job
+-- of the previous page.
+SELECT * FROM jobs
+WHERE (sqlc.narg(status)::text IS NULL OR jobs.status = sqlc.narg(status))
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (jobs.created_at, jobs.id) < (SELECT j.created_at, j.id FROM jobs AS j WHERE j.id = sqlc.narg(before))
+  )
+ORDER BY jobs.created_at DESC, jobs.id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: RequeueJob :one
+-- Gives a dead job a fresh set of attempts, starting now.
+UPDATE jobs
+SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'dead'
+RETURNING *;
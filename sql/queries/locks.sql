@@ -0,0 +1,4 @@
+-- name: TryAdvisoryXactLock :one
+-- Takes a lock held until the end of the transaction, or returns false
+-- straight away if another transaction has it.
+SELECT pg_try_advisory_xact_lock(sqlc.arg(key)::bigint) AS locked;
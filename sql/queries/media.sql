@@ -0,0 +1,28 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, created_at, user_id, content_type, thumbnail_content_type, width, height, size_bytes)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: GetMediaByID :one
+SELECT * FROM media
+WHERE id = $1;
+
+-- name: GetMediaByIDs :many
+SELECT * FROM media
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: CreateChirpMedia :exec
+INSERT INTO chirp_media (chirp_id, media_id, position)
+VALUES ($1, $2, $3);
+
+-- name: GetChirpMedia :many
+SELECT chirp_media.chirp_id, sqlc.embed(media)
+FROM chirp_media
+JOIN media ON media.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position;
+
+-- name: GetMediaByUserID :many
+SELECT * FROM media
+WHERE user_id = $1
+ORDER BY created_at;
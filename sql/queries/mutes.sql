@@ -0,0 +1,35 @@
+-- name: CreateMute :execrows
+-- Affects no rows if the user already muted them.
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMute :exec
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: GetMutedUsers :many
+-- Newest mute first.
+SELECT users.* FROM users
+JOIN mutes ON mutes.muted_id = users.id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC;
+
+-- name: GetMutedUserIDs :many
+SELECT muted_id FROM mutes
+WHERE muter_id = $1;
+
+-- name: CreateMutedKeyword :execrows
+-- Affects no rows if the user already muted the keyword.
+INSERT INTO muted_keywords (user_id, keyword, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMutedKeyword :exec
+DELETE FROM muted_keywords
+WHERE user_id = $1 AND keyword = $2;
+
+-- name: GetMutedKeywords :many
+SELECT * FROM muted_keywords
+WHERE user_id = $1
+ORDER BY keyword;
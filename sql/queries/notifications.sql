@@ -0,0 +1,79 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, created_at, user_id, actor_id, type, chirp_id)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetNotifications :many
+-- Newest first. before is the last notification of the previous page.
+-- Notifications from users blocked either way or muted, or about chirps
+-- with a muted keyword, are left out.
+SELECT * FROM notifications
+WHERE notifications.user_id = sqlc.arg(user_id)
+  AND (NOT sqlc.arg(unread_only)::bool OR notifications.read_at IS NULL)
+  AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+      OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id AND mutes.muted_id = notifications.actor_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM muted_keywords
+    JOIN chirps ON chirps.id = notifications.chirp_id
+    WHERE muted_keywords.user_id = notifications.user_id
+      AND strpos(lower(chirps.body), muted_keywords.keyword) > 0
+  )
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (notifications.created_at, notifications.id) < (SELECT n.created_at, n.id FROM notifications AS n WHERE n.id = sqlc.narg(before))
+  )
+ORDER BY notifications.created_at DESC, notifications.id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: CountUnreadNotifications :one
+-- Leaves out the same notifications as GetNotifications.
+SELECT COUNT(*) FROM notifications
+WHERE notifications.user_id = $1 AND notifications.read_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = notifications.user_id AND blocks.blocked_id = notifications.actor_id)
+      OR (blocks.blocker_id = notifications.actor_id AND blocks.blocked_id = notifications.user_id)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE mutes.muter_id = notifications.user_id AND mutes.muted_id = notifications.actor_id
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM muted_keywords
+    JOIN chirps ON chirps.id = notifications.chirp_id
+    WHERE muted_keywords.user_id = notifications.user_id
+      AND strpos(lower(chirps.body), muted_keywords.keyword) > 0
+  );
+
+-- name: MarkNotificationRead :one
+UPDATE notifications
+SET read_at = COALESCE(read_at, NOW())
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: GetNotificationPreferences :one
+SELECT * FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: UpsertNotificationPreferences :one
+INSERT INTO notification_preferences (user_id, updated_at, mentions, replies, likes, follows)
+VALUES ($1, NOW(), $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET updated_at = NOW(),
+  mentions = EXCLUDED.mentions,
+  replies = EXCLUDED.replies,
+  likes = EXCLUDED.likes,
+  follows = EXCLUDED.follows
+RETURNING *;
@@ -0,0 +1,18 @@
+-- name: TakeRateLimitToken :one
+-- Refills the bucket for the time since it was last used, then takes a
+-- token if there is one. allowed records whether a token was taken.
+INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::float8 - 1, true, NOW())
+ON CONFLICT (key) DO UPDATE
+SET tokens = CASE
+    WHEN LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * sqlc.arg(refill_rate)::float8) >= 1
+    THEN LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * sqlc.arg(refill_rate)::float8) - 1
+    ELSE LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * sqlc.arg(refill_rate)::float8)
+  END,
+  allowed = LEAST(sqlc.arg(burst)::float8, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (NOW() - rate_limit_buckets.updated_at))::float8 * sqlc.arg(refill_rate)::float8) >= 1,
+  updated_at = NOW()
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < NOW() - make_interval(secs => sqlc.arg(idle_seconds)::float8);
@@ -1,28 +1,53 @@
 -- name: CreateRefreshToken :exec
 INSERT INTO refresh_tokens(
-  token, 
+  id,
+  token_hash,
   created_at, 
   updated_at, 
   user_id,
   expires_at,
   revoked_at
 )
-VALUES($1, NOW(), NOW(), $2, $3, NULL
+VALUES($1, $2, NOW(), NOW(), $3, $4, NULL
 );
 
+-- name: GetRefreshToken :one
+-- The caller checks token_hash, so a lookup ID alone is no use.
+SELECT * FROM refresh_tokens
+WHERE id = $1;
+
 -- name: GetUserFromRefreshToken :one
-SELECT users.*
+SELECT sqlc.embed(users), refresh_tokens.token_hash
 FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1;
+WHERE refresh_tokens.id = $1
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW();
 
--- name: UpdateRefreshToken :exec
+-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
-SET token = $1, updated_at = NOW()
-WHERE user_id = $2;
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE id = $1;
 
--- name: RevokeRefreshToken :exec
+
+-- name: GetRefreshTokensByUserID :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: RevokeAllRefreshTokensForUser :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE user_id = $1 AND revoked_at IS NULL;
 
+-- name: DeleteStaleRefreshTokens :execrows
+-- Deletes up to max_results tokens that expired or were revoked before
+-- stale_before. Tokens locked by a concurrent refresh are left for next time.
+DELETE FROM refresh_tokens
+WHERE id IN (
+    SELECT stale.id FROM refresh_tokens AS stale
+    WHERE stale.expires_at < sqlc.arg(stale_before)::timestamp
+      OR stale.revoked_at < sqlc.arg(stale_before)::timestamp
+    LIMIT sqlc.arg(max_results)
+    FOR UPDATE SKIP LOCKED
+  );
@@ -0,0 +1,26 @@
+-- name: TruncateAllTables :exec
+-- Empties every table but goose's. Tables are listed in dependency order,
+-- children first; users and media refer to each other, which only one
+-- TRUNCATE of them all can handle.
+TRUNCATE
+  chirp_media,
+  chirp_hashtags,
+  chirp_mentions,
+  chirp_likes,
+  trending_chirps,
+  notifications,
+  scheduled_chirps,
+  chirps,
+  follows,
+  blocks,
+  mutes,
+  muted_keywords,
+  notification_preferences,
+  refresh_tokens,
+  data_exports,
+  media,
+  users,
+  trending_hashtags,
+  rate_limit_buckets,
+  jobs,
+  audit_events;
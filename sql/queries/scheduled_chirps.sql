@@ -0,0 +1,56 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (id, created_at, updated_at, user_id, body, reply_to_id, visibility, media_ids, publish_at)
+VALUES (gen_random_uuid(), NOW(), NOW(), sqlc.arg(user_id), sqlc.arg(body), sqlc.narg(reply_to_id), sqlc.arg(visibility), sqlc.arg(media_ids)::uuid[], sqlc.narg(publish_at))
+RETURNING *;
+
+-- name: GetScheduledChirps :many
+-- Scheduled chirps in the order they'll be published, then drafts, oldest
+-- first.
+SELECT * FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at NULLS LAST, created_at;
+
+-- name: CountScheduledChirps :one
+SELECT count(*) FROM scheduled_chirps
+WHERE user_id = $1;
+
+-- name: GetScheduledChirpForUpdate :one
+-- Waits for the scheduler if it is publishing the chirp, in which case
+-- there's no row left to get.
+SELECT * FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2
+FOR UPDATE;
+
+-- name: UpdateScheduledChirp :one
+UPDATE scheduled_chirps
+SET body = sqlc.arg(body),
+  reply_to_id = sqlc.narg(reply_to_id),
+  visibility = sqlc.arg(visibility),
+  media_ids = sqlc.arg(media_ids)::uuid[],
+  publish_at = sqlc.narg(publish_at),
+  attempts = 0,
+  last_error = NULL,
+  updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: ClaimDueScheduledChirp :one
+-- Locks the chirp due first until the transaction ends. Other replicas
+-- skip it, so each chirp is published by exactly one of them. Chirps that
+-- have failed max_attempts times, and those in skip_ids, aren't claimed.
+SELECT * FROM scheduled_chirps
+WHERE publish_at <= sqlc.arg(due_before)::timestamp
+  AND attempts < sqlc.arg(max_attempts)::int
+  AND NOT (id = ANY(COALESCE(sqlc.arg(skip_ids)::uuid[], '{}')))
+ORDER BY publish_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: RecordScheduledChirpFailure :exec
+UPDATE scheduled_chirps
+SET attempts = attempts + 1, last_error = sqlc.arg(last_error)::text
+WHERE id = sqlc.arg(id);
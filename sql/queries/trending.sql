@@ -0,0 +1,68 @@
+-- Scores add up engagement within the period, each event weighted by
+-- 0.5^(age / half_life) so recent activity counts for more.
+
+-- name: DeleteTrendingChirps :exec
+DELETE FROM trending_chirps
+WHERE period = $1;
+
+-- name: InsertTrendingChirps :execrows
+-- A like counts 1 and a reply counts 2. Only public chirps can trend, and
+-- replies that are hidden don't count.
+INSERT INTO trending_chirps (period, chirp_id, score, computed_at)
+SELECT sqlc.arg(period), engagement.chirp_id, SUM(engagement.weight * power(0.5, EXTRACT(EPOCH FROM (NOW() - engagement.at))::float8 / sqlc.arg(half_life_seconds)::float8)) AS score, NOW()
+FROM (
+    SELECT chirp_likes.chirp_id, chirp_likes.created_at AS at, 1.0::float8 AS weight
+    FROM chirp_likes
+    UNION ALL
+    SELECT replies.reply_to_id, replies.created_at, 2.0::float8
+    FROM chirps AS replies
+    WHERE replies.reply_to_id IS NOT NULL AND replies.hidden_at IS NULL
+  ) AS engagement
+  JOIN chirps ON chirps.id = engagement.chirp_id
+WHERE engagement.at > NOW() - make_interval(secs => sqlc.arg(period_seconds)::float8)
+  AND chirps.hidden_at IS NULL
+  AND chirps.visibility = 'public'
+GROUP BY engagement.chirp_id
+ORDER BY score DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: DeleteTrendingHashtags :exec
+DELETE FROM trending_hashtags
+WHERE period = $1;
+
+-- name: InsertTrendingHashtags :execrows
+-- Using a tag counts 1 and a like on a chirp with the tag counts 0.5.
+-- Only public chirps that aren't hidden count.
+INSERT INTO trending_hashtags (period, tag, score, computed_at)
+SELECT sqlc.arg(period), engagement.tag, SUM(engagement.weight * power(0.5, EXTRACT(EPOCH FROM (NOW() - engagement.at))::float8 / sqlc.arg(half_life_seconds)::float8)) AS score, NOW()
+FROM (
+    SELECT chirp_hashtags.tag, chirps.created_at AS at, 1.0::float8 AS weight
+    FROM chirp_hashtags
+    JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+    WHERE chirps.hidden_at IS NULL AND chirps.visibility = 'public'
+    UNION ALL
+    SELECT chirp_hashtags.tag, chirp_likes.created_at, 0.5::float8
+    FROM chirp_hashtags
+    JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+    JOIN chirp_likes ON chirp_likes.chirp_id = chirps.id
+    WHERE chirps.hidden_at IS NULL AND chirps.visibility = 'public'
+  ) AS engagement
+WHERE engagement.at > NOW() - make_interval(secs => sqlc.arg(period_seconds)::float8)
+GROUP BY engagement.tag
+ORDER BY score DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: GetTrendingChirps :many
+-- Chirps hidden since the ranking was computed are left out.
+SELECT sqlc.embed(chirps), trending_chirps.score
+FROM trending_chirps
+JOIN chirps ON chirps.id = trending_chirps.chirp_id
+WHERE trending_chirps.period = $1 AND chirps.hidden_at IS NULL
+ORDER BY trending_chirps.score DESC, chirps.id
+LIMIT $2;
+
+-- name: GetTrendingHashtags :many
+SELECT * FROM trending_hashtags
+WHERE period = $1
+ORDER BY score DESC, tag
+LIMIT $2;
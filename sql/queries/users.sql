@@ -1,6 +1,6 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
-VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, sqlc.narg(handle))
 RETURNING *;
 
 -- name: DeleteAllUsers :exec
@@ -21,3 +21,104 @@ UPDATE users
 SET is_chirpy_red = true
 WHERE id = $1
 RETURNING *;
+
+-- name: GetUsersByHandles :many
+-- handles must be lower-cased.
+SELECT * FROM users
+WHERE lower(handle) = ANY(sqlc.arg(handles)::text[]);
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SetUserAdmin :one
+UPDATE users
+SET is_admin = $2, updated_at = NOW()
+WHERE email = $1
+RETURNING *;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE lower(handle) = lower($1);
+
+-- name: UpdateUserProfile :one
+-- display_name and bio are left as they are when NULL. handle and
+-- avatar_media_id can be cleared, so they have flags saying whether to set
+-- them.
+UPDATE users
+SET handle = CASE WHEN sqlc.arg(set_handle)::bool THEN sqlc.narg(handle) ELSE handle END,
+  display_name = COALESCE(sqlc.narg(display_name), display_name),
+  bio = COALESCE(sqlc.narg(bio), bio),
+  avatar_media_id = CASE WHEN sqlc.arg(set_avatar)::bool THEN sqlc.narg(avatar_media_id) ELSE avatar_media_id END,
+  updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetUserStats :one
+-- Hidden chirps aren't counted.
+SELECT
+  (SELECT count(*) FROM chirps WHERE chirps.user_id = $1 AND chirps.hidden_at IS NULL) AS chirp_count,
+  (SELECT count(*) FROM follows WHERE follows.followee_id = $1) AS follower_count,
+  (SELECT count(*) FROM follows WHERE follows.follower_id = $1) AS following_count;
+
+-- name: GetUsersByIDs :many
+SELECT * FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = sqlc.arg(deletion_scheduled_at)::timestamp, updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: CancelUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUsersDueForDeletion :many
+SELECT id FROM users
+WHERE deletion_scheduled_at <= sqlc.arg(due_before)::timestamp
+ORDER BY deletion_scheduled_at
+LIMIT sqlc.arg(max_results);
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: SearchUsers :many
+-- Newest first. pattern is matched against emails and handles with ILIKE,
+-- so callers escape it; an empty pattern matches everyone. before is the
+-- last user of the previous page.
+SELECT * FROM users
+WHERE (
+    sqlc.arg(pattern)::text = ''
+    OR users.email ILIKE '%' || sqlc.arg(pattern) || '%'
+    OR users.handle ILIKE '%' || sqlc.arg(pattern) || '%'
+  )
+  AND (
+    sqlc.narg(before)::uuid IS NULL
+    OR (users.created_at, users.id) < (SELECT u.created_at, u.id FROM users AS u WHERE u.id = sqlc.narg(before))
+  )
+ORDER BY users.created_at DESC, users.id DESC
+LIMIT sqlc.arg(max_results);
+
+-- name: SetUserChirpyRed :one
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SuspendUser :one
+-- Suspending a suspended user keeps the original time.
+UPDATE users
+SET suspended_at = COALESCE(suspended_at, NOW()), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_at = NULL, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
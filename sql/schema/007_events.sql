@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE SEQUENCE event_ids;
+
+-- +goose Down
+DROP SEQUENCE event_ids;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- thread_id is the ID of the chirp that started the thread; a chirp that
+-- isn't a reply is its own thread.
+ALTER TABLE chirps
+ADD COLUMN reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN thread_id UUID;
+
+UPDATE chirps SET thread_id = id;
+
+ALTER TABLE chirps
+ALTER COLUMN thread_id SET NOT NULL;
+
+CREATE INDEX chirps_thread_id_idx ON chirps(thread_id, created_at);
+
+-- +goose Down
+DROP INDEX chirps_thread_id_idx;
+
+ALTER TABLE chirps
+DROP COLUMN thread_id,
+DROP COLUMN reply_to_id;
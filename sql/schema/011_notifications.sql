@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE TABLE notifications(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  type TEXT NOT NULL CHECK (type IN ('mention', 'reply', 'like', 'follow')),
+  chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE,
+  read_at TIMESTAMP
+);
+
+CREATE INDEX notifications_user_id_created_at_idx ON notifications(user_id, created_at DESC, id DESC);
+
+-- A user without a row gets every kind of notification.
+CREATE TABLE notification_preferences(
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  updated_at TIMESTAMP NOT NULL,
+  mentions BOOLEAN NOT NULL,
+  replies BOOLEAN NOT NULL,
+  likes BOOLEAN NOT NULL,
+  follows BOOLEAN NOT NULL
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
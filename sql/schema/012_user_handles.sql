@@ -0,0 +1,13 @@
+-- +goose Up
+-- Handles are unique regardless of case; the index is named like the
+-- constraint it stands in for.
+ALTER TABLE users
+ADD COLUMN handle TEXT;
+
+CREATE UNIQUE INDEX users_handle_key ON users(lower(handle));
+
+-- +goose Down
+DROP INDEX users_handle_key;
+
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE chirp_mentions(
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  PRIMARY KEY (chirp_id, user_id)
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions(user_id);
+
+-- tag is lower-cased
+CREATE TABLE chirp_hashtags(
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  tag TEXT NOT NULL,
+  PRIMARY KEY (chirp_id, tag)
+);
+
+CREATE INDEX chirp_hashtags_tag_idx ON chirp_hashtags(tag);
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
+DROP TABLE chirp_mentions;
@@ -0,0 +1,22 @@
+-- +goose Up
+-- Rankings are recomputed periodically for each period ('1h', '24h' or
+-- '7d') and replaced wholesale.
+CREATE TABLE trending_hashtags(
+  period TEXT NOT NULL,
+  tag TEXT NOT NULL,
+  score DOUBLE PRECISION NOT NULL,
+  computed_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (period, tag)
+);
+
+CREATE TABLE trending_chirps(
+  period TEXT NOT NULL,
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  score DOUBLE PRECISION NOT NULL,
+  computed_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (period, chirp_id)
+);
+
+-- +goose Down
+DROP TABLE trending_chirps;
+DROP TABLE trending_hashtags;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- The files themselves live in the blob store, keyed by media ID.
+CREATE TABLE media(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  content_type TEXT NOT NULL,
+  thumbnail_content_type TEXT NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  size_bytes BIGINT NOT NULL
+);
+
+CREATE TABLE chirp_media(
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  media_id UUID NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+  position SMALLINT NOT NULL CHECK (position BETWEEN 0 AND 3),
+  PRIMARY KEY (chirp_id, position),
+  UNIQUE (chirp_id, media_id)
+);
+
+-- +goose Down
+DROP TABLE chirp_media;
+DROP TABLE media;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Accounts are deleted once deletion_scheduled_at passes, unless the user
+-- cancels first.
+ALTER TABLE users
+ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users(deletion_scheduled_at)
+WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Archives of a user's data, generated in the background and kept in the
+-- blob store until they expire.
+CREATE TABLE data_exports(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'ready', 'failed')),
+  started_at TIMESTAMP,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP,
+  size_bytes BIGINT
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports(user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE data_exports;
+DROP INDEX users_deletion_scheduled_at_idx;
+
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
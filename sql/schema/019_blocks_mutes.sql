@@ -0,0 +1,36 @@
+-- +goose Up
+-- A block hides the two users' chirps from each other and stops them
+-- replying to, mentioning or following each other.
+CREATE TABLE blocks(
+  blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (blocker_id, blocked_id),
+  CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks(blocked_id);
+
+-- A mute only hides the muted user's chirps and notifications from the
+-- muter; the muted user can't tell.
+CREATE TABLE mutes(
+  muter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  muted_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (muter_id, muted_id),
+  CHECK (muter_id <> muted_id)
+);
+
+-- Keywords are stored lowercased and hide chirps containing them anywhere
+-- in their body.
+CREATE TABLE muted_keywords(
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  keyword TEXT NOT NULL CHECK (keyword <> '' AND keyword = lower(keyword)),
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, keyword)
+);
+
+-- +goose Down
+DROP TABLE muted_keywords;
+DROP TABLE mutes;
+DROP TABLE blocks;
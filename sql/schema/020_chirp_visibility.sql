@@ -0,0 +1,10 @@
+-- +goose Up
+-- Followers-only chirps can only be seen by their author's followers.
+-- Unlisted chirps can be seen by anyone but are left out of public feeds.
+ALTER TABLE chirps
+ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public'
+  CHECK (visibility IN ('public', 'followers', 'unlisted'));
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN visibility;
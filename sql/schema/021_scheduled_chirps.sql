@@ -0,0 +1,21 @@
+-- +goose Up
+-- Chirps waiting to be published at publish_at, or drafts without one.
+-- Publishing moves them to chirps, so readers never see them here.
+CREATE TABLE scheduled_chirps(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  reply_to_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+  visibility TEXT NOT NULL CHECK (visibility IN ('public', 'followers', 'unlisted')),
+  media_ids UUID[] NOT NULL,
+  publish_at TIMESTAMP
+);
+
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps(user_id);
+CREATE INDEX scheduled_chirps_publish_at_idx ON scheduled_chirps(publish_at)
+WHERE publish_at IS NOT NULL;
+
+-- +goose Down
+DROP TABLE scheduled_chirps;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- Work done outside a request. Workers claim runnable jobs with
+-- FOR UPDATE SKIP LOCKED; a job that succeeds is deleted, and one that runs
+-- out of attempts is kept as dead until an admin retries it.
+CREATE TABLE jobs(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  kind TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'running', 'dead')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL CHECK (max_attempts > 0),
+  run_at TIMESTAMP NOT NULL,
+  locked_until TIMESTAMP,
+  last_error TEXT
+);
+
+CREATE INDEX jobs_run_at_idx ON jobs(run_at) WHERE status = 'pending';
+CREATE INDEX jobs_locked_until_idx ON jobs(locked_until) WHERE status = 'running';
+CREATE INDEX jobs_status_created_at_idx ON jobs(status, created_at);
+
+-- +goose Down
+DROP TABLE jobs;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- Lets the cleanup find tokens that expired or were revoked long ago
+-- without scanning every session.
+CREATE INDEX refresh_tokens_expires_at_idx ON refresh_tokens(expires_at);
+CREATE INDEX refresh_tokens_revoked_at_idx ON refresh_tokens(revoked_at)
+WHERE revoked_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX refresh_tokens_revoked_at_idx;
+DROP INDEX refresh_tokens_expires_at_idx;
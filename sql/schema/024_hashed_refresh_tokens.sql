@@ -0,0 +1,15 @@
+-- +goose Up
+-- Refresh tokens were stored as handed to clients, so anyone who could read
+-- the table could take over a session. They are now found by a lookup ID
+-- and checked against a SHA-256 digest. Tokens from before have no ID, so
+-- they are deleted and everyone logs in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN token;
+ALTER TABLE refresh_tokens ADD COLUMN id TEXT PRIMARY KEY;
+ALTER TABLE refresh_tokens ADD COLUMN token_hash BYTEA NOT NULL;
+
+-- +goose Down
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens DROP COLUMN token_hash;
+ALTER TABLE refresh_tokens DROP COLUMN id;
+ALTER TABLE refresh_tokens ADD COLUMN token TEXT PRIMARY KEY;
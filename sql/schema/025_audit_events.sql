@@ -0,0 +1,36 @@
+-- +goose Up
+-- A record of security-sensitive actions. actor_id and target_id have no
+-- foreign keys so the history outlives the users and chirps it is about.
+CREATE TABLE audit_events(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  action TEXT NOT NULL,
+  outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+  actor_id UUID,
+  target_type TEXT,
+  target_id UUID,
+  ip TEXT NOT NULL,
+  user_agent TEXT NOT NULL,
+  request_id TEXT NOT NULL,
+  details JSONB NOT NULL
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events(created_at, id);
+CREATE INDEX audit_events_actor_id_idx ON audit_events(actor_id, created_at);
+CREATE INDEX audit_events_target_id_idx ON audit_events(target_id, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only();
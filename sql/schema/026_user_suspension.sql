@@ -0,0 +1,6 @@
+-- +goose Up
+-- Suspended users can't log in or refresh until an admin unsuspends them.
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN suspended_at;
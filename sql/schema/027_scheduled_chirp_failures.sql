@@ -0,0 +1,9 @@
+-- +goose Up
+-- A scheduled chirp that fails to publish is retried until it has failed
+-- attempts times, then left for its author to edit.
+ALTER TABLE scheduled_chirps ADD COLUMN attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE scheduled_chirps ADD COLUMN last_error TEXT;
+
+-- +goose Down
+ALTER TABLE scheduled_chirps DROP COLUMN last_error;
+ALTER TABLE scheduled_chirps DROP COLUMN attempts;
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// trendingWindow is a period over which engagement is ranked. Engagement
+// loses half its weight every quarter of the window, so a chirp that is
+// busy right now beats one that was busier at the start of the window.
+type trendingWindow struct {
+	name     string
+	duration time.Duration
+}
+
+var trendingWindows = []trendingWindow{
+	{"1h", time.Hour},
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+}
+
+const (
+	defaultTrendingWindow = "24h"
+	trendingInterval      = 5 * time.Minute
+	// maxTrending is how many chirps and hashtags are kept per window.
+	maxTrending = 100
+
+	// trendingLockKey is the advisory lock that stops replicas from
+	// recomputing the rankings at the same time.
+	trendingLockKey int64 = 0x6368697270790001
+)
+
+func (tw trendingWindow) halfLife() time.Duration {
+	return tw.duration / 4
+}
+
+// runTrendingJob recomputes the trending rankings every interval until ctx
+// is cancelled, starting straight away.
+func (cfg *apiConfig) runTrendingJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		err := cfg.refreshTrending(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error refreshing trending: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshTrending replaces the rankings of every window. Each window is
+// swapped in its own transaction, so readers never see it half written.
+// A window another replica is refreshing is skipped.
+func (cfg *apiConfig) refreshTrending(ctx context.Context) error {
+	for _, tw := range trendingWindows {
+		err := cfg.store.WithTx(ctx, func(tx store.Store) error {
+			locked, err := tx.TryAdvisoryXactLock(ctx, trendingLockKey)
+			if err != nil || !locked {
+				return err
+			}
+
+			err = tx.DeleteTrendingChirps(ctx, tw.name)
+			if err != nil {
+				return err
+			}
+			_, err = tx.InsertTrendingChirps(ctx, database.InsertTrendingChirpsParams{
+				Period:          tw.name,
+				HalfLifeSeconds: tw.halfLife().Seconds(),
+				PeriodSeconds:   tw.duration.Seconds(),
+				MaxResults:      maxTrending,
+			})
+			if err != nil {
+				return err
+			}
+
+			err = tx.DeleteTrendingHashtags(ctx, tw.name)
+			if err != nil {
+				return err
+			}
+			_, err = tx.InsertTrendingHashtags(ctx, database.InsertTrendingHashtagsParams{
+				Period:          tw.name,
+				HalfLifeSeconds: tw.halfLife().Seconds(),
+				PeriodSeconds:   tw.duration.Seconds(),
+				MaxResults:      maxTrending,
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("window %s: %w", tw.name, err)
+		}
+	}
+	return nil
+}
+
+type TrendingHashtag struct {
+	Tag   string  `json:"tag"`
+	Score float64 `json:"score"`
+}
+
+type TrendingChirp struct {
+	Chirp
+	Score float64 `json:"score"`
+}
+
+// handlerTrending returns the top hashtags and chirps of a window as of the
+// last time the trending job ran.
+func (cfg *apiConfig) handlerTrending(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Window   string            `json:"window"`
+		Hashtags []TrendingHashtag `json:"hashtags"`
+		Chirps   []TrendingChirp   `json:"chirps"`
+	}
+
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultTrendingWindow
+	}
+	known := false
+	for _, tw := range trendingWindows {
+		known = known || tw.name == window
+	}
+	if !known {
+		respondWithError(w, r, http.StatusBadRequest, codeBadRequest, "window must be 1h, 24h or 7d", nil)
+		return
+	}
+	exp, ok := parseExpand(w, r)
+	if !ok {
+		return
+	}
+	viewer, ok := cfg.optionalViewer(w, r)
+	if !ok {
+		return
+	}
+
+	limit := defaultPageSize
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxTrending {
+			respondWithError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTrending), err)
+			return
+		}
+	}
+
+	hashtags, err := cfg.store.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		Period: window,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get trending hashtags", err)
+		return
+	}
+	trending, err := cfg.store.GetTrendingChirps(r.Context(), database.GetTrendingChirpsParams{
+		Period: window,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't get trending chirps", err)
+		return
+	}
+
+	f, err := cfg.loadChirpFilter(r.Context(), viewer)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load blocks and mutes", err)
+		return
+	}
+
+	// the rankings are shared, so blocks and mutes can leave fewer than
+	// limit
+	resp := response{
+		Window:   window,
+		Hashtags: []TrendingHashtag{},
+		Chirps:   []TrendingChirp{},
+	}
+	for _, h := range hashtags {
+		if f.hasMutedKeyword("#" + h.Tag) {
+			continue
+		}
+		resp.Hashtags = append(resp.Hashtags, TrendingHashtag{Tag: h.Tag, Score: h.Score})
+	}
+	trending = slices.DeleteFunc(trending, func(c database.GetTrendingChirpsRow) bool {
+		return !f.wants(c.Chirp)
+	})
+	dbChirps := make([]database.Chirp, 0, len(trending))
+	for _, c := range trending {
+		dbChirps = append(dbChirps, c.Chirp)
+	}
+	chirps, err := cfg.chirpsFromDB(r.Context(), dbChirps, exp)
+	if err != nil {
+		respondWithDBError(w, r, "Couldn't load chirp details", err)
+		return
+	}
+	for i, c := range trending {
+		resp.Chirps = append(resp.Chirps, TrendingChirp{Chirp: chirps[i], Score: c.Score})
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
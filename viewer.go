@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lordbaldwin1/chirpy/internal/database"
+	"github.com/lordbaldwin1/chirpy/internal/store"
+)
+
+// optionalViewer returns the ID of the user whose access token came with
+// r, for endpoints anyone can read but whose results depend on who asks.
+// No Authorization header means an anonymous viewer; an invalid token gets
+// a 401 rather than being ignored, so clients notice.
+func (cfg *apiConfig) optionalViewer(w http.ResponseWriter, r *http.Request) (uuid.NullUUID, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.NullUUID{}, true
+	}
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return uuid.NullUUID{}, false
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}, true
+}
+
+// canView reports whether viewer may see chirp: it isn't by a user blocked
+// either way, and if it is followers-only the viewer is its author or
+// follows them. It is chirpFilter.canSee for a single chirp, without
+// loading everything the viewer follows.
+func canView(ctx context.Context, s store.Store, viewer uuid.NullUUID, chirp database.Chirp) (bool, error) {
+	if !viewer.Valid {
+		return chirp.Visibility != visibilityFollowers, nil
+	}
+	if viewer.UUID == chirp.UserID {
+		return true, nil
+	}
+	blocked, err := s.BlockExists(ctx, database.BlockExistsParams{
+		UserID:  viewer.UUID,
+		OtherID: chirp.UserID,
+	})
+	if err != nil || blocked {
+		return false, err
+	}
+	if chirp.Visibility != visibilityFollowers {
+		return true, nil
+	}
+	return s.FollowExists(ctx, database.FollowExistsParams{
+		FollowerID: viewer.UUID,
+		FolloweeID: chirp.UserID,
+	})
+}
+
+// chirpFilter decides which chirps a viewer sees. Chirps by users blocked
+// either way are never shown, nor are followers-only chirps by users the
+// viewer doesn't follow. Chirps by muted users or containing a muted
+// keyword are left out of feeds, but can still be opened directly and are
+// still listed on their author's profile.
+type chirpFilter struct {
+	viewerID  uuid.UUID
+	following map[uuid.UUID]bool
+	blocked   map[uuid.UUID]bool
+	muted     map[uuid.UUID]bool
+	keywords  []string
+}
+
+// loadChirpFilter loads who viewer follows, blocks and mutes. An anonymous
+// viewer sees every chirp that isn't followers-only.
+func (cfg *apiConfig) loadChirpFilter(ctx context.Context, viewer uuid.NullUUID) (chirpFilter, error) {
+	f := chirpFilter{
+		following: map[uuid.UUID]bool{},
+		blocked:   map[uuid.UUID]bool{},
+		muted:     map[uuid.UUID]bool{},
+	}
+	if !viewer.Valid {
+		return f, nil
+	}
+	f.viewerID = viewer.UUID
+
+	following, err := cfg.store.GetFolloweeIDs(ctx, viewer.UUID)
+	if err != nil {
+		return chirpFilter{}, err
+	}
+	for _, id := range following {
+		f.following[id] = true
+	}
+
+	blocked, err := cfg.store.GetBlockRelatedUserIDs(ctx, viewer.UUID)
+	if err != nil {
+		return chirpFilter{}, err
+	}
+	for _, id := range blocked {
+		f.blocked[id] = true
+	}
+	muted, err := cfg.store.GetMutedUserIDs(ctx, viewer.UUID)
+	if err != nil {
+		return chirpFilter{}, err
+	}
+	for _, id := range muted {
+		f.muted[id] = true
+	}
+	keywords, err := cfg.store.GetMutedKeywords(ctx, viewer.UUID)
+	if err != nil {
+		return chirpFilter{}, err
+	}
+	for _, k := range keywords {
+		f.keywords = append(f.keywords, k.Keyword)
+	}
+	return f, nil
+}
+
+// canSee reports whether the viewer may see chirp at all.
+func (f chirpFilter) canSee(chirp database.Chirp) bool {
+	if chirp.UserID == f.viewerID {
+		return true
+	}
+	if f.blocked[chirp.UserID] {
+		return false
+	}
+	return chirp.Visibility != visibilityFollowers || f.following[chirp.UserID]
+}
+
+// wants reports whether chirp belongs in the viewer's feeds. The viewer's
+// own chirps always do.
+func (f chirpFilter) wants(chirp database.Chirp) bool {
+	if chirp.UserID == f.viewerID {
+		return true
+	}
+	if !f.canSee(chirp) || f.muted[chirp.UserID] {
+		return false
+	}
+	return !f.hasMutedKeyword(chirp.Body)
+}
+
+// hasMutedKeyword reports whether text contains any of the viewer's muted
+// keywords, ignoring case.
+func (f chirpFilter) hasMutedKeyword(text string) bool {
+	if len(f.keywords) == 0 {
+		return false
+	}
+	text = strings.ToLower(text)
+	for _, k := range f.keywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// visible is dbChirps without those the viewer can't see.
+func (f chirpFilter) visible(dbChirps []database.Chirp) []database.Chirp {
+	kept := make([]database.Chirp, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		if f.canSee(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// wanted is dbChirps without those that don't belong in the viewer's feeds.
+func (f chirpFilter) wanted(dbChirps []database.Chirp) []database.Chirp {
+	kept := make([]database.Chirp, 0, len(dbChirps))
+	for _, c := range dbChirps {
+		if f.wants(c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}